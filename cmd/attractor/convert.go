@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/ravi-parthasarathy/attractor/pkg/pipeline"
+)
+
+// ─── convert ──────────────────────────────────────────────────────────────────
+
+func convertCmd() *cobra.Command {
+	var from, to, output string
+
+	cmd := &cobra.Command{
+		Use:   "convert <pipeline>",
+		Short: "Translate a pipeline between DOT, YAML and JSON",
+		Long: `Translate a pipeline between DOT, YAML and JSON.
+
+The syntax of the input is taken from its extension (.yaml, .yml, .json,
+anything else is DOT) unless --from is given; a path of - reads standard
+input.  The output syntax is --to, or else that of the -o file.  Every
+node, edge, param and graph attribute, the stylesheet and edge conditions
+included, carries over; comments do not.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			inSyn := pipeline.SyntaxOf(args[0])
+			if from != "" {
+				syn, err := parseSyntax(from)
+				if err != nil {
+					return fmt.Errorf("--from: %w", err)
+				}
+				inSyn = syn
+			}
+			var outSyn pipeline.Syntax
+			switch {
+			case to != "":
+				syn, err := parseSyntax(to)
+				if err != nil {
+					return fmt.Errorf("--to: %w", err)
+				}
+				outSyn = syn
+			case output != "":
+				outSyn = pipeline.SyntaxOf(output)
+			default:
+				return fmt.Errorf("give the output syntax with --to or an -o file")
+			}
+
+			var src []byte
+			var err error
+			if args[0] == "-" {
+				src, err = io.ReadAll(cmd.InOrStdin())
+			} else {
+				src, err = os.ReadFile(args[0])
+			}
+			if err != nil {
+				return fmt.Errorf("read pipeline file: %w", err)
+			}
+			p, err := pipeline.Parse(string(src), inSyn)
+			if err != nil {
+				return fmt.Errorf("parse pipeline: %w", err)
+			}
+			out, err := pipeline.Encode(p, outSyn)
+			if err != nil {
+				return err
+			}
+
+			if output == "" {
+				_, err = io.WriteString(cmd.OutOrStdout(), out)
+				return err
+			}
+			if err := os.WriteFile(output, []byte(out), 0o644); err != nil {
+				return fmt.Errorf("write file: %w", err)
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&from, "from", "", "input syntax: dot, yaml or json (default: from the file extension)")
+	cmd.Flags().StringVar(&to, "to", "", "output syntax: dot, yaml or json (default: from the -o extension)")
+	cmd.Flags().StringVarP(&output, "output", "o", "", "write to this file instead of stdout")
+	return cmd
+}
+
+// parseSyntax returns the pipeline syntax called name.
+func parseSyntax(name string) (pipeline.Syntax, error) {
+	syn := pipeline.Syntax(strings.ToLower(name))
+	if syn == "yml" {
+		syn = pipeline.SyntaxYAML
+	}
+	if !slices.Contains(pipeline.Syntaxes, syn) {
+		return "", fmt.Errorf("unknown syntax %q: use dot, yaml or json", name)
+	}
+	return syn, nil
+}
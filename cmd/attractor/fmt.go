@@ -0,0 +1,145 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/ravi-parthasarathy/attractor/pkg/pipeline"
+)
+
+// ─── fmt ──────────────────────────────────────────────────────────────────────
+
+func fmtCmd() *cobra.Command {
+	var write, list, check bool
+
+	cmd := &cobra.Command{
+		Use:   "fmt [path...]",
+		Short: "Rewrite pipeline DOT files in the canonical layout",
+		Long: `Rewrite pipeline DOT files in the canonical layout, keeping comments.
+
+Paths may be files, directories, which are searched for .dot files, or glob
+patterns.  With no paths, fmt formats standard input to standard output.
+By default the formatted source is printed; -w writes it back to the file,
+-l lists the files whose layout differs, and --check lists them and fails,
+for use in CI.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if check && write {
+				return fmt.Errorf("--check and -w cannot be used together")
+			}
+			out := cmd.OutOrStdout()
+			if len(args) == 0 {
+				if write || list || check {
+					return fmt.Errorf("-w, -l and --check need file arguments")
+				}
+				src, err := io.ReadAll(cmd.InOrStdin())
+				if err != nil {
+					return fmt.Errorf("read stdin: %w", err)
+				}
+				formatted, err := pipeline.FormatDOT(string(src))
+				if err != nil {
+					return err
+				}
+				_, err = io.WriteString(out, formatted)
+				return err
+			}
+
+			files, err := fmtFiles(args)
+			if err != nil {
+				return err
+			}
+			var failed, unformatted int
+			for _, f := range files {
+				src, err := os.ReadFile(f)
+				if err != nil {
+					return fmt.Errorf("read file: %w", err)
+				}
+				formatted, err := pipeline.FormatDOT(string(src))
+				if err != nil {
+					fmt.Fprintf(cmd.ErrOrStderr(), "%s: %v\n", f, err)
+					failed++
+					continue
+				}
+				changed := formatted != string(src)
+				if changed {
+					unformatted++
+				}
+				if (list || check) && changed {
+					fmt.Fprintln(out, f)
+				}
+				switch {
+				case write && changed:
+					info, err := os.Stat(f)
+					if err != nil {
+						return err
+					}
+					if err := os.WriteFile(f, []byte(formatted), info.Mode().Perm()); err != nil {
+						return fmt.Errorf("write file: %w", err)
+					}
+				case !write && !list && !check:
+					if _, err := io.WriteString(out, formatted); err != nil {
+						return err
+					}
+				}
+			}
+
+			if failed > 0 || check && unformatted > 0 {
+				// The problems are printed; usage would only bury them.
+				cmd.SilenceUsage = true
+			}
+			if failed > 0 {
+				return fmt.Errorf("%d file(s) could not be formatted", failed)
+			}
+			if check && unformatted > 0 {
+				return fmt.Errorf("%d file(s) are not formatted: run attractor fmt -w", unformatted)
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolVarP(&write, "write", "w", false, "write the result to the file instead of printing it")
+	cmd.Flags().BoolVarP(&list, "list", "l", false, "list files whose formatting differs")
+	cmd.Flags().BoolVar(&check, "check", false, "list files whose formatting differs and fail if there are any")
+	return cmd
+}
+
+// fmtFiles expands args into files: globs as for lint, and directories into
+// the .dot files beneath them.
+func fmtFiles(args []string) ([]string, error) {
+	paths, err := expandGlobs(args)
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	for _, p := range paths {
+		info, err := os.Stat(p)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			files = append(files, p)
+			continue
+		}
+		err = filepath.WalkDir(p, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if d.IsDir() && path != p && strings.HasPrefix(d.Name(), ".") {
+				return filepath.SkipDir
+			}
+			if !d.IsDir() && filepath.Ext(path) == ".dot" {
+				files = append(files, path)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return files, nil
+}
@@ -15,7 +15,7 @@ func graphCmd() *cobra.Command {
 	var format string
 
 	cmd := &cobra.Command{
-		Use:   "graph <pipeline.dot>",
+		Use:   "graph <pipeline>",
 		Short: "Print a human-readable summary of a pipeline",
 		Args:  cobra.ExactArgs(1),
 		RunE: func(_ *cobra.Command, args []string) error {
@@ -24,7 +24,7 @@ func graphCmd() *cobra.Command {
 			if err != nil {
 				return fmt.Errorf("read file: %w", err)
 			}
-			p, err := pipeline.ParseDOT(string(src))
+			p, err := pipeline.Parse(string(src), pipeline.SyntaxOf(dotFile))
 			if err != nil {
 				return fmt.Errorf("parse: %w", err)
 			}
@@ -143,8 +143,15 @@ func renderText(p *pipeline.Pipeline) string {
 		}
 	}
 	for _, e := range p.Edges {
+		var tags []string
+		if e.On != "" {
+			tags = append(tags, "on="+e.On)
+		}
 		if e.Condition != "" {
-			fmt.Fprintf(&sb, "  %-*s  →  %s  [%s]\n", maxFromLen, e.From, e.To, e.Condition)
+			tags = append(tags, e.Condition)
+		}
+		if len(tags) > 0 {
+			fmt.Fprintf(&sb, "  %-*s  →  %s  [%s]\n", maxFromLen, e.From, e.To, strings.Join(tags, " "))
 		} else {
 			fmt.Fprintf(&sb, "  %-*s  →  %s\n", maxFromLen, e.From, e.To)
 		}
@@ -176,6 +183,23 @@ func renderDOT(p *pipeline.Pipeline) string {
 	}
 	fmt.Fprintf(&sb, "digraph %s {\n", dotQuote(name))
 
+	if len(p.Params) > 0 {
+		fmt.Fprintf(&sb, "    subgraph %s {\n", pipeline.ParamsSubgraph)
+		for _, prm := range p.Params {
+			keys := make([]string, 0, len(prm.Attrs))
+			for k := range prm.Attrs {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+			parts := make([]string, len(keys))
+			for i, k := range keys {
+				parts[i] = k + "=" + dotQuote(prm.Attrs[k])
+			}
+			fmt.Fprintf(&sb, "        %s [%s]\n", dotQuote(prm.Name), strings.Join(parts, " "))
+		}
+		fmt.Fprintf(&sb, "    }\n")
+	}
+
 	order := topoOrder(p)
 	for _, id := range order {
 		n := p.Nodes[id]
@@ -197,9 +221,16 @@ func renderDOT(p *pipeline.Pipeline) string {
 	}
 
 	for _, e := range p.Edges {
+		var attrs []string
 		if e.Condition != "" {
-			fmt.Fprintf(&sb, "    %s -> %s [label=%s]\n",
-				dotQuote(e.From), dotQuote(e.To), dotQuote(e.Condition))
+			attrs = append(attrs, "label="+dotQuote(e.Condition))
+		}
+		if e.On != "" {
+			attrs = append(attrs, "on="+dotQuote(e.On))
+		}
+		if len(attrs) > 0 {
+			fmt.Fprintf(&sb, "    %s -> %s [%s]\n",
+				dotQuote(e.From), dotQuote(e.To), strings.Join(attrs, " "))
 		} else {
 			fmt.Fprintf(&sb, "    %s -> %s\n", dotQuote(e.From), dotQuote(e.To))
 		}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/ravi-parthasarathy/attractor/pkg/pipeline"
+	"github.com/ravi-parthasarathy/attractor/pkg/pipeline/checkpoint"
+)
+
+// ─── history ──────────────────────────────────────────────────────────────────
+
+func historyCmd() *cobra.Command {
+	var step int
+
+	cmd := &cobra.Command{
+		Use:   "history <checkpoint>",
+		Short: "List the steps recorded in a checkpoint's history",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			store, err := checkpoint.Open(args[0])
+			if err != nil {
+				return err
+			}
+			defer store.Close()
+			steps, err := store.History(cmd.Context())
+			if err != nil {
+				return err
+			}
+			if step == 0 {
+				fmt.Print(renderHistory(steps))
+				return nil
+			}
+			cp, err := pipeline.HistoryStep(steps, step)
+			if err != nil {
+				return err
+			}
+			data, err := json.MarshalIndent(cp.Data, "", "  ")
+			if err != nil {
+				return fmt.Errorf("marshal context: %w", err)
+			}
+			fmt.Println(string(data))
+			return nil
+		},
+	}
+
+	cmd.Flags().IntVar(&step, "step", 0, "print the context saved at this step as JSON")
+	return cmd
+}
+
+// renderHistory produces one line per step: its number, time, completed
+// node, outcome and the node the run continued at, or for steps taken inside
+// a fan_out, how many of its branches had finished.  The step recorded when a
+// run was suspended repeats the one before it, marked with the reason.
+func renderHistory(steps []*pipeline.Checkpoint) string {
+	var sb strings.Builder
+
+	maxIDLen := 4 // minimum "node"
+	for _, cp := range steps {
+		maxIDLen = max(maxIDLen, len(cp.LastNodeID))
+	}
+
+	fmt.Fprintf(&sb, "%4s  %-8s  %-*s  %-8s  %s\n", "step", "time", maxIDLen, "node", "outcome", "next")
+	for _, cp := range steps {
+		status := ""
+		if cp.Outcome != nil {
+			status = string(cp.Outcome.Status)
+		}
+		next := "-"
+		switch {
+		case cp.Next != nil:
+			next = cp.Next.To
+			if cp.Next.On != "" {
+				next += "  [on=" + cp.Next.On + "]"
+			}
+		case cp.Completed:
+			next = "(end)"
+		case cp.FanOut != nil:
+			done := 0
+			for _, b := range cp.FanOut.Branches {
+				if b.Done {
+					done++
+				}
+			}
+			next = fmt.Sprintf("(%d/%d branches done)", done, len(cp.FanOut.Branches))
+		}
+		if cp.Suspended {
+			next += "  [suspended: " + cp.SuspendReason + "]"
+		}
+		fmt.Fprintf(&sb, "%4d  %-8s  %-*s  %-8s  %s\n",
+			cp.Step, cp.Time.Local().Format("15:04:05"), maxIDLen, cp.LastNodeID, status, next)
+	}
+	return sb.String()
+}
@@ -0,0 +1,91 @@
+//go:build unix
+
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/ravi-parthasarathy/attractor/pkg/pipeline"
+)
+
+const napDOT = `digraph naps {
+    start [type=start]
+    nap1  [type=sleep duration="300ms"]
+    nap2  [type=sleep duration="30s"]
+    done  [type=exit]
+    start -> nap1 -> nap2 -> done
+}`
+
+// interruptRun runs napDOT with a checkpoint and sends the process SIGINT
+// signals times once start has completed.  It returns the run's error and
+// the checkpoint path.
+func interruptRun(t *testing.T, signals int) (error, string) {
+	t.Helper()
+	dir := t.TempDir()
+	dot := filepath.Join(dir, "p.dot")
+	if err := os.WriteFile(dot, []byte(napDOT), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cp := filepath.Join(dir, "cp.json")
+	errc := make(chan error, 1)
+	go func() {
+		errc <- executePipeline(context.Background(), dot, dir, "", cp, "", "", "", "", nil, 0)
+	}()
+	for {
+		if c, err := pipeline.ReadCheckpoint(cp); err == nil && c.LastNodeID == "start" {
+			break
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	for i := range signals {
+		if i > 0 {
+			// Pending signals of the same kind are delivered once.
+			time.Sleep(50 * time.Millisecond)
+		}
+		if err := syscall.Kill(os.Getpid(), syscall.SIGINT); err != nil {
+			t.Fatal(err)
+		}
+	}
+	select {
+	case err := <-errc:
+		return err, cp
+	case <-time.After(10 * time.Second):
+		t.Fatal("run did not stop after SIGINT")
+		return nil, ""
+	}
+}
+
+func TestInterruptSuspendsAfterRunningNode(t *testing.T) {
+	err, cp := interruptRun(t, 1)
+	if !errors.Is(err, pipeline.ErrSuspended) {
+		t.Fatalf("run = %v, want ErrSuspended", err)
+	}
+	c, err := pipeline.ReadCheckpoint(cp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !c.Suspended || c.SuspendReason != "interrupted by SIGINT" || c.LastNodeID != "nap1" {
+		t.Errorf("checkpoint = %s suspended=%v reason=%q, want nap1 suspended by SIGINT", c.LastNodeID, c.Suspended, c.SuspendReason)
+	}
+}
+
+func TestSecondInterruptAborts(t *testing.T) {
+	err, cp := interruptRun(t, 2)
+	if err == nil {
+		t.Fatal("expected the run to be aborted")
+	}
+	c, err := pipeline.ReadCheckpoint(cp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !c.Suspended || !strings.Contains(c.SuspendReason, "aborted by a second interrupt") || c.LastNodeID != "start" {
+		t.Errorf("checkpoint = %s suspended=%v reason=%q, want start marked aborted", c.LastNodeID, c.Suspended, c.SuspendReason)
+	}
+}
@@ -0,0 +1,355 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/ravi-parthasarathy/attractor/pkg/pipeline"
+)
+
+// ─── lint ─────────────────────────────────────────────────────────────────────
+
+func lintCmd() *cobra.Command {
+	var (
+		vars    []string
+		varFile string
+		format  string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "lint <pipeline>...",
+		Short: "Validate pipeline files without running them",
+		Long: `Validate pipeline files, in DOT, YAML or JSON, without running them.
+
+Arguments may be glob patterns such as 'pipelines/*.dot'.  Problems are
+reported with their file, line and column; --format json, sarif or github
+produces output for CI and code-review tools.`,
+		Args: cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			files, err := expandGlobs(args)
+			if err != nil {
+				return err
+			}
+			// Check the variables a run would be given, if any.
+			var values map[string]any
+			if cmd.Flags().Changed("var") || cmd.Flags().Changed("var-file") {
+				if values, err = loadVars(varFile, vars); err != nil {
+					return err
+				}
+			}
+
+			reg := buildRegistry(".", "")
+			results := make([]lintResult, 0, len(files))
+			for _, f := range files {
+				r, err := lintFile(f, reg, values)
+				if err != nil {
+					return err
+				}
+				results = append(results, r)
+			}
+
+			out := cmd.OutOrStdout()
+			switch strings.ToLower(format) {
+			case "text", "":
+				writeLintText(out, cmd.ErrOrStderr(), results)
+			case "json":
+				if err := writeLintJSON(out, results); err != nil {
+					return err
+				}
+			case "sarif":
+				if err := writeLintSARIF(out, results); err != nil {
+					return err
+				}
+			case "github":
+				writeLintGitHub(out, results)
+			default:
+				return fmt.Errorf("unknown format %q: use text, json, sarif or github", format)
+			}
+
+			if n := lintErrorCount(results); n > 0 {
+				// The problems are printed; usage would only bury them.
+				cmd.SilenceUsage = true
+				return fmt.Errorf("lint found %d error(s)", n)
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().StringArrayVar(&vars, "var", nil, "check a variable against the pipeline's params: --var key=value (repeatable)")
+	cmd.Flags().StringVar(&varFile, "var-file", "", "check the variables in a JSON object file against the pipeline's params")
+	cmd.Flags().StringVar(&format, "format", "text", "output format: text, json, sarif or github")
+	return cmd
+}
+
+// expandGlobs replaces each pattern in args with the files it matches, in
+// order and without duplicates.  Arguments without glob characters are
+// kept as they are.
+func expandGlobs(args []string) ([]string, error) {
+	var files []string
+	for _, arg := range args {
+		matches := []string{arg}
+		if strings.ContainsAny(arg, "*?[") {
+			var err error
+			if matches, err = filepath.Glob(arg); err != nil {
+				return nil, fmt.Errorf("bad pattern %q: %w", arg, err)
+			}
+			if len(matches) == 0 {
+				return nil, fmt.Errorf("no files match %q", arg)
+			}
+		}
+		for _, m := range matches {
+			if !slices.Contains(files, m) {
+				files = append(files, m)
+			}
+		}
+	}
+	return files, nil
+}
+
+// lintResult holds the problems found in one file.
+type lintResult struct {
+	File     string
+	Pipeline *pipeline.Pipeline // nil if the file did not parse
+	Problems []pipeline.LintError
+}
+
+// lintFile parses and checks one pipeline file.  Only a file that cannot
+// be read is an error; syntax errors are reported as problems.
+func lintFile(path string, reg pipeline.HandlerRegistry, values map[string]any) (lintResult, error) {
+	r := lintResult{File: path}
+	src, err := os.ReadFile(path)
+	if err != nil {
+		return r, fmt.Errorf("read file: %w", err)
+	}
+	p, err := pipeline.Parse(string(src), pipeline.SyntaxOf(path))
+	if err != nil {
+		le := pipeline.LintError{Rule: pipeline.RuleParse, Message: err.Error()}
+		var pe *pipeline.ParseError
+		if errors.As(err, &pe) {
+			le.Span = pipeline.Span{Start: pe.Pos, End: pe.Pos}
+		}
+		r.Problems = []pipeline.LintError{le}
+		return r, nil
+	}
+	r.Pipeline = p
+	if values != nil {
+		if _, err := p.BindParams(values); err != nil {
+			r.Problems = append(r.Problems, pipeline.LintError{Rule: pipeline.RuleParam, Message: err.Error()})
+		}
+	}
+	r.Problems = append(r.Problems, pipeline.Lint(p, reg, values)...)
+	return r, nil
+}
+
+func lintErrorCount(results []lintResult) int {
+	n := 0
+	for _, r := range results {
+		for _, e := range r.Problems {
+			if e.Level() == pipeline.SeverityError {
+				n++
+			}
+		}
+	}
+	return n
+}
+
+// writeLintText prints each problem to stderr as file:line:col: severity:
+// message, and an OK line to stdout for each file without errors.
+func writeLintText(stdout, stderr io.Writer, results []lintResult) {
+	for _, r := range results {
+		failed := false
+		for _, e := range r.Problems {
+			where := r.File
+			if e.Span.IsValid() {
+				where += ":" + e.Span.Start.String()
+			}
+			fmt.Fprintf(stderr, "%s: %s: %s\n", where, e.Level(), e)
+			failed = failed || e.Level() == pipeline.SeverityError
+		}
+		if !failed {
+			fmt.Fprintf(stdout, "OK: pipeline %q is valid (%d nodes, %d edges)\n",
+				r.Pipeline.Name, len(r.Pipeline.Nodes), len(r.Pipeline.Edges))
+		}
+	}
+}
+
+// lintProblemJSON is the JSON form of a problem printed by attractor lint.
+type lintProblemJSON struct {
+	File      string `json:"file"`
+	Line      int    `json:"line,omitempty"`
+	Column    int    `json:"column,omitempty"`
+	EndLine   int    `json:"end_line,omitempty"`
+	EndColumn int    `json:"end_column,omitempty"`
+	Severity  string `json:"severity"`
+	Rule      string `json:"rule,omitempty"`
+	Node      string `json:"node,omitempty"`
+	Message   string `json:"message"`
+}
+
+func writeLintJSON(w io.Writer, results []lintResult) error {
+	problems := []lintProblemJSON{}
+	for _, r := range results {
+		for _, e := range r.Problems {
+			problems = append(problems, lintProblemJSON{
+				File:      r.File,
+				Line:      e.Span.Start.Line,
+				Column:    e.Span.Start.Col,
+				EndLine:   e.Span.End.Line,
+				EndColumn: e.Span.End.Col,
+				Severity:  string(e.Level()),
+				Rule:      e.Rule,
+				Node:      e.NodeID,
+				Message:   e.Error(),
+			})
+		}
+	}
+	data, err := json.MarshalIndent(problems, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshal problems: %w", err)
+	}
+	_, err = fmt.Fprintln(w, string(data))
+	return err
+}
+
+// ─── SARIF ────────────────────────────────────────────────────────────────────
+
+// The subset of SARIF 2.1.0 that code-scanning tools read.
+type (
+	sarifLog struct {
+		Schema  string     `json:"$schema"`
+		Version string     `json:"version"`
+		Runs    []sarifRun `json:"runs"`
+	}
+	sarifRun struct {
+		Tool       sarifTool     `json:"tool"`
+		ColumnKind string        `json:"columnKind"`
+		Results    []sarifResult `json:"results"`
+	}
+	sarifTool struct {
+		Driver sarifDriver `json:"driver"`
+	}
+	sarifDriver struct {
+		Name           string      `json:"name"`
+		InformationURI string      `json:"informationUri"`
+		Rules          []sarifRule `json:"rules"`
+	}
+	sarifRule struct {
+		ID string `json:"id"`
+	}
+	sarifResult struct {
+		RuleID    string          `json:"ruleId,omitempty"`
+		Level     string          `json:"level"`
+		Message   sarifMessage    `json:"message"`
+		Locations []sarifLocation `json:"locations"`
+	}
+	sarifMessage struct {
+		Text string `json:"text"`
+	}
+	sarifLocation struct {
+		PhysicalLocation sarifPhysicalLocation `json:"physicalLocation"`
+	}
+	sarifPhysicalLocation struct {
+		ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+		Region           *sarifRegion          `json:"region,omitempty"`
+	}
+	sarifArtifactLocation struct {
+		URI string `json:"uri"`
+	}
+	sarifRegion struct {
+		StartLine   int `json:"startLine"`
+		StartColumn int `json:"startColumn"`
+		EndLine     int `json:"endLine"`
+		EndColumn   int `json:"endColumn"`
+	}
+)
+
+func writeLintSARIF(w io.Writer, results []lintResult) error {
+	run := sarifRun{
+		Tool: sarifTool{Driver: sarifDriver{
+			Name:           "attractor",
+			InformationURI: "https://github.com/ravi-parthasarathy/attractor",
+			Rules:          []sarifRule{},
+		}},
+		ColumnKind: "unicodeCodePoints",
+		Results:    []sarifResult{},
+	}
+	var rules []string
+	for _, r := range results {
+		for _, e := range r.Problems {
+			if e.Rule != "" && !slices.Contains(rules, e.Rule) {
+				rules = append(rules, e.Rule)
+			}
+			loc := sarifPhysicalLocation{ArtifactLocation: sarifArtifactLocation{URI: filepath.ToSlash(r.File)}}
+			if e.Span.IsValid() {
+				loc.Region = &sarifRegion{
+					StartLine:   e.Span.Start.Line,
+					StartColumn: e.Span.Start.Col,
+					EndLine:     max(e.Span.End.Line, e.Span.Start.Line),
+					EndColumn:   max(e.Span.End.Col, e.Span.Start.Col),
+				}
+			}
+			run.Results = append(run.Results, sarifResult{
+				RuleID:    e.Rule,
+				Level:     string(e.Level()),
+				Message:   sarifMessage{Text: e.Error()},
+				Locations: []sarifLocation{{PhysicalLocation: loc}},
+			})
+		}
+	}
+	slices.Sort(rules)
+	for _, id := range rules {
+		run.Tool.Driver.Rules = append(run.Tool.Driver.Rules, sarifRule{ID: id})
+	}
+	data, err := json.MarshalIndent(sarifLog{
+		Schema:  "https://json.schemastore.org/sarif-2.1.0.json",
+		Version: "2.1.0",
+		Runs:    []sarifRun{run},
+	}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshal sarif: %w", err)
+	}
+	_, err = fmt.Fprintln(w, string(data))
+	return err
+}
+
+// ─── GitHub Actions ───────────────────────────────────────────────────────────
+
+// writeLintGitHub prints each problem as a GitHub Actions workflow command,
+// which the Actions runner turns into an annotation on the file.
+func writeLintGitHub(w io.Writer, results []lintResult) {
+	for _, r := range results {
+		for _, e := range r.Problems {
+			props := []string{"file=" + ghEscapeProperty(filepath.ToSlash(r.File))}
+			if e.Span.IsValid() {
+				props = append(props,
+					fmt.Sprintf("line=%d", e.Span.Start.Line),
+					fmt.Sprintf("col=%d", e.Span.Start.Col))
+				if e.Span.End.Line > 0 {
+					props = append(props,
+						fmt.Sprintf("endLine=%d", e.Span.End.Line),
+						fmt.Sprintf("endColumn=%d", e.Span.End.Col))
+				}
+			}
+			if e.Rule != "" {
+				props = append(props, "title="+ghEscapeProperty("attractor "+e.Rule))
+			}
+			fmt.Fprintf(w, "::%s %s::%s\n", e.Level(), strings.Join(props, ","), ghEscapeData(e.Error()))
+		}
+	}
+}
+
+func ghEscapeData(s string) string {
+	return strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A").Replace(s)
+}
+
+func ghEscapeProperty(s string) string {
+	return strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A", ":", "%3A", ",", "%2C").Replace(s)
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/ravi-parthasarathy/attractor/pkg/lsp"
+)
+
+// ─── lsp ──────────────────────────────────────────────────────────────────────
+
+func lspCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "lsp",
+		Short: "Run a Language Server Protocol server for pipeline DOT files over stdio",
+		Long: `Run a Language Server Protocol server for pipeline DOT files over stdio.
+
+Editors start it as the language server for .dot files.  It reports the
+problems attractor lint finds as you type, completes node types and
+attributes, documents handlers on hover, jumps from a {{.key}} reference to
+the nodes that write the key, and renames node IDs across edges.`,
+		Args: cobra.NoArgs,
+		RunE: func(_ *cobra.Command, _ []string) error {
+			return lsp.NewServer(buildRegistry(".", "")).Serve(os.Stdin, os.Stdout)
+		},
+	}
+}
@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
 	"os"
@@ -15,12 +16,21 @@ import (
 	"github.com/spf13/cobra"
 
 	"github.com/ravi-parthasarathy/attractor/pkg/pipeline"
+	"github.com/ravi-parthasarathy/attractor/pkg/pipeline/checkpoint"
 	"github.com/ravi-parthasarathy/attractor/pkg/pipeline/handlers"
 
 	// Register all LLM providers via their init() functions.
 	_ "github.com/ravi-parthasarathy/attractor/pkg/llm/providers"
 )
 
+const (
+	// modelDefault is the --model used when none is given.
+	modelDefault = "anthropic:claude-sonnet-4-6"
+	// defaultGracePeriod is how long an interrupted run waits for its
+	// running node to finish; see handleInterrupts.
+	defaultGracePeriod = 30 * time.Second
+)
+
 func main() {
 	if err := rootCmd().Execute(); err != nil {
 		fmt.Fprintf(os.Stderr, "error: %v\n", err)
@@ -40,7 +50,9 @@ func rootCmd() *cobra.Command {
 		Long: `Attractor executes DOT-graph pipelines of AI coding agents.
 
 Each node in the graph is a typed handler (codergen, wait.human, set, …).
-Edges carry natural-language or boolean conditions that control flow.`,
+Edges carry natural-language or boolean conditions that control flow.
+Pipelines may also be written in YAML or JSON, chosen by the file
+extension (.yaml, .yml or .json); attractor convert translates between them.`,
 		PersistentPreRunE: func(_ *cobra.Command, _ []string) error {
 			return initLogger(logLevel, logFormat)
 		},
@@ -54,6 +66,12 @@ Edges carry natural-language or boolean conditions that control flow.`,
 	root.AddCommand(resumeCmd())
 	root.AddCommand(versionCmd())
 	root.AddCommand(graphCmd())
+	root.AddCommand(historyCmd())
+	root.AddCommand(paramsCmd())
+	root.AddCommand(typesCmd())
+	root.AddCommand(lspCmd())
+	root.AddCommand(fmtCmd())
+	root.AddCommand(convertCmd())
 	return root
 }
 
@@ -99,10 +117,12 @@ func runCmd() *cobra.Command {
 		timeout        time.Duration
 		vars           []string
 		varFile        string
+		tracePath      string
+		grace          time.Duration
 	)
 
 	cmd := &cobra.Command{
-		Use:   "run <pipeline.dot>",
+		Use:   "run <pipeline>",
 		Short: "Execute a pipeline from the beginning",
 		Args:  cobra.ExactArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
@@ -113,46 +133,20 @@ func runCmd() *cobra.Command {
 				ctx, cancel = context.WithTimeout(ctx, timeout)
 				defer cancel()
 			}
-			return executePipeline(ctx, dotFile, workdir, defaultModel, checkpointPath, outContextPath, seed, varFile, vars, "")
+			return executePipeline(ctx, dotFile, workdir, defaultModel, checkpointPath, outContextPath, seed, varFile, tracePath, vars, grace)
 		},
 	}
 
 	cmd.Flags().StringVar(&workdir, "workdir", ".", "working directory for agent file operations")
-	cmd.Flags().StringVar(&defaultModel, "model", "anthropic:claude-sonnet-4-6", "default LLM model (provider:model-id)")
-	cmd.Flags().StringVar(&checkpointPath, "checkpoint", "", "path to write/read checkpoint JSON (optional)")
+	cmd.Flags().StringVar(&defaultModel, "model", modelDefault, "default LLM model (provider:model-id)")
+	cmd.Flags().StringVar(&checkpointPath, "checkpoint", "", "checkpoint file or URI (file://, sqlite://, s3://) to save progress to (optional)")
 	cmd.Flags().StringVar(&outContextPath, "output-context", "", "write final pipeline context as JSON to this file")
 	cmd.Flags().StringVar(&seed, "seed", "", "initial seed value stored in pipeline context as 'seed'")
 	cmd.Flags().DurationVar(&timeout, "timeout", 0, "maximum wall-clock time for the pipeline (e.g. 5m, 30s); 0 means no limit")
 	cmd.Flags().StringArrayVar(&vars, "var", nil, "set a pipeline context variable: --var key=value (repeatable)")
 	cmd.Flags().StringVar(&varFile, "var-file", "", "load pipeline context variables from a JSON object file")
-	return cmd
-}
-
-// ─── lint ─────────────────────────────────────────────────────────────────────
-
-func lintCmd() *cobra.Command {
-	cmd := &cobra.Command{
-		Use:   "lint <pipeline.dot>",
-		Short: "Validate a pipeline DOT file without running it",
-		Args:  cobra.ExactArgs(1),
-		RunE: func(_ *cobra.Command, args []string) error {
-			dotFile := args[0]
-			src, err := os.ReadFile(dotFile)
-			if err != nil {
-				return fmt.Errorf("read file: %w", err)
-			}
-			p, err := pipeline.ParseDOT(string(src))
-			if err != nil {
-				return fmt.Errorf("parse: %w", err)
-			}
-			if lintErr := pipeline.ValidateErr(p); lintErr != nil {
-				return lintErr
-			}
-			fmt.Printf("OK: pipeline %q is valid (%d nodes, %d edges)\n",
-				p.Name, len(p.Nodes), len(p.Edges))
-			return nil
-		},
-	}
+	cmd.Flags().StringVar(&tracePath, "trace", "", "write engine events as JSON lines to this file")
+	cmd.Flags().DurationVar(&grace, "grace-period", defaultGracePeriod, "on interrupt, how long to let the running node finish before cancelling it; 0 waits for it")
 	return cmd
 }
 
@@ -166,36 +160,40 @@ func resumeCmd() *cobra.Command {
 		timeout        time.Duration
 		vars           []string
 		varFile        string
+		tracePath      string
+		rerunLast      bool
+		allowDrift     bool
+		atStep         int
+		atNode         string
+		grace          time.Duration
 	)
 
 	cmd := &cobra.Command{
-		Use:   "resume <pipeline.dot> <checkpoint.json>",
+		Use:   "resume <pipeline> <checkpoint>",
 		Short: "Resume a pipeline from a checkpoint",
 		Args:  cobra.ExactArgs(2),
 		RunE: func(cmd *cobra.Command, args []string) error {
-			dotFile, cpFile := args[0], args[1]
-
-			// Load context from checkpoint.
-			pctx, lastNodeID, err := pipeline.LoadCheckpoint(cpFile)
+			dotFile := args[0]
+			store, err := checkpoint.Open(args[1])
 			if err != nil {
-				return fmt.Errorf("load checkpoint: %w", err)
-			}
-			slog.Info("resuming from checkpoint", "node", lastNodeID)
-
-			// Apply --var-file values, then --var overrides.
-			if err := applyVarFile(pctx, varFile); err != nil {
 				return err
 			}
-			if err := applyVars(pctx, vars); err != nil {
-				return err
+			defer store.Close()
+
+			// Load context from the checkpoint, or from an earlier step of
+			// its history.
+			cp, err := loadResumePoint(cmd.Context(), store, atStep, atNode)
+			if err != nil {
+				return fmt.Errorf("load checkpoint: %w", err)
 			}
+			pctx := cp.PipelineContext()
 
 			// Parse pipeline.
 			src, err := os.ReadFile(dotFile)
 			if err != nil {
 				return fmt.Errorf("read pipeline file: %w", err)
 			}
-			p, err := pipeline.ParseDOT(string(src))
+			p, err := pipeline.Parse(string(src), pipeline.SyntaxOf(dotFile))
 			if err != nil {
 				return fmt.Errorf("parse pipeline: %w", err)
 			}
@@ -203,23 +201,52 @@ func resumeCmd() *cobra.Command {
 				return fmt.Errorf("invalid pipeline: %w", lintErr)
 			}
 
+			// Apply --var-file values, then --var overrides.
+			values, err := loadVars(varFile, vars)
+			if err != nil {
+				return err
+			}
+			values, err = p.BindParamOverrides(values)
+			if err != nil {
+				return err
+			}
+			pctx.Merge(values)
+
 			// Apply any stylesheet.
 			pipeline.ApplyStylesheet(p)
 
 			// Build engine.
 			reg := buildRegistry(workdir, defaultModel)
-			eng, err := pipeline.NewEngine(p, reg, pctx, cpFile)
+			eng, err := pipeline.NewEngine(p, reg, pctx, "")
 			if err != nil {
 				return fmt.Errorf("build engine: %w", err)
 			}
+			eng.SetCheckpointStore(store)
+			closeTrace, err := attachTrace(eng, tracePath)
+			if err != nil {
+				return err
+			}
 
-			ctx := signalContext(cmd.Context())
+			ctx, stop := handleInterrupts(cmd.Context(), eng, grace)
+			defer stop()
 			if timeout > 0 {
 				var cancel context.CancelFunc
 				ctx, cancel = context.WithTimeout(ctx, timeout)
 				defer cancel()
 			}
-			if runErr := eng.Execute(ctx, lastNodeID); runErr != nil {
+			runErr := eng.Resume(ctx, cp, pipeline.ResumeOptions{RerunLast: rerunLast, AllowDrift: allowDrift})
+			switch {
+			case errors.Is(runErr, pipeline.ErrPipelineDrift):
+				runErr = fmt.Errorf("%w; pass --allow-drift to resume anyway", runErr)
+			case errors.Is(runErr, pipeline.ErrRunCompleted):
+				runErr = fmt.Errorf("%w; pass --rerun-last to run the last node again", runErr)
+			case runErr != nil && ctx.Err() != nil || errors.Is(runErr, pipeline.ErrSuspended):
+				fmt.Fprintln(os.Stderr, resumeHint(dotFile, args[1], workdir, defaultModel, outContextPath))
+			}
+			if traceErr := closeTrace(); runErr == nil {
+				runErr = traceErr
+			}
+			if runErr != nil {
 				return runErr
 			}
 			return writeOutputContext(outContextPath, pctx)
@@ -227,14 +254,37 @@ func resumeCmd() *cobra.Command {
 	}
 
 	cmd.Flags().StringVar(&workdir, "workdir", ".", "working directory for agent file operations")
-	cmd.Flags().StringVar(&defaultModel, "model", "anthropic:claude-sonnet-4-6", "default LLM model")
+	cmd.Flags().StringVar(&defaultModel, "model", modelDefault, "default LLM model")
 	cmd.Flags().StringVar(&outContextPath, "output-context", "", "write final pipeline context as JSON to this file")
 	cmd.Flags().DurationVar(&timeout, "timeout", 0, "maximum wall-clock time for the pipeline (e.g. 5m, 30s); 0 means no limit")
 	cmd.Flags().StringArrayVar(&vars, "var", nil, "set a pipeline context variable: --var key=value (repeatable)")
 	cmd.Flags().StringVar(&varFile, "var-file", "", "load pipeline context variables from a JSON object file")
+	cmd.Flags().StringVar(&tracePath, "trace", "", "write engine events as JSON lines to this file")
+	cmd.Flags().BoolVar(&rerunLast, "rerun-last", false, "run the checkpoint's last completed node again instead of continuing after it")
+	cmd.Flags().BoolVar(&allowDrift, "allow-drift", false, "resume even if the pipeline file changed since the checkpoint was written")
+	cmd.Flags().IntVar(&atStep, "at-step", 0, "rewind to this step of the checkpoint history (see attractor history)")
+	cmd.Flags().StringVar(&atNode, "at-node", "", "rewind to the last step of the checkpoint history that completed this node")
+	cmd.Flags().DurationVar(&grace, "grace-period", defaultGracePeriod, "on interrupt, how long to let the running node finish before cancelling it; 0 waits for it")
+	cmd.MarkFlagsMutuallyExclusive("at-step", "at-node")
 	return cmd
 }
 
+// loadResumePoint reads the latest checkpoint in store or, when atStep or
+// atNode is set, the matching step of its history.
+func loadResumePoint(ctx context.Context, store pipeline.CheckpointStore, atStep int, atNode string) (*pipeline.Checkpoint, error) {
+	if atStep == 0 && atNode == "" {
+		return store.Load(ctx)
+	}
+	steps, err := store.History(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if atNode != "" {
+		return pipeline.HistoryNode(steps, atNode)
+	}
+	return pipeline.HistoryStep(steps, atStep)
+}
+
 // ─── version ──────────────────────────────────────────────────────────────────
 
 func versionCmd() *cobra.Command {
@@ -285,16 +335,16 @@ func versionCmd() *cobra.Command {
 func executePipeline(
 	ctx context.Context,
 	dotFile, workdir, defaultModel, checkpointPath, outContextPath, seed string,
-	varFile string,
+	varFile, tracePath string,
 	vars []string,
-	resumeFromNodeID string,
+	grace time.Duration,
 ) error {
 	// Read and parse pipeline.
 	src, err := os.ReadFile(dotFile)
 	if err != nil {
 		return fmt.Errorf("read pipeline file: %w", err)
 	}
-	p, err := pipeline.ParseDOT(string(src))
+	p, err := pipeline.Parse(string(src), pipeline.SyntaxOf(dotFile))
 	if err != nil {
 		return fmt.Errorf("parse pipeline: %w", err)
 	}
@@ -305,34 +355,87 @@ func executePipeline(
 	// Apply stylesheet overrides.
 	pipeline.ApplyStylesheet(p)
 
-	// Initialise context.
-	pctx := pipeline.NewPipelineContext()
-	if seed != "" {
-		pctx.Set("seed", seed)
-	}
-	if err := applyVarFile(pctx, varFile); err != nil {
+	// Initialise context with the variables, checked against the
+	// pipeline's declared params.
+	values, err := loadVars(varFile, vars)
+	if err != nil {
 		return err
 	}
-	if err := applyVars(pctx, vars); err != nil {
+	values, err = p.BindParams(values)
+	if err != nil {
 		return err
 	}
+	pctx := pipeline.NewPipelineContext()
+	if seed != "" {
+		pctx.Set("seed", seed)
+	}
+	pctx.Merge(values)
 
 	// Build handler registry.
 	reg := buildRegistry(workdir, defaultModel)
 
 	// Build and run engine.
-	eng, err := pipeline.NewEngine(p, reg, pctx, checkpointPath)
+	eng, err := pipeline.NewEngine(p, reg, pctx, "")
 	if err != nil {
 		return fmt.Errorf("build engine: %w", err)
 	}
+	if checkpointPath != "" {
+		store, err := checkpoint.Open(checkpointPath)
+		if err != nil {
+			return err
+		}
+		defer store.Close()
+		eng.SetCheckpointStore(store)
+	}
+	closeTrace, err := attachTrace(eng, tracePath)
+	if err != nil {
+		return err
+	}
 
-	sctx := signalContext(ctx)
-	if runErr := eng.Execute(sctx, resumeFromNodeID); runErr != nil {
+	sctx, stop := handleInterrupts(ctx, eng, grace)
+	defer stop()
+	runErr := eng.Execute(sctx, "")
+	if runErr != nil && sctx.Err() != nil || errors.Is(runErr, pipeline.ErrSuspended) {
+		if checkpointPath != "" {
+			fmt.Fprintln(os.Stderr, resumeHint(dotFile, checkpointPath, workdir, defaultModel, outContextPath))
+		} else {
+			fmt.Fprintln(os.Stderr, "[attractor] run stopped; it cannot be resumed without --checkpoint")
+		}
+	}
+	if traceErr := closeTrace(); runErr == nil {
+		runErr = traceErr
+	}
+	if runErr != nil {
 		return runErr
 	}
 	return writeOutputContext(outContextPath, pctx)
 }
 
+// attachTrace opens path and registers a JSONL tracer on eng.  The returned
+// function closes the file and reports any error from writing the trace.
+// A blank path is a no-op.
+func attachTrace(eng *pipeline.Engine, path string) (func() error, error) {
+	if path == "" {
+		return func() error { return nil }, nil
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("--trace: %w", err)
+	}
+	tracer := pipeline.NewJSONLTracer(f)
+	eng.AddObserver(tracer)
+	return func() error {
+		closeErr := f.Close()
+		if err := tracer.Err(); err != nil {
+			return fmt.Errorf("--trace: write %q: %w", path, err)
+		}
+		if closeErr != nil {
+			return fmt.Errorf("--trace: close %q: %w", path, closeErr)
+		}
+		return nil
+	}, nil
+}
+
 // writeOutputContext marshals pctx as JSON and writes it to path.
 // A blank path is a no-op.
 func writeOutputContext(path string, pctx *pipeline.PipelineContext) error {
@@ -367,10 +470,23 @@ func applyVars(pctx *pipeline.PipelineContext, vars []string) error {
 	return nil
 }
 
+// loadVars returns the variables given with --var-file and --var, with
+// --var taking precedence.
+func loadVars(varFile string, vars []string) (map[string]any, error) {
+	pctx := pipeline.NewPipelineContext()
+	if err := applyVarFile(pctx, varFile); err != nil {
+		return nil, err
+	}
+	if err := applyVars(pctx, vars); err != nil {
+		return nil, err
+	}
+	return pctx.Snapshot(), nil
+}
+
 // applyVarFile loads a JSON object from path and injects each key into pctx.
-// All values are stored as strings (fmt.Sprintf("%v", v)) for consistency with --var.
-// A blank path is a no-op. Returns an error if the file is missing, not valid JSON,
-// or the top-level value is not a JSON object.
+// Values keep their JSON types (numbers, booleans, lists, objects), with
+// null stored as "".  A blank path is a no-op. Returns an error if the file
+// is missing, not valid JSON, or the top-level value is not a JSON object.
 func applyVarFile(pctx *pipeline.PipelineContext, path string) error {
 	if path == "" {
 		return nil
@@ -379,17 +495,19 @@ func applyVarFile(pctx *pipeline.PipelineContext, path string) error {
 	if err != nil {
 		return fmt.Errorf("--var-file: read %q: %w", path, err)
 	}
-	var raw map[string]any
-	if err := json.Unmarshal(data, &raw); err != nil {
-		// Could be non-object JSON — give a clear message.
-		var top any
-		if jsonErr := json.Unmarshal(data, &top); jsonErr == nil {
-			return fmt.Errorf("--var-file %q: top-level value must be a JSON object", path)
-		}
+	top, err := pipeline.DecodeValue(data)
+	if err != nil {
 		return fmt.Errorf("--var-file %q: invalid JSON: %w", path, err)
 	}
+	raw, ok := top.(map[string]any)
+	if !ok {
+		return fmt.Errorf("--var-file %q: top-level value must be a JSON object", path)
+	}
 	for k, v := range raw {
-		pctx.Set(k, fmt.Sprintf("%v", v))
+		if v == nil {
+			v = ""
+		}
+		pctx.Set(k, v)
 	}
 	return nil
 }
@@ -427,6 +545,13 @@ func buildRegistry(workdir, defaultModel string) *handlers.Registry {
 			return buildRegistry(w, m)
 		},
 	})
+	reg.Register("map_pipeline", &handlers.MapPipelineHandler{
+		Workdir:      workdir,
+		DefaultModel: defaultModel,
+		RegistryBuilder: func(w, m string) pipeline.HandlerRegistry {
+			return buildRegistry(w, m)
+		},
+	})
 	reg.Register("codergen", &handlers.CodergenHandler{
 		DefaultModel: defaultModel,
 		Workdir:      workdir,
@@ -434,18 +559,83 @@ func buildRegistry(workdir, defaultModel string) *handlers.Registry {
 	return reg
 }
 
-// signalContext returns a context that is cancelled on SIGINT or SIGTERM.
-func signalContext(parent context.Context) context.Context {
-	ctx, cancel := context.WithCancel(parent)
+// handleInterrupts returns a context for running eng that handles SIGINT
+// and SIGTERM in two stages.  The first signal suspends the run: no further
+// node starts, and the running ones have grace to finish (no limit if grace
+// is 0) before the context is cancelled.  A second signal cancels it at once.
+// Call stop once the run has returned.
+func handleInterrupts(parent context.Context, eng *pipeline.Engine, grace time.Duration) (ctx context.Context, stop func()) {
+	ctx, cancel := context.WithCancelCause(parent)
+	ch := make(chan os.Signal, 2)
+	signal.Notify(ch, syscall.SIGINT, syscall.SIGTERM)
+	done := make(chan struct{})
 	go func() {
-		ch := make(chan os.Signal, 1)
-		signal.Notify(ch, syscall.SIGINT, syscall.SIGTERM)
-		select {
-		case <-ch:
-			fmt.Fprintln(os.Stderr, "\n[attractor] interrupted — cancelling pipeline")
-			cancel()
-		case <-ctx.Done():
+		var expired <-chan time.Time
+		suspended := false
+		for {
+			select {
+			case sig := <-ch:
+				if suspended {
+					fmt.Fprintln(os.Stderr, "\n[attractor] interrupted again — aborting")
+					cancel(errors.New("aborted by a second interrupt"))
+					return
+				}
+				suspended = true
+				eng.Suspend("interrupted by " + signalName(sig))
+				if grace > 0 {
+					timer := time.NewTimer(grace)
+					defer timer.Stop()
+					expired = timer.C
+					fmt.Fprintf(os.Stderr, "\n[attractor] interrupted — finishing the running node (up to %s); interrupt again to abort\n", grace)
+				} else {
+					fmt.Fprintln(os.Stderr, "\n[attractor] interrupted — finishing the running node; interrupt again to abort")
+				}
+			case <-expired:
+				fmt.Fprintf(os.Stderr, "[attractor] grace period of %s expired — cancelling the running node\n", grace)
+				cancel(fmt.Errorf("grace period of %s expired", grace))
+				return
+			case <-done:
+				return
+			case <-ctx.Done():
+				return
+			}
 		}
 	}()
-	return ctx
+	return ctx, func() {
+		signal.Stop(ch)
+		close(done)
+		cancel(nil)
+	}
+}
+
+func signalName(sig os.Signal) string {
+	if sig == syscall.SIGTERM {
+		return "SIGTERM"
+	}
+	return "SIGINT"
+}
+
+// resumeHint returns the message printed when a run stops early: the
+// attractor resume command that continues it with the same settings.
+func resumeHint(dotFile, checkpointURI, workdir, model, outContextPath string) string {
+	args := []string{"attractor", "resume", shellQuote(dotFile), shellQuote(checkpointURI)}
+	if workdir != "" && workdir != "." {
+		args = append(args, "--workdir", shellQuote(workdir))
+	}
+	if model != "" && model != modelDefault {
+		args = append(args, "--model", shellQuote(model))
+	}
+	if outContextPath != "" {
+		args = append(args, "--output-context", shellQuote(outContextPath))
+	}
+	return "[attractor] run suspended; to continue it, run:\n  " + strings.Join(args, " ")
+}
+
+// shellQuote quotes s for a POSIX shell when it contains anything beyond
+// plain path characters.
+func shellQuote(s string) string {
+	if s != "" && strings.Trim(s, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789-_./:=@%+,") == "" {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
 }
@@ -1,9 +1,11 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"os"
 	"path/filepath"
+	"reflect"
 	"strings"
 	"testing"
 
@@ -110,6 +112,29 @@ func TestVarFileBasic(t *testing.T) {
 	}
 }
 
+func TestVarFileKeepsTypes(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	f := filepath.Join(dir, "vars.json")
+	if err := os.WriteFile(f, []byte(`{"limit":10,"debug":true,"tags":["a"],"owner":{"name":"ann"},"none":null}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	pctx := pipeline.NewPipelineContext()
+	if err := applyVarFile(pctx, f); err != nil {
+		t.Fatalf("applyVarFile: %v", err)
+	}
+	want := map[string]any{
+		"limit": int64(10),
+		"debug": true,
+		"tags":  []any{"a"},
+		"owner": map[string]any{"name": "ann"},
+		"none":  "",
+	}
+	if got := pctx.Snapshot(); !reflect.DeepEqual(got, want) {
+		t.Errorf("context = %#v, want %#v", got, want)
+	}
+}
+
 func TestVarFileOverriddenByVar(t *testing.T) {
 	t.Parallel()
 	dir := t.TempDir()
@@ -171,6 +196,208 @@ func TestVarFileNoOp(t *testing.T) {
 	}
 }
 
+// ─── TestTrace ────────────────────────────────────────────────────────────────
+
+func TestExecutePipelineTrace(t *testing.T) {
+	dir := t.TempDir()
+	dot := filepath.Join(dir, "p.dot")
+	src := `digraph traced {
+    start [type=start]
+    greet [type=set key=greeting value="hello"]
+    done  [type=exit]
+    start -> greet
+    greet -> done
+}`
+	if err := os.WriteFile(dot, []byte(src), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	trace := filepath.Join(dir, "run.jsonl")
+	if err := executePipeline(context.Background(), dot, dir, "", "", "", "", "", trace, nil, 0); err != nil {
+		t.Fatalf("executePipeline: %v", err)
+	}
+
+	data, err := os.ReadFile(trace)
+	if err != nil {
+		t.Fatalf("read trace: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	var started []string
+	for _, line := range lines {
+		var ev pipeline.Event
+		if err := json.Unmarshal([]byte(line), &ev); err != nil {
+			t.Fatalf("trace line %q: %v", line, err)
+		}
+		if ev.Pipeline != "traced" {
+			t.Errorf("event %s: pipeline = %q, want %q", ev.Type, ev.Pipeline, "traced")
+		}
+		if ev.Type == pipeline.EventNodeStarted {
+			started = append(started, ev.NodeID)
+		}
+	}
+	if got := strings.Join(started, ","); got != "start,greet,done" {
+		t.Errorf("node_started order = %s, want start,greet,done", got)
+	}
+	if !strings.Contains(lines[len(lines)-1], `"type":"run_finished"`) {
+		t.Errorf("last trace line = %s, want run_finished", lines[len(lines)-1])
+	}
+}
+
+func TestAttachTraceBadPath(t *testing.T) {
+	t.Parallel()
+	_, err := attachTrace(nil, "/nonexistent/dir/run.jsonl")
+	if err == nil || !strings.Contains(err.Error(), "--trace") {
+		t.Errorf("expected --trace error, got %v", err)
+	}
+}
+
+// ─── TestResume ───────────────────────────────────────────────────────────────
+
+func TestResumeCmdHints(t *testing.T) {
+	dir := t.TempDir()
+	dot := filepath.Join(dir, "p.dot")
+	src := `digraph done {
+    start [type=start]
+    greet [type=set key=greeting value="hello"]
+    done  [type=exit]
+    start -> greet
+    greet -> done
+}`
+	if err := os.WriteFile(dot, []byte(src), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cp := filepath.Join(dir, "cp.json")
+	if err := executePipeline(context.Background(), dot, dir, "", cp, "", "", "", "", nil, 0); err != nil {
+		t.Fatalf("executePipeline: %v", err)
+	}
+
+	resume := func(args ...string) error {
+		cmd := resumeCmd()
+		cmd.SetArgs(append([]string{dot, cp}, args...))
+		cmd.SetContext(context.Background())
+		return cmd.Execute()
+	}
+	if err := resume(); err == nil || !strings.Contains(err.Error(), "--rerun-last") {
+		t.Errorf("expected --rerun-last hint for a completed run, got %v", err)
+	}
+	if err := resume("--rerun-last"); err != nil {
+		t.Errorf("resume --rerun-last: %v", err)
+	}
+
+	if err := os.WriteFile(dot, []byte(src+"\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := resume("--rerun-last"); err == nil || !strings.Contains(err.Error(), "--allow-drift") {
+		t.Errorf("expected --allow-drift hint for a changed pipeline, got %v", err)
+	}
+	if err := resume("--rerun-last", "--allow-drift"); err != nil {
+		t.Errorf("resume --allow-drift: %v", err)
+	}
+}
+
+func TestResumeAtStep(t *testing.T) {
+	dir := t.TempDir()
+	dot := filepath.Join(dir, "p.dot")
+	src := `digraph counter {
+    start [type=start]
+    plan  [type=set key=plan value="draft"]
+    build [type=set key=build value="{{.plan}}-built"]
+    done  [type=exit]
+    start -> plan -> build -> done
+}`
+	if err := os.WriteFile(dot, []byte(src), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cp := filepath.Join(dir, "cp.json")
+	if err := executePipeline(context.Background(), dot, dir, "", cp, "", "", "", "", nil, 0); err != nil {
+		t.Fatalf("executePipeline: %v", err)
+	}
+
+	steps, err := pipeline.ReadHistory(cp)
+	if err != nil {
+		t.Fatalf("ReadHistory: %v", err)
+	}
+	out := renderHistory(steps)
+	if !strings.Contains(out, "plan") || !strings.Contains(out, "(end)") {
+		t.Errorf("history output missing steps:\n%s", out)
+	}
+
+	// Rewind to just after plan with a different plan; build runs again.
+	outCtx := filepath.Join(dir, "out.json")
+	cmd := resumeCmd()
+	cmd.SetArgs([]string{dot, cp, "--at-node", "plan", "--var", "plan=final", "--output-context", outCtx})
+	cmd.SetContext(context.Background())
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("resume --at-node: %v", err)
+	}
+	data, err := os.ReadFile(outCtx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got map[string]any
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+	if got["build"] != "final-built" {
+		t.Errorf("build = %v, want %q", got["build"], "final-built")
+	}
+
+	if _, err := loadResumePoint(context.Background(), pipeline.NewFileStore(cp), 99, ""); err == nil {
+		t.Error("expected error for a step not in the history")
+	}
+}
+
+func TestResumeFromSQLiteCheckpoint(t *testing.T) {
+	dir := t.TempDir()
+	dot := filepath.Join(dir, "p.dot")
+	src := `digraph counter {
+    start [type=start]
+    plan  [type=set key=plan value="draft"]
+    build [type=set key=build value="{{.plan}}-built"]
+    done  [type=exit]
+    start -> plan -> build -> done
+}`
+	if err := os.WriteFile(dot, []byte(src), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	uri := "sqlite://" + filepath.Join(dir, "runs.db") + "?run=nightly"
+	if err := executePipeline(context.Background(), dot, dir, "", uri, "", "", "", "", nil, 0); err != nil {
+		t.Fatalf("executePipeline: %v", err)
+	}
+
+	outCtx := filepath.Join(dir, "out.json")
+	cmd := resumeCmd()
+	cmd.SetArgs([]string{dot, uri, "--at-node", "plan", "--var", "plan=final", "--output-context", outCtx})
+	cmd.SetContext(context.Background())
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("resume --at-node: %v", err)
+	}
+	data, err := os.ReadFile(outCtx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), `"final-built"`) {
+		t.Errorf("output context = %s, want build=final-built", data)
+	}
+
+	if err := executePipeline(context.Background(), dot, dir, "", "ftp://nowhere/cp", "", "", "", "", nil, 0); err == nil {
+		t.Error("expected error for an unknown checkpoint scheme")
+	}
+}
+
+// ─── TestResumeHint ───────────────────────────────────────────────────────────
+
+func TestResumeHint(t *testing.T) {
+	got := resumeHint("p.dot", "cp.json", ".", modelDefault, "")
+	if !strings.HasSuffix(got, "\n  attractor resume p.dot cp.json") {
+		t.Errorf("hint = %q", got)
+	}
+	got = resumeHint("my pipeline.dot", "sqlite:///tmp/runs.db?run=it's", "work", "openai:gpt-5", "out.json")
+	want := `attractor resume 'my pipeline.dot' 'sqlite:///tmp/runs.db?run=it'\''s' --workdir work --model openai:gpt-5 --output-context out.json`
+	if !strings.HasSuffix(got, want) {
+		t.Errorf("hint = %q, want suffix %q", got, want)
+	}
+}
+
 // ─── TestGraph ────────────────────────────────────────────────────────────────
 
 const batchDOT = `digraph batch {
@@ -290,3 +517,335 @@ func TestGraphDOTConditionEdges(t *testing.T) {
 		t.Errorf("DOT output missing label=fast:\n%s", out)
 	}
 }
+
+// ─── params ───────────────────────────────────────────────────────────────────
+
+const paramsDOT = `digraph release {
+    subgraph params {
+        repo  [required=true description="Repository to release"]
+        count [type=int default=2]
+        mode  [enum="fast,full" default=fast description="Build mode"]
+    }
+    start [type=start]
+    out   [type=set key=out value="{{.repo}}/{{.count}}/{{.mode}}"]
+    done  [type=exit]
+    start -> out
+    out -> done
+}`
+
+func TestRenderParams(t *testing.T) {
+	t.Parallel()
+	p, err := pipeline.ParseDOT(paramsDOT)
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	want := `name   type                default     description
+repo   string              (required)  Repository to release
+count  int                 2
+mode   string (fast|full)  "fast"      Build mode
+`
+	if got := renderParams(p); got != want {
+		t.Errorf("renderParams =\n%s\nwant\n%s", got, want)
+	}
+
+	// The params survive graph --format dot.
+	p2, err := pipeline.ParseDOT(renderDOT(p))
+	if err != nil {
+		t.Fatalf("re-parse: %v", err)
+	}
+	if got := renderParams(p2); got != want {
+		t.Errorf("params after round trip =\n%s", got)
+	}
+}
+
+func TestRenderType(t *testing.T) {
+	t.Parallel()
+	s, ok := pipeline.LookupSchema(pipeline.NodeTypeSleep)
+	if !ok {
+		t.Fatal("no schema for sleep")
+	}
+	got := renderType(s)
+	for _, want := range []string{
+		"sleep: Pause for a duration\n",
+		"duration   duration  (required)  How long to pause\n",
+		"Common attributes:\n",
+		"retry_delay  duration  0s",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("renderType missing %q:\n%s", want, got)
+		}
+	}
+}
+
+func TestBuiltinSchemas(t *testing.T) {
+	t.Parallel()
+	reg := buildRegistry(t.TempDir(), "")
+	for _, s := range pipeline.Schemas() {
+		if s.Type == pipeline.NodeTypeFanOut {
+			continue
+		}
+		h, err := reg.Get(s.Type)
+		if err != nil {
+			t.Errorf("schema for %q has no handler: %v", s.Type, err)
+			continue
+		}
+		sh, ok := h.(pipeline.SchemaHandler)
+		if !ok || sh.Schema().Type != s.Type {
+			t.Errorf("handler for %q does not describe its schema", s.Type)
+		}
+	}
+}
+
+func TestExecutePipelineParams(t *testing.T) {
+	dir := t.TempDir()
+	dot := filepath.Join(dir, "p.dot")
+	if err := os.WriteFile(dot, []byte(paramsDOT), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	out := filepath.Join(dir, "out.json")
+	run := func(varFile string, vars ...string) error {
+		return executePipeline(context.Background(), dot, dir, "", "", out, "", varFile, "", vars, 0)
+	}
+
+	if err := run("", "repo=attractor", "count=3"); err != nil {
+		t.Fatalf("executePipeline: %v", err)
+	}
+	data, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got map[string]any
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+	if got["out"] != "attractor/3/fast" {
+		t.Errorf("out = %v, want attractor/3/fast", got["out"])
+	}
+
+	// Nothing runs when the variables do not match the params.
+	if err := os.Remove(out); err != nil {
+		t.Fatal(err)
+	}
+	err = run("", "count=3")
+	if err == nil || !strings.Contains(err.Error(), `missing required param "repo"`) {
+		t.Errorf("executePipeline without repo = %v, want a missing param error", err)
+	}
+	varFile := filepath.Join(dir, "vars.json")
+	if err := os.WriteFile(varFile, []byte(`{"repo":"attractor","count":"many"}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	err = run(varFile)
+	if err == nil || !strings.Contains(err.Error(), `param "count": "many" is not a valid int`) {
+		t.Errorf("executePipeline with a bad --var-file = %v, want a type error", err)
+	}
+	if _, statErr := os.Stat(out); !os.IsNotExist(statErr) {
+		t.Errorf("output context written by a rejected run")
+	}
+}
+
+// ─── lint ─────────────────────────────────────────────────────────────────────
+
+func TestLintFormats(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"good.dot":   "digraph good {\n  start [type=start]\n  exit [type=exit]\n  start -> exit\n}\n",
+		"bad.dot":    "digraph bad {\n  start [type=start]\n  nap [type=sleep duration=soon]\n  exit [type=exit]\n  start -> nap -> exit\n}\n",
+		"syntax.dot": "digraph syntax {\n  start [type=start\n  start -> exit\n}\n",
+	}
+	for name, src := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(src), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	lint := func(format string) (string, error) {
+		var out strings.Builder
+		cmd := lintCmd()
+		cmd.SetArgs([]string{filepath.Join(dir, "*.dot"), "--format", format})
+		cmd.SetOut(&out)
+		cmd.SetErr(&strings.Builder{})
+		err := cmd.Execute()
+		return out.String(), err
+	}
+
+	out, err := lint("json")
+	if err == nil || !strings.Contains(err.Error(), "2 error(s)") {
+		t.Errorf("lint error = %v, want 2 errors", err)
+	}
+	var problems []lintProblemJSON
+	if err := json.Unmarshal([]byte(out), &problems); err != nil {
+		t.Fatalf("unmarshal %s: %v", out, err)
+	}
+	want := []lintProblemJSON{
+		{File: filepath.Join(dir, "bad.dot"), Line: 3, Column: 19, EndLine: 3, EndColumn: 32, Severity: "error",
+			Rule: pipeline.RuleAttrValue, Node: "nap", Message: `node "nap": duration="soon" must be a duration such as 30s or 5m`},
+		{File: filepath.Join(dir, "syntax.dot"), Line: 3, Column: 9, EndLine: 3, EndColumn: 9, Severity: "error",
+			Rule: pipeline.RuleParse, Message: `dot parse error at 3:9: unexpected "->", expected one of: = ] , id`},
+	}
+	if !reflect.DeepEqual(problems, want) {
+		t.Errorf("json problems =\n%+v\nwant\n%+v", problems, want)
+	}
+
+	out, _ = lint("github")
+	wantLine := "::error file=" + filepath.ToSlash(filepath.Join(dir, "bad.dot")) +
+		",line=3,col=19,endLine=3,endColumn=32,title=attractor attr-value::node \"nap\": duration=\"soon\" must be a duration such as 30s or 5m\n"
+	if !strings.HasPrefix(out, wantLine) {
+		t.Errorf("github output =\n%s\nwant first line\n%s", out, wantLine)
+	}
+
+	out, _ = lint("sarif")
+	var log sarifLog
+	if err := json.Unmarshal([]byte(out), &log); err != nil {
+		t.Fatalf("unmarshal sarif: %v", err)
+	}
+	if len(log.Runs) != 1 || len(log.Runs[0].Results) != 2 || len(log.Runs[0].Tool.Driver.Rules) != 2 {
+		t.Fatalf("sarif = %s", out)
+	}
+	if r := log.Runs[0].Results[0]; r.RuleID != pipeline.RuleAttrValue || r.Locations[0].PhysicalLocation.Region.StartColumn != 19 {
+		t.Errorf("sarif result = %+v", r)
+	}
+
+	if _, err := expandGlobs([]string{filepath.Join(dir, "*.none")}); err == nil {
+		t.Error("expandGlobs accepted a pattern matching nothing")
+	}
+}
+
+// ─── TestFmt ──────────────────────────────────────────────────────────────────
+
+func TestFmt(t *testing.T) {
+	dir := t.TempDir()
+	const (
+		messy = "digraph m {\n  start -> exit\n  exit [type=exit]\n  start [type=\"start\"]\n}\n"
+		tidy  = "digraph m {\n    exit  [type=exit]\n    start [type=start]\n\n    start -> exit\n}\n"
+	)
+	files := map[string]string{"messy.dot": messy, "sub/tidy.dot": tidy}
+	for name, src := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(src), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	run := func(args ...string) (string, error) {
+		var out strings.Builder
+		cmd := fmtCmd()
+		cmd.SetArgs(args)
+		cmd.SetOut(&out)
+		cmd.SetErr(&strings.Builder{})
+		err := cmd.Execute()
+		return out.String(), err
+	}
+
+	messyPath := filepath.Join(dir, "messy.dot")
+	if out, err := run(messyPath); err != nil || out != tidy {
+		t.Errorf("fmt = %q, %v; want %q", out, err, tidy)
+	}
+	if out, err := run("-l", dir); err != nil || out != messyPath+"\n" {
+		t.Errorf("fmt -l = %q, %v", out, err)
+	}
+	if out, err := run("--check", dir); err == nil || out != messyPath+"\n" {
+		t.Errorf("fmt --check = %q, %v; want the messy file and an error", out, err)
+	}
+	if _, err := run("-w", dir); err != nil {
+		t.Fatalf("fmt -w: %v", err)
+	}
+	if data, _ := os.ReadFile(messyPath); string(data) != tidy {
+		t.Errorf("fmt -w wrote %q", data)
+	}
+	if out, err := run("--check", dir); err != nil || out != "" {
+		t.Errorf("fmt --check after -w = %q, %v", out, err)
+	}
+}
+
+// The example pipelines are kept in the canonical layout.
+func TestFmtExamples(t *testing.T) {
+	var out strings.Builder
+	cmd := fmtCmd()
+	cmd.SetArgs([]string{"--check", "../../examples"})
+	cmd.SetOut(&out)
+	cmd.SetErr(&out)
+	if err := cmd.Execute(); err != nil {
+		t.Errorf("examples are not formatted (run attractor fmt -w examples): %v\n%s", err, out.String())
+	}
+}
+
+// ─── TestConvert ──────────────────────────────────────────────────────────────
+
+func TestConvert(t *testing.T) {
+	dir := t.TempDir()
+	const src = "digraph c {\n    model_stylesheet=\"* { model: \\\"m1\\\" }\"\n\n" +
+		"    start [type=start]\n    nap   [type=sleep duration=soon]\n    exit  [type=exit]\n\n" +
+		"    start -> nap\n    nap   -> exit [label=\"outcome == 'success'\"]\n}\n"
+	dotPath := filepath.Join(dir, "c.dot")
+	if err := os.WriteFile(dotPath, []byte(src), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	convert := func(args ...string) (string, error) {
+		var out strings.Builder
+		cmd := convertCmd()
+		cmd.SetArgs(args)
+		cmd.SetOut(&out)
+		cmd.SetErr(&strings.Builder{})
+		cmd.SetIn(strings.NewReader(src))
+		err := cmd.Execute()
+		return out.String(), err
+	}
+
+	yamlPath := filepath.Join(dir, "c.yaml")
+	if _, err := convert(dotPath, "-o", yamlPath); err != nil {
+		t.Fatalf("convert to yaml: %v", err)
+	}
+	data, _ := os.ReadFile(yamlPath)
+	for _, want := range []string{"stylesheet: '* { model: \"m1\" }'\n", "condition: outcome == 'success'"} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("yaml lacks %q:\n%s", want, data)
+		}
+	}
+	if out, err := convert(yamlPath, "--to", "dot"); err != nil || out != src {
+		t.Errorf("convert back to dot = %v\n%s\nwant\n%s", err, out, src)
+	}
+	if out, err := convert("-", "--to", "json"); err != nil || !strings.Contains(out, `"stylesheet": "* { model: \"m1\" }"`) {
+		t.Errorf("convert stdin to json = %v\n%s", err, out)
+	}
+	if _, err := convert(dotPath); err == nil {
+		t.Error("convert with no output syntax succeeded")
+	}
+	if _, err := convert(dotPath, "--to", "xml"); err == nil {
+		t.Error("convert --to xml succeeded")
+	}
+
+	// lint reads the YAML file and reports positions in it.
+	r, err := lintFile(yamlPath, nil, nil)
+	if err != nil {
+		t.Fatalf("lintFile: %v", err)
+	}
+	if len(r.Problems) != 1 || r.Problems[0].Rule != pipeline.RuleAttrValue || r.Problems[0].Span.Start != (pipeline.Pos{Line: 5, Col: 22}) {
+		t.Errorf("lint problems = %+v\n%s", r.Problems, data)
+	}
+}
+
+func TestConvertExamples(t *testing.T) {
+	var files []string
+	for _, pattern := range []string{"*.dot", "*.yaml", "*/*.dot"} {
+		m, _ := filepath.Glob(filepath.Join("../../examples", pattern))
+		files = append(files, m...)
+	}
+	for _, f := range files {
+		src, err := os.ReadFile(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		p, err := pipeline.Parse(string(src), pipeline.SyntaxOf(f))
+		if err != nil {
+			t.Errorf("%s: %v", f, err)
+			continue
+		}
+		// Encode checks that each translation reads back the same.
+		for _, syn := range pipeline.Syntaxes {
+			if _, err := pipeline.Encode(p, syn); err != nil {
+				t.Errorf("%s to %s: %v", f, syn, err)
+			}
+		}
+	}
+}
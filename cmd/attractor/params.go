@@ -0,0 +1,113 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/ravi-parthasarathy/attractor/pkg/pipeline"
+)
+
+// ─── params ───────────────────────────────────────────────────────────────────
+
+func paramsCmd() *cobra.Command {
+	var format string
+
+	cmd := &cobra.Command{
+		Use:   "params <pipeline>",
+		Short: "List the parameters a pipeline declares",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(_ *cobra.Command, args []string) error {
+			src, err := os.ReadFile(args[0])
+			if err != nil {
+				return fmt.Errorf("read file: %w", err)
+			}
+			p, err := pipeline.Parse(string(src), pipeline.SyntaxOf(args[0]))
+			if err != nil {
+				return fmt.Errorf("parse: %w", err)
+			}
+
+			switch strings.ToLower(format) {
+			case "json":
+				data, err := json.MarshalIndent(paramsJSON(p.Params), "", "  ")
+				if err != nil {
+					return fmt.Errorf("marshal params: %w", err)
+				}
+				fmt.Println(string(data))
+			case "text", "":
+				fmt.Print(renderParams(p))
+			default:
+				return fmt.Errorf("unknown format %q: use text or json", format)
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&format, "format", "text", "output format: text or json")
+	return cmd
+}
+
+// renderParams produces one line per declared param: its name, type,
+// whether it is required or else its default, and its description, with
+// the allowed values after the type.
+func renderParams(p *pipeline.Pipeline) string {
+	if len(p.Params) == 0 {
+		return fmt.Sprintf("Pipeline %s declares no params.\n", p.Name)
+	}
+
+	rows := [][]string{{"name", "type", "default", "description"}}
+	for _, prm := range p.Params {
+		typ := string(prm.Type)
+		if len(prm.Enum) > 0 {
+			typ += " (" + strings.Join(prm.Enum, "|") + ")"
+		}
+		def := "-"
+		switch {
+		case prm.Required:
+			def = "(required)"
+		case prm.HasDefault:
+			def = strconv.Quote(prm.Default)
+			if prm.Type != pipeline.ParamString {
+				def = prm.Default
+			}
+		}
+		rows = append(rows, []string{prm.Name, typ, def, prm.Description})
+	}
+
+	return renderTable(rows)
+}
+
+// paramJSON is the JSON form of a param printed by attractor params.
+type paramJSON struct {
+	Name        string   `json:"name"`
+	Type        string   `json:"type"`
+	Required    bool     `json:"required,omitempty"`
+	Default     any      `json:"default,omitempty"`
+	Description string   `json:"description,omitempty"`
+	Enum        []string `json:"enum,omitempty"`
+}
+
+func paramsJSON(params []*pipeline.Param) []paramJSON {
+	out := make([]paramJSON, 0, len(params))
+	for _, prm := range params {
+		pj := paramJSON{
+			Name:        prm.Name,
+			Type:        string(prm.Type),
+			Required:    prm.Required,
+			Description: prm.Description,
+			Enum:        prm.Enum,
+		}
+		if prm.HasDefault {
+			pj.Default = prm.Default
+			if v, err := prm.Parse(prm.Default); err == nil {
+				pj.Default = v
+			}
+		}
+		out = append(out, pj)
+	}
+	return out
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/ravi-parthasarathy/attractor/pkg/pipeline"
+)
+
+// ─── types ────────────────────────────────────────────────────────────────────
+
+func typesCmd() *cobra.Command {
+	var format string
+
+	cmd := &cobra.Command{
+		Use:   "types [type]",
+		Short: "List node types, or the attributes of one",
+		Args:  cobra.MaximumNArgs(1),
+		RunE: func(_ *cobra.Command, args []string) error {
+			schemas := pipeline.Schemas()
+			if len(args) == 1 {
+				s, ok := pipeline.LookupSchema(pipeline.NodeType(args[0]))
+				if !ok {
+					return fmt.Errorf("unknown node type %q: run attractor types for the list", args[0])
+				}
+				schemas = []pipeline.NodeSchema{s}
+			}
+
+			switch strings.ToLower(format) {
+			case "json":
+				data, err := json.MarshalIndent(typesJSON(schemas), "", "  ")
+				if err != nil {
+					return fmt.Errorf("marshal types: %w", err)
+				}
+				fmt.Println(string(data))
+			case "text", "":
+				if len(args) == 1 {
+					fmt.Print(renderType(schemas[0]))
+				} else {
+					fmt.Print(renderTypes(schemas))
+				}
+			default:
+				return fmt.Errorf("unknown format %q: use text or json", format)
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&format, "format", "text", "output format: text or json")
+	return cmd
+}
+
+// renderTypes produces one line per node type with its description.
+func renderTypes(schemas []pipeline.NodeSchema) string {
+	rows := [][]string{{"type", "description"}}
+	for _, s := range schemas {
+		rows = append(rows, []string{string(s.Type), s.Description})
+	}
+	return renderTable(rows)
+}
+
+// renderType describes one node type: its attributes with their types,
+// whether they are required or else their defaults, and what they do,
+// followed by the attributes every node accepts.
+func renderType(s pipeline.NodeSchema) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%s: %s\n\n", s.Type, s.Description)
+	if len(s.Attrs) > 0 {
+		sb.WriteString(renderAttrs(s.Attrs))
+		sb.WriteString("\n")
+	}
+	sb.WriteString("Common attributes:\n")
+	sb.WriteString(renderAttrs(pipeline.CommonAttrs))
+	return sb.String()
+}
+
+func renderAttrs(attrs []pipeline.AttrSchema) string {
+	rows := [][]string{{"attribute", "type", "default", "description"}}
+	for _, a := range attrs {
+		typ := string(a.Type)
+		if len(a.Enum) > 0 {
+			typ += " (" + strings.Join(a.Enum, "|") + ")"
+		}
+		def := "-"
+		switch {
+		case a.Required:
+			def = "(required)"
+		case a.Default != "":
+			def = a.Default
+		}
+		rows = append(rows, []string{a.Name, typ, def, a.Description})
+	}
+	return renderTable(rows)
+}
+
+// renderTable aligns every column of rows but the last.
+func renderTable(rows [][]string) string {
+	widths := make([]int, len(rows[0])-1)
+	for _, row := range rows {
+		for i := range widths {
+			widths[i] = max(widths[i], len(row[i]))
+		}
+	}
+	var sb strings.Builder
+	for _, row := range rows {
+		var line strings.Builder
+		for i, w := range widths {
+			fmt.Fprintf(&line, "%-*s  ", w, row[i])
+		}
+		line.WriteString(row[len(row)-1])
+		fmt.Fprintln(&sb, strings.TrimRight(line.String(), " "))
+	}
+	return sb.String()
+}
+
+// typeJSON is the JSON form of a node type printed by attractor types.
+type typeJSON struct {
+	Type        string     `json:"type"`
+	Description string     `json:"description"`
+	Attrs       []attrJSON `json:"attributes"`
+}
+
+type attrJSON struct {
+	Name        string   `json:"name"`
+	Type        string   `json:"type"`
+	Required    bool     `json:"required,omitempty"`
+	Default     string   `json:"default,omitempty"`
+	Enum        []string `json:"enum,omitempty"`
+	Description string   `json:"description,omitempty"`
+}
+
+func typesJSON(schemas []pipeline.NodeSchema) []typeJSON {
+	out := make([]typeJSON, 0, len(schemas))
+	for _, s := range schemas {
+		tj := typeJSON{Type: string(s.Type), Description: s.Description, Attrs: []attrJSON{}}
+		for _, a := range s.Attrs {
+			tj.Attrs = append(tj.Attrs, attrJSON{
+				Name:        a.Name,
+				Type:        string(a.Type),
+				Required:    a.Required,
+				Default:     a.Default,
+				Enum:        a.Enum,
+				Description: a.Description,
+			})
+		}
+		out = append(out, tj)
+	}
+	return out
+}
@@ -0,0 +1,245 @@
+package lsp
+
+import (
+	"errors"
+	"strings"
+	"unicode/utf16"
+
+	"github.com/ravi-parthasarathy/attractor/pkg/pipeline"
+)
+
+// document is an open pipeline source.
+type document struct {
+	uri   string
+	text  string
+	lines []string
+	// code holds the tokens of text without its comments, ending with a
+	// TokenEOF.
+	code []pipeline.Token
+	// p is text parsed, or nil if it does not parse; last is the most
+	// recent version that did, which completion falls back on while the
+	// user is in the middle of an edit.
+	p, last *pipeline.Pipeline
+	err     error
+}
+
+func newDocument(uri, text string, prev *document) *document {
+	d := &document{uri: uri, text: text, lines: strings.Split(text, "\n")}
+	for _, t := range pipeline.ScanDOT(text) {
+		if t.Kind != pipeline.TokenComment {
+			d.code = append(d.code, t)
+		}
+	}
+	d.p, d.err = pipeline.ParseDOT(text)
+	d.last = d.p
+	if d.p == nil && prev != nil {
+		d.last = prev.last
+	}
+	return d
+}
+
+// diagnostics lints the document: a syntax error if it does not parse,
+// else the problems pipeline.Lint finds.
+func (d *document) diagnostics(reg pipeline.HandlerRegistry) []diagnostic {
+	diags := []diagnostic{}
+	if d.err != nil {
+		var pos pipeline.Pos
+		var pe *pipeline.ParseError
+		if errors.As(d.err, &pe) {
+			pos = pe.Pos
+		}
+		diags = append(diags, diagnostic{
+			Range:    d.toRange(pipeline.Span{Start: pos, End: pos}),
+			Severity: severityError,
+			Code:     pipeline.RuleParse,
+			Source:   "attractor",
+			Message:  d.err.Error(),
+		})
+		return diags
+	}
+	for _, e := range pipeline.Lint(d.p, reg, nil) {
+		sev := severityError
+		if e.Level() == pipeline.SeverityWarning {
+			sev = severityWarning
+		}
+		diags = append(diags, diagnostic{
+			Range:    d.toRange(e.Span),
+			Severity: sev,
+			Code:     e.Rule,
+			Source:   "attractor",
+			Message:  e.Error(),
+		})
+	}
+	return diags
+}
+
+// ─── Positions ────────────────────────────────────────────────────────────────
+
+// toPosition converts pos, which counts code points from 1, to an LSP
+// position, which counts UTF-16 code units from 0.
+func (d *document) toPosition(pos pipeline.Pos) position {
+	if !pos.IsValid() {
+		return position{}
+	}
+	line := min(pos.Line, len(d.lines)) - 1
+	units, col := 0, 1
+	for _, r := range d.lines[line] {
+		if col >= pos.Col {
+			break
+		}
+		units += utf16.RuneLen(r)
+		col++
+	}
+	return position{Line: line, Character: units}
+}
+
+// fromPosition is the inverse of toPosition.
+func (d *document) fromPosition(p position) pipeline.Pos {
+	pos := pipeline.Pos{Line: p.Line + 1, Col: 1}
+	if p.Line < 0 || p.Line >= len(d.lines) {
+		return pos
+	}
+	units := 0
+	for _, r := range d.lines[p.Line] {
+		if units >= p.Character {
+			break
+		}
+		units += utf16.RuneLen(r)
+		pos.Col++
+	}
+	return pos
+}
+
+func (d *document) toRange(s pipeline.Span) lspRange {
+	end := s.End
+	if !end.IsValid() || end.Before(s.Start) {
+		end = s.Start
+	}
+	return lspRange{Start: d.toPosition(s.Start), End: d.toPosition(end)}
+}
+
+// ─── Tokens ───────────────────────────────────────────────────────────────────
+
+// tokenAt returns the index in d.code of the ID token the cursor at pos
+// is at, in or just after, or -1.  Next is the index of the first token
+// that starts at or after pos, or of the ID token itself.
+func (d *document) tokenAt(pos pipeline.Pos) (word, next int) {
+	for i, t := range d.code {
+		switch {
+		case t.Kind == pipeline.TokenEOF || pos.Before(t.Span.Start):
+			return -1, i
+		case t.Kind == pipeline.TokenID && !t.Span.End.Before(pos):
+			return i, i
+		case t.Span.Start == pos:
+			return -1, i
+		}
+	}
+	return -1, len(d.code) - 1
+}
+
+// tokText returns the text of token i, or "" if there is none.
+func (d *document) tokText(i int) string {
+	if i < 0 || i >= len(d.code) {
+		return ""
+	}
+	return d.code[i].Text
+}
+
+// attrContext says where in an attribute list a position is.
+type attrContext struct {
+	// kind is "node" for a node statement or a node [...] default, "edge"
+	// for an edge statement or an edge [...] default, "graph" otherwise.
+	kind string
+	// node is the ID of the node of a node statement.
+	node string
+	// attr is the attribute whose value is at the position, or "" if the
+	// position is at an attribute name.
+	attr string
+	// present are the attributes the list already sets, and nodeType the
+	// value of its type attribute, if any.
+	present  map[string]bool
+	nodeType string
+}
+
+// attrContextAt finds the attribute list around pos, if there is one.
+func (d *document) attrContextAt(pos pipeline.Pos) (attrContext, bool) {
+	word, next := d.tokenAt(pos)
+	// Find the unclosed [ before the position.
+	open, depth := -1, 0
+	for j := next - 1; j >= 0 && open < 0; j-- {
+		switch d.code[j].Text {
+		case "]":
+			depth++
+		case "[":
+			if depth == 0 {
+				open = j
+			}
+			depth--
+		case "{", "}":
+			if d.code[j].Kind == pipeline.TokenPunct {
+				return attrContext{}, false
+			}
+		}
+	}
+	if open < 0 {
+		return attrContext{}, false
+	}
+
+	ac := attrContext{kind: "graph", present: map[string]bool{}}
+	// The owner precedes the first of the statement's attribute lists.
+	j := open - 1
+	for j >= 0 && d.code[j].Text == "]" {
+		for j >= 0 && d.code[j].Text != "[" {
+			j--
+		}
+		j--
+	}
+	switch owner := d.tokText(j); {
+	case j < 0:
+	case owner == "}":
+		ac.kind = "edge"
+	case d.code[j].Kind != pipeline.TokenID:
+	case d.tokText(j-1) == "->" || d.tokText(j-1) == "--":
+		ac.kind = "edge"
+	case strings.EqualFold(owner, "node"):
+		ac.kind = "node"
+	case strings.EqualFold(owner, "edge"):
+		ac.kind = "edge"
+	case strings.EqualFold(owner, "graph"):
+	default:
+		ac.kind = "node"
+		ac.node = unquote(owner)
+	}
+
+	for k := open + 1; k < len(d.code); k++ {
+		t := d.code[k]
+		if t.Kind == pipeline.TokenEOF || t.Kind == pipeline.TokenPunct && strings.Contains("[]{}", t.Text) {
+			break
+		}
+		if k == word || t.Kind != pipeline.TokenID || d.tokText(k+1) != "=" {
+			continue
+		}
+		name := unquote(t.Text)
+		ac.present[name] = true
+		if name == "type" && k+2 != word && d.code[k+2].Kind == pipeline.TokenID {
+			ac.nodeType = unquote(d.code[k+2].Text)
+		}
+	}
+	if ac.nodeType == "" && ac.node != "" && d.last != nil {
+		if n, ok := d.last.Nodes[ac.node]; ok {
+			ac.nodeType = string(n.Type)
+		}
+	}
+	if next >= 2 && d.tokText(next-1) == "=" && d.code[next-2].Kind == pipeline.TokenID {
+		ac.attr = unquote(d.code[next-2].Text)
+	}
+	return ac, true
+}
+
+// unquote strips the quotes from a quoted DOT ID.
+func unquote(s string) string {
+	if len(s) >= 2 && s[0] == '"' && s[len(s)-1] == '"' {
+		return strings.ReplaceAll(s[1:len(s)-1], `\"`, `"`)
+	}
+	return s
+}
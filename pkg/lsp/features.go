@@ -0,0 +1,315 @@
+package lsp
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/ravi-parthasarathy/attractor/pkg/pipeline"
+)
+
+// edgeAttrs are the attributes the engine reads on edges.
+var edgeAttrs = []pipeline.AttrSchema{
+	{Name: "label", Type: pipeline.AttrCondition, Description: "Condition under which the edge is followed"},
+	{Name: "on", Type: pipeline.AttrEnum, Enum: []string{pipeline.EdgeOnFailure, pipeline.EdgeOnExhausted},
+		Description: "Follow the edge when the source node fails, or once it has reached max_visits, instead of on success"},
+}
+
+// attrsFor returns the attributes a list of kind ac.kind accepts.
+func attrsFor(ac attrContext) []pipeline.AttrSchema {
+	switch ac.kind {
+	case "edge":
+		return edgeAttrs
+	case "node":
+		s, _ := pipeline.LookupSchema(pipeline.NodeType(ac.nodeType))
+		return append(slices.Clone(s.Attrs), pipeline.CommonAttrs...)
+	}
+	return nil
+}
+
+func findAttr(attrs []pipeline.AttrSchema, name string) *pipeline.AttrSchema {
+	for i := range attrs {
+		if attrs[i].Name == name {
+			return &attrs[i]
+		}
+	}
+	return nil
+}
+
+// ─── Completion ───────────────────────────────────────────────────────────────
+
+// complete suggests attribute names inside an attribute list, and values
+// after an = for node types, enums and booleans.  It works from tokens
+// rather than the parsed pipeline, so it works on text that does not
+// parse yet.
+func (d *document) complete(pos pipeline.Pos) []completionItem {
+	items := []completionItem{}
+	ac, ok := d.attrContextAt(pos)
+	if !ok {
+		return items
+	}
+	attrs := attrsFor(ac)
+
+	if ac.attr != "" {
+		if ac.kind == "node" && ac.attr == "type" {
+			for _, s := range pipeline.Schemas() {
+				items = append(items, completionItem{
+					Label:         string(s.Type),
+					Kind:          kindClass,
+					Detail:        s.Description,
+					Documentation: &markupContent{Kind: "markdown", Value: typeDoc(s)},
+				})
+			}
+			return items
+		}
+		a := findAttr(attrs, ac.attr)
+		switch {
+		case a == nil:
+		case a.Type == pipeline.AttrEnum:
+			for _, v := range a.Enum {
+				items = append(items, completionItem{Label: v, Kind: kindEnumMember})
+			}
+		case a.Type == pipeline.AttrBool:
+			for _, v := range []string{"true", "false"} {
+				items = append(items, completionItem{Label: v, Kind: kindValue})
+			}
+		}
+		return items
+	}
+
+	for _, a := range attrs {
+		if ac.present[a.Name] {
+			continue
+		}
+		items = append(items, completionItem{
+			Label:         a.Name,
+			Kind:          kindProperty,
+			Detail:        attrDetail(a),
+			Documentation: &markupContent{Kind: "markdown", Value: a.Description},
+		})
+	}
+	return items
+}
+
+// attrDetail summarises the type of a and its default.
+func attrDetail(a pipeline.AttrSchema) string {
+	s := string(a.Type)
+	if len(a.Enum) > 0 {
+		s += " (" + strings.Join(a.Enum, "|") + ")"
+	}
+	switch {
+	case a.Required:
+		s += ", required"
+	case a.Default != "":
+		s += ", default " + a.Default
+	}
+	return s
+}
+
+// ─── Hover ────────────────────────────────────────────────────────────────────
+
+// hover documents the token at pos: a node type value, an attribute name,
+// or a node ID.
+func (d *document) hover(pos pipeline.Pos) (*hover, bool) {
+	word, _ := d.tokenAt(pos)
+	if word < 0 {
+		return nil, false
+	}
+	tok := d.code[word]
+	rng := d.toRange(tok.Span)
+	text := unquote(tok.Text)
+	doc := func(md string) (*hover, bool) {
+		return &hover{Contents: markupContent{Kind: "markdown", Value: md}, Range: &rng}, true
+	}
+
+	if ac, ok := d.attrContextAt(pos); ok {
+		switch {
+		case ac.attr == "" && d.tokText(word+1) == "=":
+			if a := findAttr(attrsFor(ac), text); a != nil {
+				return doc(fmt.Sprintf("**%s** `%s`\n\n%s", a.Name, attrDetail(*a), a.Description))
+			}
+		case ac.attr == "type" && ac.kind == "node":
+			if s, ok := pipeline.LookupSchema(pipeline.NodeType(text)); ok {
+				return doc(typeDoc(s))
+			}
+		}
+		return nil, false
+	}
+
+	if d.p == nil {
+		return nil, false
+	}
+	if n := d.nodeAt(pos); n != nil {
+		md := fmt.Sprintf("**%s**: node of type `%s`", n.ID, n.Type)
+		if s, ok := pipeline.LookupSchema(n.Type); ok {
+			md += "\n\n" + s.Description
+		}
+		return doc(md)
+	}
+	return nil, false
+}
+
+// typeDoc is the markdown documentation of a node type: its description
+// and a table of its attributes.
+func typeDoc(s pipeline.NodeSchema) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "**%s**: %s\n", s.Type, s.Description)
+	if len(s.Attrs) > 0 {
+		sb.WriteString("\n| attribute | type | default | description |\n|---|---|---|---|\n")
+		for _, a := range s.Attrs {
+			def := ""
+			switch {
+			case a.Required:
+				def = "(required)"
+			case a.Default != "":
+				def = "`" + a.Default + "`"
+			}
+			typ := string(a.Type)
+			if len(a.Enum) > 0 {
+				typ += " (" + strings.Join(a.Enum, "\\|") + ")"
+			}
+			fmt.Fprintf(&sb, "| `%s` | %s | %s | %s |\n", a.Name, typ, def, a.Description)
+		}
+	}
+	return sb.String()
+}
+
+// nodeAt returns the node whose ID is at pos in a node statement or an
+// edge.
+func (d *document) nodeAt(pos pipeline.Pos) *pipeline.Node {
+	if d.p == nil {
+		return nil
+	}
+	for _, n := range d.p.Nodes {
+		for _, ref := range n.Refs {
+			if ref.Contains(pos) || ref.End == pos {
+				return n
+			}
+		}
+	}
+	return nil
+}
+
+// ─── Definition ───────────────────────────────────────────────────────────────
+
+// keyRef matches the context key paths a template references, such as
+// .user.name.
+var keyRef = regexp.MustCompile(`\.[A-Za-z_][A-Za-z0-9_]*(?:\.[A-Za-z_][A-Za-z0-9_]*)*`)
+
+// definition finds, for a {{.key}} reference at pos, the nodes that write
+// the key, and for a node ID, the node's definition.
+func (d *document) definition(pos pipeline.Pos) []location {
+	locs := []location{}
+	if d.p == nil {
+		return locs
+	}
+	if path := d.templateKeyAt(pos); path != "" {
+		root, _, _ := strings.Cut(path, ".")
+		for _, n := range d.p.Writers(path) {
+			span := n.Span
+			// Point at the attribute that names the key, if one does.
+			for name, v := range n.Attrs {
+				if s, ok := n.AttrSpans[name]; ok && slices.Contains(splitKeys(v), root) {
+					span = s
+					break
+				}
+			}
+			locs = append(locs, location{URI: d.uri, Range: d.toRange(span)})
+		}
+		return locs
+	}
+	if n := d.nodeAt(pos); n != nil {
+		locs = append(locs, location{URI: d.uri, Range: d.toRange(n.Span)})
+	}
+	return locs
+}
+
+func splitKeys(v string) []string {
+	keys := strings.Split(v, ",")
+	for i := range keys {
+		keys[i] = strings.TrimSpace(keys[i])
+	}
+	return keys
+}
+
+// templateKeyAt returns the context key path referenced at pos inside a
+// {{ }} action of a string, without its leading dot, or "".
+func (d *document) templateKeyAt(pos pipeline.Pos) string {
+	word, _ := d.tokenAt(pos)
+	if word < 0 {
+		return ""
+	}
+	tok := d.code[word]
+	// Find the byte offset of pos in the token's text.
+	off, at := 0, tok.Span.Start
+	for off < len(tok.Text) && at.Before(pos) {
+		r, size := utf8.DecodeRuneInString(tok.Text[off:])
+		if r == '\n' {
+			at = pipeline.Pos{Line: at.Line + 1, Col: 1}
+		} else {
+			at.Col++
+		}
+		off += size
+	}
+	open := strings.LastIndex(tok.Text[:off], "{{")
+	if open < 0 || strings.Contains(tok.Text[open:off], "}}") {
+		return ""
+	}
+	end := strings.Index(tok.Text[off:], "}}")
+	if end < 0 {
+		return ""
+	}
+	action := tok.Text[open : off+end]
+	cursor := off - open
+	refs := keyRef.FindAllStringIndex(action, -1)
+	for _, m := range refs {
+		if m[0] <= cursor && cursor <= m[1] {
+			return action[m[0]+1 : m[1]]
+		}
+	}
+	if len(refs) == 1 {
+		return action[refs[0][0]+1 : refs[0][1]]
+	}
+	return ""
+}
+
+// ─── Rename ───────────────────────────────────────────────────────────────────
+
+// rename replaces every mention of the node ID at pos with newName.
+func (d *document) rename(pos pipeline.Pos, newName string) (*workspaceEdit, error) {
+	if d.p == nil {
+		return nil, fmt.Errorf("cannot rename in a pipeline that does not parse: %v", d.err)
+	}
+	n := d.nodeAt(pos)
+	if n == nil {
+		return nil, fmt.Errorf("no node ID at %s", pos)
+	}
+	newName = unquote(strings.TrimSpace(newName))
+	if newName == "" {
+		return nil, fmt.Errorf("node ID must not be empty")
+	}
+	if _, ok := d.p.Nodes[newName]; ok && newName != n.ID {
+		return nil, fmt.Errorf("node %q already exists", newName)
+	}
+	text := quoteID(newName)
+	edits := []textEdit{}
+	for _, ref := range n.Refs {
+		edits = append(edits, textEdit{Range: d.toRange(ref), NewText: text})
+	}
+	return &workspaceEdit{Changes: map[string][]textEdit{d.uri: edits}}, nil
+}
+
+// quoteID quotes id unless DOT reads it as a plain identifier.
+func quoteID(id string) string {
+	plain := !unicode.IsDigit([]rune(id)[0])
+	for _, r := range id {
+		plain = plain && (r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r))
+	}
+	if plain && !slices.Contains([]string{"node", "edge", "graph", "digraph", "subgraph", "strict"}, strings.ToLower(id)) {
+		return id
+	}
+	return `"` + strings.ReplaceAll(id, `"`, `\"`) + `"`
+}
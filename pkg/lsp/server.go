@@ -0,0 +1,207 @@
+package lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+
+	"github.com/ravi-parthasarathy/attractor/pkg/pipeline"
+)
+
+// Server answers LSP requests for the pipeline documents an editor has
+// open.  It handles one message at a time, in the order they arrive.
+type Server struct {
+	reg  pipeline.HandlerRegistry
+	docs map[string]*document
+	out  io.Writer
+}
+
+// NewServer returns a server that lints documents against reg, which may
+// be nil to skip checking that node types have handlers.
+func NewServer(reg pipeline.HandlerRegistry) *Server {
+	return &Server{reg: reg, docs: map[string]*document{}}
+}
+
+// Serve reads requests from r and writes responses and diagnostics to w
+// until r is exhausted or the client sends exit.
+func (s *Server) Serve(r io.Reader, w io.Writer) error {
+	s.out = w
+	br := bufio.NewReader(r)
+	for {
+		msg, err := readMessage(br)
+		var rpcErr *rpcError
+		switch {
+		case errors.Is(err, io.EOF):
+			return nil
+		case errors.As(err, &rpcErr):
+			if err := s.reply(nil, nil, rpcErr); err != nil {
+				return err
+			}
+			continue
+		case err != nil:
+			return fmt.Errorf("read message: %w", err)
+		}
+		if msg.Method == "" {
+			continue // a response to a request of ours; we send none
+		}
+		if msg.Method == "exit" {
+			return nil
+		}
+
+		result, err := s.handle(msg)
+		if msg.ID == nil {
+			if err != nil {
+				slog.Warn("lsp notification failed", "method", msg.Method, "err", err)
+			}
+			continue
+		}
+		if err != nil && !errors.As(err, &rpcErr) {
+			rpcErr = &rpcError{Code: codeRequestFailed, Message: err.Error()}
+		}
+		if err := s.reply(msg.ID, result, rpcErr); err != nil {
+			return err
+		}
+	}
+}
+
+func (s *Server) reply(id json.RawMessage, result any, rpcErr *rpcError) error {
+	if id == nil {
+		id = json.RawMessage("null")
+	}
+	switch {
+	case rpcErr != nil:
+		result = nil // a response has a result or an error, not both
+	case result == nil:
+		result = json.RawMessage("null")
+	}
+	return writeMessage(s.out, &message{ID: id, Result: result, Error: rpcErr})
+}
+
+func (s *Server) notify(method string, params any) error {
+	data, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+	return writeMessage(s.out, &message{Method: method, Params: data})
+}
+
+// handle dispatches one request or notification.
+func (s *Server) handle(msg *message) (any, error) {
+	switch msg.Method {
+	case "initialize":
+		return map[string]any{
+			"capabilities": map[string]any{
+				"textDocumentSync": 1, // full
+				"completionProvider": map[string]any{
+					"triggerCharacters": []string{"[", " ", ",", "="},
+				},
+				"hoverProvider":      true,
+				"definitionProvider": true,
+				"renameProvider":     true,
+			},
+			"serverInfo": map[string]any{"name": "attractor"},
+		}, nil
+	case "initialized", "$/cancelRequest", "$/setTrace", "workspace/didChangeConfiguration", "textDocument/didSave":
+		return nil, nil
+	case "shutdown":
+		return nil, nil
+
+	case "textDocument/didOpen":
+		var p didOpenParams
+		if err := unmarshalParams(msg, &p); err != nil {
+			return nil, err
+		}
+		return nil, s.update(p.TextDocument.URI, p.TextDocument.Text)
+	case "textDocument/didChange":
+		var p didChangeParams
+		if err := unmarshalParams(msg, &p); err != nil {
+			return nil, err
+		}
+		if len(p.ContentChanges) == 0 {
+			return nil, nil
+		}
+		// With full sync, the last change holds the whole text.
+		return nil, s.update(p.TextDocument.URI, p.ContentChanges[len(p.ContentChanges)-1].Text)
+	case "textDocument/didClose":
+		var p didCloseParams
+		if err := unmarshalParams(msg, &p); err != nil {
+			return nil, err
+		}
+		delete(s.docs, p.TextDocument.URI)
+		return nil, s.notify("textDocument/publishDiagnostics",
+			publishDiagnosticsParams{URI: p.TextDocument.URI, Diagnostics: []diagnostic{}})
+
+	case "textDocument/completion":
+		d, pos, err := s.position(msg)
+		if err != nil {
+			return nil, err
+		}
+		return completionList{Items: d.complete(pos)}, nil
+	case "textDocument/hover":
+		d, pos, err := s.position(msg)
+		if err != nil {
+			return nil, err
+		}
+		if h, ok := d.hover(pos); ok {
+			return h, nil
+		}
+		return nil, nil
+	case "textDocument/definition":
+		d, pos, err := s.position(msg)
+		if err != nil {
+			return nil, err
+		}
+		return d.definition(pos), nil
+	case "textDocument/rename":
+		var p renameParams
+		if err := unmarshalParams(msg, &p); err != nil {
+			return nil, err
+		}
+		d, err := s.doc(p.TextDocument.URI)
+		if err != nil {
+			return nil, err
+		}
+		return d.rename(d.fromPosition(p.Position), p.NewName)
+	}
+	return nil, &rpcError{Code: codeMethodNotFound, Message: fmt.Sprintf("method %q is not supported", msg.Method)}
+}
+
+// update replaces the text of a document and publishes its diagnostics.
+func (s *Server) update(uri, text string) error {
+	d := newDocument(uri, text, s.docs[uri])
+	s.docs[uri] = d
+	return s.notify("textDocument/publishDiagnostics",
+		publishDiagnosticsParams{URI: uri, Diagnostics: d.diagnostics(s.reg)})
+}
+
+func (s *Server) doc(uri string) (*document, error) {
+	d, ok := s.docs[uri]
+	if !ok {
+		return nil, &rpcError{Code: codeInvalidParams, Message: fmt.Sprintf("document %s is not open", uri)}
+	}
+	return d, nil
+}
+
+// position reads the document and position of a text document position
+// request.
+func (s *Server) position(msg *message) (*document, pipeline.Pos, error) {
+	var p textDocumentPositionParams
+	if err := unmarshalParams(msg, &p); err != nil {
+		return nil, pipeline.Pos{}, err
+	}
+	d, err := s.doc(p.TextDocument.URI)
+	if err != nil {
+		return nil, pipeline.Pos{}, err
+	}
+	return d, d.fromPosition(p.Position), nil
+}
+
+func unmarshalParams(msg *message, v any) error {
+	if err := json.Unmarshal(msg.Params, v); err != nil {
+		return &rpcError{Code: codeInvalidParams, Message: err.Error()}
+	}
+	return nil
+}
@@ -0,0 +1,217 @@
+package lsp_test
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/ravi-parthasarathy/attractor/pkg/lsp"
+	_ "github.com/ravi-parthasarathy/attractor/pkg/pipeline/handlers"
+)
+
+const uri = "file:///p.dot"
+
+// session runs a server over requests, each a method and its params, and
+// returns what it wrote: responses keyed by the index of their request,
+// and every notification.
+func session(t *testing.T, requests ...any) (map[int]json.RawMessage, []map[string]json.RawMessage) {
+	t.Helper()
+	var in bytes.Buffer
+	for i := 0; i < len(requests); i += 2 {
+		msg := map[string]any{"jsonrpc": "2.0", "method": requests[i], "params": requests[i+1]}
+		if !strings.HasPrefix(requests[i].(string), "textDocument/did") {
+			msg["id"] = i / 2
+		}
+		body, _ := json.Marshal(msg)
+		fmt.Fprintf(&in, "Content-Length: %d\r\n\r\n%s", len(body), body)
+	}
+	var out bytes.Buffer
+	if err := lsp.NewServer(nil).Serve(&in, &out); err != nil {
+		t.Fatalf("Serve: %v", err)
+	}
+
+	results := map[int]json.RawMessage{}
+	var notes []map[string]json.RawMessage
+	r := bufio.NewReader(&out)
+	for {
+		header, err := textproto.NewReader(r).ReadMIMEHeader()
+		if err == io.EOF {
+			return results, notes
+		}
+		if err != nil {
+			t.Fatalf("read header: %v", err)
+		}
+		n, _ := strconv.Atoi(header.Get("Content-Length"))
+		body := make([]byte, n)
+		if _, err := io.ReadFull(r, body); err != nil {
+			t.Fatalf("read body: %v", err)
+		}
+		var msg map[string]json.RawMessage
+		if err := json.Unmarshal(body, &msg); err != nil {
+			t.Fatalf("unmarshal %s: %v", body, err)
+		}
+		if id, ok := msg["id"]; ok {
+			i, _ := strconv.Atoi(string(id))
+			if e, ok := msg["error"]; ok {
+				results[i] = e
+			} else {
+				results[i] = msg["result"]
+			}
+		} else {
+			notes = append(notes, msg)
+		}
+	}
+}
+
+func open(text string) map[string]any {
+	return map[string]any{"textDocument": map[string]any{"uri": uri, "languageId": "dot", "version": 1, "text": text}}
+}
+
+func at(line, char int) map[string]any {
+	return map[string]any{"textDocument": map[string]any{"uri": uri}, "position": map[string]any{"line": line, "character": char}}
+}
+
+const src = `digraph p {
+  start [type=start]
+  greet [type=set key=greeting value="hi"]
+  say   [type=exec cmd="echo {{.greeting}}" ]
+  exit  [type=exit]
+  start -> greet -> say
+  say -> exit
+}`
+
+func TestDiagnostics(t *testing.T) {
+	_, notes := session(t,
+		"textDocument/didOpen", open(strings.Replace(src, `cmd=`, `timeout=soon cmd=`, 1)),
+		"textDocument/didChange", map[string]any{
+			"textDocument":   map[string]any{"uri": uri, "version": 2},
+			"contentChanges": []any{map[string]any{"text": "digraph p {\n  a -> \n}"}},
+		},
+	)
+	if len(notes) != 2 {
+		t.Fatalf("got %d notifications, want 2", len(notes))
+	}
+	var diags struct {
+		URI         string `json:"uri"`
+		Diagnostics []struct {
+			Range struct {
+				Start struct{ Line, Character int } `json:"start"`
+			} `json:"range"`
+			Severity int    `json:"severity"`
+			Code     string `json:"code"`
+			Message  string `json:"message"`
+		} `json:"diagnostics"`
+	}
+	json.Unmarshal(notes[0]["params"], &diags)
+	if len(diags.Diagnostics) != 1 || diags.Diagnostics[0].Code != "attr-value" ||
+		diags.Diagnostics[0].Range.Start.Line != 3 || diags.Diagnostics[0].Range.Start.Character != 19 {
+		t.Errorf("didOpen diagnostics = %+v", diags)
+	}
+	json.Unmarshal(notes[1]["params"], &diags)
+	if len(diags.Diagnostics) != 1 || diags.Diagnostics[0].Code != "parse" || diags.Diagnostics[0].Severity != 1 ||
+		diags.Diagnostics[0].Range.Start.Line != 2 {
+		t.Errorf("didChange diagnostics = %+v", diags)
+	}
+}
+
+func labels(t *testing.T, result json.RawMessage) []string {
+	t.Helper()
+	var list struct {
+		Items []struct{ Label string } `json:"items"`
+	}
+	if err := json.Unmarshal(result, &list); err != nil {
+		t.Fatalf("unmarshal %s: %v", result, err)
+	}
+	var out []string
+	for _, it := range list.Items {
+		out = append(out, it.Label)
+	}
+	return out
+}
+
+func TestCompletion(t *testing.T) {
+	text := "digraph p {\n  a [type=\n  b [type=set \n  a -> b [on=\n}"
+	results, _ := session(t,
+		"textDocument/didOpen", open(text),
+		"textDocument/completion", at(1, 10),
+		"textDocument/completion", at(2, 14),
+		"textDocument/completion", at(3, 13),
+	)
+	types := labels(t, results[1])
+	for _, want := range []string{"exec", "set", "start"} {
+		if !strings.Contains(strings.Join(types, " "), want) {
+			t.Errorf("type completion %v lacks %q", types, want)
+		}
+	}
+	attrs := strings.Join(labels(t, results[2]), " ")
+	if !strings.Contains(attrs, "key") || !strings.Contains(attrs, "retry_max") || strings.Contains(attrs, "type") {
+		t.Errorf("set attribute completion = %s", attrs)
+	}
+	if got := strings.Join(labels(t, results[3]), " "); got != "failure exhausted" {
+		t.Errorf("edge on completion = %q", got)
+	}
+}
+
+func TestHoverDefinitionRename(t *testing.T) {
+	results, _ := session(t,
+		"textDocument/didOpen", open(src),
+		"textDocument/hover", at(3, 14),
+		"textDocument/definition", at(3, 34),
+		"textDocument/rename", map[string]any{
+			"textDocument": map[string]any{"uri": uri}, "position": map[string]any{"line": 5, "character": 12},
+			"newName": "greet-user",
+		},
+		"textDocument/rename", map[string]any{
+			"textDocument": map[string]any{"uri": uri}, "position": map[string]any{"line": 5, "character": 12},
+			"newName": "say",
+		},
+		"textDocument/frobnicate", map[string]any{},
+	)
+
+	var h struct {
+		Contents struct{ Value string } `json:"contents"`
+	}
+	json.Unmarshal(results[1], &h)
+	if !strings.HasPrefix(h.Contents.Value, "**exec**: ") || !strings.Contains(h.Contents.Value, "| `cmd` |") {
+		t.Errorf("hover = %q", h.Contents.Value)
+	}
+
+	type rng struct {
+		Start struct{ Line, Character int } `json:"start"`
+		End   struct{ Line, Character int } `json:"end"`
+	}
+	var locs []struct{ Range rng }
+	json.Unmarshal(results[2], &locs)
+	if len(locs) != 1 || locs[0].Range.Start.Line != 2 || locs[0].Range.Start.Character != 18 {
+		t.Errorf("definition = %s, want key=greeting on line 2", results[2])
+	}
+
+	var edit struct {
+		Changes map[string][]struct {
+			Range   rng
+			NewText string
+		} `json:"changes"`
+	}
+	json.Unmarshal(results[3], &edit)
+	edits := edit.Changes[uri]
+	if len(edits) != 2 || edits[0].NewText != `"greet-user"` {
+		t.Fatalf("rename = %s", results[3])
+	}
+	for i, line := range []int{2, 5} {
+		if edits[i].Range.Start.Line != line {
+			t.Errorf("rename edit %d on line %d, want %d", i, edits[i].Range.Start.Line, line)
+		}
+	}
+	if !strings.Contains(string(results[4]), `node \"say\" already exists`) {
+		t.Errorf("rename to an existing node = %s", results[4])
+	}
+	if !strings.Contains(string(results[5]), "-32601") {
+		t.Errorf("unknown method = %s", results[5])
+	}
+}
@@ -29,6 +29,7 @@ const (
 	NodeTypeStringTransform NodeType = "string_transform"
 	NodeTypeForEach         NodeType = "for_each"
 	NodeTypeInclude         NodeType = "include"
+	NodeTypeMapPipeline     NodeType = "map_pipeline"
 )
 
 // Node represents a single vertex in the pipeline graph.
@@ -36,21 +37,58 @@ type Node struct {
 	ID    string
 	Type  NodeType
 	Attrs map[string]string // all DOT attributes
+	// Span is where the node is defined: its ID in its first node
+	// statement, or where it is first mentioned if it has none.  AttrSpans
+	// holds the name=value span of each attribute that set Attrs.  Both are
+	// zero for pipelines built in code.
+	Span      Span
+	AttrSpans map[string]Span
+	// Refs lists every place the node's ID appears in a node statement or
+	// as an edge endpoint, in source order.
+	Refs []Span
 }
 
+// Edge trigger values for the "on" edge attribute.
+const (
+	// EdgeOnFailure marks an edge that is only followed when its source node
+	// fails (after any retries are exhausted).
+	EdgeOnFailure = "failure"
+	// EdgeOnExhausted marks an edge that is followed instead of running its
+	// source node once that node has reached its max_visits limit.
+	EdgeOnExhausted = "exhausted"
+)
+
 // Edge is a directed connection between two nodes.
 type Edge struct {
 	From      string
 	To        string
 	Condition string // empty means unconditional
+	On        string // "" for the normal success path, EdgeOnFailure or EdgeOnExhausted
+	// Span runs from the source node ID to the target node ID of the edge
+	// statement; AttrSpans is as for Node.
+	Span      Span
+	AttrSpans map[string]Span
 }
 
-// Pipeline is the parsed representation of a .dot pipeline file.
+// Pipeline is the parsed representation of a pipeline file, whether it
+// is written in DOT, YAML or JSON.
 type Pipeline struct {
 	Name       string
 	Nodes      map[string]*Node
 	Edges      []*Edge
 	Stylesheet *Stylesheet
+	Attrs      map[string]string // graph-level DOT attributes
+	// Params are the variables the pipeline declares, in declaration
+	// order; see ParamsSubgraph.
+	Params []*Param
+	// Fingerprint is the hex SHA-256 of the source the pipeline was parsed
+	// from, or "" for pipelines built in code.  Checkpoints record it so
+	// that resuming can detect a changed pipeline.
+	Fingerprint string
+	// Span covers the graph header, such as digraph name, and AttrSpans
+	// the graph attributes.  Both are zero for pipelines built in code.
+	Span      Span
+	AttrSpans map[string]Span
 }
 
 // OutgoingEdges returns all edges leaving nodeID, in definition order.
@@ -0,0 +1,135 @@
+package pipeline
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+)
+
+// FanOutState records the branches of a fan_out that was running when a
+// checkpoint was written.  Resuming from such a checkpoint restores the
+// branches that had reached the fan_in and re-launches the others after their
+// last completed node.
+type FanOutState struct {
+	// Node is the fan_out node.
+	Node     string         `json:"node"`
+	Branches []*BranchState `json:"branches"`
+}
+
+// BranchState is the progress of one fan_out branch.
+type BranchState struct {
+	// Start is the first node of the branch.
+	Start string `json:"start"`
+	// LastNodeID is the branch's last completed node and Next the edge it
+	// chose after it; both are empty until the branch completes a node.
+	LastNodeID string          `json:"last_node_id,omitempty"`
+	Next       *CheckpointEdge `json:"next,omitempty"`
+	// Done is set once the branch has reached the fan_in.
+	Done bool `json:"done,omitempty"`
+	// Data holds the context keys the branch has written so far.
+	Data map[string]any `json:"data,omitempty"`
+}
+
+// resumeAt returns the node a branch restarts at.
+func (b *BranchState) resumeAt() string {
+	switch {
+	case b.Next != nil:
+		return b.Next.To
+	case b.LastNodeID != "":
+		// No edge was recorded; run the node again to select one.
+		return b.LastNodeID
+	}
+	return b.Start
+}
+
+// fanOutProgress tracks the branches of a running fan_out and checkpoints
+// the parent run each time one of them advances.
+type fanOutProgress struct {
+	mu    sync.Mutex
+	e     *Engine
+	pctx  *PipelineContext // the fan_out's input context
+	base  map[string]any   // snapshot of pctx
+	state FanOutState
+}
+
+// newFanOutProgress starts tracking the branches of node that begin at the
+// targets of edges, picking up the progress in resume if it is non-nil.
+func newFanOutProgress(e *Engine, node string, pctx *PipelineContext, base map[string]any, edges []*Edge, resume *FanOutState) *fanOutProgress {
+	p := &fanOutProgress{e: e, pctx: pctx, base: base, state: FanOutState{Node: node}}
+	recorded := make(map[string]*BranchState)
+	if resume != nil {
+		for _, b := range resume.Branches {
+			recorded[b.Start] = b
+		}
+	}
+	for _, edge := range edges {
+		b, ok := recorded[edge.To]
+		if !ok {
+			b = &BranchState{Start: edge.To}
+		}
+		p.state.Branches = append(p.state.Branches, b)
+	}
+	return p
+}
+
+// stepper returns the function a branch engine checkpoints through: it
+// records the branch's latest node and writes, then saves the parent run.
+func (p *fanOutProgress) stepper(b *BranchState) func(context.Context, *PipelineContext, Checkpoint) error {
+	return func(ctx context.Context, branchCtx *PipelineContext, cp Checkpoint) error {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		b.LastNodeID, b.Next = cp.LastNodeID, cp.Next
+		b.Data = p.writes(branchCtx)
+		return p.save(ctx)
+	}
+}
+
+// finish records that branch b has reached the fan_in.
+func (p *fanOutProgress) finish(ctx context.Context, b *BranchState, branchCtx *PipelineContext) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	b.Done = true
+	b.Data = p.writes(branchCtx)
+	return p.save(ctx)
+}
+
+// writes returns the keys branchCtx holds that differ from the fan_out's
+// input.
+func (p *fanOutProgress) writes(branchCtx *PipelineContext) map[string]any {
+	snap := branchCtx.Snapshot()
+	data := make(map[string]any)
+	for _, k := range changedKeys(p.base, snap) {
+		data[k] = snap[k]
+	}
+	return data
+}
+
+// save checkpoints the parent run at the fan_out; p.mu must be held.
+func (p *fanOutProgress) save(ctx context.Context) error {
+	if err := p.e.saveCheckpoint(ctx, p.pctx, Checkpoint{LastNodeID: p.state.Node, FanOut: &p.state}); err != nil {
+		return fmt.Errorf("save checkpoint: %w", err)
+	}
+	return nil
+}
+
+// resumedEdges returns the edges of fan_out node that start the branches
+// recorded in resume, in edge order.
+func resumedEdges(node string, edges []*Edge, resume *FanOutState) ([]*Edge, error) {
+	starts := make(map[string]bool)
+	for _, b := range resume.Branches {
+		starts[b.Start] = true
+	}
+	var out []*Edge
+	for _, edge := range edges {
+		if edge.On == "" && starts[edge.To] {
+			out = append(out, edge)
+			delete(starts, edge.To)
+		}
+	}
+	for start := range starts {
+		return nil, fmt.Errorf("fan_out node %q: checkpointed branch %q is no longer one of its edges", node, start)
+	}
+	slog.Info("resuming fan_out branches", "node", node, "branches", len(out))
+	return out, nil
+}
@@ -0,0 +1,259 @@
+package pipeline
+
+import "time"
+
+// DefaultHTTPTimeout is the time limit of an http node that sets no
+// timeout.
+const DefaultHTTPTimeout = 30 * time.Second
+
+// builtinSchemas describe the node types of the built-in handlers, so that
+// Validate checks their attributes whether or not the handlers package is
+// linked in.  The handlers return them from Schema.
+var builtinSchemas = []NodeSchema{
+	{
+		Type:        NodeTypeStart,
+		Description: "Entry point; exactly one per pipeline",
+		Attrs: []AttrSchema{
+			{Name: "seed", Type: AttrString, Description: "Value stored in seed when the run is given none"},
+		},
+	},
+	{
+		Type:        NodeTypeExit,
+		Description: "Normal termination; exactly one per pipeline",
+	},
+	{
+		Type:        NodeTypeCodergen,
+		Description: "LLM coding-agent loop with file and shell tools",
+		Attrs: []AttrSchema{
+			{Name: "prompt", Type: AttrTemplate, Description: "Task for the agent; the seed when unset"},
+			{Name: "system_prompt", Type: AttrString, Description: "System prompt for the agent"},
+			{Name: "max_turns", Type: AttrInt, Description: "Most agent turns"},
+		},
+	},
+	{
+		Type:        NodeTypeHuman,
+		Description: "Pause and read a line from stdin",
+		Attrs: []AttrSchema{
+			{Name: "prompt", Type: AttrString, Description: "Text shown to the user"},
+			{Name: "key", Type: AttrKey, Default: "<id>_response", Description: "Context key for the response"},
+			{Name: "options", Type: AttrString, Description: "Comma-separated choices; the edge labelled with the chosen one is followed"},
+		},
+	},
+	{
+		Type:        NodeTypeSet,
+		Description: "Render a template and store it in a context key",
+		Attrs: []AttrSchema{
+			{Name: "key", Type: AttrKey, Required: true, Description: "Context key to write"},
+			{Name: "value", Type: AttrTemplate, Description: "Template for the value"},
+		},
+	},
+	{
+		Type:        NodeTypeFanOut,
+		Description: "Fork to the selected outgoing edges in parallel",
+		Attrs: []AttrSchema{
+			{Name: "join", Type: AttrString, Description: "ID of the matching fan_in node"},
+		},
+	},
+	{
+		Type:        NodeTypeFanIn,
+		Description: "Join the branches of the matching fan_out",
+		Attrs: []AttrSchema{
+			{Name: "mode", Type: AttrEnum, Enum: JoinModes, Default: JoinAll, Description: "How many branches must succeed"},
+			{Name: "quorum", Type: AttrInt, Description: "Branches that must succeed with mode=quorum"},
+			{Name: "merge", Type: AttrEnum, Enum: MergePolicies, Default: MergeLast, Description: "How writes of several branches to one key combine"},
+			{Name: "reduce", Type: AttrString, Description: "Per-key reducers, key:reducer, comma-separated"},
+		},
+	},
+	{
+		Type:        NodeTypeHTTP,
+		Description: "Make an HTTP request and store the response",
+		Attrs: []AttrSchema{
+			{Name: "url", Type: AttrTemplate, Required: true, Description: "Request URL"},
+			{Name: "method", Type: AttrString, Default: "GET", Description: "Request method"},
+			{Name: "body", Type: AttrTemplate, Description: "Request body"},
+			{Name: "headers", Type: AttrTemplate, Description: "Request headers, Name: value pairs separated by ;"},
+			{Name: "timeout", Type: AttrDuration, Default: DefaultHTTPTimeout.String(), Description: "Request timeout"},
+			{Name: "fail_non2xx", Type: AttrBool, Default: "false", Description: "Fail the node on a status outside 2xx"},
+			{Name: "response_key", Type: AttrKey, Default: "<id>_body", Description: "Context key for the response body"},
+			{Name: "status_key", Type: AttrKey, Default: "<id>_status", Description: "Context key for the status code"},
+			{Name: "json_key", Type: AttrKey, Default: "<id>_json", Description: "Context key for a JSON response, decoded"},
+		},
+	},
+	{
+		Type:        NodeTypeAssert,
+		Description: "Fail the node if a condition is false",
+		Attrs: []AttrSchema{
+			{Name: "expr", Type: AttrCondition, Required: true, Description: "Condition that must hold"},
+			{Name: "message", Type: AttrString, Description: "Error message when it does not"},
+		},
+	},
+	{
+		Type:        NodeTypeSleep,
+		Description: "Pause for a duration",
+		Attrs: []AttrSchema{
+			{Name: "duration", Type: AttrDuration, Required: true, Description: "How long to pause"},
+		},
+	},
+	{
+		Type:        NodeTypeSwitch,
+		Description: "Follow the edge whose label equals the value of a context key",
+		Attrs: []AttrSchema{
+			{Name: "key", Type: AttrKey, Required: true, Description: "Context key to route on"},
+		},
+	},
+	{
+		Type:        NodeTypeEnv,
+		Description: "Read an environment variable into a context key",
+		Attrs: []AttrSchema{
+			{Name: "key", Type: AttrKey, Required: true, Description: "Context key to write"},
+			{Name: "from", Type: AttrString, Required: true, Description: "Environment variable to read"},
+			{Name: "required", Type: AttrBool, Default: "false", Description: "Fail the node when the variable is unset or empty"},
+			{Name: "default", Type: AttrString, Description: "Value used when the variable is unset or empty"},
+		},
+	},
+	{
+		Type:        NodeTypeReadFile,
+		Description: "Read a file into a context key",
+		Attrs: []AttrSchema{
+			{Name: "key", Type: AttrKey, Required: true, Description: "Context key to write"},
+			{Name: "path", Type: AttrTemplate, Required: true, Description: "File to read"},
+			{Name: "required", Type: AttrBool, Default: "true", Description: `Fail the node when the file does not exist; if false, store ""`},
+		},
+	},
+	{
+		Type:        NodeTypeWriteFile,
+		Description: "Write content to a file, creating parent directories",
+		Attrs: []AttrSchema{
+			{Name: "path", Type: AttrTemplate, Required: true, Description: "File to write"},
+			{Name: "content", Type: AttrTemplate, Required: true, Description: "Content to write"},
+			{Name: "append", Type: AttrBool, Default: "false", Description: "Append to the file instead of replacing it"},
+			{Name: "mode", Type: AttrString, Default: "0644", Description: "Octal permissions for a new file"},
+		},
+	},
+	{
+		Type:        NodeTypeJSONExtract,
+		Description: "Extract a value from a JSON string by dot-path",
+		Attrs: []AttrSchema{
+			{Name: "source", Type: AttrKey, Required: true, Description: "Context key holding the JSON"},
+			{Name: "path", Type: AttrString, Required: true, Description: "Dot-path to the value, such as .items.0.id"},
+			{Name: "key", Type: AttrKey, Required: true, Description: "Context key to write"},
+			{Name: "default", Type: AttrString, Description: "Value used when the source is empty or the path is missing"},
+		},
+	},
+	{
+		Type:        NodeTypeSplit,
+		Description: "Split a string in the context into a list",
+		Attrs: []AttrSchema{
+			{Name: "source", Type: AttrKey, Required: true, Description: "Context key to split"},
+			{Name: "key", Type: AttrKey, Required: true, Description: "Context key for the list"},
+			{Name: "sep", Type: AttrString, Default: `\n`, Description: "Separator"},
+			{Name: "trim", Type: AttrBool, Default: "false", Description: "Trim elements and drop empty ones"},
+		},
+	},
+	{
+		Type:        NodeTypeMap,
+		Description: "Run a codergen prompt for every element of a list, in parallel",
+		Attrs: []AttrSchema{
+			{Name: "items", Type: AttrKey, Required: true, Description: "Context key holding the list"},
+			{Name: "item_key", Type: AttrKey, Required: true, Description: "Key each element is bound to in the prompt"},
+			{Name: "prompt", Type: AttrTemplate, Required: true, Description: "Prompt for each element"},
+			{Name: "results_key", Type: AttrKey, Default: "<id>_results", Description: "Context key for the JSON array of outputs"},
+			{Name: "concurrency", Type: AttrInt, Description: "Most elements processed at once; 0 or unset is all"},
+			{Name: "system_prompt", Type: AttrString, Description: "System prompt for the agent"},
+			{Name: "max_turns", Type: AttrInt, Description: "Most agent turns per element"},
+		},
+	},
+	{
+		Type:        NodeTypePrompt,
+		Description: "Single-turn LLM call without tools",
+		Attrs: []AttrSchema{
+			{Name: "prompt", Type: AttrTemplate, Required: true, Description: "Prompt"},
+			{Name: "key", Type: AttrKey, Required: true, Description: "Context key for the response text"},
+			{Name: "system", Type: AttrString, Description: "System prompt"},
+			{Name: "max_tokens", Type: AttrInt, Description: "Most tokens to generate"},
+		},
+	},
+	{
+		Type:        NodeTypeJSONDecode,
+		Description: "Unpack a JSON object into context keys, keeping value types",
+		Attrs: []AttrSchema{
+			{Name: "source", Type: AttrKey, Required: true, Description: "Context key holding the object"},
+			{Name: "prefix", Type: AttrString, Description: "Prefix for the keys written"},
+		},
+	},
+	{
+		Type:        NodeTypeExec,
+		Description: "Run a shell command",
+		Attrs: []AttrSchema{
+			{Name: "cmd", Type: AttrTemplate, Required: true, Description: "Command, run with sh -c"},
+			{Name: "workdir", Type: AttrTemplate, Description: "Directory to run in"},
+			{Name: "timeout", Type: AttrDuration, Description: "Time limit for the command"},
+			{Name: "stdout_key", Type: AttrKey, Default: "<id>_stdout", Description: "Context key for stdout"},
+			{Name: "stderr_key", Type: AttrKey, Description: "Context key for stderr"},
+			{Name: "exit_code_key", Type: AttrKey, Description: "Context key for the exit code"},
+			{Name: "fail_on_error", Type: AttrBool, Default: "true", Description: "Fail the node on a non-zero exit; if false, the outcome is partial"},
+		},
+	},
+	{
+		Type:        NodeTypeJSONPack,
+		Description: "Pack context keys into a JSON object string",
+		Attrs: []AttrSchema{
+			{Name: "keys", Type: AttrKeys, Required: true, Description: "Comma-separated context keys to pack"},
+			{Name: "output", Type: AttrKey, Required: true, Description: "Context key for the JSON"},
+		},
+	},
+	{
+		Type:        NodeTypeRegex,
+		Description: "Extract a regular expression match from a context value",
+		Attrs: []AttrSchema{
+			{Name: "source", Type: AttrKey, Required: true, Description: "Context key to match against"},
+			{Name: "pattern", Type: AttrRegex, Required: true, Description: "Regular expression"},
+			{Name: "key", Type: AttrKey, Required: true, Description: "Context key to write"},
+			{Name: "group", Type: AttrInt, Default: "0", Description: "Capture group to store; 0 is the whole match"},
+			{Name: "no_match", Type: AttrString, Description: "Value stored when nothing matches"},
+		},
+	},
+	{
+		Type:        NodeTypeStringTransform,
+		Description: "Apply a chain of string operations to a context value",
+		Attrs: []AttrSchema{
+			{Name: "source", Type: AttrKey, Required: true, Description: "Context key to transform"},
+			{Name: "ops", Type: AttrString, Required: true, Description: "Comma-separated operations: trim, upper, lower, replace"},
+			{Name: "key", Type: AttrKey, Required: true, Description: "Context key to write"},
+			{Name: "old", Type: AttrTemplate, Description: "Text replace looks for"},
+			{Name: "new", Type: AttrTemplate, Description: "Text replace substitutes"},
+		},
+	},
+	{
+		Type:        NodeTypeForEach,
+		Description: "Run a shell command for every element of a list, in order",
+		Attrs: []AttrSchema{
+			{Name: "items", Type: AttrKey, Required: true, Description: "Context key holding the list"},
+			{Name: "item_key", Type: AttrKey, Required: true, Description: "Key each element is bound to in the command"},
+			{Name: "cmd", Type: AttrTemplate, Required: true, Description: "Command for each element"},
+			{Name: "results_key", Type: AttrKey, Default: "<id>_results", Description: "Context key for the JSON array of outputs"},
+			{Name: "workdir", Type: AttrTemplate, Description: "Directory to run in"},
+			{Name: "timeout", Type: AttrDuration, Description: "Time limit for each command"},
+			{Name: "fail_on_error", Type: AttrBool, Default: "true", Description: "Fail the node when a command fails"},
+		},
+	},
+	{
+		Type:        NodeTypeInclude,
+		Description: "Run another DOT file as a sub-pipeline sharing the context",
+		Attrs: []AttrSchema{
+			{Name: "path", Type: AttrTemplate, Required: true, Description: "DOT file to run"},
+		},
+	},
+	{
+		Type:        NodeTypeMapPipeline,
+		Description: "Run a DOT file for every element of a list, in parallel",
+		Attrs: []AttrSchema{
+			{Name: "items", Type: AttrKey, Required: true, Description: "Context key holding the list"},
+			{Name: "item_key", Type: AttrKey, Required: true, Description: "Key each run gets its element under"},
+			{Name: "path", Type: AttrTemplate, Required: true, Description: "DOT file to run"},
+			{Name: "results_key", Type: AttrKey, Default: "<id>_results", Description: "Context key for the JSON array of outputs"},
+			{Name: "outputs", Type: AttrKeys, Description: "Keys collected from each run; unset collects every key the run wrote"},
+			{Name: "concurrency", Type: AttrInt, Description: "Most runs at once; 0 or unset is all"},
+		},
+	},
+}
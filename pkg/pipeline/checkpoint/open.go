@@ -0,0 +1,120 @@
+// Package checkpoint provides pipeline.CheckpointStore implementations and
+// opens them from --checkpoint URIs:
+//
+//	cp.json, file://cp.json           local file (pipeline.FileStore)
+//	sqlite://runs.db?run=nightly      table in an SQLite database
+//	s3://bucket/runs/nightly.json     object in an S3-compatible store
+//
+// S3 options are given as query parameters: endpoint (for MinIO and other
+// S3-compatible servers, which are addressed path-style) and region.  They
+// default to $AWS_ENDPOINT_URL and $AWS_REGION; credentials come from
+// $AWS_ACCESS_KEY_ID, $AWS_SECRET_ACCESS_KEY and $AWS_SESSION_TOKEN.
+package checkpoint
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/ravi-parthasarathy/attractor/pkg/pipeline"
+)
+
+// Open returns the checkpoint store named by uri.  A uri without a scheme
+// is a file path.
+func Open(uri string) (pipeline.CheckpointStore, error) {
+	scheme, rest, ok := strings.Cut(uri, "://")
+	if !ok {
+		scheme, rest = "file", uri
+	}
+	switch scheme {
+	case "file":
+		if rest == "" {
+			return nil, fmt.Errorf("checkpoint %q: missing path", uri)
+		}
+		return pipeline.NewFileStore(rest), nil
+	case "sqlite":
+		path, query, _ := strings.Cut(rest, "?")
+		if path == "" {
+			return nil, fmt.Errorf("checkpoint %q: missing database path", uri)
+		}
+		q, err := url.ParseQuery(query)
+		if err != nil {
+			return nil, fmt.Errorf("checkpoint %q: %w", uri, err)
+		}
+		return OpenSQLite(path, q.Get("run"))
+	case "s3":
+		u, err := url.Parse(uri)
+		if err != nil {
+			return nil, fmt.Errorf("checkpoint %q: %w", uri, err)
+		}
+		key := strings.TrimPrefix(u.Path, "/")
+		if u.Host == "" || key == "" {
+			return nil, fmt.Errorf("checkpoint %q: want s3://bucket/key", uri)
+		}
+		q := u.Query()
+		cfg := S3Config{
+			Endpoint: firstNonEmpty(q.Get("endpoint"), os.Getenv("AWS_ENDPOINT_URL")),
+			Region:   firstNonEmpty(q.Get("region"), os.Getenv("AWS_REGION"), os.Getenv("AWS_DEFAULT_REGION")),
+			Bucket:   u.Host,
+			Key:      key,
+			Credentials: Credentials{
+				AccessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+				SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+				SessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+			},
+		}
+		return NewS3(cfg)
+	}
+	return nil, fmt.Errorf("checkpoint %q: unknown scheme %q (want file, sqlite or s3)", uri, scheme)
+}
+
+func firstNonEmpty(vals ...string) string {
+	for _, v := range vals {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// lockOwner identifies the process holding a store lock.  Stores that keep
+// their lock as data (a row, an object) record it so that a lock left behind
+// by a crashed process on the same host can be taken over.
+type lockOwner struct {
+	Host     string    `json:"host"`
+	PID      int       `json:"pid"`
+	Acquired time.Time `json:"acquired"`
+}
+
+func currentOwner() lockOwner {
+	host, _ := os.Hostname()
+	return lockOwner{Host: host, PID: os.Getpid(), Acquired: time.Now().UTC()}
+}
+
+// stale reports whether o is a process on this host that no longer exists.
+// Locks held from other hosts are never considered stale.
+func (o lockOwner) stale() bool {
+	host, _ := os.Hostname()
+	if o.Host != host || o.PID <= 0 {
+		return false
+	}
+	return !processAlive(o.PID)
+}
+
+func (o lockOwner) String() string {
+	return fmt.Sprintf("pid %d on %s since %s", o.PID, o.Host, o.Acquired.Format(time.RFC3339))
+}
+
+// processAlive reports whether a process with the given PID exists.  Where
+// that cannot be determined the process is assumed to be alive.
+func processAlive(pid int) bool {
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	return !errors.Is(p.Signal(syscall.Signal(0)), os.ErrProcessDone)
+}
@@ -0,0 +1,394 @@
+package checkpoint
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ravi-parthasarathy/attractor/pkg/pipeline"
+)
+
+// S3Config locates a checkpoint in an S3-compatible object store.
+type S3Config struct {
+	// Endpoint is the base URL of an S3-compatible server such as MinIO,
+	// which is addressed path-style.  Empty means AWS, addressed
+	// virtual-host style.
+	Endpoint    string
+	Region      string // default us-east-1
+	Bucket      string
+	Key         string
+	Credentials Credentials
+	// Client is the HTTP client to use; nil means http.DefaultClient.
+	Client *http.Client
+}
+
+// S3Store keeps a checkpoint in an S3-compatible object store:
+//
+//	<key>                   snapshot of the full checkpoint
+//	<key>.history/<step>    one pipeline.JournalEntry per step
+//	<key>.lock              run lock, created with If-None-Match: *
+//
+// Each step object holds only the keys its step changed.  The snapshot is
+// rewritten every pipeline.DefaultCompactEvery steps and when the run
+// completes; loading replays the step objects written after it.  Object
+// PUTs replace the whole object or nothing, so a crash never leaves a
+// partial checkpoint.
+type S3Store struct {
+	cfg    S3Config
+	base   *url.URL
+	client *http.Client
+	now    func() time.Time
+	locked bool
+
+	data    map[string]any // context after the last step object; nil if unknown
+	pending int            // step objects since the snapshot
+}
+
+// NewS3 returns a store for cfg.
+func NewS3(cfg S3Config) (*S3Store, error) {
+	if cfg.Bucket == "" || cfg.Key == "" {
+		return nil, fmt.Errorf("checkpoint s3: bucket and key are required")
+	}
+	if cfg.Region == "" {
+		cfg.Region = "us-east-1"
+	}
+	var base *url.URL
+	var err error
+	if cfg.Endpoint != "" {
+		base, err = url.Parse(strings.TrimSuffix(cfg.Endpoint, "/") + "/" + cfg.Bucket)
+	} else {
+		base, err = url.Parse(fmt.Sprintf("https://%s.s3.%s.amazonaws.com", cfg.Bucket, cfg.Region))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("checkpoint s3: endpoint: %w", err)
+	}
+	client := cfg.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &S3Store{cfg: cfg, base: base, client: client, now: time.Now}, nil
+}
+
+func (s *S3Store) historyPrefix() string { return s.cfg.Key + ".history/" }
+
+func (s *S3Store) stepKey(step int) string {
+	return fmt.Sprintf("%s%010d.json", s.historyPrefix(), step)
+}
+
+// keyStep returns the step of a key made by stepKey.
+func (s *S3Store) keyStep(key string) (int, bool) {
+	n, err := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(key, s.historyPrefix()), ".json"))
+	return n, err == nil
+}
+
+func (s *S3Store) Lock(ctx context.Context) error {
+	if s.locked {
+		return nil
+	}
+	owner, err := json.Marshal(currentOwner())
+	if err != nil {
+		return err
+	}
+	lockKey := s.cfg.Key + ".lock"
+	status, err := s.put(ctx, lockKey, owner, map[string]string{"If-None-Match": "*"})
+	if status == http.StatusPreconditionFailed {
+		held, gerr := s.get(ctx, lockKey)
+		var o lockOwner
+		if gerr != nil || json.Unmarshal(held, &o) != nil || !o.stale() {
+			return fmt.Errorf("s3://%s/%s: %w (%s); delete %s if that run is gone",
+				s.cfg.Bucket, s.cfg.Key, pipeline.ErrCheckpointLocked, o, lockKey)
+		}
+		// Left behind by a process on this host that has died.
+		_, err = s.put(ctx, lockKey, owner, nil)
+	}
+	if err != nil {
+		return fmt.Errorf("checkpoint lock: %w", err)
+	}
+	s.locked = true
+	return nil
+}
+
+func (s *S3Store) Unlock(ctx context.Context) error {
+	if !s.locked {
+		return nil
+	}
+	if err := s.delete(ctx, s.cfg.Key+".lock"); err != nil {
+		return fmt.Errorf("checkpoint unlock: %w", err)
+	}
+	s.locked = false
+	return nil
+}
+
+func (s *S3Store) Save(ctx context.Context, cp *pipeline.Checkpoint) error {
+	// The step objects are authoritative, so they are written first; the
+	// snapshot only saves fetching them all.
+	entry := pipeline.NewJournalEntry(s.data, cp)
+	body, err := pipeline.MarshalCheckpoint(entry)
+	if err != nil {
+		return fmt.Errorf("history marshal: %w", err)
+	}
+	if _, err := s.put(ctx, s.stepKey(cp.Step), body, nil); err != nil {
+		s.data = nil
+		return fmt.Errorf("history write: %w", err)
+	}
+	s.data = maps.Clone(cp.Data)
+	s.pending++
+	if !entry.Base && !cp.Completed && s.pending < pipeline.DefaultCompactEvery {
+		return nil
+	}
+	if !entry.Base {
+		if body, err = pipeline.MarshalCheckpoint(cp); err != nil {
+			return fmt.Errorf("checkpoint marshal: %w", err)
+		}
+	}
+	if _, err := s.put(ctx, s.cfg.Key, body, nil); err != nil {
+		return fmt.Errorf("checkpoint write: %w", err)
+	}
+	s.pending = 0
+	return nil
+}
+
+func (s *S3Store) Load(ctx context.Context) (*pipeline.Checkpoint, error) {
+	snap := &pipeline.Checkpoint{}
+	body, err := s.get(ctx, s.cfg.Key)
+	switch {
+	case errors.Is(err, errNotFound):
+		// Stopped before the first snapshot; the step objects may still
+		// hold the run.
+		snap = nil
+	case err != nil:
+		return nil, fmt.Errorf("checkpoint read: %w", err)
+	default:
+		if snap, err = decodeCheckpoint(body); err != nil {
+			return nil, err
+		}
+	}
+
+	after := 0
+	if snap != nil {
+		after = snap.Step
+	}
+	entries, err := s.entries(ctx, after)
+	if err != nil {
+		return nil, fmt.Errorf("checkpoint read: %w", err)
+	}
+	if snap == nil && len(entries) == 0 {
+		return nil, pipeline.ErrNoCheckpoint
+	}
+	cp := snap
+	if len(entries) > 0 {
+		var data map[string]any
+		if snap != nil {
+			data = snap.Data
+		}
+		for i := range entries {
+			data = entries[i].Apply(data)
+		}
+		last := entries[len(entries)-1].Checkpoint
+		last.Data = data
+		cp = &last
+	}
+	s.data = maps.Clone(cp.Data)
+	s.pending = len(entries)
+	return cp, nil
+}
+
+func (s *S3Store) History(ctx context.Context) ([]*pipeline.Checkpoint, error) {
+	entries, err := s.entries(ctx, 0)
+	if err != nil {
+		return nil, fmt.Errorf("history read: %w", err)
+	}
+	return pipeline.ReplayJournal(nil, entries), nil
+}
+
+// entries returns the step objects for steps after the given one, in order.
+func (s *S3Store) entries(ctx context.Context, after int) ([]pipeline.JournalEntry, error) {
+	keys, err := s.list(ctx, s.historyPrefix())
+	if err != nil {
+		return nil, err
+	}
+	var entries []pipeline.JournalEntry
+	for _, k := range keys {
+		if step, ok := s.keyStep(k); !ok || step <= after {
+			continue
+		}
+		body, err := s.get(ctx, k)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", k, err)
+		}
+		var e pipeline.JournalEntry
+		if err := pipeline.UnmarshalCheckpoint(body, &e); err != nil {
+			return nil, fmt.Errorf("%s: %w", k, err)
+		}
+		entries = append(entries, e)
+	}
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].Step < entries[j].Step })
+	return entries, nil
+}
+
+func (s *S3Store) Reset(ctx context.Context) error {
+	keys, err := s.list(ctx, s.historyPrefix())
+	if err != nil {
+		return fmt.Errorf("checkpoint reset: %w", err)
+	}
+	for _, k := range append(keys, s.cfg.Key) {
+		if err := s.delete(ctx, k); err != nil {
+			return fmt.Errorf("checkpoint reset: %w", err)
+		}
+	}
+	s.data, s.pending = nil, 0
+	return nil
+}
+
+func (s *S3Store) Close() error {
+	return s.Unlock(context.Background())
+}
+
+// ─── requests ─────────────────────────────────────────────────────────────────
+
+var errNotFound = errors.New("not found")
+
+// objectURL returns the URL of key, with each path segment encoded the way
+// SigV4 expects.
+func (s *S3Store) objectURL(key string) *url.URL {
+	segs := strings.Split(key, "/")
+	for i, seg := range segs {
+		segs[i] = uriEncode(seg)
+	}
+	basePath := strings.TrimSuffix(s.base.Path, "/") // "/bucket" or ""
+	u := *s.base
+	u.Path = basePath + "/" + key
+	u.RawPath = basePath + "/" + strings.Join(segs, "/")
+	return &u
+}
+
+// do signs and sends a request, returning the response body and status.
+// A 404 is errNotFound; other non-2xx statuses are errors too.
+func (s *S3Store) do(ctx context.Context, method string, u *url.URL, body []byte, header map[string]string) ([]byte, int, error) {
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, 0, err
+	}
+	req.URL = u
+	for k, v := range header {
+		req.Header.Set(k, v)
+	}
+	hash := emptyPayloadHash
+	if len(body) > 0 {
+		hash = sha256Hex(body)
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set("X-Amz-Content-Sha256", hash)
+	signV4(req, hash, s.cfg.Credentials, s.cfg.Region, "s3", s.now())
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, resp.StatusCode, err
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, resp.StatusCode, errNotFound
+	}
+	if resp.StatusCode/100 != 2 {
+		return data, resp.StatusCode, fmt.Errorf("%s %s: %s: %s", method, u.Path, resp.Status, s3ErrorMessage(data))
+	}
+	return data, resp.StatusCode, nil
+}
+
+func (s *S3Store) put(ctx context.Context, key string, body []byte, header map[string]string) (int, error) {
+	_, status, err := s.do(ctx, http.MethodPut, s.objectURL(key), body, header)
+	return status, err
+}
+
+func (s *S3Store) get(ctx context.Context, key string) ([]byte, error) {
+	data, _, err := s.do(ctx, http.MethodGet, s.objectURL(key), nil, nil)
+	return data, err
+}
+
+func (s *S3Store) delete(ctx context.Context, key string) error {
+	_, _, err := s.do(ctx, http.MethodDelete, s.objectURL(key), nil, nil)
+	if errors.Is(err, errNotFound) {
+		return nil
+	}
+	return err
+}
+
+// listResult is the part of a ListObjectsV2 response the store reads.
+type listResult struct {
+	Contents []struct {
+		Key string `xml:"Key"`
+	} `xml:"Contents"`
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+}
+
+// list returns the keys starting with prefix, following continuation tokens.
+func (s *S3Store) list(ctx context.Context, prefix string) ([]string, error) {
+	var keys []string
+	token := ""
+	for {
+		u := *s.base
+		if u.Path == "" {
+			u.Path = "/"
+		}
+		q := url.Values{"list-type": {"2"}, "prefix": {prefix}}
+		if token != "" {
+			q.Set("continuation-token", token)
+		}
+		u.RawQuery = canonicalQuery(q)
+		data, _, err := s.do(ctx, http.MethodGet, &u, nil, nil)
+		if err != nil {
+			return nil, err
+		}
+		var res listResult
+		if err := xml.Unmarshal(data, &res); err != nil {
+			return nil, fmt.Errorf("list %s: %w", prefix, err)
+		}
+		for _, c := range res.Contents {
+			keys = append(keys, c.Key)
+		}
+		if !res.IsTruncated || res.NextContinuationToken == "" {
+			return keys, nil
+		}
+		token = res.NextContinuationToken
+	}
+}
+
+// s3ErrorMessage extracts the message from an S3 XML error body.
+func s3ErrorMessage(data []byte) string {
+	var e struct {
+		Code    string `xml:"Code"`
+		Message string `xml:"Message"`
+	}
+	if xml.Unmarshal(data, &e) != nil || e.Code == "" {
+		return strings.TrimSpace(string(data))
+	}
+	return e.Code + ": " + e.Message
+}
+
+// decodeCheckpoint unmarshals one stored checkpoint.
+func decodeCheckpoint(data []byte) (*pipeline.Checkpoint, error) {
+	var cp pipeline.Checkpoint
+	if err := pipeline.UnmarshalCheckpoint(data, &cp); err != nil {
+		return nil, fmt.Errorf("checkpoint unmarshal: %w", err)
+	}
+	if cp.Data == nil {
+		cp.Data = make(map[string]any)
+	}
+	return &cp, nil
+}
@@ -0,0 +1,54 @@
+package checkpoint
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Vectors from the AWS Signature Version 4 test suite.
+func TestSignV4TestSuite(t *testing.T) {
+	creds := Credentials{
+		AccessKeyID:     "AKIDEXAMPLE",
+		SecretAccessKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY",
+	}
+	now := time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC)
+
+	for _, tc := range []struct {
+		name, url, signature string
+	}{
+		{"get-vanilla", "https://example.amazonaws.com/",
+			"5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31"},
+		{"get-vanilla-query-order-key-case", "https://example.amazonaws.com/?Param2=value2&Param1=value1",
+			"b97d918cfa904a5beff61c982a1b6f458b799221646efd99d3219ec94cdf2500"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodGet, tc.url, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			signV4(req, emptyPayloadHash, creds, "us-east-1", "service", now)
+			want := "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, " +
+				"SignedHeaders=host;x-amz-date, Signature=" + tc.signature
+			if got := req.Header.Get("Authorization"); got != want {
+				t.Errorf("Authorization =\n  %s\nwant\n  %s", got, want)
+			}
+		})
+	}
+}
+
+func TestSignV4SessionToken(t *testing.T) {
+	req, err := http.NewRequest(http.MethodGet, "https://example.amazonaws.com/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signV4(req, emptyPayloadHash, Credentials{AccessKeyID: "AK", SecretAccessKey: "SK", SessionToken: "tok"},
+		"us-east-1", "s3", time.Now())
+	if req.Header.Get("X-Amz-Security-Token") != "tok" {
+		t.Error("session token header not set")
+	}
+	if !strings.Contains(req.Header.Get("Authorization"), "SignedHeaders=host;x-amz-date;x-amz-security-token,") {
+		t.Errorf("session token not signed: %s", req.Header.Get("Authorization"))
+	}
+}
@@ -0,0 +1,206 @@
+package checkpoint
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"maps"
+
+	// Pure-Go SQLite driver, so that CGO_ENABLED=0 builds can use it.
+	_ "modernc.org/sqlite"
+
+	"github.com/ravi-parthasarathy/attractor/pkg/pipeline"
+)
+
+// DefaultRun is the run name used when a store URI does not name one.
+const DefaultRun = "default"
+
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS checkpoints (
+	run  TEXT    NOT NULL,
+	step INTEGER NOT NULL,
+	base INTEGER NOT NULL DEFAULT 0,
+	body TEXT    NOT NULL,
+	PRIMARY KEY (run, step)
+);
+CREATE TABLE IF NOT EXISTS checkpoint_locks (
+	run   TEXT PRIMARY KEY,
+	owner TEXT NOT NULL
+);`
+
+// SQLiteStore keeps the checkpoints of one named run in an SQLite database,
+// one row per step.  Several runs can share a database.  Each row is a
+// pipeline.JournalEntry holding only the keys its step changed, except that
+// every pipeline.DefaultCompactEvery steps a base row holds the whole
+// context; the latest checkpoint is replayed from the last base row.  Each
+// Save is a single statement, so a crash never leaves a partial checkpoint.
+type SQLiteStore struct {
+	db     *sql.DB
+	run    string
+	locked bool
+
+	data    map[string]any // context after the last row; nil if unknown
+	pending int            // rows since the last base row
+}
+
+// OpenSQLite opens (creating if needed) the database at path and returns a
+// store for the named run; an empty run uses DefaultRun.
+func OpenSQLite(path, run string) (*SQLiteStore, error) {
+	if run == "" {
+		run = DefaultRun
+	}
+	db, err := sql.Open("sqlite", "file:"+path+"?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)")
+	if err != nil {
+		return nil, fmt.Errorf("checkpoint sqlite %s: %w", path, err)
+	}
+	if _, err := db.Exec(sqliteSchema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("checkpoint sqlite %s: create schema: %w", path, err)
+	}
+	return &SQLiteStore{db: db, run: run}, nil
+}
+
+func (s *SQLiteStore) Lock(ctx context.Context) error {
+	if s.locked {
+		return nil
+	}
+	owner, err := json.Marshal(currentOwner())
+	if err != nil {
+		return err
+	}
+	res, err := s.db.ExecContext(ctx,
+		`INSERT INTO checkpoint_locks (run, owner) VALUES (?, ?) ON CONFLICT (run) DO NOTHING`,
+		s.run, string(owner))
+	if err != nil {
+		return fmt.Errorf("checkpoint lock: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		// Held already; take it over only from a process that has died,
+		// and only if nobody else did so first.
+		var held string
+		if err := s.db.QueryRowContext(ctx,
+			`SELECT owner FROM checkpoint_locks WHERE run = ?`, s.run).Scan(&held); err != nil {
+			return fmt.Errorf("checkpoint lock: %w", err)
+		}
+		var o lockOwner
+		if json.Unmarshal([]byte(held), &o) == nil && !o.stale() {
+			return fmt.Errorf("run %q: %w (%s)", s.run, pipeline.ErrCheckpointLocked, o)
+		}
+		res, err := s.db.ExecContext(ctx,
+			`UPDATE checkpoint_locks SET owner = ? WHERE run = ? AND owner = ?`,
+			string(owner), s.run, held)
+		if err != nil {
+			return fmt.Errorf("checkpoint lock: %w", err)
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			return fmt.Errorf("run %q: %w", s.run, pipeline.ErrCheckpointLocked)
+		}
+	}
+	s.locked = true
+	return nil
+}
+
+func (s *SQLiteStore) Unlock(ctx context.Context) error {
+	if !s.locked {
+		return nil
+	}
+	if _, err := s.db.ExecContext(ctx, `DELETE FROM checkpoint_locks WHERE run = ?`, s.run); err != nil {
+		return fmt.Errorf("checkpoint unlock: %w", err)
+	}
+	s.locked = false
+	return nil
+}
+
+func (s *SQLiteStore) Save(ctx context.Context, cp *pipeline.Checkpoint) error {
+	prev := s.data
+	if s.pending+1 >= pipeline.DefaultCompactEvery {
+		prev = nil
+	}
+	entry := pipeline.NewJournalEntry(prev, cp)
+	body, err := pipeline.MarshalCheckpoint(entry)
+	if err != nil {
+		return fmt.Errorf("checkpoint marshal: %w", err)
+	}
+	if _, err := s.db.ExecContext(ctx,
+		`INSERT OR REPLACE INTO checkpoints (run, step, base, body) VALUES (?, ?, ?, ?)`,
+		s.run, cp.Step, entry.Base, string(body)); err != nil {
+		s.data = nil
+		return fmt.Errorf("checkpoint write: %w", err)
+	}
+	s.data = maps.Clone(cp.Data)
+	s.pending++
+	if entry.Base {
+		s.pending = 0
+	}
+	return nil
+}
+
+func (s *SQLiteStore) Load(ctx context.Context) (*pipeline.Checkpoint, error) {
+	entries, err := s.entries(ctx,
+		`SELECT body FROM checkpoints WHERE run = ?1 AND step >= COALESCE(
+			(SELECT MAX(step) FROM checkpoints WHERE run = ?1 AND base), 0)
+		ORDER BY step`)
+	if err != nil {
+		return nil, fmt.Errorf("checkpoint read: %w", err)
+	}
+	if len(entries) == 0 {
+		return nil, pipeline.ErrNoCheckpoint
+	}
+	var data map[string]any
+	for i := range entries {
+		data = entries[i].Apply(data)
+	}
+	cp := entries[len(entries)-1].Checkpoint
+	cp.Data = data
+	s.data = maps.Clone(data)
+	s.pending = len(entries) - 1
+	return &cp, nil
+}
+
+func (s *SQLiteStore) History(ctx context.Context) ([]*pipeline.Checkpoint, error) {
+	entries, err := s.entries(ctx, `SELECT body FROM checkpoints WHERE run = ?1 ORDER BY step`)
+	if err != nil {
+		return nil, fmt.Errorf("history read: %w", err)
+	}
+	return pipeline.ReplayJournal(nil, entries), nil
+}
+
+// entries runs query, which selects row bodies for run ?1.
+func (s *SQLiteStore) entries(ctx context.Context, query string) ([]pipeline.JournalEntry, error) {
+	rows, err := s.db.QueryContext(ctx, query, s.run)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []pipeline.JournalEntry
+	for rows.Next() {
+		var body string
+		if err := rows.Scan(&body); err != nil {
+			return nil, err
+		}
+		var e pipeline.JournalEntry
+		if err := pipeline.UnmarshalCheckpoint([]byte(body), &e); err != nil {
+			return nil, fmt.Errorf("checkpoint unmarshal: %w", err)
+		}
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
+
+func (s *SQLiteStore) Reset(ctx context.Context) error {
+	if _, err := s.db.ExecContext(ctx, `DELETE FROM checkpoints WHERE run = ?`, s.run); err != nil {
+		return fmt.Errorf("checkpoint reset: %w", err)
+	}
+	s.data, s.pending = nil, 0
+	return nil
+}
+
+func (s *SQLiteStore) Close() error {
+	err := s.Unlock(context.Background())
+	if cerr := s.db.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
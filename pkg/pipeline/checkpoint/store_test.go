@@ -0,0 +1,350 @@
+package checkpoint_test
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/ravi-parthasarathy/attractor/pkg/pipeline"
+	"github.com/ravi-parthasarathy/attractor/pkg/pipeline/checkpoint"
+)
+
+// fakeS3 is an in-memory S3-compatible server that understands the requests
+// S3Store makes: PUT (with If-None-Match: *), GET, DELETE and ListObjectsV2.
+// It rejects requests that are not signed or whose payload hash is wrong.
+type fakeS3 struct {
+	t       *testing.T
+	mu      sync.Mutex
+	objects map[string][]byte // "bucket/key" → body
+	page    int               // ListObjectsV2 page size
+}
+
+func newFakeS3(t *testing.T) *httptest.Server {
+	f := &fakeS3{t: t, objects: map[string][]byte{}, page: 2}
+	srv := httptest.NewServer(f)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=") {
+		http.Error(w, "unsigned request", http.StatusForbidden)
+		return
+	}
+	sum := sha256.Sum256(body)
+	if r.Header.Get("X-Amz-Content-Sha256") != hex.EncodeToString(sum[:]) {
+		http.Error(w, "payload hash mismatch", http.StatusBadRequest)
+		return
+	}
+
+	path := strings.TrimPrefix(r.URL.Path, "/")
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if r.Method == http.MethodGet && r.URL.Query().Get("list-type") == "2" {
+		f.list(w, path, r.URL.Query())
+		return
+	}
+	switch r.Method {
+	case http.MethodPut:
+		if _, exists := f.objects[path]; exists && r.Header.Get("If-None-Match") == "*" {
+			w.WriteHeader(http.StatusPreconditionFailed)
+			return
+		}
+		f.objects[path] = body
+	case http.MethodGet:
+		data, ok := f.objects[path]
+		if !ok {
+			http.Error(w, "<Error><Code>NoSuchKey</Code></Error>", http.StatusNotFound)
+			return
+		}
+		w.Write(data)
+	case http.MethodDelete:
+		delete(f.objects, path)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (f *fakeS3) list(w http.ResponseWriter, bucket string, q url.Values) {
+	prefix := bucket + "/" + q.Get("prefix")
+	var keys []string
+	for k := range f.objects {
+		if strings.HasPrefix(k, prefix) {
+			keys = append(keys, strings.TrimPrefix(k, bucket+"/"))
+		}
+	}
+	sort.Strings(keys)
+	if tok := q.Get("continuation-token"); tok != "" {
+		i := sort.SearchStrings(keys, tok)
+		keys = keys[i:]
+	}
+	type content struct {
+		Key string `xml:"Key"`
+	}
+	var res struct {
+		XMLName               xml.Name  `xml:"ListBucketResult"`
+		Contents              []content `xml:"Contents"`
+		IsTruncated           bool      `xml:"IsTruncated"`
+		NextContinuationToken string    `xml:"NextContinuationToken,omitempty"`
+	}
+	for i, k := range keys {
+		if i == f.page {
+			res.IsTruncated = true
+			res.NextContinuationToken = k
+			break
+		}
+		res.Contents = append(res.Contents, content{Key: k})
+	}
+	xml.NewEncoder(w).Encode(res)
+}
+
+// openStores returns a function that opens a fresh store instance on the
+// same underlying storage, for each backend.
+func openStores(t *testing.T) map[string]func() pipeline.CheckpointStore {
+	dir := t.TempDir()
+	srv := newFakeS3(t)
+	t.Setenv("AWS_ACCESS_KEY_ID", "AKID")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "SECRET")
+
+	open := func(uri string) func() pipeline.CheckpointStore {
+		return func() pipeline.CheckpointStore {
+			s, err := checkpoint.Open(uri)
+			if err != nil {
+				t.Fatal(err)
+			}
+			t.Cleanup(func() { s.Close() })
+			return s
+		}
+	}
+	return map[string]func() pipeline.CheckpointStore{
+		"file":   open(filepath.Join(dir, "cp.json")),
+		"sqlite": open("sqlite://" + filepath.Join(dir, "runs.db") + "?run=nightly"),
+		"s3":     open("s3://bucket/runs/nightly.json?endpoint=" + url.QueryEscape(srv.URL)),
+	}
+}
+
+func TestStoreConformance(t *testing.T) {
+	for name, open := range openStores(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			s := open()
+
+			if _, err := s.Load(ctx); !errors.Is(err, pipeline.ErrNoCheckpoint) {
+				t.Fatalf("Load on empty store: err = %v, want ErrNoCheckpoint", err)
+			}
+			for step, node := range []string{"a", "b", "c"} {
+				cp := &pipeline.Checkpoint{
+					LastNodeID: node,
+					Step:       step + 1,
+					Data:       map[string]any{"node": node},
+				}
+				if err := s.Save(ctx, cp); err != nil {
+					t.Fatalf("Save step %d: %v", step+1, err)
+				}
+			}
+
+			cp, err := s.Load(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if cp.LastNodeID != "c" || cp.Step != 3 || cp.Data["node"] != "c" {
+				t.Errorf("Load = %+v, want step 3 at node c", cp)
+			}
+
+			steps, err := s.History(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, h := range steps {
+				got = append(got, h.LastNodeID)
+			}
+			if strings.Join(got, ",") != "a,b,c" {
+				t.Errorf("History nodes = %v, want [a b c]", got)
+			}
+
+			// A second instance sees the same checkpoints.
+			other := open()
+			if cp, err := other.Load(ctx); err != nil || cp.Step != 3 {
+				t.Errorf("second instance Load = %+v, %v", cp, err)
+			}
+
+			if err := s.Reset(ctx); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := other.Load(ctx); !errors.Is(err, pipeline.ErrNoCheckpoint) {
+				t.Errorf("Load after Reset: err = %v, want ErrNoCheckpoint", err)
+			}
+		})
+	}
+}
+
+func TestStoreTypedValues(t *testing.T) {
+	typed := map[string]any{
+		"s":     "text",
+		"n":     int64(9007199254740993),
+		"f":     2.0,
+		"ratio": 0.25,
+		"ok":    true,
+		"none":  nil,
+		"list":  []any{int64(1), 1.5, "x", []any{}},
+		"obj":   map[string]any{"name": "Ann", "age": int64(30), "score": 7.0},
+	}
+	for name, open := range openStores(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			s := open()
+			// Step 1 is a base entry; step 2 journals only the changed keys.
+			second := maps.Clone(typed)
+			second["obj"] = map[string]any{"name": "Bob", "tags": []any{"a"}}
+			second["f"] = 3.0
+			for step, data := range []map[string]any{typed, second} {
+				cp := &pipeline.Checkpoint{LastNodeID: fmt.Sprint(step + 1), Step: step + 1, Data: data}
+				if err := s.Save(ctx, cp); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			other := open()
+			cp, err := other.Load(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(cp.Data, second) {
+				t.Errorf("Load = %#v\nwant %#v", cp.Data, second)
+			}
+			history, err := other.History(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(history) != 2 || !reflect.DeepEqual(history[0].Data, typed) {
+				t.Errorf("history step 1 = %#v\nwant %#v", history[0].Data, typed)
+			}
+		})
+	}
+}
+
+func TestStoreJournalReplay(t *testing.T) {
+	const steps = 2*pipeline.DefaultCompactEvery + 7
+	big := strings.Repeat("x", 1<<16)
+
+	for name, open := range openStores(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			s := open()
+
+			// Each step changes one of a few keys and sometimes removes
+			// another, across more than one compaction.
+			data := map[string]any{"big": big}
+			var want []map[string]any
+			for step := 1; step <= steps; step++ {
+				data = maps.Clone(data)
+				data[fmt.Sprintf("k%d", step%5)] = float64(step)
+				if step%9 == 0 {
+					delete(data, fmt.Sprintf("k%d", (step+1)%5))
+				}
+				want = append(want, data)
+				cp := &pipeline.Checkpoint{LastNodeID: fmt.Sprint(step), Step: step, Data: data}
+				if err := s.Save(ctx, cp); err != nil {
+					t.Fatalf("Save step %d: %v", step, err)
+				}
+			}
+
+			other := open()
+			cp, err := other.Load(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if cp.Step != steps || !reflect.DeepEqual(cp.Data, want[steps-1]) {
+				t.Fatalf("Load = step %d %v, want step %d %v", cp.Step, cp.Data, steps, want[steps-1])
+			}
+
+			history, err := other.History(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(history) != steps {
+				t.Fatalf("History has %d steps, want %d", len(history), steps)
+			}
+			for i, h := range history {
+				if !reflect.DeepEqual(h.Data, want[i]) {
+					t.Fatalf("History step %d = %v, want %v", h.Step, h.Data, want[i])
+				}
+			}
+
+			// A store that loaded the checkpoint carries on journalling
+			// from it, e.g. when resuming from an earlier step.
+			rewound := maps.Clone(want[2])
+			if err := other.Save(ctx, &pipeline.Checkpoint{LastNodeID: "r", Step: steps + 1, Data: rewound}); err != nil {
+				t.Fatal(err)
+			}
+			cp, err = open().Load(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if cp.LastNodeID != "r" || !reflect.DeepEqual(cp.Data, rewound) {
+				t.Errorf("Load after rewind = %s %v, want r %v", cp.LastNodeID, cp.Data, rewound)
+			}
+		})
+	}
+}
+
+func TestStoreLock(t *testing.T) {
+	for name, open := range openStores(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			a, b := open(), open()
+
+			if err := a.Lock(ctx); err != nil {
+				t.Fatal(err)
+			}
+			if err := b.Lock(ctx); !errors.Is(err, pipeline.ErrCheckpointLocked) {
+				t.Fatalf("second Lock: err = %v, want ErrCheckpointLocked", err)
+			}
+			if err := a.Unlock(ctx); err != nil {
+				t.Fatal(err)
+			}
+			if err := b.Lock(ctx); err != nil {
+				t.Fatalf("Lock after Unlock: %v", err)
+			}
+			// Close releases the lock.
+			if err := b.Close(); err != nil {
+				t.Fatal(err)
+			}
+			if err := a.Lock(ctx); err != nil {
+				t.Fatalf("Lock after Close: %v", err)
+			}
+		})
+	}
+}
+
+func TestOpenErrors(t *testing.T) {
+	for _, uri := range []string{
+		"file://",
+		"sqlite://",
+		"s3://bucket",
+		"s3:///key",
+		"ftp://host/cp.json",
+	} {
+		if _, err := checkpoint.Open(uri); err == nil {
+			t.Errorf("Open(%q): want error", uri)
+		}
+	}
+}
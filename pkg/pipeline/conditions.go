@@ -1,7 +1,12 @@
 package pipeline
 
 import (
+	"context"
 	"fmt"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
 	"strings"
 )
 
@@ -9,166 +14,851 @@ import (
 //
 // Supported grammar:
 //
-//	<expr>  ::= <or>
-//	<or>    ::= <and> ( "||" <and> )*
-//	<and>   ::= <atom> ( "&&" <atom> )*
-//	<atom>  ::= "!" <atom> | "(" <expr> ")" | <key> "==" <value> | <key> "!=" <value> | <key>
-//	<key>   ::= alphanumeric + _ + .
-//	<value> ::= single-quoted | double-quoted | bare word
+//	<expr>     ::= <or>
+//	<or>       ::= <and> ( "||" <and> )*
+//	<and>      ::= <unary> ( "&&" <unary> )*
+//	<unary>    ::= "!" <unary> | "(" <expr> ")" | <compare>
+//	<compare>  ::= <operand> [ <op> <rhs> ]
+//	<op>       ::= "==" | "!=" | "<" | "<=" | ">" | ">=" | "=~" | "!~" | "in" | "not in"
+//	<operand>  ::= <path> | <literal> | <call> | <list> | <template>
+//	<rhs>      ::= <literal> | <call> | <list> | <regex>     (a bare word is a literal)
+//	<call>     ::= <name> "(" [ <operand> ( "," <operand> )* ] ")"
+//	<list>     ::= "[" [ <rhs> ( "," <rhs> )* ] "]"
+//	<path>     ::= <key> ( "." <field> )*
+//	<literal>  ::= single-quoted | double-quoted | number | true | false
+//	<regex>    ::= "/" pattern "/" [ "i" ]
+//	<template> ::= "{{" ... "}}"     (only at the start of the expression)
 //
-// A bare key is truthy if its value in ctx is non-empty.
+// A path names a context key; when no key has the whole dotted name, the
+// part after the longest key that exists is looked up inside its value (an
+// object, a list, or a string holding JSON): result.status, items.0.
+//
+// == and != compare numerically when one side is a number and the other
+// converts to one, and as text otherwise.  The ordering operators need two
+// numbers, or two strings that are not numbers.  =~ matches a regular
+// expression against the text of a value, and in tests membership of a
+// list (on its right a bare word names a context key).  The functions are
+// contains, startsWith, endsWith, len, lower, upper, trim and exists.
+//
+// An operand standing alone is truthy unless it is missing, false, "", 0,
+// or an empty list or object.
+//
+// An expression that begins with "{{" is a template condition, the form the
+// spec describes: everything through the last "}}" is rendered as a Go
+// template against the context, with the template functions of attributes.
+// The rendered text, trimmed, is a number when it reads as one, a bool when
+// it is true or false, missing when it is "<no value>", and a string
+// otherwise, and takes part in the rest of the expression like any other
+// operand:
+//
+//	{{ .status }} == "done"
+//	{{ and (eq .lang "go") (gt (len .files) 0) }}
+//
+// Templates render as RenderTemplate would under a background context; use
+// EvalConditionContext to carry options such as WithStrictTemplates.
 func EvalCondition(expr string, ctx map[string]any) (bool, error) {
-	p := &condParser{input: strings.TrimSpace(expr), ctx: ctx}
-	result, err := p.parseOr()
+	return EvalConditionContext(context.Background(), expr, ctx)
+}
+
+// EvalConditionContext is EvalCondition with templates rendered under ctx.
+func EvalConditionContext(ctx context.Context, expr string, data map[string]any) (bool, error) {
+	c, err := ParseCondition(expr)
+	if err != nil {
+		return false, err
+	}
+	return c.EvalContext(ctx, data)
+}
+
+// Condition is a parsed condition expression; see EvalCondition.
+type Condition struct {
+	expr string
+	root condBool
+	keys []string
+}
+
+// ConditionError reports a syntax error in a condition expression at the
+// byte offset Pos.
+type ConditionError struct {
+	Expr string
+	Pos  int
+	Msg  string
+}
+
+func (e *ConditionError) Error() string {
+	return fmt.Sprintf("condition %q: %s at column %d", e.Expr, e.Msg, e.Pos+1)
+}
+
+// ParseCondition parses a condition expression.  Syntax errors are
+// *ConditionError values.
+func ParseCondition(expr string) (*Condition, error) {
+	toks, err := lexCondition(expr)
+	if err != nil {
+		return nil, err
+	}
+	p := &condParser{expr: expr, toks: toks}
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tokEOF {
+		return nil, p.errorf(t, "unexpected %s", t.describe())
+	}
+	return &Condition{expr: expr, root: root, keys: p.keys}, nil
+}
+
+// Eval evaluates the condition against a context map.
+func (c *Condition) Eval(ctx map[string]any) (bool, error) {
+	return c.EvalContext(context.Background(), ctx)
+}
+
+// EvalContext is Eval with templates rendered under ctx.
+func (c *Condition) EvalContext(ctx context.Context, data map[string]any) (bool, error) {
+	ok, err := c.root.test(ctx, data)
 	if err != nil {
-		return false, fmt.Errorf("condition %q: %w", expr, err)
+		return false, fmt.Errorf("condition %q: %w", c.expr, err)
+	}
+	return ok, nil
+}
+
+// Keys returns the context paths the condition reads, in the order they
+// appear.  Every path is reported regardless of how the expression would
+// evaluate.
+func (c *Condition) Keys() []string { return c.keys }
+
+// conditionKeys returns the context keys referenced by a condition
+// expression.
+func conditionKeys(expr string) ([]string, error) {
+	c, err := ParseCondition(expr)
+	if err != nil {
+		return nil, err
+	}
+	return c.keys, nil
+}
+
+// validateConditions parses every attribute whose schema type is condition
+// and the label of every edge that is a condition.
+func validateConditions(p *Pipeline) []LintError {
+	var errs []LintError
+	ids := make([]string, 0, len(p.Nodes))
+	for id := range p.Nodes {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		n := p.Nodes[id]
+		for _, attr := range attrsOfType(n.Type, AttrCondition) {
+			if n.Attrs[attr] == "" {
+				continue
+			}
+			if _, err := ParseCondition(n.Attrs[attr]); err != nil {
+				errs = append(errs, LintError{NodeID: id, Rule: RuleCondition, Attr: attr, Message: fmt.Sprintf("attribute %q: %v", attr, err)})
+			}
+		}
+	}
+	for _, e := range p.Edges {
+		if !conditionEdge(p, e) {
+			continue
+		}
+		if _, err := ParseCondition(e.Condition); err != nil {
+			errs = append(errs, LintError{NodeID: e.From, Rule: RuleCondition, Edge: e, Attr: "label", Message: fmt.Sprintf("edge to %q: %v", e.To, err)})
+		}
+	}
+	return errs
+}
+
+// conditionEdge reports whether the label of e is a condition: it is not
+// empty or "_", does not leave a switch node, and does not name an option
+// of the wait.human node it leaves.
+func conditionEdge(p *Pipeline, e *Edge) bool {
+	n, ok := p.Nodes[e.From]
+	if !ok || n.Type == NodeTypeSwitch || e.Condition == "" || e.Condition == "_" {
+		return false
+	}
+	return n.Type != NodeTypeHuman || !slices.ContainsFunc(strings.Split(n.Attrs["options"], ","), func(o string) bool {
+		return labelMatches(e.Condition, o)
+	})
+}
+
+// ─── lexer ───────────────────────────────────────────────────────────────────
+
+type tokKind int
+
+const (
+	tokEOF tokKind = iota
+	tokWord
+	tokNumber
+	tokString
+	tokRegex
+	tokTemplate
+	tokOp
+)
+
+type condToken struct {
+	kind tokKind
+	text string // operator, word, or the unquoted string or regex body
+	pos  int
+}
+
+func (t condToken) describe() string {
+	switch t.kind {
+	case tokEOF:
+		return "end of expression"
+	case tokString:
+		return strconv.Quote(t.text)
+	case tokRegex:
+		return "/" + t.text + "/"
 	}
-	return result, nil
+	return fmt.Sprintf("%q", t.text)
 }
 
+var condOps = []string{"==", "!=", "<=", ">=", "=~", "!~", "&&", "||", "<", ">", "!", "(", ")", "[", "]", ","}
+
+func isWordByte(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_' || c == '.'
+}
+
+func lexCondition(expr string) ([]condToken, error) {
+	var toks []condToken
+	errAt := func(pos int, format string, args ...any) error {
+		return &ConditionError{Expr: expr, Pos: pos, Msg: fmt.Sprintf(format, args...)}
+	}
+	i := len(expr) - len(strings.TrimLeft(expr, " \t\r\n"))
+	if strings.HasPrefix(expr[i:], "{{") {
+		// The template runs through the last "}}"; without one it is left to
+		// the template parser to report.
+		end := len(expr)
+		if j := strings.LastIndex(expr, "}}"); j > i {
+			end = j + 2
+		}
+		toks = append(toks, condToken{tokTemplate, expr[i:end], i})
+		i = end
+	}
+	for i < len(expr) {
+		c := expr[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '\'' || c == '"':
+			end := strings.IndexByte(expr[i+1:], c)
+			if end < 0 {
+				return nil, errAt(i, "unterminated string")
+			}
+			toks = append(toks, condToken{tokString, expr[i+1 : i+1+end], i})
+			i += end + 2
+		case c == '/' && len(toks) > 0 && toks[len(toks)-1].kind == tokOp &&
+			(toks[len(toks)-1].text == "=~" || toks[len(toks)-1].text == "!~"):
+			var body strings.Builder
+			j := i + 1
+			for ; j < len(expr) && expr[j] != '/'; j++ {
+				if expr[j] == '\\' && j+1 < len(expr) && expr[j+1] == '/' {
+					j++
+				}
+				body.WriteByte(expr[j])
+			}
+			if j >= len(expr) {
+				return nil, errAt(i, "unterminated regular expression")
+			}
+			j++
+			pattern := body.String()
+			if j < len(expr) && expr[j] == 'i' {
+				pattern = "(?i)" + pattern
+				j++
+			}
+			toks = append(toks, condToken{tokRegex, pattern, i})
+			i = j
+		case isWordByte(c) || c == '-' && i+1 < len(expr) && expr[i+1] >= '0' && expr[i+1] <= '9':
+			j := i + 1
+			for j < len(expr) && (isWordByte(expr[j]) || expr[j] == '-') {
+				j++
+			}
+			word := expr[i:j]
+			kind := tokWord
+			if _, err := strconv.ParseFloat(word, 64); err == nil {
+				kind = tokNumber
+			}
+			toks = append(toks, condToken{kind, word, i})
+			i = j
+		default:
+			op := ""
+			for _, o := range condOps {
+				if strings.HasPrefix(expr[i:], o) {
+					op = o
+					break
+				}
+			}
+			if op == "" {
+				return nil, errAt(i, "unexpected character %q", c)
+			}
+			toks = append(toks, condToken{tokOp, op, i})
+			i += len(op)
+		}
+	}
+	return append(toks, condToken{kind: tokEOF, pos: len(expr)}), nil
+}
+
+// ─── parser ──────────────────────────────────────────────────────────────────
+
 type condParser struct {
-	input string
-	pos   int
-	ctx   map[string]any
+	expr string
+	toks []condToken
+	i    int
+	keys []string // every context path referenced, in parse order
 }
 
-func (p *condParser) peek() string {
-	if p.pos >= len(p.input) {
-		return ""
+func (p *condParser) peek() condToken { return p.toks[p.i] }
+
+func (p *condParser) next() condToken {
+	t := p.toks[p.i]
+	if t.kind != tokEOF {
+		p.i++
 	}
-	return p.input[p.pos:]
+	return t
 }
 
-func (p *condParser) skipWS() {
-	for p.pos < len(p.input) && (p.input[p.pos] == ' ' || p.input[p.pos] == '\t') {
-		p.pos++
+// accept consumes the next token if it is the operator op.
+func (p *condParser) accept(op string) bool {
+	if t := p.peek(); t.kind == tokOp && t.text == op {
+		p.i++
+		return true
 	}
+	return false
+}
+
+func (p *condParser) errorf(t condToken, format string, args ...any) error {
+	return &ConditionError{Expr: p.expr, Pos: t.pos, Msg: fmt.Sprintf(format, args...)}
 }
 
-func (p *condParser) parseOr() (bool, error) {
+func (p *condParser) parseOr() (condBool, error) {
 	left, err := p.parseAnd()
 	if err != nil {
-		return false, err
+		return nil, err
 	}
-	for {
-		p.skipWS()
-		if !strings.HasPrefix(p.peek(), "||") {
-			break
-		}
-		p.pos += 2
+	for p.accept("||") {
 		right, err := p.parseAnd()
 		if err != nil {
-			return false, err
+			return nil, err
 		}
-		left = left || right
+		left = condOr{left, right}
 	}
 	return left, nil
 }
 
-func (p *condParser) parseAnd() (bool, error) {
-	left, err := p.parseAtom()
+func (p *condParser) parseAnd() (condBool, error) {
+	left, err := p.parseUnary()
 	if err != nil {
-		return false, err
+		return nil, err
 	}
-	for {
-		p.skipWS()
-		if !strings.HasPrefix(p.peek(), "&&") {
-			break
-		}
-		p.pos += 2
-		right, err := p.parseAtom()
+	for p.accept("&&") {
+		right, err := p.parseUnary()
 		if err != nil {
-			return false, err
+			return nil, err
 		}
-		left = left && right
+		left = condAnd{left, right}
 	}
 	return left, nil
 }
 
-func (p *condParser) parseAtom() (bool, error) {
-	p.skipWS()
-	if p.pos >= len(p.input) {
-		return false, fmt.Errorf("unexpected end of expression")
+func (p *condParser) parseUnary() (condBool, error) {
+	if p.accept("!") {
+		x, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return condNot{x}, nil
 	}
-	// Negation
-	if p.input[p.pos] == '!' {
-		p.pos++
-		v, err := p.parseAtom()
-		return !v, err
+	if t := p.peek(); p.accept("(") {
+		x, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if !p.accept(")") {
+			return nil, p.errorf(p.peek(), "expected ')' to close '(' at column %d, found %s", t.pos+1, p.peek().describe())
+		}
+		return x, nil
 	}
-	// Parenthesised group
-	if p.input[p.pos] == '(' {
-		p.pos++
-		v, err := p.parseOr()
+	return p.parseCompare()
+}
+
+func (p *condParser) parseCompare() (condBool, error) {
+	left, err := p.parseOperand(false)
+	if err != nil {
+		return nil, err
+	}
+	t := p.peek()
+	op := ""
+	switch {
+	case t.kind == tokOp && slices.Contains([]string{"==", "!=", "<", "<=", ">", ">=", "=~", "!~"}, t.text):
+		op = t.text
+		p.next()
+	case t.kind == tokWord && t.text == "in":
+		op = "in"
+		p.next()
+	case t.kind == tokWord && t.text == "not" && p.toks[p.i+1].kind == tokWord && p.toks[p.i+1].text == "in":
+		op = "not in"
+		p.i += 2
+	default:
+		return condTruthy{left}, nil
+	}
+
+	cmp := condCompare{op: op, left: left, pos: t.pos}
+	rt := p.peek()
+	switch {
+	case op == "=~" || op == "!~":
+		if rt.kind != tokRegex && rt.kind != tokString {
+			return nil, p.errorf(rt, "expected a /regular expression/ or string after %s, found %s", op, rt.describe())
+		}
+		p.next()
+		re, err := regexp.Compile(rt.text)
+		if err != nil {
+			return nil, p.errorf(rt, "invalid regular expression: %v", err)
+		}
+		cmp.re = re
+	case op == "in" || op == "not in":
+		// The right of in is a list literal or a context key holding one.
+		if cmp.right, err = p.parseOperand(false); err != nil {
+			return nil, err
+		}
+	default:
+		if cmp.right, err = p.parseOperand(true); err != nil {
+			return nil, err
+		}
+	}
+	return cmp, nil
+}
+
+// parseOperand parses a value.  When literal is set a bare word is a string
+// rather than a context path.
+func (p *condParser) parseOperand(literal bool) (condValue, error) {
+	t := p.next()
+	switch t.kind {
+	case tokString:
+		return condLiteral{t.text}, nil
+	case tokNumber:
+		return condNumber{t.text}, nil
+	case tokTemplate:
+		tpl, err := ParseTemplate(t.text)
 		if err != nil {
-			return false, err
-		}
-		p.skipWS()
-		if p.pos >= len(p.input) || p.input[p.pos] != ')' {
-			return false, fmt.Errorf("expected ')'")
-		}
-		p.pos++
-		return v, nil
-	}
-	// Key (possibly followed by == or !=)
-	key := p.parseKey()
-	if key == "" {
-		return false, fmt.Errorf("expected identifier at pos %d in %q", p.pos, p.input)
-	}
-	p.skipWS()
-	if strings.HasPrefix(p.peek(), "==") {
-		p.pos += 2
-		p.skipWS()
-		val := p.parseValue()
-		ctxVal := fmt.Sprintf("%v", p.ctx[key])
-		return ctxVal == val, nil
-	}
-	if strings.HasPrefix(p.peek(), "!=") {
-		p.pos += 2
-		p.skipWS()
-		val := p.parseValue()
-		ctxVal := fmt.Sprintf("%v", p.ctx[key])
-		return ctxVal != val, nil
-	}
-	// Bare key: truthy if value is non-empty
-	v, ok := p.ctx[key]
+			return nil, p.errorf(t, "invalid template: %v", err)
+		}
+		p.keys = append(p.keys, templateKeys(tpl)...)
+		return condTemplate{t.text}, nil
+	case tokWord:
+		switch {
+		case t.text == "true" || t.text == "false":
+			return condLiteral{t.text == "true"}, nil
+		case p.accept("("):
+			return p.parseCall(t)
+		case literal:
+			return condLiteral{t.text}, nil
+		}
+		if strings.HasPrefix(t.text, ".") || strings.HasSuffix(t.text, ".") || strings.Contains(t.text, "..") {
+			return nil, p.errorf(t, "invalid key %q", t.text)
+		}
+		p.keys = append(p.keys, t.text)
+		return condPath{t.text}, nil
+	case tokOp:
+		if t.text == "[" {
+			return p.parseList()
+		}
+	}
+	return nil, p.errorf(t, "expected a value, found %s", t.describe())
+}
+
+func (p *condParser) parseList() (condValue, error) {
+	var list condList
+	if p.accept("]") {
+		return list, nil
+	}
+	for {
+		v, err := p.parseOperand(true)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, v)
+		if p.accept("]") {
+			return list, nil
+		}
+		if t := p.peek(); !p.accept(",") {
+			return nil, p.errorf(t, "expected ',' or ']' in list, found %s", t.describe())
+		}
+	}
+}
+
+func (p *condParser) parseCall(name condToken) (condValue, error) {
+	fn, ok := condFuncs[name.text]
 	if !ok {
-		return false, nil
+		return nil, p.errorf(name, "unknown function %q", name.text)
+	}
+	call := condCall{name: name.text, fn: fn}
+	if !p.accept(")") {
+		for {
+			v, err := p.parseOperand(false)
+			if err != nil {
+				return nil, err
+			}
+			call.args = append(call.args, v)
+			if p.accept(")") {
+				break
+			}
+			if t := p.peek(); !p.accept(",") {
+				return nil, p.errorf(t, "expected ',' or ')' in call to %s, found %s", name.text, t.describe())
+			}
+		}
+	}
+	if len(call.args) != fn.arity {
+		return nil, p.errorf(name, "%s takes %d argument(s), got %d", name.text, fn.arity, len(call.args))
+	}
+	return call, nil
+}
+
+// ─── evaluation ──────────────────────────────────────────────────────────────
+
+type condBool interface {
+	test(ctx context.Context, data map[string]any) (bool, error)
+}
+
+type condValue interface {
+	value(ctx context.Context, data map[string]any) (any, bool, error) // value, whether it exists
+}
+
+type (
+	condOr     struct{ l, r condBool }
+	condAnd    struct{ l, r condBool }
+	condNot    struct{ x condBool }
+	condTruthy struct{ x condValue }
+	condPath   struct{ path string }
+	condList   []condValue
+	// condLiteral is a quoted string, a bare word or a boolean.
+	condLiteral struct{ v any }
+	// condNumber is a number literal, kept as written.
+	condNumber struct{ text string }
+	// condTemplate is a template whose rendered text is the value.
+	condTemplate struct{ text string }
+	condCompare  struct {
+		op          string
+		left, right condValue
+		re          *regexp.Regexp
+		pos         int
+	}
+	condCall struct {
+		name string
+		fn   condFunc
+		args []condValue
+	}
+)
+
+// || and && short-circuit, so that a guard such as exists(score) keeps the
+// right side from being evaluated when it does not hold.
+func (c condOr) test(ctx context.Context, data map[string]any) (bool, error) {
+	l, err := c.l.test(ctx, data)
+	if err != nil || l {
+		return l, err
+	}
+	return c.r.test(ctx, data)
+}
+
+func (c condAnd) test(ctx context.Context, data map[string]any) (bool, error) {
+	l, err := c.l.test(ctx, data)
+	if err != nil || !l {
+		return false, err
+	}
+	return c.r.test(ctx, data)
+}
+
+func (c condNot) test(ctx context.Context, data map[string]any) (bool, error) {
+	v, err := c.x.test(ctx, data)
+	return !v, err
+}
+
+func (c condTruthy) test(ctx context.Context, data map[string]any) (bool, error) {
+	v, ok, err := c.x.value(ctx, data)
+	if err != nil || !ok {
+		return false, err
+	}
+	return truthy(v), nil
+}
+
+func (c condPath) value(ctx context.Context, data map[string]any) (any, bool, error) {
+	v, ok := lookupPath(data, c.path)
+	return v, ok, nil
+}
+
+func (c condLiteral) value(context.Context, map[string]any) (any, bool, error) { return c.v, true, nil }
+
+func (c condNumber) value(context.Context, map[string]any) (any, bool, error) {
+	n, _ := toNumber(c.text)
+	return n, true, nil
+}
+
+func (c condTemplate) value(ctx context.Context, data map[string]any) (any, bool, error) {
+	out, err := RenderTemplate(ctx, c.text, data)
+	if err != nil {
+		return nil, false, err
+	}
+	switch out = strings.TrimSpace(out); out {
+	case "<no value>":
+		return nil, false, nil
+	case "true", "false":
+		return out == "true", true, nil
 	}
-	return fmt.Sprintf("%v", v) != "", nil
+	if n, err := toNumber(out); err == nil {
+		return n, true, nil
+	}
+	return out, true, nil
 }
 
-func (p *condParser) parseKey() string {
-	start := p.pos
-	for p.pos < len(p.input) {
-		c := p.input[p.pos]
-		if (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') ||
-			(c >= '0' && c <= '9') || c == '_' || c == '.' {
-			p.pos++
-		} else {
-			break
+func (c condList) value(ctx context.Context, data map[string]any) (any, bool, error) {
+	out := make([]any, len(c))
+	for i, e := range c {
+		v, _, err := e.value(ctx, data)
+		if err != nil {
+			return nil, false, err
 		}
+		out[i] = v
 	}
-	return p.input[start:p.pos]
+	return out, true, nil
 }
 
-func (p *condParser) parseValue() string {
-	if p.pos >= len(p.input) {
-		return ""
+func (c condCall) value(ctx context.Context, data map[string]any) (any, bool, error) {
+	args := make([]any, len(c.args))
+	exists := make([]bool, len(c.args))
+	for i, a := range c.args {
+		v, ok, err := a.value(ctx, data)
+		if err != nil {
+			return nil, false, err
+		}
+		args[i], exists[i] = v, ok
 	}
-	quote := p.input[p.pos]
-	if quote == '\'' || quote == '"' {
-		p.pos++
-		start := p.pos
-		for p.pos < len(p.input) && p.input[p.pos] != quote {
-			p.pos++
+	v, err := c.fn.call(args, exists)
+	if err != nil {
+		return nil, false, fmt.Errorf("%s: %w", c.name, err)
+	}
+	return v, true, nil
+}
+
+func (c condCompare) test(ctx context.Context, data map[string]any) (bool, error) {
+	l, lok, err := c.left.value(ctx, data)
+	if err != nil {
+		return false, err
+	}
+	if c.re != nil {
+		return c.re.MatchString(FormatValue(l)) == (c.op == "=~"), nil
+	}
+	r, rok, err := c.right.value(ctx, data)
+	if err != nil {
+		return false, err
+	}
+	switch c.op {
+	case "==":
+		return condEqual(l, r), nil
+	case "!=":
+		return !condEqual(l, r), nil
+	case "in", "not in":
+		list, ok := asList(r)
+		if !ok {
+			return false, fmt.Errorf("right of %s at column %d is %s, not a list", c.op, c.pos+1, describeValue(r))
+		}
+		found := slices.ContainsFunc(list, func(e any) bool { return condEqual(l, e) })
+		return found == (c.op == "in"), nil
+	}
+	if !lok || !rok {
+		return false, nil // a missing value has no order
+	}
+	order, err := condCompareOrder(l, r)
+	if err != nil {
+		return false, fmt.Errorf("%s at column %d: %w", c.op, c.pos+1, err)
+	}
+	switch c.op {
+	case "<":
+		return order < 0, nil
+	case "<=":
+		return order <= 0, nil
+	case ">":
+		return order > 0, nil
+	default:
+		return order >= 0, nil
+	}
+}
+
+// isNumber reports whether v is a number value (not a string).
+func isNumber(v any) bool {
+	switch v.(type) {
+	case int64, float64, int:
+		return true
+	}
+	return false
+}
+
+// condEqual compares numerically when one side is a number and the other
+// converts to one, and as text otherwise.
+func condEqual(l, r any) bool {
+	if isNumber(l) || isNumber(r) {
+		x, errX := toNumber(l)
+		y, errY := toNumber(r)
+		if errX == nil && errY == nil {
+			return toFloat(x) == toFloat(y)
 		}
-		val := p.input[start:p.pos]
-		if p.pos < len(p.input) {
-			p.pos++ // consume closing quote
+	}
+	return FormatValue(l) == FormatValue(r)
+}
+
+// condCompareOrder orders two numbers, or two strings that are not numbers.
+func condCompareOrder(l, r any) (int, error) {
+	x, errX := toNumber(l)
+	y, errY := toNumber(r)
+	switch {
+	case errX == nil && errY == nil:
+		return compareFloat(toFloat(x), toFloat(y)), nil
+	case errX != nil && errY != nil:
+		ls, lok := l.(string)
+		rs, rok := r.(string)
+		if lok && rok {
+			return strings.Compare(ls, rs), nil
 		}
-		return val
 	}
-	// Bare word
-	return p.parseKey()
+	return 0, fmt.Errorf("cannot compare %s with %s", describeValue(l), describeValue(r))
+}
+
+func compareFloat(x, y float64) int {
+	switch {
+	case x < y:
+		return -1
+	case x > y:
+		return 1
+	}
+	return 0
+}
+
+func describeValue(v any) string {
+	if s, ok := v.(string); ok {
+		return strconv.Quote(s)
+	}
+	if v == nil {
+		return "a missing value"
+	}
+	return string(valueType(v)) + " " + FormatValue(v)
+}
+
+// truthy reports whether a value counts as true on its own.
+func truthy(v any) bool {
+	switch v := v.(type) {
+	case nil:
+		return false
+	case bool:
+		return v
+	case string:
+		return v != ""
+	case int64:
+		return v != 0
+	case int:
+		return v != 0
+	case float64:
+		return v != 0
+	case []any:
+		return len(v) > 0
+	case map[string]any:
+		return len(v) > 0
+	}
+	return FormatValue(v) != ""
+}
+
+// asList returns v as a list: a list value, or a string holding a JSON
+// array.
+func asList(v any) ([]any, bool) {
+	if s, ok := v.(string); ok {
+		if dv, err := DecodeValue([]byte(s)); err == nil {
+			v = dv
+		}
+	}
+	l, ok := v.([]any)
+	return l, ok
+}
+
+// lookupPath resolves a dotted path against ctx: the key with the whole
+// name if there is one, else the longest key that prefixes it, with the
+// rest of the path looked up inside its value.
+func lookupPath(ctx map[string]any, path string) (any, bool) {
+	if v, ok := ctx[path]; ok {
+		return v, true
+	}
+	for i := strings.LastIndexByte(path, '.'); i > 0; i = strings.LastIndexByte(path[:i], '.') {
+		if v, ok := ctx[path[:i]]; ok {
+			return lookupField(v, strings.Split(path[i+1:], "."))
+		}
+	}
+	return nil, false
+}
+
+func lookupField(v any, fields []string) (any, bool) {
+	for _, f := range fields {
+		if s, ok := v.(string); ok {
+			dv, err := DecodeValue([]byte(s))
+			if err != nil {
+				return nil, false
+			}
+			v = dv
+		}
+		switch x := v.(type) {
+		case map[string]any:
+			var ok bool
+			if v, ok = x[f]; !ok {
+				return nil, false
+			}
+		case []any:
+			i, err := strconv.Atoi(f)
+			if err != nil || i < 0 || i >= len(x) {
+				return nil, false
+			}
+			v = x[i]
+		default:
+			return nil, false
+		}
+	}
+	return v, true
+}
+
+// ─── functions ───────────────────────────────────────────────────────────────
+
+type condFunc struct {
+	arity int
+	call  func(args []any, exists []bool) (any, error)
+}
+
+func strFunc(f func(string) string) condFunc {
+	return condFunc{1, func(a []any, _ []bool) (any, error) { return f(FormatValue(a[0])), nil }}
+}
+
+func strPairFunc(f func(s, x string) bool) condFunc {
+	return condFunc{2, func(a []any, _ []bool) (any, error) { return f(FormatValue(a[0]), FormatValue(a[1])), nil }}
+}
+
+var condFuncs = map[string]condFunc{
+	// contains(list, x) tests membership, contains(object, key) tests for a
+	// key, and contains(text, s) for a substring.
+	"contains": {2, func(a []any, _ []bool) (any, error) {
+		switch h := a[0].(type) {
+		case []any:
+			return slices.ContainsFunc(h, func(e any) bool { return condEqual(e, a[1]) }), nil
+		case map[string]any:
+			_, ok := h[FormatValue(a[1])]
+			return ok, nil
+		}
+		return strings.Contains(FormatValue(a[0]), FormatValue(a[1])), nil
+	}},
+	"startsWith": strPairFunc(strings.HasPrefix),
+	"endsWith":   strPairFunc(strings.HasSuffix),
+	"len": {1, func(a []any, _ []bool) (any, error) {
+		switch v := a[0].(type) {
+		case []any:
+			return int64(len(v)), nil
+		case map[string]any:
+			return int64(len(v)), nil
+		}
+		return int64(len([]rune(FormatValue(a[0])))), nil
+	}},
+	"lower": strFunc(strings.ToLower),
+	"upper": strFunc(strings.ToUpper),
+	"trim":  strFunc(strings.TrimSpace),
+	// exists(key) reports whether a key is set, even to "".
+	"exists": {1, func(_ []any, exists []bool) (any, error) { return exists[0], nil }},
 }
@@ -0,0 +1,200 @@
+package pipeline
+
+import (
+	"fmt"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// ─── Syntaxes ─────────────────────────────────────────────────────────────────
+
+// Syntax is a notation a pipeline source is written in.  All of them
+// describe the same Pipeline, so a pipeline can be converted from one to
+// another without loss.
+type Syntax string
+
+const (
+	SyntaxDOT  Syntax = "dot"
+	SyntaxYAML Syntax = "yaml"
+	SyntaxJSON Syntax = "json"
+)
+
+// Syntaxes lists the syntaxes pipelines can be written in.
+var Syntaxes = []Syntax{SyntaxDOT, SyntaxYAML, SyntaxJSON}
+
+// SyntaxOf returns the syntax of a pipeline file from its extension:
+// .yaml and .yml are YAML, .json is JSON and anything else is DOT.
+func SyntaxOf(path string) Syntax {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		return SyntaxYAML
+	case ".json":
+		return SyntaxJSON
+	}
+	return SyntaxDOT
+}
+
+// Parse parses a pipeline source written in syn.  A syntax error is a
+// *ParseError.
+func Parse(src string, syn Syntax) (*Pipeline, error) {
+	switch syn {
+	case SyntaxDOT:
+		return ParseDOT(src)
+	case SyntaxYAML, SyntaxJSON:
+		return parseYAML(src, syn)
+	}
+	return nil, fmt.Errorf("unknown pipeline syntax %q", syn)
+}
+
+// Encode writes p in syn: DOT in the layout of FormatDOT, or YAML or JSON
+// as described in ParseYAML.  Comments of the source p was parsed from are
+// not part of p and are lost.  Encode checks that the result parses back to
+// the same pipeline and fails if it would not.
+func Encode(p *Pipeline, syn Syntax) (string, error) {
+	var out string
+	var err error
+	switch syn {
+	case SyntaxDOT:
+		out, err = encodeDOT(p)
+	case SyntaxYAML:
+		out, err = encodeYAML(p)
+	case SyntaxJSON:
+		out, err = encodeJSON(p)
+	default:
+		return "", fmt.Errorf("unknown pipeline syntax %q", syn)
+	}
+	if err != nil {
+		return "", err
+	}
+	q, err := Parse(out, syn)
+	if err != nil {
+		return "", fmt.Errorf("encode %s: %w", syn, err)
+	}
+	if !samePipeline(p, q) {
+		return "", fmt.Errorf("encode %s: the result would not describe the same pipeline", syn)
+	}
+	return out, nil
+}
+
+// nodeOrder returns the IDs of p's nodes in source order, with nodes of
+// unknown position last in ID order.
+func nodeOrder(p *Pipeline) []string {
+	ids := make([]string, 0, len(p.Nodes))
+	for id := range p.Nodes {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		a, b := p.Nodes[ids[i]].Span, p.Nodes[ids[j]].Span
+		switch {
+		case a.IsValid() != b.IsValid():
+			return a.IsValid()
+		case a.Start != b.Start:
+			return a.Start.Before(b.Start)
+		}
+		return ids[i] < ids[j]
+	})
+	return ids
+}
+
+// attrOrder returns the names of attrs with type first and the rest by
+// name, the order FormatDOT writes them in.
+func attrOrder(attrs map[string]string) []string {
+	names := make([]string, 0, len(attrs))
+	for name := range attrs {
+		names = append(names, name)
+	}
+	slices.SortFunc(names, func(a, b string) int {
+		switch {
+		case a == "type":
+			return -1
+		case b == "type":
+			return 1
+		}
+		return strings.Compare(a, b)
+	})
+	return names
+}
+
+// ─── DOT ──────────────────────────────────────────────────────────────────────
+
+// encodeDOT writes p as DOT statements and lays them out with FormatDOT.
+func encodeDOT(p *Pipeline) (string, error) {
+	var sb strings.Builder
+	quote := dotString
+	attr := func(name, value string) string {
+		if !plainID.MatchString(name) || isKeyword(name) {
+			name = quote(name)
+		}
+		return name + "=" + quote(value)
+	}
+	attrList := func(attrs map[string]string) string {
+		var parts []string
+		for _, name := range attrOrder(attrs) {
+			parts = append(parts, attr(name, attrs[name]))
+		}
+		if len(parts) == 0 {
+			return ""
+		}
+		return " [" + strings.Join(parts, " ") + "]"
+	}
+
+	sb.WriteString("digraph ")
+	if p.Name != "" {
+		sb.WriteString(quote(p.Name) + " ")
+	}
+	sb.WriteString("{\n")
+	for _, name := range attrOrder(p.Attrs) {
+		sb.WriteString(attr(name, p.Attrs[name]) + "\n")
+	}
+	if len(p.Params) > 0 {
+		sb.WriteString("subgraph " + ParamsSubgraph + " {\n")
+		for _, prm := range p.Params {
+			sb.WriteString(quote(prm.Name) + attrList(prm.Attrs) + "\n")
+		}
+		sb.WriteString("}\n")
+	}
+	for _, id := range nodeOrder(p) {
+		n := p.Nodes[id]
+		sb.WriteString(quote(id) + attrList(n.Attrs) + "\n")
+	}
+	for _, e := range p.Edges {
+		attrs := map[string]string{}
+		if e.Condition != "" {
+			attrs["label"] = e.Condition
+		}
+		if e.On != "" {
+			attrs["on"] = e.On
+		}
+		sb.WriteString(quote(e.From) + " -> " + quote(e.To) + attrList(attrs) + "\n")
+	}
+	sb.WriteString("}\n")
+	return FormatDOT(sb.String())
+}
+
+// dotString quotes s as a DOT string that unquote reads back as s.  Quotes
+// are escaped, and so are backslashes, except that a lone backslash before
+// an ordinary character is left alone, so that \n stays \n.
+func dotString(s string) string {
+	var sb strings.Builder
+	sb.WriteByte('"')
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == '"':
+			sb.WriteString(`\"`)
+		case s[i] == '\\' && !loneBackslash(s, i):
+			sb.WriteString(`\\`)
+		default:
+			sb.WriteByte(s[i])
+		}
+	}
+	sb.WriteByte('"')
+	return sb.String()
+}
+
+// loneBackslash reports whether the backslash at s[i] has no backslash on
+// either side and comes before a character other than a quote.
+func loneBackslash(s string, i int) bool {
+	return (i == 0 || s[i-1] != '\\') && i+1 < len(s) && s[i+1] != '"' && s[i+1] != '\\'
+}
@@ -0,0 +1,454 @@
+package pipeline
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// keyAttr names a context key a node reads or writes: the value of attr, or
+// def when attr is unset.  A def starting with "_" is appended to the node
+// ID; an empty attr means the key is always def.
+type keyAttr struct {
+	attr, def string
+}
+
+// keyReadAttrs lists, per node type, the attributes naming a context key the
+// node reads, besides the keys its templates and conditions reference.
+var keyReadAttrs = map[NodeType][]string{
+	NodeTypeSwitch:          {"key"},
+	NodeTypeJSONExtract:     {"source"},
+	NodeTypeSplit:           {"source"},
+	NodeTypeJSONDecode:      {"source"},
+	NodeTypeRegex:           {"source"},
+	NodeTypeStringTransform: {"source"},
+	NodeTypeForEach:         {"items"},
+	NodeTypeMap:             {"items"},
+	NodeTypeMapPipeline:     {"items"},
+}
+
+// keyWriteAttrs lists, per node type, the context keys the node writes.
+var keyWriteAttrs = map[NodeType][]keyAttr{
+	NodeTypeStart:           {{"", "start_time"}},
+	NodeTypeExit:            {{"", "exit_time"}},
+	NodeTypeCodergen:        {{"", "last_output"}, {"", "_output"}},
+	NodeTypeHuman:           {{"key", "_response"}},
+	NodeTypeSet:             {{"key", ""}},
+	NodeTypeFanOut:          {{"", "_fanout"}},
+	NodeTypeFanIn:           {{"", "_fanin"}, {"", "_merged"}, {"", "_conflicts"}},
+	NodeTypeHTTP:            {{"response_key", "_body"}, {"status_key", "_status"}, {"json_key", "_json"}},
+	NodeTypeEnv:             {{"key", ""}},
+	NodeTypeReadFile:        {{"key", ""}},
+	NodeTypeJSONExtract:     {{"key", ""}},
+	NodeTypeSplit:           {{"key", ""}},
+	NodeTypeMap:             {{"results_key", "_results"}, {"", "last_output"}},
+	NodeTypePrompt:          {{"key", ""}, {"", "last_output"}},
+	NodeTypeExec:            {{"stdout_key", "_stdout"}, {"stderr_key", ""}, {"exit_code_key", ""}, {"", "last_output"}},
+	NodeTypeJSONPack:        {{"output", ""}},
+	NodeTypeRegex:           {{"key", ""}},
+	NodeTypeStringTransform: {{"key", ""}},
+	NodeTypeForEach:         {{"results_key", "_results"}, {"", "last_output"}, {"", "_count"}},
+	NodeTypeMapPipeline:     {{"results_key", "_results"}, {"", "last_output"}, {"", "_count"}},
+}
+
+// engineWrites are the keys the engine sets around every node.
+var engineWrites = []keyAttr{
+	{"", "outcome"}, {"", "last_node"}, {"", "_visits"},
+	{"", "last_error"}, {"", "last_error_kind"}, {"", "last_error_node"}, {"", "last_error_attempts"},
+}
+
+// externalKeys are keys a run may be given outside the pipeline's own
+// nodes: seed comes from --seed.
+var externalKeys = []string{"seed"}
+
+// nodeIO is what a node does with context keys.
+type nodeIO struct {
+	reads  []string // paths read, in attribute order
+	writes keySet
+	named  []string        // keys the pipeline author named in write attributes
+	local  map[string]bool // keys the node binds for its own templates
+	any    bool            // the node may read any key (a sub-pipeline)
+}
+
+// keySet is a set of context keys.  An entry ending in "*" stands for every
+// key with that prefix.
+type keySet map[string]bool
+
+// covers reports whether s holds the context path: the path itself, a key
+// it is nested under, or a prefix entry matching either.
+func (s keySet) covers(path string) bool {
+	for k := range s {
+		if p, ok := strings.CutSuffix(k, "*"); ok {
+			if strings.HasPrefix(path, p) {
+				return true
+			}
+		} else if k == path || strings.HasPrefix(path, k+".") {
+			return true
+		}
+	}
+	return false
+}
+
+func (s keySet) union(t keySet) keySet {
+	u := maps.Clone(s)
+	maps.Copy(u, t)
+	return u
+}
+
+// intersect returns the entries of s and t that the other set also
+// covers: a key, or a prefix entry the other set has a shorter prefix for.
+func (s keySet) intersect(t keySet) keySet {
+	u := keySet{}
+	for _, pair := range [][2]keySet{{s, t}, {t, s}} {
+		for k := range pair[0] {
+			if pair[1].coversEntry(k) {
+				u[k] = true
+			}
+		}
+	}
+	return u
+}
+
+func (s keySet) coversEntry(k string) bool {
+	p, isPrefix := strings.CutSuffix(k, "*")
+	if !isPrefix {
+		return s.covers(k)
+	}
+	for e := range s {
+		if q, ok := strings.CutSuffix(e, "*"); ok && strings.HasPrefix(p, q) {
+			return true
+		}
+	}
+	return false
+}
+
+// nodeKeys derives the keys node n reads and writes from its type and
+// attributes.
+func nodeKeys(n *Node) nodeIO {
+	io := nodeIO{writes: keySet{}, local: map[string]bool{}}
+	key := func(k keyAttr) (string, bool) {
+		if v := strings.TrimSpace(n.Attrs[k.attr]); k.attr != "" && v != "" {
+			return v, true
+		}
+		if strings.HasPrefix(k.def, "_") {
+			return n.ID + k.def, false
+		}
+		return k.def, false
+	}
+	for _, k := range append(slices.Clone(keyWriteAttrs[n.Type]), engineWrites...) {
+		if v, named := key(k); v != "" {
+			io.writes[v] = true
+			if named {
+				io.named = append(io.named, v)
+			}
+		}
+	}
+	switch n.Type {
+	case NodeTypeJSONPack:
+		for _, k := range strings.Split(n.Attrs["keys"], ",") {
+			if k = strings.TrimSpace(k); k != "" {
+				io.reads = append(io.reads, k)
+			}
+		}
+	case NodeTypeJSONDecode:
+		io.writes[n.Attrs["prefix"]+"*"] = true
+	case NodeTypeInclude:
+		io.writes["*"] = true
+		io.any = true
+	case NodeTypeForEach, NodeTypeMap:
+		io.local[n.Attrs["item_key"]] = true
+	case NodeTypeMapPipeline:
+		io.any = true
+		io.local[n.Attrs["item_key"]] = true
+		io.local[n.Attrs["item_key"]+"_index"] = true
+	}
+	for _, attr := range keyReadAttrs[n.Type] {
+		if v := strings.TrimSpace(n.Attrs[attr]); v != "" {
+			io.reads = append(io.reads, v)
+		}
+	}
+	for _, attr := range attrsOfType(n.Type, AttrCondition) {
+		if c, err := ParseCondition(n.Attrs[attr]); err == nil && n.Attrs[attr] != "" {
+			io.reads = append(io.reads, c.Keys()...)
+		}
+	}
+	for _, attr := range attrsOfType(n.Type, AttrTemplate) {
+		if t, err := ParseTemplate(n.Attrs[attr]); err == nil {
+			io.reads = append(io.reads, templateKeys(t)...)
+		}
+	}
+	return io
+}
+
+// Writers returns the nodes that write the context key path names, or a
+// key it is nested under, in ID order: nodes whose attributes name the key
+// and nodes whose type writes it by default.  Sub-pipelines, which may
+// write any key, are left out.
+func (p *Pipeline) Writers(path string) []*Node {
+	var out []*Node
+	for _, id := range slices.Sorted(maps.Keys(p.Nodes)) {
+		writes := nodeKeys(p.Nodes[id]).writes
+		delete(writes, "*")
+		if writes.covers(path) {
+			out = append(out, p.Nodes[id])
+		}
+	}
+	return out
+}
+
+func (io nodeIO) isLocal(path string) bool {
+	for k := range io.local {
+		if path == k || strings.HasPrefix(path, k+".") {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckDataflow follows every path from the start node and warns about
+// context keys that are read where some path to the read does not write
+// them, keys that no node, param or variable provides at all, keys that
+// are written but never read (other than by a node that leads straight to
+// an exit, whose keys are the run's result), and keys that only vars supplies, which
+// should be declared as params.  vars holds the variables a run would be
+// given, or nil.
+//
+// A key counts as defined at a node when every path from start to it
+// writes the key; the branches that meet at a fan_in all run, so their
+// writes are combined.
+func CheckDataflow(p *Pipeline, vars map[string]any) []LintError {
+	start := ""
+	ids := make([]string, 0, len(p.Nodes))
+	for id, n := range p.Nodes {
+		ids = append(ids, id)
+		if n.Type == NodeTypeStart {
+			start = id
+		}
+	}
+	if start == "" {
+		return nil
+	}
+	sort.Strings(ids)
+
+	ios := make(map[string]nodeIO, len(ids))
+	written := keySet{}
+	for _, id := range ids {
+		ios[id] = nodeKeys(p.Nodes[id])
+		maps.Copy(written, ios[id].writes)
+	}
+	params := keySet{}
+	for _, prm := range p.Params {
+		params[prm.Name] = true
+	}
+	supplied := keySet{}
+	for k := range vars {
+		supplied[k] = true
+	}
+
+	// Keys defined on entry to each node; nil until a path reaches it.
+	in := map[string]keySet{start: params.union(supplied)}
+	for _, k := range externalKeys {
+		in[start][k] = true
+	}
+	out := func(id string) keySet { return in[id].union(ios[id].writes) }
+	preds := map[string][]string{}
+	for _, e := range p.Edges {
+		preds[e.To] = append(preds[e.To], e.From)
+	}
+	for changed := true; changed; {
+		changed = false
+		for _, id := range ids {
+			if id == start {
+				continue
+			}
+			var set keySet
+			for _, from := range preds[id] {
+				switch {
+				case in[from] == nil:
+				case set == nil:
+					set = out(from)
+				case p.Nodes[id].Type == NodeTypeFanIn:
+					set = set.union(out(from))
+				default:
+					set = set.intersect(out(from))
+				}
+			}
+			if set != nil && !maps.Equal(set, in[id]) {
+				in[id] = set
+				changed = true
+			}
+		}
+	}
+
+	var warns []LintError
+	reported := map[string]bool{}
+	onlyVars := map[string]bool{}
+	// check reports path if it is not in defined where node nodeID, or
+	// the condition of edge e leaving it, reads it.
+	check := func(nodeID string, e *Edge, path string, defined keySet) {
+		if defined.covers(path) || reported[nodeID+"\x00"+path] {
+			return
+		}
+		reported[nodeID+"\x00"+path] = true
+		w := LintError{NodeID: nodeID, Rule: RuleUndefinedKey, Severity: SeverityWarning, Edge: e}
+		where := ""
+		if e != nil {
+			where, w.Attr = fmt.Sprintf("edge to %q ", e.To), "label"
+		}
+		if written.covers(path) {
+			w.Message = fmt.Sprintf("%sreads %q, which may be undefined", where, path)
+			if route := undefinedPath(p, ios, start, nodeID, path); route != nil {
+				w.Message += fmt.Sprintf(": nothing writes it on the path %s", strings.Join(route, " -> "))
+			}
+			warns = append(warns, w)
+			return
+		}
+		w.Message = fmt.Sprintf("%sreads %q, which no node writes and no param declares", where, path)
+		if s := closestKey(path, written, params, supplied); s != "" {
+			w.Message += fmt.Sprintf(" (did you mean %q?)", s)
+		}
+		warns = append(warns, w)
+	}
+	var reads []string
+	for _, id := range ids {
+		io := ios[id]
+		for _, path := range io.reads {
+			if io.isLocal(path) {
+				continue
+			}
+			reads = append(reads, path)
+			if supplied.covers(path) && !written.covers(path) && !params.covers(path) {
+				onlyVars[strings.SplitN(path, ".", 2)[0]] = true
+			}
+			if in[id] != nil {
+				check(id, nil, path, in[id])
+			}
+		}
+	}
+	for _, e := range p.Edges {
+		if !conditionEdge(p, e) {
+			continue
+		}
+		c, err := ParseCondition(e.Condition)
+		if err != nil {
+			continue
+		}
+		for _, path := range c.Keys() {
+			reads = append(reads, path)
+			if supplied.covers(path) && !written.covers(path) && !params.covers(path) {
+				onlyVars[strings.SplitN(path, ".", 2)[0]] = true
+			}
+			if in[e.From] != nil {
+				check(e.From, e, path, out(e.From))
+			}
+		}
+	}
+
+	// A sub-pipeline may read anything, so unread keys are only reported
+	// when there is none.  The keys of a node that leads straight to an
+	// exit are the run's result, read by whoever ran it (--output-context).
+	if !slices.ContainsFunc(ids, func(id string) bool { return ios[id].any }) {
+		for _, id := range ids {
+			if leadsToExit(p, id) {
+				continue
+			}
+			for _, k := range ios[id].named {
+				if !slices.ContainsFunc(reads, func(r string) bool { return r == k || strings.HasPrefix(r, k+".") }) {
+					warns = append(warns, LintError{
+						NodeID:   id,
+						Rule:     RuleUnreadKey,
+						Severity: SeverityWarning,
+						Message:  fmt.Sprintf("writes %q, which is never read", k),
+					})
+				}
+			}
+		}
+	}
+	for _, k := range slices.Sorted(maps.Keys(onlyVars)) {
+		warns = append(warns, LintError{
+			Rule:     RuleUndeclaredVar,
+			Severity: SeverityWarning,
+			Message:  fmt.Sprintf("key %q is supplied only by --var or --var-file; declare it in subgraph params", k),
+		})
+	}
+	return locateErrors(p, warns)
+}
+
+// leadsToExit reports whether an edge leads from id straight to an exit
+// node.
+func leadsToExit(p *Pipeline, id string) bool {
+	return slices.ContainsFunc(p.OutgoingEdges(id), func(e *Edge) bool {
+		n := p.Nodes[e.To]
+		return n != nil && n.Type == NodeTypeExit
+	})
+}
+
+// undefinedPath returns a path of node IDs from start to target along which
+// no node before target writes path, or nil if there is none.
+func undefinedPath(p *Pipeline, ios map[string]nodeIO, start, target, path string) []string {
+	prev := map[string]string{start: ""}
+	queue := []string{start}
+	for len(queue) > 0 {
+		id := queue[0]
+		queue = queue[1:]
+		if id == target {
+			break
+		}
+		if ios[id].writes.covers(path) {
+			continue
+		}
+		for _, e := range p.OutgoingEdges(id) {
+			if _, seen := prev[e.To]; !seen {
+				prev[e.To] = id
+				queue = append(queue, e.To)
+			}
+		}
+	}
+	if _, ok := prev[target]; !ok {
+		return nil
+	}
+	var route []string
+	for id := target; id != ""; id = prev[id] {
+		route = append([]string{id}, route...)
+	}
+	return route
+}
+
+// closestKey returns the known key most like path, for suggesting a fix
+// for a misspelt key, or "" if none is close.
+func closestKey(path string, sets ...keySet) string {
+	best, bestDist := "", 3
+	for _, s := range sets {
+		for _, k := range slices.Sorted(maps.Keys(s)) {
+			if strings.HasSuffix(k, "*") {
+				continue
+			}
+			if d := editDistance(path, k); d < bestDist && d < len(path) {
+				best, bestDist = k, d
+			}
+		}
+	}
+	return best
+}
+
+// editDistance is the Levenshtein distance between a and b.
+func editDistance(a, b string) int {
+	row := make([]int, len(b)+1)
+	for j := range row {
+		row[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		diag := row[0]
+		row[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			diag, row[j] = row[j], min(row[j]+1, row[j-1]+1, diag+cost)
+		}
+	}
+	return row[len(b)]
+}
@@ -6,21 +6,40 @@ import (
 	"fmt"
 	"log/slog"
 	"strconv"
+	"strings"
 	"sync"
 	"time"
 )
 
-const maxNodeVisits = 50
+// DefaultMaxVisits is the number of times a node may run in a single
+// execution when neither the node nor the graph sets max_visits.
+const DefaultMaxVisits = 50
 
 // Engine executes a Pipeline graph using a HandlerRegistry.
 type Engine struct {
-	pipeline       *Pipeline
-	handlerReg     HandlerRegistry
-	pctx           *PipelineContext
-	checkpointPath string
+	pipeline   *Pipeline
+	handlerReg HandlerRegistry
+	pctx       *PipelineContext
+	store      CheckpointStore // nil disables checkpointing
+	observers  []Observer
+	looping    map[string]bool   // nodes on a cycle; see cyclicNodes
+	joins      map[string]string // fan_out node ID → matching fan_in node ID
+	step       int               // number of the last checkpoint written
+	last       *Checkpoint       // the last checkpoint written, or resumed from
+	suspend    *suspension       // shared with fan_out branch engines
+
+	// resumeFrom is the checkpoint Resume was given, and resumeFanOut the
+	// branch progress to pick up when the run reaches its fan_out node.
+	resumeFrom   *Checkpoint
+	resumeFanOut *FanOutState
+	// branchStep, set on the engines running fan_out branches of a
+	// checkpointed run, records their progress in the parent's checkpoint.
+	branchStep func(ctx context.Context, pctx *PipelineContext, cp Checkpoint) error
 }
 
-// NewEngine creates an Engine after validating the pipeline.
+// NewEngine creates an Engine after validating the pipeline.  A non-empty
+// checkpointPath checkpoints to a FileStore at that path; see
+// SetCheckpointStore for other stores.
 func NewEngine(
 	p *Pipeline,
 	reg HandlerRegistry,
@@ -39,12 +58,35 @@ func NewEngine(
 	if err := ValidateErr(p); err != nil {
 		return nil, err
 	}
-	return &Engine{
-		pipeline:       p,
-		handlerReg:     reg,
-		pctx:           pctx,
-		checkpointPath: checkpointPath,
-	}, nil
+	if err := lintErr(ValidateHandlers(p, reg)); err != nil {
+		return nil, err
+	}
+	e := &Engine{
+		pipeline:   p,
+		handlerReg: reg,
+		pctx:       pctx,
+		looping:    cyclicNodes(p),
+		joins:      matchFanIns(p),
+		suspend:    &suspension{},
+	}
+	if checkpointPath != "" {
+		e.store = NewFileStore(checkpointPath)
+	}
+	return e, nil
+}
+
+// SetCheckpointStore makes the engine checkpoint to s, replacing any store
+// set up by NewEngine.  The engine locks s while Execute runs but does not
+// close it.  It must not be called while Execute is running.
+func (e *Engine) SetCheckpointStore(s CheckpointStore) {
+	e.store = s
+}
+
+// AddObserver registers o to receive every event of subsequent runs,
+// including events from fan-out branches, included sub-pipelines and
+// handlers.  It must not be called while Execute is running.
+func (e *Engine) AddObserver(o Observer) {
+	e.observers = append(e.observers, o)
 }
 
 // Execute runs the pipeline starting from the start node, or from
@@ -57,17 +99,63 @@ func (e *Engine) Execute(ctx context.Context, resumeFromNodeID string) error {
 	if startID == "" {
 		return fmt.Errorf("no start node found in pipeline")
 	}
-	return e.run(ctx, startID, e.pctx, "")
+
+	// Claim the checkpoint store for this run.  A fresh run starts a new
+	// history; a resumed one continues its numbering.
+	if e.store != nil {
+		if err := e.store.Lock(ctx); err != nil {
+			return err
+		}
+		defer func() {
+			if err := e.store.Unlock(context.WithoutCancel(ctx)); err != nil {
+				slog.Warn("release checkpoint lock", "error", err)
+			}
+		}()
+		if resumeFromNodeID == "" {
+			if err := e.store.Reset(ctx); err != nil {
+				return err
+			}
+		}
+		e.step, e.last = 0, nil
+		last, err := e.store.Load(ctx)
+		switch {
+		case err == nil:
+			e.step, e.last = last.Step, last
+		case !errors.Is(err, ErrNoCheckpoint):
+			return err
+		}
+		if e.resumeFrom != nil {
+			// Resuming from an earlier step of the history.
+			e.last = e.resumeFrom
+		}
+	}
+	e.resumeFrom = nil
+
+	ctx = e.withObservers(ctx)
+	ctx = e.withTemplateOptions(ctx)
+	began := time.Now()
+	Emit(ctx, Event{Type: EventRunStarted, NodeID: startID})
+	err := e.run(ctx, startID, e.pctx, "")
+	if err != nil {
+		err = e.suspended(ctx, err)
+	}
+	finished := Event{Type: EventRunFinished, Status: OutcomeSuccess, Duration: time.Since(began)}
+	if err != nil {
+		finished.Status = OutcomeFail
+		finished.Error = err.Error()
+	}
+	Emit(ctx, finished)
+	return err
 }
 
 // run is the inner sequential execution loop.  It stops when:
 //   - an exit node is reached (returns nil)
-//   - a node whose type equals stopAtType is encountered (returns nil, caller
-//     takes over from that node)
+//   - the node stopAt is reached (returns nil, caller takes over from that
+//     node); fan-out branches stop at their fan_in
 //   - an error occurs
 //
-// stopAtType == "" means run until exit.
-func (e *Engine) run(ctx context.Context, startID string, pctx *PipelineContext, stopAtType NodeType) error {
+// stopAt == "" means run until exit.
+func (e *Engine) run(ctx context.Context, startID string, pctx *PipelineContext, stopAt string) error {
 	visits := make(map[string]int)
 	currentID := startID
 
@@ -79,33 +167,62 @@ func (e *Engine) run(ctx context.Context, startID string, pctx *PipelineContext,
 		default:
 		}
 
-		// Cycle detection.
-		visits[currentID]++
-		if visits[currentID] > maxNodeVisits {
-			return fmt.Errorf("cycle detected: node %q visited more than %d times", currentID, maxNodeVisits)
-		}
-
 		node, ok := e.pipeline.Nodes[currentID]
 		if !ok {
 			return fmt.Errorf("node %q not found in pipeline", currentID)
 		}
 
-		// Stop-at boundary: caller will handle this node type.
-		if stopAtType != "" && node.Type == stopAtType {
+		// Stop-at boundary: caller will handle this node.
+		if stopAt != "" && node.ID == stopAt {
 			return nil
 		}
 
-		// ── Fan-out: run all branches in parallel then skip to fan_in ──────
+		if _, ok := e.suspend.requested(); ok {
+			return fmt.Errorf("%w before node %q", ErrSuspended, currentID)
+		}
+
+		// Loop guard: a node that has used up its max_visits either hands
+		// over to its on=exhausted edge or aborts the run.
+		if limit := e.maxVisits(node); limit > 0 && visits[node.ID] >= limit {
+			next, err := e.selectExhausted(ctx, node.ID, pctx)
+			if err != nil {
+				return fmt.Errorf("node %q: select exhausted edge: %w", node.ID, err)
+			}
+			if next == nil {
+				return fmt.Errorf("node %q: visit limit reached (max_visits=%d)", node.ID, limit)
+			}
+			slog.Warn("visit limit reached, following exhausted edge",
+				"node", node.ID, "max_visits", limit, "next", next.To)
+			Emit(ctx, Event{
+				Type:      EventEdgeSelected,
+				From:      next.From,
+				To:        next.To,
+				Condition: next.Condition,
+				On:        next.On,
+			})
+			currentID = next.To
+			continue
+		}
+		visits[node.ID]++
+		if e.looping[node.ID] {
+			pctx.Set(node.ID+"_visits", strconv.Itoa(visits[node.ID]))
+		}
+
+		// ── Fan-out: run the selected branches in parallel, then continue
+		// from the matching fan_in ───────────────────────────────────────
 		if node.Type == NodeTypeFanOut {
-			if err := e.executeFanOut(ctx, node, pctx); err != nil {
-				return err
+			joinID, ok := e.joins[node.ID]
+			if !ok {
+				return fmt.Errorf("fan_out node %q: no matching fan_in node", node.ID)
 			}
-			// After fan-out completes, find and continue from fan_in.
-			fanInID, err := e.findFanIn(node.ID)
-			if err != nil {
-				return fmt.Errorf("fan_out node %q: %w", node.ID, err)
+			var resume *FanOutState
+			if e.resumeFanOut != nil && e.resumeFanOut.Node == node.ID {
+				resume, e.resumeFanOut = e.resumeFanOut, nil
+			}
+			if err := e.executeFanOut(ctx, node, joinID, pctx, resume); err != nil {
+				return err
 			}
-			currentID = fanInID
+			currentID = joinID
 			continue
 		}
 
@@ -116,122 +233,328 @@ func (e *Engine) run(ctx context.Context, startID string, pctx *PipelineContext,
 
 		slog.Info("executing node", "node", node.ID, "type", node.Type)
 
-		if execErr := executeWithRetry(ctx, handler, node, pctx); execErr != nil {
-			// Check for the exit sentinel.
-			var exitSig ExitSignal
-			if errors.As(execErr, &exitSig) {
-				slog.Info("pipeline complete", "node", node.ID)
-				pctx.Set("last_node", node.ID)
-				if e.checkpointPath != "" {
-					_ = pctx.SaveCheckpoint(e.checkpointPath, node.ID)
-				}
-				return nil
+		observed := observing(ctx)
+		var before map[string]any
+		if observed {
+			before = pctx.Snapshot()
+		}
+		began := time.Now()
+		Emit(ctx, Event{Type: EventNodeStarted, NodeID: node.ID, NodeType: node.Type})
+
+		out, attempts, execErr := executeWithRetry(ctx, handler, node, pctx)
+
+		// Check for the exit sentinel.
+		var exitSig ExitSignal
+		exited := execErr != nil && errors.As(execErr, &exitSig)
+		if exited {
+			execErr = nil
+			out = Outcome{Status: OutcomeSuccess}
+			pctx.Set("last_node", node.ID)
+		} else if execErr != nil {
+			recordFailure(pctx, node.ID, execErr, attempts)
+		} else {
+			applyOutcome(pctx, out)
+		}
+
+		if observed {
+			finished := Event{
+				Type:     EventNodeFinished,
+				NodeID:   node.ID,
+				NodeType: node.Type,
+				Status:   out.Status,
+				Attempt:  attempts,
+				Duration: time.Since(began),
+			}
+			if execErr != nil {
+				finished.Error = execErr.Error()
+			}
+			Emit(ctx, finished)
+			if keys := changedKeys(before, pctx.Snapshot()); len(keys) > 0 {
+				Emit(ctx, Event{Type: EventContextChanged, NodeID: node.ID, Keys: keys})
 			}
-			return fmt.Errorf("node %q: %w", node.ID, execErr)
 		}
 
-		// Checkpoint after every successful node execution.
-		if e.checkpointPath != "" {
-			if cpErr := pctx.SaveCheckpoint(e.checkpointPath, node.ID); cpErr != nil {
+		if exited {
+			slog.Info("pipeline complete", "node", node.ID)
+			if cpErr := e.saveCheckpoint(ctx, pctx, Checkpoint{LastNodeID: node.ID, Outcome: &out, Completed: true}); cpErr != nil {
 				return fmt.Errorf("node %q: save checkpoint: %w", node.ID, cpErr)
 			}
+			return nil
 		}
 
-		// Determine next node.
-		nextID, err := e.selectNext(node.ID, pctx)
-		if err != nil {
-			return fmt.Errorf("node %q: select next: %w", node.ID, err)
+		var next *Edge
+		if execErr != nil {
+			// Cancellation of the whole run is never routed to a recovery
+			// branch.
+			if ctx.Err() != nil {
+				return fmt.Errorf("node %q: %w", node.ID, execErr)
+			}
+			next, err = e.selectFailure(ctx, node.ID, pctx)
+			if err != nil {
+				return fmt.Errorf("node %q: select failure edge: %w", node.ID, err)
+			}
+			if next == nil {
+				return fmt.Errorf("node %q: %w", node.ID, execErr)
+			}
+			slog.Warn("node failed, following failure edge",
+				"node", node.ID, "next", next.To, "error", execErr)
+		} else {
+			next, err = e.selectNext(ctx, node.ID, pctx, out.PreferredLabel)
+			if err != nil {
+				// Record the node as done without a next edge; resuming
+				// selects the edge again.
+				err = fmt.Errorf("node %q: select next: %w", node.ID, err)
+				if cpErr := e.saveCheckpoint(ctx, pctx, Checkpoint{LastNodeID: node.ID, Outcome: &out}); cpErr != nil {
+					return errors.Join(err, fmt.Errorf("node %q: save checkpoint: %w", node.ID, cpErr))
+				}
+				return err
+			}
+		}
+
+		// Checkpoint after every node execution, with the edge taken next.
+		cp := Checkpoint{LastNodeID: node.ID, Outcome: &out, Next: checkpointEdge(next), Completed: next == nil}
+		if cpErr := e.saveCheckpoint(ctx, pctx, cp); cpErr != nil {
+			return fmt.Errorf("node %q: save checkpoint: %w", node.ID, cpErr)
 		}
-		if nextID == "" {
+
+		if next == nil {
 			// No outgoing edges and not an exit node — treat as implicit exit.
 			slog.Info("pipeline ended", "node", node.ID, "reason", "no outgoing edges")
 			return nil
 		}
-
-		currentID = nextID
+		Emit(ctx, Event{
+			Type:      EventEdgeSelected,
+			From:      next.From,
+			To:        next.To,
+			Condition: next.Condition,
+			On:        next.On,
+		})
+
+		currentID = next.To
 	}
 }
 
-// executeFanOut runs all outgoing branches of a fan_out node in parallel,
-// using goroutines. Each branch receives an independent copy of pctx and
-// runs until it reaches a fan_in node (exclusive). After all branches
-// complete, their results are merged into pctx (last-write-wins).
-func (e *Engine) executeFanOut(ctx context.Context, fanOutNode *Node, pctx *PipelineContext) error {
-	outEdges := e.pipeline.OutgoingEdges(fanOutNode.ID)
-	if len(outEdges) == 0 {
+// executeFanOut runs the selected outgoing branches of a fan_out node in
+// parallel, using goroutines.  Each branch receives an independent copy of
+// pctx and runs until it reaches joinID (exclusive).  The fan_in's join mode
+// decides how many branches must succeed; as soon as that is settled, either
+// way, the remaining branches are cancelled.  The writes of the successful
+// branches are then merged into pctx according to the fan_in's merge policy.
+//
+// When the run is checkpointed, every node a branch completes checkpoints the
+// run at the fan_out with the progress of all branches.  A non-nil resume is
+// that progress from an earlier run: finished branches are restored rather
+// than run, and the others restart after their last completed node.
+func (e *Engine) executeFanOut(ctx context.Context, fanOutNode *Node, joinID string, pctx *PipelineContext, resume *FanOutState) error {
+	allEdges := e.pipeline.OutgoingEdges(fanOutNode.ID)
+	if len(allEdges) == 0 {
 		return fmt.Errorf("fan_out node %q has no outgoing edges", fanOutNode.ID)
 	}
 
+	snap := pctx.Snapshot()
+	outEdges, err := e.selectBranches(ctx, fanOutNode.ID, allEdges, snap, resume)
+	if err != nil {
+		return err
+	}
+	if len(outEdges) == 0 {
+		return nil
+	}
+
+	joinNode := e.pipeline.Nodes[joinID]
+	mode, quorum, err := parseJoinMode(joinNode)
+	if err != nil {
+		return fmt.Errorf("fan_in node %q: %w", joinID, err)
+	}
+	need := requiredSuccesses(mode, quorum, len(outEdges))
+	if need > len(outEdges) {
+		return fmt.Errorf("fan_in node %q: quorum=%d exceeds the %d branches started", joinID, need, len(outEdges))
+	}
+
 	type branchResult struct {
-		snap map[string]any
-		err  error
+		idx    int
+		branch string
+		snap   map[string]any
+		err    error
+	}
+	results := make(chan branchResult, len(outEdges))
+
+	// Cancelling branchesCtx stops the branches that are still running once
+	// the join is decided.
+	branchesCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// Branches of a checkpointed run record their progress; those of
+	// branches nested inside them do not.
+	var progress *fanOutProgress
+	if e.store != nil {
+		progress = newFanOutProgress(e, fanOutNode.ID, pctx, snap, outEdges, resume)
 	}
-	results := make([]branchResult, len(outEdges))
 
 	var wg sync.WaitGroup
 	for i, edge := range outEdges {
 		branchStart := edge.To
 		idx := i
+		branchCtx := pctx.Copy()
+		startAt := branchStart
+		var state *BranchState
+		if progress != nil {
+			state = progress.state.Branches[i]
+			branchCtx.Merge(state.Data)
+			if state.Done {
+				slog.Info("fan_out branch restored from checkpoint", "branch", branchStart)
+				results <- branchResult{idx: idx, branch: branchStart, snap: branchCtx.Snapshot()}
+				continue
+			}
+			startAt = state.resumeAt()
+		}
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
-			branchCtx := pctx.Copy()
 			subEng := &Engine{
 				pipeline:   e.pipeline,
 				handlerReg: e.handlerReg,
 				pctx:       branchCtx,
-				// no checkpointing inside branches
+				looping:    e.looping,
+				joins:      e.joins,
+				suspend:    e.suspend,
+			}
+			if progress != nil {
+				subEng.branchStep = progress.stepper(state)
+			}
+			slog.Debug("fan_out branch starting", "branch", branchStart, "at", startAt)
+			Emit(ctx, Event{Type: EventBranchStarted, NodeID: fanOutNode.ID, Branch: branchStart})
+			began := time.Now()
+			err := subEng.run(branchesCtx, startAt, branchCtx, joinID)
+			if err == nil && progress != nil {
+				err = progress.finish(ctx, state, branchCtx)
+			}
+			finished := Event{
+				Type:     EventBranchFinished,
+				NodeID:   fanOutNode.ID,
+				Branch:   branchStart,
+				Status:   OutcomeSuccess,
+				Duration: time.Since(began),
 			}
-			slog.Debug("fan_out branch starting", "branch", branchStart)
-			err := subEng.run(ctx, branchStart, branchCtx, NodeTypeFanIn)
 			if err != nil {
-				results[idx] = branchResult{err: fmt.Errorf("branch %q: %w", branchStart, err)}
+				finished.Status = OutcomeFail
+				if branchesCtx.Err() != nil && ctx.Err() == nil {
+					// Cancelled because the join was already decided.
+					finished.Status = OutcomeSkipped
+				}
+				finished.Error = err.Error()
+				Emit(ctx, finished)
+				results <- branchResult{idx: idx, branch: branchStart, err: fmt.Errorf("branch %q: %w", branchStart, err)}
 				return
 			}
+			Emit(ctx, finished)
 			slog.Debug("fan_out branch complete", "branch", branchStart)
-			results[idx] = branchResult{snap: branchCtx.Snapshot()}
+			results <- branchResult{idx: idx, branch: branchStart, snap: branchCtx.Snapshot()}
 		}()
 	}
-	wg.Wait()
 
-	// Collect errors and merge results.
+	// Collect results until the join is decided: enough branches have
+	// succeeded, or so many have failed that it can no longer happen.
+	succeeded := make([]*branchResult, len(outEdges))
+	var successes int
 	var errs []error
-	for _, r := range results {
+	for pending := len(outEdges); pending > 0; pending-- {
+		r := <-results
 		if r.err != nil {
 			errs = append(errs, r.err)
+		} else {
+			succeeded[r.idx] = &r
+			successes++
+		}
+		if _, ok := e.suspend.requested(); ok {
+			// Let every branch finish its running node rather than
+			// cancelling the rest as soon as one stops.
 			continue
 		}
-		pctx.Merge(r.snap)
+		if successes >= need && stopsEarly(mode) {
+			break
+		}
+		if len(outEdges)-len(errs) < need {
+			break
+		}
+	}
+	cancel()
+	wg.Wait()
+
+	if ctx.Err() != nil {
+		return fmt.Errorf("fan_out node %q: %w", fanOutNode.ID, ctx.Err())
+	}
+	if _, ok := e.suspend.requested(); ok && successes < need {
+		// The branches stopped between nodes; their progress is in the
+		// checkpoint.
+		return fmt.Errorf("fan_out node %q: %w", fanOutNode.ID, ErrSuspended)
+	}
+	if successes < need {
+		if mode == JoinAll {
+			return fmt.Errorf("parallel branches failed: %v", errs)
+		}
+		return fmt.Errorf("fan_in node %q: mode=%s needs %d successful branch(es), got %d: %v",
+			joinID, mode, need, successes, errs)
 	}
 	if len(errs) > 0 {
-		return fmt.Errorf("parallel branches failed: %v", errs)
+		slog.Warn("parallel branches failed but join succeeded",
+			"fan_in", joinID, "mode", mode, "failed", len(errs), "errors", fmt.Sprint(errs))
+	}
+
+	// Merge what each successful branch wrote, in branch (edge) order.
+	var writes []branchWrites
+	var merged []string
+	for _, r := range succeeded {
+		if r == nil {
+			continue
+		}
+		data := make(map[string]any)
+		for _, k := range changedKeys(snap, r.snap) {
+			data[k] = r.snap[k]
+		}
+		writes = append(writes, branchWrites{branch: r.branch, data: data})
+		merged = append(merged, r.branch)
+	}
+
+	values, conflicts, err := mergeBranches(joinNode, writes)
+	if err != nil {
+		return fmt.Errorf("fan_in node %q: %w", joinID, err)
+	}
+	pctx.Merge(values)
+	pctx.Set(joinID+"_merged", strings.Join(merged, ","))
+	if len(conflicts) > 0 {
+		slog.Warn("parallel branches wrote conflicting values",
+			"fan_in", joinID, "keys", strings.Join(conflicts, ","))
+		pctx.Set(joinID+"_conflicts", strings.Join(conflicts, ","))
 	}
 	return nil
 }
 
-// findFanIn performs a BFS from fanOutID to locate the first downstream node
-// of type fan_in. Returns an error if none is reachable.
-func (e *Engine) findFanIn(fanOutID string) (string, error) {
-	visited := make(map[string]bool)
-	queue := []string{fanOutID}
-	for len(queue) > 0 {
-		id := queue[0]
-		queue = queue[1:]
-		if visited[id] {
+// selectBranches returns the outgoing edges of a fan_out whose branches are
+// started.  Only branches whose edge label holds are; unlabelled edges always
+// are.  A resumed fan_out starts the branches the interrupted run chose.
+func (e *Engine) selectBranches(ctx context.Context, fanOutID string, edges []*Edge, snap map[string]any, resume *FanOutState) ([]*Edge, error) {
+	if resume != nil {
+		return resumedEdges(fanOutID, edges, resume)
+	}
+	var selected []*Edge
+	for _, edge := range edges {
+		if edge.On != "" {
 			continue
 		}
-		visited[id] = true
-		for _, edge := range e.pipeline.OutgoingEdges(id) {
-			next := edge.To
-			if n, ok := e.pipeline.Nodes[next]; ok && n.Type == NodeTypeFanIn {
-				return next, nil
+		if cond := edge.Condition; cond != "" && cond != "_" {
+			ok, err := EvalConditionContext(ctx, cond, snap)
+			if err != nil {
+				return nil, fmt.Errorf("fan_out node %q: edge to %q: condition %q: %w", fanOutID, edge.To, cond, err)
 			}
-			if !visited[next] {
-				queue = append(queue, next)
+			if !ok {
+				slog.Debug("fan_out branch skipped", "branch", edge.To, "condition", cond)
+				continue
 			}
 		}
+		Emit(ctx, Event{Type: EventEdgeSelected, From: edge.From, To: edge.To, Condition: edge.Condition})
+		selected = append(selected, edge)
 	}
-	return "", fmt.Errorf("no fan_in node reachable from fan_out %q", fanOutID)
+	return selected, nil
 }
 
 // startNode returns the ID of the first node with type NodeTypeStart.
@@ -244,16 +567,51 @@ func (e *Engine) startNode() string {
 	return ""
 }
 
+// saveCheckpoint persists pctx and cp as the engine's next step when the
+// engine has a checkpoint store, or as the progress of its branch on a
+// fan_out branch engine; otherwise it is a no-op.
+func (e *Engine) saveCheckpoint(ctx context.Context, pctx *PipelineContext, cp Checkpoint) error {
+	if e.branchStep != nil {
+		return e.branchStep(ctx, pctx, cp)
+	}
+	if e.store == nil {
+		return nil
+	}
+	e.step++
+	cp.Step = e.step
+	cp.Time = time.Now().UTC()
+	cp.Fingerprint = e.pipeline.Fingerprint
+	cp.Data = pctx.Snapshot()
+	// Save even when the run is being cancelled, so the step just finished
+	// is not lost.
+	if err := e.store.Save(context.WithoutCancel(ctx), &cp); err != nil {
+		return err
+	}
+	e.last = &cp
+	return nil
+}
+
 // selectNext evaluates outgoing edges from nodeID in order and returns the
 // first edge whose condition evaluates to true.  An empty label (or
 // underscore "_") is treated as an unconditional edge.
 //
+// A non-empty preferred label (from the node's Outcome) takes precedence:
+// the first success edge whose label matches it is chosen outright.
+//
 // For switch nodes, exact string matching is used instead of condition
 // evaluation — see selectNextSwitch.
-func (e *Engine) selectNext(nodeID string, pctx *PipelineContext) (string, error) {
+func (e *Engine) selectNext(ctx context.Context, nodeID string, pctx *PipelineContext, preferred string) (*Edge, error) {
 	edges := e.pipeline.OutgoingEdges(nodeID)
 	if len(edges) == 0 {
-		return "", nil
+		return nil, nil
+	}
+
+	if preferred != "" {
+		for _, edge := range edges {
+			if edge.On == "" && labelMatches(edge.Condition, preferred) {
+				return edge, nil
+			}
+		}
 	}
 
 	// Switch nodes use value-equality routing, not condition evaluation.
@@ -264,33 +622,152 @@ func (e *Engine) selectNext(nodeID string, pctx *PipelineContext) (string, error
 	snap := pctx.Snapshot()
 
 	for _, edge := range edges {
+		if edge.On != "" {
+			continue
+		}
 		cond := edge.Condition
 		// Unconditional edges.
 		if cond == "" || cond == "_" {
-			return edge.To, nil
+			return edge, nil
 		}
-		ok, err := EvalCondition(cond, snap)
+		ok, err := EvalConditionContext(ctx, cond, snap)
 		if err != nil {
-			return "", fmt.Errorf("edge %q→%q: condition %q: %w", edge.From, edge.To, cond, err)
+			return nil, fmt.Errorf("edge %q→%q: condition %q: %w", edge.From, edge.To, cond, err)
 		}
 		if ok {
-			return edge.To, nil
+			return edge, nil
 		}
 	}
 
 	// No condition matched — this is a pipeline stall.
-	return "", fmt.Errorf("no outgoing edge condition matched for node %q", nodeID)
+	return nil, fmt.Errorf("no outgoing edge condition matched for node %q", nodeID)
+}
+
+// selectFailure picks the recovery edge for a node that has just failed.
+// Candidates, in definition order, are edges marked on=failure (whose label,
+// if any, must also hold) and conditional edges whose label references the
+// "outcome" key, so that both of these forms route a failure:
+//
+//	work -> fix [on=failure]
+//	work -> fix [label="outcome == 'fail'"]
+//
+// Unconditional success edges are never followed after a failure.  A nil
+// result means the node has no applicable recovery edge and the run aborts.
+func (e *Engine) selectFailure(ctx context.Context, nodeID string, pctx *PipelineContext) (*Edge, error) {
+	snap := pctx.Snapshot()
+	for _, edge := range e.pipeline.OutgoingEdges(nodeID) {
+		cond := edge.Condition
+		switch edge.On {
+		case EdgeOnFailure:
+		case "":
+			if cond == "" || cond == "_" || !referencesKey(cond, "outcome") {
+				continue
+			}
+		default:
+			continue
+		}
+		if cond == "" || cond == "_" {
+			return edge, nil
+		}
+		ok, err := EvalConditionContext(ctx, cond, snap)
+		if err != nil {
+			return nil, fmt.Errorf("edge %q→%q: condition %q: %w", edge.From, edge.To, cond, err)
+		}
+		if ok {
+			return edge, nil
+		}
+	}
+	return nil, nil
+}
+
+// referencesKey reports whether the condition expression mentions key.
+// Unparseable conditions report false; they surface as errors elsewhere.
+func referencesKey(cond, key string) bool {
+	keys, err := conditionKeys(cond)
+	if err != nil {
+		return false
+	}
+	for _, k := range keys {
+		if k == key {
+			return true
+		}
+	}
+	return false
+}
+
+// recordFailure stores the details of a failed node in the context so that a
+// recovery branch can inspect them.
+func recordFailure(pctx *PipelineContext, nodeID string, err error, attempts int) {
+	pctx.Set("outcome", string(OutcomeFail))
+	pctx.Set("last_error", err.Error())
+	pctx.Set("last_error_kind", ErrorKind(err))
+	pctx.Set("last_error_node", nodeID)
+	pctx.Set("last_error_attempts", strconv.Itoa(attempts))
+}
+
+// selectExhausted picks the first on=exhausted edge leaving nodeID whose
+// label, if any, holds.  A nil result means the node has no applicable
+// exhausted edge.
+func (e *Engine) selectExhausted(ctx context.Context, nodeID string, pctx *PipelineContext) (*Edge, error) {
+	snap := pctx.Snapshot()
+	for _, edge := range e.pipeline.OutgoingEdges(nodeID) {
+		if edge.On != EdgeOnExhausted {
+			continue
+		}
+		cond := edge.Condition
+		if cond == "" || cond == "_" {
+			return edge, nil
+		}
+		ok, err := EvalConditionContext(ctx, cond, snap)
+		if err != nil {
+			return nil, fmt.Errorf("edge %q→%q: condition %q: %w", edge.From, edge.To, cond, err)
+		}
+		if ok {
+			return edge, nil
+		}
+	}
+	return nil, nil
+}
+
+// maxVisits returns the number of times node may run in one execution: the
+// node's max_visits attribute, else the graph's, else DefaultMaxVisits.
+// Zero means unlimited.  Values are checked by Validate, so a malformed
+// attribute here falls back to the next level.
+func (e *Engine) maxVisits(node *Node) int {
+	if n, ok := parseMaxVisits(node.Attrs["max_visits"]); ok {
+		return n
+	}
+	if n, ok := parseMaxVisits(e.pipeline.Attrs["max_visits"]); ok {
+		return n
+	}
+	return DefaultMaxVisits
+}
+
+// parseMaxVisits parses a max_visits attribute value, which must be a
+// non-negative integer.
+func parseMaxVisits(s string) (int, bool) {
+	if s == "" {
+		return 0, false
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 0 {
+		return 0, false
+	}
+	return n, true
 }
 
 // selectNextSwitch routes a switch node by matching the current value of the
 // context key against edge labels using exact string equality.
 // Falls back to any edge labelled "", "_", or "default" when no label matches.
-func (e *Engine) selectNextSwitch(node *Node, edges []*Edge, pctx *PipelineContext) (string, error) {
+func (e *Engine) selectNextSwitch(node *Node, edges []*Edge, pctx *PipelineContext) (*Edge, error) {
 	key := node.Attrs["key"]
-	ctxVal := fmt.Sprintf("%v", pctx.Snapshot()[key])
+	ctxVal := pctx.GetString(key)
 
 	var defaultEdge *Edge
 	for _, edge := range edges {
+		if edge.On != "" {
+			continue
+		}
 		cond := edge.Condition
 		if cond == "" || cond == "_" || cond == "default" {
 			if defaultEdge == nil {
@@ -299,24 +776,25 @@ func (e *Engine) selectNextSwitch(node *Node, edges []*Edge, pctx *PipelineConte
 			continue
 		}
 		if cond == ctxVal {
-			return edge.To, nil
+			return edge, nil
 		}
 	}
 	if defaultEdge != nil {
-		return defaultEdge.To, nil
+		return defaultEdge, nil
 	}
-	return "", fmt.Errorf("switch node %q: no edge matches value %q and no default edge", node.ID, ctxVal)
+	return nil, fmt.Errorf("switch node %q: no edge matches value %q and no default edge", node.ID, ctxVal)
 }
 
-// executeWithRetry calls h.Handle and, on error, retries up to retry_max
-// additional times with retry_delay between attempts.  ExitSignal errors are
-// never retried — they are returned immediately.
+// executeWithRetry runs h (see runHandler) and, on failure, retries up to
+// retry_max additional times with retry_delay between attempts.  ExitSignal
+// errors are never retried — they are returned immediately.  The final
+// outcome and the number of attempts made are returned alongside the error.
 //
 // Node attributes consulted:
 //
 //	retry_max   — integer ≥ 0 (default 0, meaning no retry)
 //	retry_delay — duration string (default "0s")
-func executeWithRetry(ctx context.Context, h Handler, node *Node, pctx *PipelineContext) error {
+func executeWithRetry(ctx context.Context, h Handler, node *Node, pctx *PipelineContext) (Outcome, int, error) {
 	maxRetries := 0
 	if s := node.Attrs["retry_max"]; s != "" {
 		if n, err := strconv.Atoi(s); err == nil && n > 0 {
@@ -331,35 +809,45 @@ func executeWithRetry(ctx context.Context, h Handler, node *Node, pctx *Pipeline
 		}
 	}
 
-	var lastErr error
+	var (
+		out     Outcome
+		lastErr error
+	)
 	for attempt := 0; attempt <= maxRetries; attempt++ {
 		if attempt > 0 {
 			slog.Warn("retrying node", "node", node.ID, "attempt", attempt, "max", maxRetries)
+			Emit(ctx, Event{
+				Type:     EventNodeRetry,
+				NodeID:   node.ID,
+				NodeType: node.Type,
+				Attempt:  attempt + 1,
+				Error:    lastErr.Error(),
+			})
 			if retryDelay > 0 {
 				timer := time.NewTimer(retryDelay)
 				select {
 				case <-ctx.Done():
 					timer.Stop()
-					return fmt.Errorf("node %q: retry cancelled: %w", node.ID, ctx.Err())
+					return out, attempt, fmt.Errorf("node %q: retry cancelled: %w", node.ID, ctx.Err())
 				case <-timer.C:
 				}
 			}
 		}
 
-		lastErr = h.Handle(ctx, node, pctx)
+		out, lastErr = runHandler(ctx, h, node, pctx)
 		if lastErr == nil {
-			return nil
+			return out, attempt + 1, nil
 		}
 
 		// ExitSignal must propagate immediately — never retry.
 		var exitSig ExitSignal
 		if errors.As(lastErr, &exitSig) {
-			return lastErr
+			return out, attempt + 1, lastErr
 		}
 	}
 
 	if maxRetries > 0 {
-		return fmt.Errorf("after %d attempt(s): %w", maxRetries+1, lastErr)
+		return out, maxRetries + 1, fmt.Errorf("after %d attempt(s): %w", maxRetries+1, lastErr)
 	}
-	return lastErr
+	return out, 1, lastErr
 }
@@ -0,0 +1,133 @@
+package pipeline_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/ravi-parthasarathy/attractor/pkg/pipeline"
+)
+
+const convertSrc = `digraph demo {
+    goal="Ship it"
+    model_stylesheet="* { model: \"m1\" } type[exec] { model: \"m2\" }"
+
+    subgraph params {
+        repo  [required=true]
+        flags [type=list default="[\"-v\"]"]
+    }
+
+    start [type=start]
+    build [type=exec cmd="make \"{{.repo}}\" \\
+      && echo {done}" timeout="5m"]
+    fix   [prompt="Fix: {{.build_output}}"]
+    exit  [type=exit]
+
+    start -> build
+    build -> exit [label="outcome == 'success' && build_exit_code == 0"]
+    build -> fix  [on=failure]
+    fix   -> build
+}
+`
+
+func TestEncode(t *testing.T) {
+	p, err := pipeline.ParseDOT(convertSrc)
+	if err != nil {
+		t.Fatalf("ParseDOT: %v", err)
+	}
+	want, err := pipeline.Encode(p, pipeline.SyntaxDOT)
+	if err != nil {
+		t.Fatalf("Encode dot: %v", err)
+	}
+	for _, syn := range []pipeline.Syntax{pipeline.SyntaxYAML, pipeline.SyntaxJSON} {
+		out, err := pipeline.Encode(p, syn)
+		if err != nil {
+			t.Fatalf("Encode %s: %v", syn, err)
+		}
+		q, err := pipeline.Parse(out, syn)
+		if err != nil {
+			t.Fatalf("Parse %s: %v\n%s", syn, err, out)
+		}
+		if q.Stylesheet == nil || len(q.Stylesheet.Rules) != 2 || q.Stylesheet.Rules[1].Model != "m2" {
+			t.Errorf("%s stylesheet = %+v", syn, q.Stylesheet)
+		}
+		if got := q.Edges[1].Condition; got != p.Edges[1].Condition {
+			t.Errorf("%s condition = %q, want %q", syn, got, p.Edges[1].Condition)
+		}
+		// Back in DOT, the pipeline reads as it did.
+		if got, err := pipeline.Encode(q, pipeline.SyntaxDOT); err != nil || got != want {
+			t.Errorf("%s to dot = %v\n%s\nwant\n%s", syn, err, got, want)
+		}
+	}
+
+	yaml, _ := pipeline.Encode(p, pipeline.SyntaxYAML)
+	for _, s := range []string{
+		"name: demo\n",
+		"stylesheet: '* { model: \"m1\" } type[exec] { model: \"m2\" }'\n",
+		"  flags: {type: list, default: '[\"-v\"]'}\n",
+		"    cmd: |-\n      make \"{{.repo}}\" \\\n            && echo {done}\n",
+		"  - {from: build, to: fix, on: failure}\n",
+	} {
+		if !strings.Contains(yaml, s) {
+			t.Errorf("yaml lacks %q:\n%s", s, yaml)
+		}
+	}
+}
+
+func TestEncode_DOTStrings(t *testing.T) {
+	// Every value survives the trip through DOT, quotes and backslashes
+	// included.
+	values := map[string]string{
+		"dir":    `C:\`,
+		"say":    `say "hi"`,
+		"json":   `{"msg": "a \"quoted\" word", "path": "C:\\tmp"}`,
+		"share":  `\\server\share`,
+		"prompt": `one\ntwo`,
+		"mixed":  `\"\\"`,
+	}
+	var sb strings.Builder
+	sb.WriteString("nodes:\n  start:\n    type: start\n")
+	for k, v := range values {
+		fmt.Fprintf(&sb, "    %s: '%s'\n", k, v)
+	}
+	p, err := pipeline.ParseYAML(sb.String())
+	if err != nil {
+		t.Fatalf("ParseYAML: %v", err)
+	}
+	dot, err := pipeline.Encode(p, pipeline.SyntaxDOT)
+	if err != nil {
+		t.Fatalf("Encode dot: %v", err)
+	}
+	for _, s := range []string{`dir="C:\\"`, `say="say \"hi\""`, `prompt="one\ntwo"`, `share="\\\\server\share"`, `"C:\\\\tmp\"`} {
+		if !strings.Contains(dot, s) {
+			t.Errorf("dot lacks %s:\n%s", s, dot)
+		}
+	}
+	q, err := pipeline.ParseDOT(dot)
+	if err != nil {
+		t.Fatalf("ParseDOT: %v\n%s", err, dot)
+	}
+	for k, v := range values {
+		if got := q.Nodes["start"].Attrs[k]; got != v {
+			t.Errorf("%s after yaml -> dot = %q, want %q", k, got, v)
+		}
+	}
+	yaml, err := pipeline.Encode(q, pipeline.SyntaxYAML)
+	if err != nil {
+		t.Fatalf("Encode yaml: %v", err)
+	}
+	if again, err := pipeline.Parse(yaml, pipeline.SyntaxYAML); err != nil {
+		t.Errorf("Parse yaml: %v", err)
+	} else if back, err := pipeline.Encode(again, pipeline.SyntaxDOT); err != nil || back != dot {
+		t.Errorf("dot -> yaml -> dot = %v\n%s\nwant\n%s", err, back, dot)
+	}
+
+	for path, want := range map[string]pipeline.Syntax{
+		"a.dot": pipeline.SyntaxDOT, "a.gv": pipeline.SyntaxDOT,
+		"a.yaml": pipeline.SyntaxYAML, "a.YML": pipeline.SyntaxYAML, "a.json": pipeline.SyntaxJSON,
+	} {
+		if got := pipeline.SyntaxOf(path); got != want {
+			t.Errorf("SyntaxOf(%q) = %s, want %s", path, got, want)
+		}
+	}
+}
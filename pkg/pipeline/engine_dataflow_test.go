@@ -0,0 +1,103 @@
+package pipeline_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/ravi-parthasarathy/attractor/pkg/pipeline"
+)
+
+func dataflowWarnings(t *testing.T, src string, vars map[string]any) string {
+	t.Helper()
+	p, err := pipeline.ParseDOT(src)
+	if err != nil {
+		t.Fatalf("ParseDOT: %v", err)
+	}
+	if errs := pipeline.Validate(p); len(errs) != 0 {
+		t.Fatalf("Validate = %v", errs)
+	}
+	var msgs []string
+	for _, w := range pipeline.CheckDataflow(p, vars) {
+		msgs = append(msgs, w.Error())
+	}
+	return strings.Join(msgs, "\n")
+}
+
+func TestCheckDataflow(t *testing.T) {
+	got := dataflowWarnings(t, `digraph flow {
+		start   [type=start]
+		ask     [type=set key=summary value="short"]
+		check   [type=exec cmd="test -f x" stdout_key=probe fail_on_error=false]
+		extra   [type=set key=detail value="long"]
+		report  [type=write_file path="out.txt" content="{{.sumary}} {{.detail}} {{.summary}}"]
+		unused  [type=set key=scratch value=1]
+		last    [type=set key=result value=done]
+		exit    [type=exit]
+		start -> ask -> check
+		check -> extra  [label="probe == 'yes'"]
+		check -> report [label="probe.ok"]
+		extra -> report
+		report -> unused -> last [label="{{ .summary }} == short && missing"]
+		last -> exit
+	}`, nil)
+	for _, want := range []string{
+		`node "report": reads "sumary", which no node writes and no param declares (did you mean "summary"?)`,
+		`node "report": reads "detail", which may be undefined: nothing writes it on the path start -> ask -> check -> report`,
+		`node "unused": edge to "last" reads "missing", which no node writes`,
+		`node "unused": writes "scratch", which is never read`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("warnings missing %q:\n%s", want, got)
+		}
+	}
+	// The key written just before the exit is the run's result.
+	for _, unwanted := range []string{`reads "summary"`, `reads "probe`, `"probe", which is never read`, `"result", which is never read`} {
+		if strings.Contains(got, unwanted) {
+			t.Errorf("unexpected warning %q:\n%s", unwanted, got)
+		}
+	}
+}
+
+func TestCheckDataflowScopes(t *testing.T) {
+	// Keys written on every branch of a fan_out, by json_decode with a
+	// prefix, by a loop body before its own edge, and an item bound by
+	// for_each are all defined where they are read.
+	got := dataflowWarnings(t, `digraph scopes {
+		start  [type=start]
+		fan    [type=fan_out]
+		a      [type=set key=left value=1]
+		b      [type=set key=right value=2]
+		join   [type=fan_in]
+		decode [type=json_decode source=left prefix="r_"]
+		each   [type=for_each items=r_files item_key=file cmd="wc -l {{.file}} {{.right}}" results_key=counts]
+		retry  [type=set key=tries value="{{.counts}}"]
+		exit   [type=exit]
+		start -> fan
+		fan -> a -> join
+		fan -> b -> join
+		join -> decode -> each -> retry
+		retry -> each [label="tries != 3"]
+		retry -> exit
+	}`, nil)
+	if got != "" {
+		t.Errorf("CheckDataflow = %s, want no warnings", got)
+	}
+}
+
+func TestCheckDataflowVars(t *testing.T) {
+	src := `digraph vars {
+		subgraph params { depth [type=int default=1] }
+		start [type=start]
+		run   [type=exec cmd="make {{.target}} DEPTH={{.depth}} SEED={{.seed}}"]
+		exit  [type=exit]
+		start -> run -> exit
+	}`
+	got := dataflowWarnings(t, src, map[string]any{"target": "all", "depth": "2"})
+	want := `key "target" is supplied only by --var or --var-file; declare it in subgraph params`
+	if got != want {
+		t.Errorf("CheckDataflow = %q, want %q", got, want)
+	}
+	if got := dataflowWarnings(t, src, nil); !strings.Contains(got, `reads "target", which no node writes`) {
+		t.Errorf("CheckDataflow without vars = %q, want target reported", got)
+	}
+}
@@ -0,0 +1,271 @@
+package pipeline_test
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/ravi-parthasarathy/attractor/pkg/pipeline"
+)
+
+// recorder is an Observer that keeps every event it receives.
+type recorder struct {
+	mu     sync.Mutex
+	events []pipeline.Event
+}
+
+func (r *recorder) OnEvent(ev pipeline.Event) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, ev)
+}
+
+func (r *recorder) types() []pipeline.EventType {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	out := make([]pipeline.EventType, len(r.events))
+	for i, ev := range r.events {
+		out[i] = ev.Type
+	}
+	return out
+}
+
+func (r *recorder) ofType(t pipeline.EventType) []pipeline.Event {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var out []pipeline.Event
+	for _, ev := range r.events {
+		if ev.Type == t {
+			out = append(out, ev)
+		}
+	}
+	return out
+}
+
+// emittingHandler forwards a custom event through pipeline.Emit.
+type emittingHandler struct{}
+
+func (h *emittingHandler) Handle(ctx context.Context, node *pipeline.Node, _ *pipeline.PipelineContext) error {
+	pipeline.Emit(ctx, pipeline.Event{Type: pipeline.EventAgent, NodeID: node.ID, AgentEvent: "tool_call", Tool: "bash"})
+	return nil
+}
+
+func observedRun(t *testing.T, p *pipeline.Pipeline, reg pipeline.HandlerRegistry, obs ...pipeline.Observer) error {
+	t.Helper()
+	eng, err := pipeline.NewEngine(p, reg, pipeline.NewPipelineContext(), "")
+	if err != nil {
+		t.Fatalf("NewEngine: %v", err)
+	}
+	for _, o := range obs {
+		eng.AddObserver(o)
+	}
+	return eng.Execute(context.Background(), "")
+}
+
+func TestEventsSequence(t *testing.T) {
+	t.Parallel()
+	p := &pipeline.Pipeline{
+		Name: "events_test",
+		Nodes: map[string]*pipeline.Node{
+			"s":   {ID: "s", Type: pipeline.NodeTypeStart},
+			"set": {ID: "set", Type: pipeline.NodeTypeSet, Attrs: map[string]string{"key": "flag", "value": "true"}},
+			"e":   {ID: "e", Type: pipeline.NodeTypeExit},
+		},
+		Edges: []*pipeline.Edge{
+			{From: "s", To: "set"},
+			{From: "set", To: "e", Condition: "flag"},
+		},
+	}
+	reg := &stubRegistry{handlers: map[pipeline.NodeType]pipeline.Handler{
+		pipeline.NodeTypeStart: &countingHandler{},
+		pipeline.NodeTypeSet:   &setHandler{},
+		pipeline.NodeTypeExit:  &exitHandler{},
+	}}
+	rec := &recorder{}
+	if err := observedRun(t, p, reg, rec); err != nil {
+		t.Fatalf("Execute: %v", err)
+	}
+
+	want := []pipeline.EventType{
+		pipeline.EventRunStarted,
+		pipeline.EventNodeStarted, pipeline.EventNodeFinished, pipeline.EventContextChanged, pipeline.EventEdgeSelected,
+		pipeline.EventNodeStarted, pipeline.EventNodeFinished, pipeline.EventContextChanged, pipeline.EventEdgeSelected,
+		pipeline.EventNodeStarted, pipeline.EventNodeFinished, pipeline.EventContextChanged,
+		pipeline.EventRunFinished,
+	}
+	if got := rec.types(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("event types:\n got  %v\n want %v", got, want)
+	}
+
+	for _, ev := range rec.events {
+		if ev.Pipeline != "events_test" {
+			t.Errorf("%s event Pipeline = %q, want %q", ev.Type, ev.Pipeline, "events_test")
+		}
+		if ev.Time.IsZero() {
+			t.Errorf("%s event has zero Time", ev.Type)
+		}
+	}
+
+	edges := rec.ofType(pipeline.EventEdgeSelected)
+	if edges[1].From != "set" || edges[1].To != "e" || edges[1].Condition != "flag" {
+		t.Errorf("second edge_selected = %+v, want set→e on condition %q", edges[1], "flag")
+	}
+
+	changed := rec.ofType(pipeline.EventContextChanged)
+	if want := []string{"flag"}; !reflect.DeepEqual(changed[1].Keys, want) {
+		t.Errorf("context_changed keys for set = %v, want %v", changed[1].Keys, want)
+	}
+
+	finished := rec.ofType(pipeline.EventRunFinished)[0]
+	if finished.Status != pipeline.OutcomeSuccess || finished.Error != "" {
+		t.Errorf("run_finished = %+v, want success", finished)
+	}
+}
+
+func TestEventsRetryAndFailure(t *testing.T) {
+	t.Parallel()
+	p := failurePipeline(&pipeline.Edge{From: "work", To: "fix", On: pipeline.EdgeOnFailure})
+	p.Nodes["work"].Attrs = map[string]string{"retry_max": "1", "retry_delay": "0s"}
+	rec := &recorder{}
+	if err := observedRun(t, p, failureRegistry(&alwaysFailHandler{}), rec); err != nil {
+		t.Fatalf("Execute: %v", err)
+	}
+
+	retries := rec.ofType(pipeline.EventNodeRetry)
+	if len(retries) != 1 || retries[0].NodeID != "work" || retries[0].Attempt != 2 {
+		t.Errorf("node_retry events = %+v, want one for work attempt 2", retries)
+	}
+
+	var work pipeline.Event
+	for _, ev := range rec.ofType(pipeline.EventNodeFinished) {
+		if ev.NodeID == "work" {
+			work = ev
+		}
+	}
+	if work.Status != pipeline.OutcomeFail || work.Attempt != 2 || work.Error == "" {
+		t.Errorf("node_finished for work = %+v, want fail after 2 attempts", work)
+	}
+
+	var recovery bool
+	for _, ev := range rec.ofType(pipeline.EventEdgeSelected) {
+		if ev.From == "work" && ev.To == "fix" && ev.On == pipeline.EdgeOnFailure {
+			recovery = true
+		}
+	}
+	if !recovery {
+		t.Error("expected edge_selected for work → fix [on=failure]")
+	}
+}
+
+func TestEventsRunFinishedOnError(t *testing.T) {
+	t.Parallel()
+	p := minimalPipeline("work", nil)
+	reg := &stubRegistry{handlers: map[pipeline.NodeType]pipeline.Handler{
+		pipeline.NodeTypeStart: &countingHandler{},
+		"work":                 &alwaysFailHandler{},
+		pipeline.NodeTypeExit:  &exitHandler{},
+	}}
+	rec := &recorder{}
+	if err := observedRun(t, p, reg, rec); err == nil {
+		t.Fatal("expected error")
+	}
+	finished := rec.ofType(pipeline.EventRunFinished)
+	if len(finished) != 1 || finished[0].Status != pipeline.OutcomeFail || finished[0].Error == "" {
+		t.Errorf("run_finished = %+v, want one failed event", finished)
+	}
+}
+
+func TestEventsFanOutBranches(t *testing.T) {
+	t.Parallel()
+	p := &pipeline.Pipeline{
+		Name: "fan_events",
+		Nodes: map[string]*pipeline.Node{
+			"s":   {ID: "s", Type: pipeline.NodeTypeStart},
+			"fo":  {ID: "fo", Type: pipeline.NodeTypeFanOut},
+			"a":   {ID: "a", Type: "emit"},
+			"b":   {ID: "b", Type: "emit"},
+			"fi":  {ID: "fi", Type: pipeline.NodeTypeFanIn},
+			"end": {ID: "end", Type: pipeline.NodeTypeExit},
+		},
+		Edges: []*pipeline.Edge{
+			{From: "s", To: "fo"},
+			{From: "fo", To: "a"},
+			{From: "fo", To: "b"},
+			{From: "a", To: "fi"},
+			{From: "b", To: "fi"},
+			{From: "fi", To: "end"},
+		},
+	}
+	reg := &stubRegistry{handlers: map[pipeline.NodeType]pipeline.Handler{
+		pipeline.NodeTypeStart:  &countingHandler{},
+		pipeline.NodeTypeFanOut: &noopHandler{},
+		pipeline.NodeTypeFanIn:  &noopHandler{},
+		"emit":                  &emittingHandler{},
+		pipeline.NodeTypeExit:   &exitHandler{},
+	}}
+	rec := &recorder{}
+	if err := observedRun(t, p, reg, rec); err != nil {
+		t.Fatalf("Execute: %v", err)
+	}
+
+	branches := map[string]bool{}
+	for _, ev := range rec.ofType(pipeline.EventBranchFinished) {
+		if ev.NodeID != "fo" || ev.Status != pipeline.OutcomeSuccess {
+			t.Errorf("branch_finished = %+v, want success under fo", ev)
+		}
+		branches[ev.Branch] = true
+	}
+	if !branches["a"] || !branches["b"] || len(branches) != 2 {
+		t.Errorf("finished branches = %v, want a and b", branches)
+	}
+	if n := len(rec.ofType(pipeline.EventBranchStarted)); n != 2 {
+		t.Errorf("branch_started events = %d, want 2", n)
+	}
+
+	// Events emitted by handlers inside branches reach the outer observers.
+	if n := len(rec.ofType(pipeline.EventAgent)); n != 2 {
+		t.Errorf("forwarded handler events = %d, want 2", n)
+	}
+}
+
+func TestEmitWithoutObservers(t *testing.T) {
+	t.Parallel()
+	// Must not panic when the context does not belong to an observed run.
+	pipeline.Emit(context.Background(), pipeline.Event{Type: pipeline.EventAgent})
+}
+
+func TestJSONLTracer(t *testing.T) {
+	t.Parallel()
+	var buf bytes.Buffer
+	tracer := pipeline.NewJSONLTracer(&buf)
+	if err := observedRun(t, minimalPipeline("work", nil), &stubRegistry{handlers: map[pipeline.NodeType]pipeline.Handler{
+		pipeline.NodeTypeStart: &countingHandler{},
+		"work":                 &countingHandler{},
+		pipeline.NodeTypeExit:  &exitHandler{},
+	}}, tracer); err != nil {
+		t.Fatalf("Execute: %v", err)
+	}
+	if err := tracer.Err(); err != nil {
+		t.Fatalf("tracer: %v", err)
+	}
+
+	var types []string
+	sc := bufio.NewScanner(&buf)
+	for sc.Scan() {
+		var line map[string]any
+		if err := json.Unmarshal(sc.Bytes(), &line); err != nil {
+			t.Fatalf("line %q is not JSON: %v", sc.Text(), err)
+		}
+		if _, ok := line["time"]; !ok {
+			t.Errorf("line %q has no time field", sc.Text())
+		}
+		types = append(types, line["type"].(string))
+	}
+	if len(types) == 0 || types[0] != string(pipeline.EventRunStarted) || types[len(types)-1] != string(pipeline.EventRunFinished) {
+		t.Errorf("trace types = %v, want run_started … run_finished", types)
+	}
+}
@@ -0,0 +1,205 @@
+package pipeline_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/ravi-parthasarathy/attractor/pkg/pipeline"
+)
+
+// kindFailHandler always fails with a NodeError of the given kind.
+type kindFailHandler struct {
+	kind string
+}
+
+func (h *kindFailHandler) Handle(_ context.Context, node *pipeline.Node, _ *pipeline.PipelineContext) error {
+	return &pipeline.NodeError{Kind: h.kind, Err: errors.New("tests failed in " + node.ID)}
+}
+
+// failurePipeline builds s → work → e with a recovery node "fix" reachable
+// from work via the given edge, and fix → e.
+func failurePipeline(recovery *pipeline.Edge) *pipeline.Pipeline {
+	return &pipeline.Pipeline{
+		Name: "failure_test",
+		Nodes: map[string]*pipeline.Node{
+			"s":    {ID: "s", Type: pipeline.NodeTypeStart},
+			"work": {ID: "work", Type: "work", Attrs: map[string]string{}},
+			"fix":  {ID: "fix", Type: pipeline.NodeTypeSet, Attrs: map[string]string{"key": "fixed", "value": "yes"}},
+			"e":    {ID: "e", Type: pipeline.NodeTypeExit},
+		},
+		Edges: []*pipeline.Edge{
+			{From: "s", To: "work"},
+			{From: "work", To: "e"},
+			recovery,
+			{From: "fix", To: "e"},
+		},
+	}
+}
+
+func failureRegistry(work pipeline.Handler) *stubRegistry {
+	return &stubRegistry{handlers: map[pipeline.NodeType]pipeline.Handler{
+		pipeline.NodeTypeStart: &countingHandler{},
+		"work":                 work,
+		pipeline.NodeTypeSet:   &setHandler{},
+		pipeline.NodeTypeExit:  &exitHandler{},
+	}}
+}
+
+func TestFailureEdgeOnAttr(t *testing.T) {
+	t.Parallel()
+	p := failurePipeline(&pipeline.Edge{From: "work", To: "fix", On: pipeline.EdgeOnFailure})
+	pctx := pipeline.NewPipelineContext()
+	eng, err := pipeline.NewEngine(p, failureRegistry(&kindFailHandler{kind: pipeline.ErrorKindExitCode}), pctx, "")
+	if err != nil {
+		t.Fatalf("NewEngine: %v", err)
+	}
+	if err := eng.Execute(context.Background(), ""); err != nil {
+		t.Fatalf("expected recovery branch to absorb failure, got: %v", err)
+	}
+	if got := pctx.GetString("fixed"); got != "yes" {
+		t.Errorf("fixed = %q, want %q (recovery branch not taken)", got, "yes")
+	}
+	if got := pctx.GetString("last_error"); !strings.Contains(got, "tests failed in work") {
+		t.Errorf("last_error = %q, want handler message", got)
+	}
+	if got := pctx.GetString("last_error_kind"); got != pipeline.ErrorKindExitCode {
+		t.Errorf("last_error_kind = %q, want %q", got, pipeline.ErrorKindExitCode)
+	}
+	if got := pctx.GetString("last_error_node"); got != "work" {
+		t.Errorf("last_error_node = %q, want %q", got, "work")
+	}
+	if got := pctx.GetString("last_error_attempts"); got != "1" {
+		t.Errorf("last_error_attempts = %q, want %q", got, "1")
+	}
+}
+
+func TestFailureEdgeOutcomeCondition(t *testing.T) {
+	t.Parallel()
+	p := failurePipeline(&pipeline.Edge{From: "work", To: "fix", Condition: "outcome == 'fail'"})
+	pctx := pipeline.NewPipelineContext()
+	eng, err := pipeline.NewEngine(p, failureRegistry(&alwaysFailHandler{}), pctx, "")
+	if err != nil {
+		t.Fatalf("NewEngine: %v", err)
+	}
+	if err := eng.Execute(context.Background(), ""); err != nil {
+		t.Fatalf("Execute: %v", err)
+	}
+	if got := pctx.GetString("fixed"); got != "yes" {
+		t.Errorf("fixed = %q, want %q", got, "yes")
+	}
+	if got := pctx.GetString("last_error_kind"); got != pipeline.ErrorKindError {
+		t.Errorf("last_error_kind = %q, want %q", got, pipeline.ErrorKindError)
+	}
+}
+
+func TestFailureEdgeNotTakenOnSuccess(t *testing.T) {
+	t.Parallel()
+	p := failurePipeline(&pipeline.Edge{From: "work", To: "fix", On: pipeline.EdgeOnFailure})
+	// Put the failure edge first so definition order cannot explain the result.
+	p.Edges[1], p.Edges[2] = p.Edges[2], p.Edges[1]
+	pctx := pipeline.NewPipelineContext()
+	eng, err := pipeline.NewEngine(p, failureRegistry(&countingHandler{}), pctx, "")
+	if err != nil {
+		t.Fatalf("NewEngine: %v", err)
+	}
+	if err := eng.Execute(context.Background(), ""); err != nil {
+		t.Fatalf("Execute: %v", err)
+	}
+	if _, ok := pctx.Get("fixed"); ok {
+		t.Error("failure edge followed after a successful node")
+	}
+	if got := pctx.GetString("outcome"); got != string(pipeline.OutcomeSuccess) {
+		t.Errorf("outcome = %q, want %q", got, pipeline.OutcomeSuccess)
+	}
+}
+
+func TestFailureWithoutRecoveryEdgeAborts(t *testing.T) {
+	t.Parallel()
+	// The only extra edge is an unrelated conditional success edge.
+	p := failurePipeline(&pipeline.Edge{From: "work", To: "fix", Condition: "flag"})
+	pctx := pipeline.NewPipelineContext()
+	pctx.Set("flag", "true")
+	eng, err := pipeline.NewEngine(p, failureRegistry(&alwaysFailHandler{}), pctx, "")
+	if err != nil {
+		t.Fatalf("NewEngine: %v", err)
+	}
+	if err := eng.Execute(context.Background(), ""); err == nil {
+		t.Fatal("expected error when no failure edge applies")
+	}
+	if _, ok := pctx.Get("fixed"); ok {
+		t.Error("success edge followed after a failure")
+	}
+}
+
+func TestFailureEdgeRecordsAttempts(t *testing.T) {
+	t.Parallel()
+	p := failurePipeline(&pipeline.Edge{From: "work", To: "fix", On: pipeline.EdgeOnFailure})
+	p.Nodes["work"].Attrs = map[string]string{"retry_max": "2", "retry_delay": "0s"}
+	pctx := pipeline.NewPipelineContext()
+	eng, err := pipeline.NewEngine(p, failureRegistry(&alwaysFailHandler{}), pctx, "")
+	if err != nil {
+		t.Fatalf("NewEngine: %v", err)
+	}
+	if err := eng.Execute(context.Background(), ""); err != nil {
+		t.Fatalf("Execute: %v", err)
+	}
+	if got := pctx.GetString("last_error_attempts"); got != "3" {
+		t.Errorf("last_error_attempts = %q, want %q", got, "3")
+	}
+}
+
+func TestFailureEdgeConditionFiltersByKind(t *testing.T) {
+	t.Parallel()
+	p := failurePipeline(&pipeline.Edge{
+		From:      "work",
+		To:        "fix",
+		On:        pipeline.EdgeOnFailure,
+		Condition: "last_error_kind == 'timeout'",
+	})
+	pctx := pipeline.NewPipelineContext()
+	eng, err := pipeline.NewEngine(p, failureRegistry(&kindFailHandler{kind: pipeline.ErrorKindExitCode}), pctx, "")
+	if err != nil {
+		t.Fatalf("NewEngine: %v", err)
+	}
+	if err := eng.Execute(context.Background(), ""); err == nil {
+		t.Fatal("expected error: failure edge condition should not match an exit_code failure")
+	}
+}
+
+func TestParseDOT_FailureEdge(t *testing.T) {
+	src := `digraph f {
+		s    [type=start]
+		work [type=exec cmd="make test"]
+		fix  [type=set key="fixed" value="yes"]
+		e    [type=exit]
+		s    -> work
+		work -> e
+		work -> fix [on=failure]
+		fix  -> e
+	}`
+	p, err := pipeline.ParseDOT(src)
+	if err != nil {
+		t.Fatalf("ParseDOT: %v", err)
+	}
+	var found bool
+	for _, e := range p.OutgoingEdges("work") {
+		if e.To == "fix" && e.On == pipeline.EdgeOnFailure {
+			found = true
+		}
+	}
+	if !found {
+		t.Error("expected work -> fix edge with on=failure")
+	}
+	if err := pipeline.ValidateErr(p); err != nil {
+		t.Errorf("expected valid pipeline, got: %v", err)
+	}
+}
+
+func TestValidate_UnknownEdgeTrigger(t *testing.T) {
+	p := failurePipeline(&pipeline.Edge{From: "work", To: "fix", On: "sometimes"})
+	if err := pipeline.ValidateErr(p); err == nil {
+		t.Error("expected lint error for unknown on= value")
+	}
+}
@@ -0,0 +1,189 @@
+package pipeline_test
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/ravi-parthasarathy/attractor/pkg/pipeline"
+)
+
+// branchHandler records how often each node runs and sets <id>_out.  While
+// broken, b2 fails once a2 and c1 have finished, so the other branches are
+// complete when the fan_out gives up.
+type branchHandler struct {
+	mu     sync.Mutex
+	calls  map[string]int
+	broken bool
+	others sync.WaitGroup
+}
+
+func newBranchHandler(broken bool) *branchHandler {
+	h := &branchHandler{calls: make(map[string]int), broken: broken}
+	if broken {
+		h.others.Add(2)
+	}
+	return h
+}
+
+func (h *branchHandler) Handle(_ context.Context, node *pipeline.Node, pctx *pipeline.PipelineContext) error {
+	h.mu.Lock()
+	h.calls[node.ID]++
+	h.mu.Unlock()
+	if h.broken {
+		switch node.ID {
+		case "b2":
+			h.others.Wait()
+			return errors.New("b2 is broken")
+		case "a2", "c1":
+			defer h.others.Done()
+		}
+	}
+	pctx.Set(node.ID+"_out", "v-"+node.ID)
+	return nil
+}
+
+const branchResumeDOT = `digraph branches {
+	s  [type=start]
+	fo [type=fan_out]
+	a1 [type=work]
+	a2 [type=work]
+	b1 [type=work]
+	b2 [type=work]
+	c1 [type=work]
+	j  [type=fan_in]
+	r  [type=work]
+	e  [type=exit]
+
+	s  -> fo
+	fo -> a1 -> a2 -> j
+	fo -> b1 -> b2 -> j
+	fo -> c1 -> j
+	j  -> r -> e
+}`
+
+func branchEngine(t *testing.T, work *branchHandler, pctx *pipeline.PipelineContext, cpPath string) *pipeline.Engine {
+	t.Helper()
+	p, err := pipeline.ParseDOT(branchResumeDOT)
+	if err != nil {
+		t.Fatalf("ParseDOT: %v", err)
+	}
+	reg := &stubRegistry{handlers: map[pipeline.NodeType]pipeline.Handler{
+		pipeline.NodeTypeStart: &countingHandler{},
+		pipeline.NodeTypeFanIn: &noopHandler{},
+		"work":                 work,
+		pipeline.NodeTypeExit:  &exitHandler{},
+	}}
+	eng, err := pipeline.NewEngine(p, reg, pctx, cpPath)
+	if err != nil {
+		t.Fatalf("NewEngine: %v", err)
+	}
+	return eng
+}
+
+// failInBranchB runs branchResumeDOT until b2 fails and returns the
+// checkpoint path.
+func failInBranchB(t *testing.T) string {
+	t.Helper()
+	cpPath := filepath.Join(t.TempDir(), "cp.json")
+	eng := branchEngine(t, newBranchHandler(true), pipeline.NewPipelineContext(), cpPath)
+	if err := eng.Execute(context.Background(), ""); err == nil {
+		t.Fatal("expected branch b to fail")
+	}
+	return cpPath
+}
+
+func TestFanOutCheckpointRecordsBranches(t *testing.T) {
+	cp := readCheckpoint(t, failInBranchB(t))
+	if cp.LastNodeID != "fo" || cp.FanOut == nil || cp.FanOut.Node != "fo" {
+		t.Fatalf("checkpoint = %s fan_out=%+v, want progress of fo", cp.LastNodeID, cp.FanOut)
+	}
+	branches := make(map[string]*pipeline.BranchState)
+	for _, b := range cp.FanOut.Branches {
+		branches[b.Start] = b
+	}
+	// A branch cancelled by b's failure just after its last node has not
+	// been marked done, but resumes at the fan_in all the same.
+	atJoin := func(b *pipeline.BranchState) bool {
+		return b != nil && (b.Done || b.Next != nil && b.Next.To == "j")
+	}
+	if a := branches["a1"]; !atJoin(a) || a.Data["a2_out"] != "v-a2" {
+		t.Errorf("branch a1 = %+v, want finished with a2_out", a)
+	}
+	if c := branches["c1"]; !atJoin(c) {
+		t.Errorf("branch c1 = %+v, want finished", c)
+	}
+	b := branches["b1"]
+	if b == nil || b.Done || b.LastNodeID != "b1" || b.Next == nil || b.Next.To != "b2" {
+		t.Errorf("branch b1 = %+v, want b1 completed and next b2", b)
+	}
+	if b != nil && b.Data["a2_out"] != nil {
+		t.Errorf("branch b1 holds another branch's writes: %v", b.Data)
+	}
+	// Branch writes stay out of the run's context until the fan_in.
+	if cp.Data["a2_out"] != nil {
+		t.Errorf("checkpoint context holds branch writes: %v", cp.Data)
+	}
+}
+
+func TestFanOutResumeRunsOnlyUnfinishedBranches(t *testing.T) {
+	cpPath := failInBranchB(t)
+	cp := readCheckpoint(t, cpPath)
+
+	work := newBranchHandler(false)
+	pctx := cp.PipelineContext()
+	eng := branchEngine(t, work, pctx, cpPath)
+	if err := eng.Resume(context.Background(), cp, pipeline.ResumeOptions{}); err != nil {
+		t.Fatalf("Resume: %v", err)
+	}
+
+	for _, id := range []string{"a1", "a2", "b1", "c1"} {
+		if n := work.calls[id]; n != 0 {
+			t.Errorf("%s ran %d times on resume, want 0", id, n)
+		}
+	}
+	for _, id := range []string{"b2", "r"} {
+		if n := work.calls[id]; n != 1 {
+			t.Errorf("%s ran %d times on resume, want 1", id, n)
+		}
+	}
+	for _, key := range []string{"a1_out", "a2_out", "b1_out", "b2_out", "c1_out", "r_out"} {
+		if pctx.GetString(key) == "" {
+			t.Errorf("%s missing after resume", key)
+		}
+	}
+	if got := pctx.GetString("j_merged"); got != "a1,b1,c1" {
+		t.Errorf("j_merged = %q, want a1,b1,c1", got)
+	}
+	if done := readCheckpoint(t, cpPath); !done.Completed || done.FanOut != nil {
+		t.Errorf("final checkpoint = %+v, want completed outside the fan_out", done)
+	}
+}
+
+func TestFanOutResumeRerunLastRestartsBranches(t *testing.T) {
+	cpPath := failInBranchB(t)
+	cp := readCheckpoint(t, cpPath)
+
+	work := newBranchHandler(false)
+	eng := branchEngine(t, work, cp.PipelineContext(), cpPath)
+	if err := eng.Resume(context.Background(), cp, pipeline.ResumeOptions{RerunLast: true}); err != nil {
+		t.Fatalf("Resume: %v", err)
+	}
+	for _, id := range []string{"a1", "a2", "b1", "b2", "c1"} {
+		if n := work.calls[id]; n != 1 {
+			t.Errorf("%s ran %d times, want 1", id, n)
+		}
+	}
+}
+
+func TestFanOutResumeDriftedBranch(t *testing.T) {
+	cp := readCheckpoint(t, failInBranchB(t))
+	cp.FanOut.Branches[0].Start = "gone"
+
+	eng := branchEngine(t, newBranchHandler(false), cp.PipelineContext(), "")
+	if err := eng.Resume(context.Background(), cp, pipeline.ResumeOptions{}); err == nil {
+		t.Error("expected an error for a branch that no longer leaves the fan_out")
+	}
+}
@@ -0,0 +1,205 @@
+package pipeline_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/ravi-parthasarathy/attractor/pkg/pipeline"
+	"github.com/ravi-parthasarathy/attractor/pkg/pipeline/handlers"
+)
+
+// runFanOutDOT parses src and runs it with the real start/set/fan/exit
+// handlers, returning the final context.
+func runFanOutDOT(t *testing.T, src string, vars map[string]string) *pipeline.PipelineContext {
+	t.Helper()
+	pctx, err := execFanOutDOT(t, src, vars)
+	if err != nil {
+		t.Fatalf("Execute: %v", err)
+	}
+	return pctx
+}
+
+// execFanOutDOT is runFanOutDOT for runs that may fail.
+func execFanOutDOT(t *testing.T, src string, vars map[string]string) (*pipeline.PipelineContext, error) {
+	t.Helper()
+	p, err := pipeline.ParseDOT(src)
+	if err != nil {
+		t.Fatalf("ParseDOT: %v", err)
+	}
+	reg := handlers.NewRegistry()
+	reg.Register("start", &handlers.StartHandler{})
+	reg.Register("fan_out", &handlers.FanOutHandler{})
+	reg.Register("set", &handlers.SetHandler{})
+	reg.Register("fan_in", &handlers.FanInHandler{})
+	reg.Register("exit", &handlers.ExitHandler{})
+
+	pctx := pipeline.NewPipelineContext()
+	for k, v := range vars {
+		pctx.Set(k, v)
+	}
+	eng, err := pipeline.NewEngine(p, reg, pctx, "")
+	if err != nil {
+		t.Fatalf("NewEngine: %v", err)
+	}
+	return pctx, eng.Execute(context.Background(), "")
+}
+
+// nestedDOT has an inner fan_out inside one branch of an outer fan_out.  The
+// inner fan_in is the first fan_in reachable from the outer fan_out, so a
+// plain nearest-fan_in search would join the outer section there.
+const nestedDOT = `digraph nested {
+	s     [type=start]
+	outer [type=fan_out]
+	inner [type=fan_out]
+	a     [type=set key="a" value="1"]
+	b     [type=set key="b" value="2"]
+	c     [type=set key="c" value="3"]
+	ij    [type=fan_in]
+	after [type=set key="inner_done" value="{{.b}}{{.c}}"]
+	aa    [type=set key="a2" value="{{.a}}"]
+	oj    [type=fan_in]
+	r     [type=set key="report" value="{{.a2}}-{{.inner_done}}"]
+	e     [type=exit]
+
+	s     -> outer
+	outer -> inner
+	outer -> a
+	inner -> b
+	inner -> c
+	b     -> ij
+	c     -> ij
+	ij    -> after
+	after -> oj
+	a     -> aa
+	aa    -> oj
+	oj    -> r
+	r     -> e
+}`
+
+func TestFanOutNested(t *testing.T) {
+	t.Parallel()
+	pctx := runFanOutDOT(t, nestedDOT, nil)
+	if got := pctx.GetString("report"); got != "1-23" {
+		t.Errorf("report = %q, want %q", got, "1-23")
+	}
+	if got := pctx.GetString("ij_fanin"); got != "complete" {
+		t.Errorf("ij_fanin = %q, want inner fan_in to have run", got)
+	}
+	if got := pctx.GetString("oj_fanin"); got != "complete" {
+		t.Errorf("oj_fanin = %q, want outer fan_in to have run", got)
+	}
+}
+
+func TestFanOutConditionalBranches(t *testing.T) {
+	t.Parallel()
+	src := `digraph cond {
+		s    [type=start]
+		fork [type=fan_out]
+		a    [type=set key="a" value="ran"]
+		b    [type=set key="b" value="ran"]
+		c    [type=set key="c" value="ran"]
+		join [type=fan_in]
+		e    [type=exit]
+		s    -> fork
+		fork -> a [label="want_a"]
+		fork -> b [label="mode == 'full'"]
+		fork -> c
+		a    -> join
+		b    -> join
+		c    -> join
+		join -> e
+	}`
+	pctx := runFanOutDOT(t, src, map[string]string{"want_a": "yes", "mode": "quick"})
+	if got := pctx.GetString("a"); got != "ran" {
+		t.Errorf("a = %q, want selected branch to run", got)
+	}
+	if _, ok := pctx.Get("b"); ok {
+		t.Error("branch b ran although its condition was false")
+	}
+	if got := pctx.GetString("c"); got != "ran" {
+		t.Errorf("c = %q, want unconditional branch to run", got)
+	}
+}
+
+func TestFanOutNoBranchSelected(t *testing.T) {
+	t.Parallel()
+	src := `digraph none {
+		s    [type=start]
+		fork [type=fan_out]
+		a    [type=set key="a" value="ran"]
+		join [type=fan_in]
+		e    [type=exit]
+		s    -> fork
+		fork -> a [label="want_a"]
+		a    -> join
+		join -> e
+	}`
+	pctx := runFanOutDOT(t, src, nil)
+	if _, ok := pctx.Get("a"); ok {
+		t.Error("branch a ran although its condition was false")
+	}
+	if got := pctx.GetString("join_fanin"); got != "complete" {
+		t.Errorf("join_fanin = %q, want run to continue at the fan_in", got)
+	}
+}
+
+func TestFanOutExplicitJoin(t *testing.T) {
+	t.Parallel()
+	// Branch a passes through a stray fan_in before the real join, which
+	// makes structural matching ambiguous; join= resolves it.
+	src := `digraph explicit {
+		s     [type=start]
+		fork  [type=fan_out join="join"]
+		a     [type=set key="a" value="1"]
+		b     [type=set key="b" value="2"]
+		stray [type=fan_in]
+		join  [type=fan_in]
+		e     [type=exit]
+		s     -> fork
+		fork  -> a
+		fork  -> b
+		a     -> stray
+		stray -> join
+		b     -> join
+		join  -> e
+	}`
+	pctx := runFanOutDOT(t, src, nil)
+	if got := pctx.GetString("stray_fanin"); got != "complete" {
+		t.Errorf("stray_fanin = %q, want node inside branch a to run", got)
+	}
+	if got := pctx.GetString("join_fanin"); got != "complete" {
+		t.Errorf("join_fanin = %q, want join to run", got)
+	}
+
+	p, err := pipeline.ParseDOT(strings.Replace(src, `join="join"`, "", 1))
+	if err != nil {
+		t.Fatalf("ParseDOT: %v", err)
+	}
+	if err := pipeline.ValidateErr(p); err == nil || !strings.Contains(err.Error(), "several fan_in nodes") {
+		t.Errorf("expected ambiguous fan_in lint error without join, got %v", err)
+	}
+}
+
+func TestValidate_FanOutBadJoin(t *testing.T) {
+	for _, join := range []string{"missing", "a"} {
+		src := `digraph bad {
+			s    [type=start]
+			fork [type=fan_out join="` + join + `"]
+			a    [type=set key="a" value="1"]
+			j    [type=fan_in]
+			e    [type=exit]
+			s    -> fork
+			fork -> a
+			a    -> j
+			j    -> e
+		}`
+		p, err := pipeline.ParseDOT(src)
+		if err != nil {
+			t.Fatalf("ParseDOT: %v", err)
+		}
+		if err := pipeline.ValidateErr(p); err == nil || !strings.Contains(err.Error(), "join=") {
+			t.Errorf("join=%q: expected lint error, got %v", join, err)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package pipeline_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/ravi-parthasarathy/attractor/pkg/pipeline"
+)
+
+func TestFormatDOT(t *testing.T) {
+	src := `// demo pipeline
+digraph "demo" { // the graph
+  say -> exit [label="outcome == 'success'"]
+  start -> say;
+  rankdir = "LR"
+  start [ type = "start" ]
+  say [cmd="echo {{.greeting}}", type="exec", timeout="30s" // bounded
+  ]
+  greet [
+    // what to say
+    value="hello", type=set, key="greeting"]
+
+
+  exit [type=exit]
+  start -> greet
+  subgraph params { name [default="world", description="Who to greet"] }
+  # trailing note
+}
+`
+	want := `// demo pipeline
+digraph demo { // the graph
+    rankdir=LR
+
+    subgraph params {
+        name [default=world description="Who to greet"]
+    }
+
+    start [type=start]
+    say   [type=exec cmd="echo {{.greeting}}" timeout="30s"] // bounded
+    greet [type=set
+           key=greeting
+           // what to say
+           value=hello]
+
+    exit [type=exit]
+
+    say   -> exit [label="outcome == 'success'"]
+    start -> say
+    start -> greet
+    # trailing note
+}
+`
+	got, err := pipeline.FormatDOT(src)
+	if err != nil {
+		t.Fatalf("FormatDOT: %v", err)
+	}
+	if got != want {
+		t.Errorf("FormatDOT =\n%s\nwant\n%s", got, want)
+	}
+	if again, err := pipeline.FormatDOT(got); err != nil || again != got {
+		t.Errorf("FormatDOT is not idempotent: %v\n%s", err, again)
+	}
+
+	// Long attribute lists go one attribute per line.
+	got, err = pipeline.FormatDOT(`digraph d { n [type=set key=k value="` + strings.Repeat("x", 90) + `"] }`)
+	if err != nil || !strings.Contains(got, "    n [type=set\n       key=k\n       value=") {
+		t.Errorf("FormatDOT of a long node = %v\n%s", err, got)
+	}
+}
+
+func TestFormatDOT_KeepsOrder(t *testing.T) {
+	// Moving the node default above a changes what a gets, so the
+	// statements stay where they are.
+	src := "digraph d {\n  start [type=start]\n  start -> a\n  node [type=exit]\n  a\n}\n"
+	want := "digraph d {\n    start [type=start]\n    start -> a\n    node [type=exit]\n    a\n}\n"
+	got, err := pipeline.FormatDOT(src)
+	if err != nil {
+		t.Fatalf("FormatDOT: %v", err)
+	}
+	if got != want {
+		t.Errorf("FormatDOT =\n%s\nwant\n%s", got, want)
+	}
+
+	if _, err := pipeline.FormatDOT("digraph d { a -> }"); err == nil {
+		t.Error("FormatDOT accepted a syntax error")
+	}
+}
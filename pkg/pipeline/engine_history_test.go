@@ -0,0 +1,113 @@
+package pipeline_test
+
+import (
+	"context"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/ravi-parthasarathy/attractor/pkg/pipeline"
+)
+
+func historyNodes(steps []*pipeline.Checkpoint) []string {
+	var ids []string
+	for _, cp := range steps {
+		ids = append(ids, cp.LastNodeID)
+	}
+	return ids
+}
+
+func readHistory(t *testing.T, cpPath string) []*pipeline.Checkpoint {
+	t.Helper()
+	steps, err := pipeline.ReadHistory(cpPath)
+	if err != nil {
+		t.Fatalf("ReadHistory: %v", err)
+	}
+	return steps
+}
+
+// completedRun runs resumeDOT to the end and returns the checkpoint path.
+func completedRun(t *testing.T) string {
+	t.Helper()
+	cpPath := filepath.Join(t.TempDir(), "cp.json")
+	eng := resumeEngine(t, resumeDOT, &journalHandler{}, pipeline.NewPipelineContext(), cpPath)
+	if err := eng.Execute(context.Background(), ""); err != nil {
+		t.Fatalf("Execute: %v", err)
+	}
+	return cpPath
+}
+
+func TestHistoryRecordsEveryStep(t *testing.T) {
+	t.Parallel()
+	cpPath := completedRun(t)
+	steps := readHistory(t, cpPath)
+	if got := historyNodes(steps); !slices.Equal(got, []string{"s", "a", "b", "e"}) {
+		t.Fatalf("history nodes = %v, want [s a b e]", got)
+	}
+	for i, cp := range steps {
+		if cp.Step != i+1 {
+			t.Errorf("entry %d: Step = %d, want %d", i, cp.Step, i+1)
+		}
+	}
+	// Each step keeps the context as it was then.
+	if _, ok := steps[1].Data["b_done"]; ok {
+		t.Error("step 2 (after a) already holds b_done")
+	}
+	if steps[2].Data["b_done"] != "yes" {
+		t.Error("step 3 (after b) lacks b_done")
+	}
+	if cp := readCheckpoint(t, cpPath); cp.Step != 4 {
+		t.Errorf("checkpoint Step = %d, want 4", cp.Step)
+	}
+}
+
+func TestHistoryRewindToNode(t *testing.T) {
+	t.Parallel()
+	cpPath := completedRun(t)
+	cp, err := pipeline.HistoryNode(readHistory(t, cpPath), "a")
+	if err != nil {
+		t.Fatalf("HistoryNode: %v", err)
+	}
+
+	work := &journalHandler{}
+	eng := resumeEngine(t, resumeDOT, work, cp.PipelineContext(), cpPath)
+	if err := eng.Resume(context.Background(), cp, pipeline.ResumeOptions{}); err != nil {
+		t.Fatalf("Resume: %v", err)
+	}
+	if !slices.Equal(work.calls, []string{"b"}) {
+		t.Errorf("calls = %v, want [b]", work.calls)
+	}
+
+	// The journal keeps the original steps and numbers the new ones after
+	// them.
+	steps := readHistory(t, cpPath)
+	if got := historyNodes(steps); !slices.Equal(got, []string{"s", "a", "b", "e", "b", "e"}) {
+		t.Errorf("history nodes = %v, want [s a b e b e]", got)
+	}
+	if last := steps[len(steps)-1]; last.Step != 6 {
+		t.Errorf("last Step = %d, want 6", last.Step)
+	}
+}
+
+func TestHistoryFreshRunStartsOver(t *testing.T) {
+	t.Parallel()
+	cpPath := completedRun(t)
+	eng := resumeEngine(t, resumeDOT, &journalHandler{}, pipeline.NewPipelineContext(), cpPath)
+	if err := eng.Execute(context.Background(), ""); err != nil {
+		t.Fatalf("Execute: %v", err)
+	}
+	if n := len(readHistory(t, cpPath)); n != 4 {
+		t.Errorf("history has %d steps, want 4", n)
+	}
+}
+
+func TestHistoryStepNotFound(t *testing.T) {
+	t.Parallel()
+	steps := readHistory(t, completedRun(t))
+	if _, err := pipeline.HistoryStep(steps, 9); err == nil {
+		t.Error("expected error for missing step")
+	}
+	if _, err := pipeline.HistoryNode(steps, "nope"); err == nil {
+		t.Error("expected error for node not in history")
+	}
+}
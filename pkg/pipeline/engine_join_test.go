@@ -0,0 +1,211 @@
+package pipeline_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ravi-parthasarathy/attractor/pkg/pipeline"
+)
+
+// delayHandler waits for the node's "delay" attribute, then fails if "fail"
+// is set or else stores "value" under "key".  It returns early with the
+// context's error when cancelled.
+type delayHandler struct{}
+
+func (h *delayHandler) Handle(ctx context.Context, node *pipeline.Node, pctx *pipeline.PipelineContext) error {
+	d, _ := time.ParseDuration(node.Attrs["delay"])
+	select {
+	case <-time.After(d):
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	if node.Attrs["fail"] != "" {
+		return errors.New(node.ID + " failed")
+	}
+	pctx.Set(node.Attrs["key"], node.Attrs["value"])
+	return nil
+}
+
+// joinPipeline fans out to one "work" node per branch spec and joins them at
+// a fan_in with the given attributes.
+func joinPipeline(joinAttrs map[string]string, branches map[string]map[string]string) *pipeline.Pipeline {
+	p := &pipeline.Pipeline{
+		Name: "join_test",
+		Nodes: map[string]*pipeline.Node{
+			"s":    {ID: "s", Type: pipeline.NodeTypeStart},
+			"fork": {ID: "fork", Type: pipeline.NodeTypeFanOut, Attrs: map[string]string{}},
+			"join": {ID: "join", Type: pipeline.NodeTypeFanIn, Attrs: joinAttrs},
+			"e":    {ID: "e", Type: pipeline.NodeTypeExit},
+		},
+		Edges: []*pipeline.Edge{{From: "s", To: "fork"}},
+	}
+	for _, id := range []string{"fast", "slow", "third"} {
+		attrs, ok := branches[id]
+		if !ok {
+			continue
+		}
+		p.Nodes[id] = &pipeline.Node{ID: id, Type: "work", Attrs: attrs}
+		p.Edges = append(p.Edges,
+			&pipeline.Edge{From: "fork", To: id},
+			&pipeline.Edge{From: id, To: "join"})
+	}
+	p.Edges = append(p.Edges, &pipeline.Edge{From: "join", To: "e"})
+	return p
+}
+
+func runJoin(t *testing.T, p *pipeline.Pipeline) (*pipeline.PipelineContext, time.Duration, error) {
+	t.Helper()
+	reg := &stubRegistry{handlers: map[pipeline.NodeType]pipeline.Handler{
+		pipeline.NodeTypeStart: &countingHandler{},
+		pipeline.NodeTypeFanIn: &noopHandler{},
+		"work":                 &delayHandler{},
+		pipeline.NodeTypeExit:  &exitHandler{},
+	}}
+	pctx := pipeline.NewPipelineContext()
+	eng, err := pipeline.NewEngine(p, reg, pctx, "")
+	if err != nil {
+		t.Fatalf("NewEngine: %v", err)
+	}
+	began := time.Now()
+	err = eng.Execute(context.Background(), "")
+	return pctx, time.Since(began), err
+}
+
+// slowBranch never finishes within a test unless cancelled.
+var slowBranch = map[string]string{"delay": "10s", "key": "slow", "value": "done"}
+
+func TestJoinFirstSuccessCancelsSiblings(t *testing.T) {
+	t.Parallel()
+	p := joinPipeline(map[string]string{"mode": "first_success"}, map[string]map[string]string{
+		"fast": {"delay": "10ms", "key": "answer", "value": "fast"},
+		"slow": slowBranch,
+	})
+	pctx, elapsed, err := runJoin(t, p)
+	if err != nil {
+		t.Fatalf("Execute: %v", err)
+	}
+	if elapsed > 5*time.Second {
+		t.Errorf("run took %v; slow branch was not cancelled", elapsed)
+	}
+	if got := pctx.GetString("answer"); got != "fast" {
+		t.Errorf("answer = %q, want %q", got, "fast")
+	}
+	if _, ok := pctx.Get("slow"); ok {
+		t.Error("cancelled branch's writes were merged")
+	}
+	if got := pctx.GetString("join_merged"); got != "fast" {
+		t.Errorf("join_merged = %q, want %q", got, "fast")
+	}
+}
+
+func TestJoinFirstSuccessSkipsFailures(t *testing.T) {
+	t.Parallel()
+	p := joinPipeline(map[string]string{"mode": "first_success"}, map[string]map[string]string{
+		"fast": {"delay": "1ms", "fail": "yes"},
+		"slow": {"delay": "30ms", "key": "answer", "value": "slow"},
+	})
+	pctx, _, err := runJoin(t, p)
+	if err != nil {
+		t.Fatalf("Execute: %v", err)
+	}
+	if got := pctx.GetString("answer"); got != "slow" {
+		t.Errorf("answer = %q, want %q", got, "slow")
+	}
+}
+
+func TestJoinAllFailsFast(t *testing.T) {
+	t.Parallel()
+	p := joinPipeline(nil, map[string]map[string]string{
+		"fast": {"delay": "10ms", "fail": "yes"},
+		"slow": slowBranch,
+	})
+	_, elapsed, err := runJoin(t, p)
+	if err == nil || !strings.Contains(err.Error(), "fast failed") {
+		t.Fatalf("expected fast branch failure, got %v", err)
+	}
+	if elapsed > 5*time.Second {
+		t.Errorf("run took %v; slow branch was not cancelled", elapsed)
+	}
+}
+
+func TestJoinAnyWaitsForAll(t *testing.T) {
+	t.Parallel()
+	p := joinPipeline(map[string]string{"mode": "any"}, map[string]map[string]string{
+		"fast":  {"delay": "1ms", "fail": "yes"},
+		"slow":  {"delay": "20ms", "key": "b", "value": "2"},
+		"third": {"delay": "1ms", "key": "c", "value": "3"},
+	})
+	pctx, _, err := runJoin(t, p)
+	if err != nil {
+		t.Fatalf("Execute: %v", err)
+	}
+	if pctx.GetString("b") != "2" || pctx.GetString("c") != "3" {
+		t.Errorf("b, c = %q, %q; want both successful branches merged", pctx.GetString("b"), pctx.GetString("c"))
+	}
+	if got := pctx.GetString("join_merged"); got != "slow,third" {
+		t.Errorf("join_merged = %q, want %q", got, "slow,third")
+	}
+}
+
+func TestJoinAnyAllFailed(t *testing.T) {
+	t.Parallel()
+	p := joinPipeline(map[string]string{"mode": "any"}, map[string]map[string]string{
+		"fast": {"delay": "1ms", "fail": "yes"},
+		"slow": {"delay": "1ms", "fail": "yes"},
+	})
+	if _, _, err := runJoin(t, p); err == nil {
+		t.Fatal("expected error when no branch succeeds")
+	}
+}
+
+func TestJoinQuorum(t *testing.T) {
+	t.Parallel()
+	p := joinPipeline(map[string]string{"mode": "quorum", "quorum": "2"}, map[string]map[string]string{
+		"fast":  {"delay": "1ms", "key": "a", "value": "1"},
+		"slow":  slowBranch,
+		"third": {"delay": "5ms", "key": "c", "value": "3"},
+	})
+	pctx, elapsed, err := runJoin(t, p)
+	if err != nil {
+		t.Fatalf("Execute: %v", err)
+	}
+	if elapsed > 5*time.Second {
+		t.Errorf("run took %v; slow branch was not cancelled", elapsed)
+	}
+	if got := pctx.GetString("join_merged"); got != "fast,third" {
+		t.Errorf("join_merged = %q, want %q", got, "fast,third")
+	}
+}
+
+func TestJoinQuorumUnreachable(t *testing.T) {
+	t.Parallel()
+	p := joinPipeline(map[string]string{"mode": "quorum", "quorum": "2"}, map[string]map[string]string{
+		"fast":  {"delay": "1ms", "fail": "yes"},
+		"slow":  slowBranch,
+		"third": {"delay": "1ms", "fail": "yes"},
+	})
+	_, elapsed, err := runJoin(t, p)
+	if err == nil || !strings.Contains(err.Error(), "needs 2") {
+		t.Fatalf("expected quorum error, got %v", err)
+	}
+	if elapsed > 5*time.Second {
+		t.Errorf("run took %v; slow branch was not cancelled", elapsed)
+	}
+}
+
+func TestValidate_JoinMode(t *testing.T) {
+	for _, attrs := range []map[string]string{
+		{"mode": "most"},
+		{"mode": "quorum"},
+		{"mode": "quorum", "quorum": "0"},
+		{"mode": "all", "quorum": "2"},
+	} {
+		p := joinPipeline(attrs, map[string]map[string]string{"fast": {}})
+		if err := pipeline.ValidateErr(p); err == nil {
+			t.Errorf("%v: expected lint error", attrs)
+		}
+	}
+}
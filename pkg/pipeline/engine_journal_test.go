@@ -0,0 +1,214 @@
+package pipeline_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ravi-parthasarathy/attractor/pkg/pipeline"
+)
+
+// chainDOT returns a pipeline running n work nodes one after another.
+func chainDOT(n int) string {
+	var sb strings.Builder
+	sb.WriteString("digraph chain {\n\ts [type=start]\n\te [type=exit]\n")
+	for i := 1; i <= n; i++ {
+		fmt.Fprintf(&sb, "\tw%d [type=work]\n", i)
+	}
+	sb.WriteString("\ts")
+	for i := 1; i <= n; i++ {
+		fmt.Fprintf(&sb, " -> w%d", i)
+	}
+	sb.WriteString(" -> e\n}\n")
+	return sb.String()
+}
+
+// bigContext returns a context holding n values of size bytes each.
+func bigContext(n, size int) *pipeline.PipelineContext {
+	pctx := pipeline.NewPipelineContext()
+	for i := range n {
+		pctx.Set(fmt.Sprintf("blob%d", i), strings.Repeat(string(rune('a'+i)), size))
+	}
+	return pctx
+}
+
+func fileSize(t *testing.T, path string) int64 {
+	t.Helper()
+	fi, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fi.Size()
+}
+
+func TestJournalRecordsOnlyChangedKeys(t *testing.T) {
+	const nodes, blob = 60, 1 << 20
+	cpPath := filepath.Join(t.TempDir(), "cp.json")
+	eng := resumeEngine(t, chainDOT(nodes), &journalHandler{}, bigContext(1, blob), cpPath)
+	if err := eng.Execute(context.Background(), ""); err != nil {
+		t.Fatal(err)
+	}
+
+	// The blob is journalled once, in the first entry, not once per step.
+	if size := fileSize(t, pipeline.HistoryPath(cpPath)); size > blob+blob/2 {
+		t.Errorf("journal is %d bytes for a %d-byte context over %d steps", size, blob, nodes+2)
+	}
+
+	cp := readCheckpoint(t, cpPath)
+	if !cp.Completed || len(cp.Data["blob0"].(string)) != blob || cp.Data[fmt.Sprintf("w%d_done", nodes)] != "yes" {
+		t.Errorf("checkpoint = step %d completed=%v with %d keys", cp.Step, cp.Completed, len(cp.Data))
+	}
+	history := readHistory(t, cpPath)
+	if len(history) != nodes+2 {
+		t.Fatalf("history has %d steps, want %d", len(history), nodes+2)
+	}
+	if h := history[10]; h.Data["blob0"] == nil || h.Data["w10_done"] != "yes" || h.Data["w11_done"] != nil {
+		t.Errorf("history step %d has the wrong context: %d keys", h.Step, len(h.Data))
+	}
+}
+
+func TestJournalReplayedAfterSnapshot(t *testing.T) {
+	// The checkpoint file is written at step 1; a's step is only in the
+	// journal, so reading the checkpoint has to replay it.
+	cpPath := failAtB(t)
+	cp := readCheckpoint(t, cpPath)
+	if cp.LastNodeID != "a" || cp.Data["a_done"] != "yes" {
+		t.Fatalf("checkpoint = %s %v, want a with a_done", cp.LastNodeID, cp.Data)
+	}
+
+	// Without the checkpoint file the journal alone still has every step.
+	if err := os.Remove(cpPath); err != nil {
+		t.Fatal(err)
+	}
+	if again := readCheckpoint(t, cpPath); again.Step != cp.Step || again.Data["a_done"] != "yes" {
+		t.Errorf("journal-only checkpoint = step %d %v, want step %d", again.Step, again.Data, cp.Step)
+	}
+}
+
+func TestJournalTornAppendRepairedOnResume(t *testing.T) {
+	cpPath := failAtB(t)
+	f, err := os.OpenFile(pipeline.HistoryPath(cpPath), os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(`{"last_node_id":"b","dat`)
+	f.Close()
+
+	pctx, _, err := pipeline.LoadCheckpoint(cpPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	work := &journalHandler{}
+	eng := resumeEngine(t, resumeDOT, work, pctx, cpPath)
+	if err := eng.Resume(context.Background(), readCheckpoint(t, cpPath), pipeline.ResumeOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	// The fragment was cut off before the resumed steps were appended.
+	history := readHistory(t, cpPath)
+	if got := strings.Join(historyNodes(history), ","); got != "s,a,b,e" {
+		t.Errorf("history nodes = %s, want s,a,b,e", got)
+	}
+	if cp := readCheckpoint(t, cpPath); !cp.Completed || cp.Data["b_done"] != "yes" {
+		t.Errorf("checkpoint after resume = %+v", cp)
+	}
+}
+
+// rewriteStore is the checkpointing the journal replaced, kept as the
+// benchmark's baseline: every Save rewrites the whole checkpoint file and
+// appends the whole checkpoint to the history.
+type rewriteStore struct{ path string }
+
+func (s *rewriteStore) Lock(context.Context) error   { return nil }
+func (s *rewriteStore) Unlock(context.Context) error { return nil }
+func (s *rewriteStore) Close() error                 { return nil }
+
+func (s *rewriteStore) Save(_ context.Context, cp *pipeline.Checkpoint) error {
+	b, err := json.Marshal(cp)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(s.path+".tmp", b, 0o644); err != nil {
+		return err
+	}
+	if err := os.Rename(s.path+".tmp", s.path); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(pipeline.HistoryPath(s.path), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(b, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func (s *rewriteStore) Load(context.Context) (*pipeline.Checkpoint, error) {
+	return nil, pipeline.ErrNoCheckpoint
+}
+
+func (s *rewriteStore) History(context.Context) ([]*pipeline.Checkpoint, error) { return nil, nil }
+
+func (s *rewriteStore) Reset(context.Context) error {
+	for _, p := range []string{s.path, pipeline.HistoryPath(s.path)} {
+		if err := os.Remove(p); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	}
+	return nil
+}
+
+// BenchmarkCheckpoint runs a 500-node pipeline over a context holding 4 MB
+// of values: journalling changed keys, journalling with a snapshot on every
+// step, and, as the baseline, rewriting the whole checkpoint and appending
+// it to the history on every step.
+func BenchmarkCheckpoint(b *testing.B) {
+	const nodes = 500
+	p, err := pipeline.ParseDOT(chainDOT(nodes))
+	if err != nil {
+		b.Fatal(err)
+	}
+	for _, bc := range []struct {
+		name  string
+		store func(path string) pipeline.CheckpointStore
+	}{
+		{"journal", func(path string) pipeline.CheckpointStore {
+			return pipeline.NewFileStore(path)
+		}},
+		{"snapshot_every_step", func(path string) pipeline.CheckpointStore {
+			s := pipeline.NewFileStore(path)
+			s.SetCompactEvery(1)
+			return s
+		}},
+		{"full_rewrite", func(path string) pipeline.CheckpointStore {
+			return &rewriteStore{path: path}
+		}},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			store := bc.store(filepath.Join(b.TempDir(), "cp.json"))
+			for b.Loop() {
+				reg := &stubRegistry{handlers: map[pipeline.NodeType]pipeline.Handler{
+					pipeline.NodeTypeStart: &countingHandler{},
+					"work":                 &journalHandler{},
+					pipeline.NodeTypeExit:  &exitHandler{},
+				}}
+				eng, err := pipeline.NewEngine(p, reg, bigContext(4, 1<<20), "")
+				if err != nil {
+					b.Fatal(err)
+				}
+				eng.SetCheckpointStore(store)
+				if err := eng.Execute(context.Background(), ""); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,231 @@
+package pipeline_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/ravi-parthasarathy/attractor/pkg/pipeline"
+)
+
+// stopAfterHandler sets "stop" once it has been called n times.
+type stopAfterHandler struct {
+	n     int
+	calls int
+}
+
+func (h *stopAfterHandler) Handle(_ context.Context, _ *pipeline.Node, pctx *pipeline.PipelineContext) error {
+	h.calls++
+	if h.calls >= h.n {
+		pctx.Set("stop", "true")
+	}
+	return nil
+}
+
+// loopPipeline builds s → work ⟲ with work → e once "stop" is set, and an
+// on=exhausted edge from work to "out", which sets gave_up before exiting.
+func loopPipeline() *pipeline.Pipeline {
+	return &pipeline.Pipeline{
+		Name: "loop_test",
+		Nodes: map[string]*pipeline.Node{
+			"s":    {ID: "s", Type: pipeline.NodeTypeStart},
+			"work": {ID: "work", Type: "work", Attrs: map[string]string{}},
+			"out":  {ID: "out", Type: pipeline.NodeTypeSet, Attrs: map[string]string{"key": "gave_up", "value": "yes"}},
+			"e":    {ID: "e", Type: pipeline.NodeTypeExit},
+		},
+		Edges: []*pipeline.Edge{
+			{From: "s", To: "work"},
+			{From: "work", To: "e", Condition: "stop"},
+			{From: "work", To: "work", Condition: "!stop"},
+			{From: "work", To: "out", On: pipeline.EdgeOnExhausted},
+			{From: "out", To: "e"},
+		},
+	}
+}
+
+func runLoop(t *testing.T, p *pipeline.Pipeline, work pipeline.Handler) (*pipeline.PipelineContext, error) {
+	t.Helper()
+	reg := &stubRegistry{handlers: map[pipeline.NodeType]pipeline.Handler{
+		pipeline.NodeTypeStart: &countingHandler{},
+		"work":                 work,
+		pipeline.NodeTypeSet:   &setHandler{},
+		pipeline.NodeTypeExit:  &exitHandler{},
+	}}
+	pctx := pipeline.NewPipelineContext()
+	eng, err := pipeline.NewEngine(p, reg, pctx, "")
+	if err != nil {
+		t.Fatalf("NewEngine: %v", err)
+	}
+	return pctx, eng.Execute(context.Background(), "")
+}
+
+func TestLoopDefaultLimitAborts(t *testing.T) {
+	t.Parallel()
+	p := loopPipeline()
+	p.Edges = p.Edges[:3] // no exhausted edge
+	delete(p.Nodes, "out")
+	work := &stopAfterHandler{n: 1000}
+	_, err := runLoop(t, p, work)
+	if err == nil || !strings.Contains(err.Error(), "visit limit reached") {
+		t.Fatalf("expected visit limit error, got %v", err)
+	}
+	if work.calls != pipeline.DefaultMaxVisits {
+		t.Errorf("calls = %d, want %d", work.calls, pipeline.DefaultMaxVisits)
+	}
+}
+
+func TestLoopNodeMaxVisitsFollowsExhaustedEdge(t *testing.T) {
+	t.Parallel()
+	p := loopPipeline()
+	p.Nodes["work"].Attrs["max_visits"] = "3"
+	work := &stopAfterHandler{n: 1000}
+	pctx, err := runLoop(t, p, work)
+	if err != nil {
+		t.Fatalf("Execute: %v", err)
+	}
+	if work.calls != 3 {
+		t.Errorf("calls = %d, want 3", work.calls)
+	}
+	if got := pctx.GetString("gave_up"); got != "yes" {
+		t.Errorf("gave_up = %q, want exhausted edge to be followed", got)
+	}
+	if got := pctx.GetString("work_visits"); got != "3" {
+		t.Errorf("work_visits = %q, want %q", got, "3")
+	}
+}
+
+func TestLoopGraphMaxVisits(t *testing.T) {
+	t.Parallel()
+	p := loopPipeline()
+	p.Attrs = map[string]string{"max_visits": "2"}
+	work := &stopAfterHandler{n: 1000}
+	if _, err := runLoop(t, p, work); err != nil {
+		t.Fatalf("Execute: %v", err)
+	}
+	if work.calls != 2 {
+		t.Errorf("calls = %d, want 2", work.calls)
+	}
+}
+
+func TestLoopNodeOverridesGraphMaxVisits(t *testing.T) {
+	t.Parallel()
+	p := loopPipeline()
+	p.Attrs = map[string]string{"max_visits": "2"}
+	p.Nodes["work"].Attrs["max_visits"] = "4"
+	work := &stopAfterHandler{n: 1000}
+	if _, err := runLoop(t, p, work); err != nil {
+		t.Fatalf("Execute: %v", err)
+	}
+	if work.calls != 4 {
+		t.Errorf("calls = %d, want 4", work.calls)
+	}
+}
+
+func TestLoopUnlimited(t *testing.T) {
+	t.Parallel()
+	p := loopPipeline()
+	p.Nodes["work"].Attrs["max_visits"] = "0"
+	work := &stopAfterHandler{n: pipeline.DefaultMaxVisits + 10}
+	pctx, err := runLoop(t, p, work)
+	if err != nil {
+		t.Fatalf("Execute: %v", err)
+	}
+	if _, ok := pctx.Get("gave_up"); ok {
+		t.Error("exhausted edge followed with max_visits=0")
+	}
+	if work.calls != pipeline.DefaultMaxVisits+10 {
+		t.Errorf("calls = %d, want %d", work.calls, pipeline.DefaultMaxVisits+10)
+	}
+}
+
+func TestLoopVisitsOnlyForCyclicNodes(t *testing.T) {
+	t.Parallel()
+	pctx, err := runLoop(t, loopPipeline(), &stopAfterHandler{n: 2})
+	if err != nil {
+		t.Fatalf("Execute: %v", err)
+	}
+	if got := pctx.GetString("work_visits"); got != "2" {
+		t.Errorf("work_visits = %q, want %q", got, "2")
+	}
+	if _, ok := pctx.Get("s_visits"); ok {
+		t.Error("s_visits set for a node that is not on a cycle")
+	}
+}
+
+func TestExhaustedEdgeNotTakenNormally(t *testing.T) {
+	t.Parallel()
+	p := loopPipeline()
+	// Put the exhausted edge first so definition order cannot explain the result.
+	p.Edges[1], p.Edges[3] = p.Edges[3], p.Edges[1]
+	pctx, err := runLoop(t, p, &stopAfterHandler{n: 1})
+	if err != nil {
+		t.Fatalf("Execute: %v", err)
+	}
+	if _, ok := pctx.Get("gave_up"); ok {
+		t.Error("exhausted edge followed before the visit limit was reached")
+	}
+}
+
+func TestParseDOT_MaxVisits(t *testing.T) {
+	src := `digraph loop {
+		max_visits=5
+		s    [type=start]
+		work [type=set key="n" value="x" max_visits=2]
+		e    [type=exit]
+		s    -> work
+		work -> work [label="!n"]
+		work -> e    [label="n"]
+		work -> e    [on=exhausted]
+	}`
+	p, err := pipeline.ParseDOT(src)
+	if err != nil {
+		t.Fatalf("ParseDOT: %v", err)
+	}
+	if got := p.Attrs["max_visits"]; got != "5" {
+		t.Errorf("graph max_visits = %q, want %q", got, "5")
+	}
+	if got := p.Nodes["work"].Attrs["max_visits"]; got != "2" {
+		t.Errorf("node max_visits = %q, want %q", got, "2")
+	}
+	if err := pipeline.ValidateErr(p); err != nil {
+		t.Errorf("expected valid pipeline, got: %v", err)
+	}
+}
+
+func TestValidate_CycleWithoutWayOut(t *testing.T) {
+	p := &pipeline.Pipeline{
+		Name: "stuck",
+		Nodes: map[string]*pipeline.Node{
+			"s": {ID: "s", Type: pipeline.NodeTypeStart},
+			"a": {ID: "a", Type: "work"},
+			"b": {ID: "b", Type: "work"},
+			"e": {ID: "e", Type: pipeline.NodeTypeExit},
+		},
+		Edges: []*pipeline.Edge{
+			{From: "s", To: "a"},
+			{From: "s", To: "e", Condition: "skip"},
+			{From: "a", To: "b"},
+			{From: "b", To: "a"},
+		},
+	}
+	err := pipeline.ValidateErr(p)
+	if err == nil || !strings.Contains(err.Error(), "cycle through a, b") {
+		t.Fatalf("expected cycle lint error, got %v", err)
+	}
+
+	// An exhausted edge is a way out.
+	p.Edges = append(p.Edges, &pipeline.Edge{From: "b", To: "e", On: pipeline.EdgeOnExhausted})
+	if err := pipeline.ValidateErr(p); err != nil {
+		t.Errorf("expected valid pipeline, got: %v", err)
+	}
+}
+
+func TestValidate_BadMaxVisits(t *testing.T) {
+	p := loopPipeline()
+	p.Nodes["work"].Attrs["max_visits"] = "-1"
+	p.Attrs = map[string]string{"max_visits": "lots"}
+	errs := pipeline.Validate(p)
+	if len(errs) != 2 {
+		t.Fatalf("expected 2 lint errors, got %v", errs)
+	}
+}
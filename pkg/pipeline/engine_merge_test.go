@@ -0,0 +1,126 @@
+package pipeline_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/ravi-parthasarathy/attractor/pkg/pipeline"
+)
+
+// mergeDOT fans out to two branches that both write "out" (with different
+// values) and "n"; a writes "only_a".  The fan_in attributes are spliced in
+// from joinAttrs.
+func mergeDOT(joinAttrs string) string {
+	return `digraph merge {
+		s     [type=start]
+		fork  [type=fan_out]
+		a     [type=set key="out" value="from a"]
+		a2    [type=set key="n" value="2"]
+		a3    [type=set key="only_a" value="yes"]
+		b     [type=set key="out" value="from b"]
+		b2    [type=set key="n" value="3"]
+		join  [type=fan_in ` + joinAttrs + `]
+		e     [type=exit]
+		s     -> fork
+		fork  -> a
+		fork  -> b
+		a     -> a2
+		a2    -> a3
+		a3    -> join
+		b     -> b2
+		b2    -> join
+		join  -> e
+	}`
+}
+
+func TestMergeLastReportsConflicts(t *testing.T) {
+	t.Parallel()
+	pctx := runFanOutDOT(t, mergeDOT(""), nil)
+	// b is the last branch in edge order.
+	if got := pctx.GetString("out"); got != "from b" {
+		t.Errorf("out = %q, want %q", got, "from b")
+	}
+	if got := pctx.GetString("only_a"); got != "yes" {
+		t.Errorf("only_a = %q, want %q", got, "yes")
+	}
+	if got := pctx.GetString("join_conflicts"); got != "n,out" {
+		t.Errorf("join_conflicts = %q, want %q", got, "n,out")
+	}
+}
+
+func TestMergeNoConflictForUnchangedKeys(t *testing.T) {
+	t.Parallel()
+	// A key present before the fan_out and untouched by the branches is not
+	// a write, so it cannot conflict.
+	pctx := runFanOutDOT(t, mergeDOT(`reduce="out:concat,n:sum"`), map[string]string{"shared": "x"})
+	if _, ok := pctx.Get("join_conflicts"); ok {
+		t.Errorf("join_conflicts = %q, want none", pctx.GetString("join_conflicts"))
+	}
+}
+
+func TestMergeNamespace(t *testing.T) {
+	t.Parallel()
+	pctx := runFanOutDOT(t, mergeDOT(`merge=namespace`), nil)
+	if got := pctx.GetString("a.out"); got != "from a" {
+		t.Errorf("a.out = %q, want %q", got, "from a")
+	}
+	if got := pctx.GetString("b.out"); got != "from b" {
+		t.Errorf("b.out = %q, want %q", got, "from b")
+	}
+	if _, ok := pctx.Get("out"); ok {
+		t.Error("un-namespaced key out set under merge=namespace")
+	}
+}
+
+func TestMergeCollect(t *testing.T) {
+	t.Parallel()
+	pctx := runFanOutDOT(t, mergeDOT(`merge=collect`), nil)
+	if got := pctx.GetString("out"); got != `["from a","from b"]` {
+		t.Errorf("out = %s, want JSON array in branch order", got)
+	}
+	if got := pctx.GetString("only_a"); got != `["yes"]` {
+		t.Errorf("only_a = %s, want %s", got, `["yes"]`)
+	}
+}
+
+func TestMergeErrorOnConflict(t *testing.T) {
+	t.Parallel()
+	_, err := execFanOutDOT(t, mergeDOT(`merge=error`), nil)
+	if err == nil {
+		t.Fatal("expected conflict error")
+	}
+	if !strings.Contains(err.Error(), "n, out") {
+		t.Errorf("error %q should name the conflicting keys", err)
+	}
+}
+
+func TestMergeErrorResolvedByReducers(t *testing.T) {
+	t.Parallel()
+	pctx := runFanOutDOT(t, mergeDOT(`merge=error reduce="out:concat, n:sum"`), nil)
+	if got := pctx.GetString("out"); got != "from a\nfrom b" {
+		t.Errorf("out = %q, want concatenation in branch order", got)
+	}
+	if got := pctx.GetString("n"); got != "5" {
+		t.Errorf("n = %q, want %q", got, "5")
+	}
+}
+
+func TestMergeSumNonNumeric(t *testing.T) {
+	t.Parallel()
+	_, err := execFanOutDOT(t, mergeDOT(`reduce="out:sum"`), nil)
+	if err == nil || !strings.Contains(err.Error(), "not a number") {
+		t.Errorf("expected non-numeric sum error, got %v", err)
+	}
+}
+
+func TestValidate_MergeAttrs(t *testing.T) {
+	for _, attrs := range []string{`merge=sometimes`, `reduce="out"`, `reduce="out:median"`} {
+		p, err := pipeline.ParseDOT(mergeDOT(attrs))
+		if err != nil {
+			t.Fatalf("ParseDOT: %v", err)
+		}
+		if err := pipeline.ValidateErr(p); err == nil {
+			t.Errorf("%s: expected lint error", attrs)
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package pipeline_test
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/ravi-parthasarathy/attractor/pkg/pipeline"
+)
+
+// outcomeHandler returns a fixed Outcome from Execute.  Handle is only there
+// to satisfy pipeline.Handler and must never be called by the engine.
+type outcomeHandler struct {
+	out pipeline.Outcome
+}
+
+func (h *outcomeHandler) Handle(_ context.Context, _ *pipeline.Node, _ *pipeline.PipelineContext) error {
+	panic("engine called Handle on an OutcomeHandler")
+}
+
+func (h *outcomeHandler) Execute(_ context.Context, _ *pipeline.Node, _ *pipeline.PipelineContext) (pipeline.Outcome, error) {
+	return h.out, nil
+}
+
+// labelledPipeline builds s → work with two labelled edges, "approve" and
+// "reject", each setting "route" before reaching the exit node.
+func labelledPipeline() *pipeline.Pipeline {
+	return &pipeline.Pipeline{
+		Name: "outcome_test",
+		Nodes: map[string]*pipeline.Node{
+			"s":    {ID: "s", Type: pipeline.NodeTypeStart},
+			"work": {ID: "work", Type: "work"},
+			"yes":  {ID: "yes", Type: pipeline.NodeTypeSet, Attrs: map[string]string{"key": "route", "value": "yes"}},
+			"no":   {ID: "no", Type: pipeline.NodeTypeSet, Attrs: map[string]string{"key": "route", "value": "no"}},
+			"fix":  {ID: "fix", Type: pipeline.NodeTypeSet, Attrs: map[string]string{"key": "route", "value": "fix"}},
+			"e":    {ID: "e", Type: pipeline.NodeTypeExit},
+		},
+		Edges: []*pipeline.Edge{
+			{From: "s", To: "work"},
+			{From: "work", To: "yes", Condition: "approve"},
+			{From: "work", To: "no", Condition: "reject"},
+			{From: "work", To: "fix", On: pipeline.EdgeOnFailure},
+			{From: "yes", To: "e"},
+			{From: "no", To: "e"},
+			{From: "fix", To: "e"},
+		},
+	}
+}
+
+func runOutcome(t *testing.T, out pipeline.Outcome, cpPath string) *pipeline.PipelineContext {
+	t.Helper()
+	return runOutcomePipeline(t, labelledPipeline(), out, cpPath)
+}
+
+func runOutcomePipeline(t *testing.T, p *pipeline.Pipeline, out pipeline.Outcome, cpPath string) *pipeline.PipelineContext {
+	t.Helper()
+	reg := &stubRegistry{handlers: map[pipeline.NodeType]pipeline.Handler{
+		pipeline.NodeTypeStart: &countingHandler{},
+		"work":                 &outcomeHandler{out: out},
+		pipeline.NodeTypeSet:   &setHandler{},
+		pipeline.NodeTypeExit:  &exitHandler{},
+	}}
+	pctx := pipeline.NewPipelineContext()
+	eng, err := pipeline.NewEngine(p, reg, pctx, cpPath)
+	if err != nil {
+		t.Fatalf("NewEngine: %v", err)
+	}
+	if err := eng.Execute(context.Background(), ""); err != nil {
+		t.Fatalf("Execute: %v", err)
+	}
+	return pctx
+}
+
+func TestOutcomePreferredLabel(t *testing.T) {
+	t.Parallel()
+	// Neither label is a truthy context key, so only the preferred label can
+	// select the "reject" edge.
+	pctx := runOutcome(t, pipeline.Outcome{PreferredLabel: "Reject"}, "")
+	if got := pctx.GetString("route"); got != "no" {
+		t.Errorf("route = %q, want %q", got, "no")
+	}
+}
+
+func TestOutcomeOutputsApplied(t *testing.T) {
+	t.Parallel()
+	pctx := runOutcome(t, pipeline.Outcome{
+		PreferredLabel: "approve",
+		Outputs:        map[string]any{"report": "3 of 4 passed"},
+	}, "")
+	if got := pctx.GetString("report"); got != "3 of 4 passed" {
+		t.Errorf("report = %q, want declared output", got)
+	}
+	if got := pctx.GetString("route"); got != "yes" {
+		t.Errorf("route = %q, want %q", got, "yes")
+	}
+}
+
+func TestOutcomePartialStatusCondition(t *testing.T) {
+	t.Parallel()
+	p := labelledPipeline()
+	p.Edges[1].Condition = "outcome == 'partial'"
+	pctx := runOutcomePipeline(t, p, pipeline.Outcome{Status: pipeline.OutcomePartial}, "")
+	if got := pctx.GetString("route"); got != "yes" {
+		t.Errorf("route = %q, want %q", got, "yes")
+	}
+}
+
+func TestOutcomeFailStatusRoutesFailure(t *testing.T) {
+	t.Parallel()
+	pctx := runOutcome(t, pipeline.Outcome{
+		Status: pipeline.OutcomeFail,
+		Notes:  "lint found 3 problems",
+	}, "")
+	if got := pctx.GetString("route"); got != "fix" {
+		t.Errorf("route = %q, want %q", got, "fix")
+	}
+	if got := pctx.GetString("last_error"); got != "lint found 3 problems" {
+		t.Errorf("last_error = %q, want notes", got)
+	}
+}
+
+func TestOutcomeRecordedInCheckpoint(t *testing.T) {
+	t.Parallel()
+	cpPath := filepath.Join(t.TempDir(), "cp.json")
+	runOutcome(t, pipeline.Outcome{PreferredLabel: "approve"}, cpPath)
+
+	// The final checkpoint is written by the exit node.
+
+	cp, err := pipeline.ReadCheckpoint(cpPath)
+	if err != nil {
+		t.Fatalf("ReadCheckpoint: %v", err)
+	}
+	if cp.LastNodeID != "e" {
+		t.Errorf("LastNodeID = %q, want %q", cp.LastNodeID, "e")
+	}
+	if cp.Outcome == nil || cp.Outcome.Status != pipeline.OutcomeSuccess {
+		t.Errorf("Outcome = %+v, want success", cp.Outcome)
+	}
+}
@@ -0,0 +1,170 @@
+package pipeline_test
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/ravi-parthasarathy/attractor/pkg/pipeline"
+)
+
+const paramsDOT = `digraph params_test {
+	subgraph params {
+		repo  [type=string required=true description="Repository to build"]
+		depth [type=int default=1]
+		mode  [enum="fast, full" default=fast]
+		ratio [type=number]
+		tags  [type=list default="[\"a\"]"]
+	}
+	start [type=start]
+	exit  [type=exit]
+	start -> exit
+}`
+
+func parseParams(t *testing.T, src string) *pipeline.Pipeline {
+	t.Helper()
+	p, err := pipeline.ParseDOT(src)
+	if err != nil {
+		t.Fatalf("ParseDOT: %v", err)
+	}
+	return p
+}
+
+func TestParseParams(t *testing.T) {
+	p := parseParams(t, paramsDOT)
+	if len(p.Nodes) != 2 {
+		t.Errorf("nodes = %d, want 2 (params are not nodes)", len(p.Nodes))
+	}
+	var names []string
+	for _, prm := range p.Params {
+		names = append(names, prm.Name)
+	}
+	if got := strings.Join(names, ","); got != "repo,depth,mode,ratio,tags" {
+		t.Errorf("params = %s, want declaration order", got)
+	}
+	repo := p.Param("repo")
+	if repo.Type != pipeline.ParamString || !repo.Required || repo.HasDefault || repo.Description != "Repository to build" {
+		t.Errorf("repo = %+v", repo)
+	}
+	mode := p.Param("mode")
+	if mode.Type != pipeline.ParamString || !mode.HasDefault || mode.Default != "fast" || !reflect.DeepEqual(mode.Enum, []string{"fast", "full"}) {
+		t.Errorf("mode = %+v", mode)
+	}
+	if tags := p.Param("tags"); tags.Default != `["a"]` {
+		t.Errorf("tags default = %q, want the quotes unescaped", tags.Default)
+	}
+	if errs := pipeline.Validate(p); len(errs) != 0 {
+		t.Errorf("Validate = %v, want no errors", errs)
+	}
+}
+
+func TestValidateParams(t *testing.T) {
+	p := parseParams(t, `digraph bad {
+		subgraph params {
+			a [type=integer]
+			b [required=maybe]
+			c [required=true default=x]
+			d [type=int default=one]
+			e [enum="x,y" default=z]
+			f [type=bool enum="true,perhaps"]
+		}
+		start [type=start]
+		exit  [type=exit]
+		start -> exit
+	}`)
+	var msgs []string
+	for _, e := range pipeline.Validate(p) {
+		msgs = append(msgs, e.Error())
+	}
+	got := strings.Join(msgs, "\n")
+	for _, want := range []string{
+		`param "a": unknown type "integer"`,
+		`param "b": required="maybe" must be true or false`,
+		`param "c": a required param cannot have a default`,
+		`param "d": default: "one" is not a valid int`,
+		`param "e": default: "z" is not one of x, y`,
+		`param "f": enum value: "perhaps" is not a valid bool`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("lint errors missing %q:\n%s", want, got)
+		}
+	}
+}
+
+func TestBindParams(t *testing.T) {
+	p := parseParams(t, paramsDOT)
+	got, err := p.BindParams(map[string]any{
+		"repo":  "attractor",
+		"ratio": "0.5",
+		"mode":  "full",
+	})
+	if err != nil {
+		t.Fatalf("BindParams: %v", err)
+	}
+	want := map[string]any{
+		"repo":  "attractor",
+		"depth": int64(1),
+		"mode":  "full",
+		"ratio": 0.5,
+		"tags":  []any{"a"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("BindParams = %#v, want %#v", got, want)
+	}
+
+	// Typed values, as from --var-file, must already have the type.
+	got, err = p.BindParams(map[string]any{"repo": "x", "depth": int64(3), "ratio": int64(2)})
+	if err != nil {
+		t.Fatalf("BindParams: %v", err)
+	}
+	if got["depth"] != int64(3) || got["ratio"] != int64(2) {
+		t.Errorf("BindParams = %v, want depth 3 and ratio 2", got)
+	}
+}
+
+func TestBindParamsErrors(t *testing.T) {
+	p := parseParams(t, paramsDOT)
+	_, err := p.BindParams(map[string]any{
+		"depth":  "deep",
+		"mode":   "slow",
+		"tags":   true,
+		"colour": "red",
+	})
+	if err == nil {
+		t.Fatal("BindParams succeeded, want errors")
+	}
+	for _, want := range []string{
+		`unknown variable "colour"`,
+		`missing required param "repo"`,
+		`param "depth": "deep" is not a valid int`,
+		`param "mode": "slow" is not one of fast, full`,
+		`param "tags": want list, got bool true`,
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error missing %q:\n%v", want, err)
+		}
+	}
+}
+
+func TestBindParamOverrides(t *testing.T) {
+	p := parseParams(t, paramsDOT)
+	got, err := p.BindParamOverrides(map[string]any{"depth": "5"})
+	if err != nil {
+		t.Fatalf("BindParamOverrides: %v", err)
+	}
+	if want := map[string]any{"depth": int64(5)}; !reflect.DeepEqual(got, want) {
+		t.Errorf("BindParamOverrides = %v, want only the override", got)
+	}
+	if _, err := p.BindParamOverrides(map[string]any{"depth": "x"}); err == nil {
+		t.Error("BindParamOverrides accepted an invalid int")
+	}
+}
+
+func TestBindParamsUndeclared(t *testing.T) {
+	p := parseParams(t, `digraph plain { start [type=start] exit [type=exit] start -> exit }`)
+	vars := map[string]any{"anything": "goes"}
+	got, err := p.BindParams(vars)
+	if err != nil || !reflect.DeepEqual(got, vars) {
+		t.Errorf("BindParams = %v, %v; want vars unchanged", got, err)
+	}
+}
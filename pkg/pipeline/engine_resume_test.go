@@ -0,0 +1,192 @@
+package pipeline_test
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/ravi-parthasarathy/attractor/pkg/pipeline"
+)
+
+// journalHandler appends the ID of every node it runs to calls, and fails
+// while broken is set.
+type journalHandler struct {
+	calls  []string
+	broken bool
+}
+
+func (h *journalHandler) Handle(_ context.Context, node *pipeline.Node, pctx *pipeline.PipelineContext) error {
+	h.calls = append(h.calls, node.ID)
+	if h.broken && node.ID == "b" {
+		return errors.New("b is broken")
+	}
+	pctx.Set(node.ID+"_done", "yes")
+	return nil
+}
+
+const resumeDOT = `digraph resume {
+	s [type=start]
+	a [type=work]
+	b [type=work]
+	e [type=exit]
+	s -> a -> b -> e
+}`
+
+// resumeEngine parses src and builds an engine that checkpoints to cpPath.
+func resumeEngine(t *testing.T, src string, work *journalHandler, pctx *pipeline.PipelineContext, cpPath string) *pipeline.Engine {
+	t.Helper()
+	p, err := pipeline.ParseDOT(src)
+	if err != nil {
+		t.Fatalf("ParseDOT: %v", err)
+	}
+	reg := &stubRegistry{handlers: map[pipeline.NodeType]pipeline.Handler{
+		pipeline.NodeTypeStart: &countingHandler{},
+		"work":                 work,
+		pipeline.NodeTypeExit:  &exitHandler{},
+	}}
+	eng, err := pipeline.NewEngine(p, reg, pctx, cpPath)
+	if err != nil {
+		t.Fatalf("NewEngine: %v", err)
+	}
+	return eng
+}
+
+// failAtB runs resumeDOT until b fails and returns the checkpoint path.
+func failAtB(t *testing.T) string {
+	t.Helper()
+	cpPath := filepath.Join(t.TempDir(), "cp.json")
+	work := &journalHandler{broken: true}
+	eng := resumeEngine(t, resumeDOT, work, pipeline.NewPipelineContext(), cpPath)
+	if err := eng.Execute(context.Background(), ""); err == nil {
+		t.Fatal("expected b to fail")
+	}
+	return cpPath
+}
+
+func readCheckpoint(t *testing.T, path string) *pipeline.Checkpoint {
+	t.Helper()
+	cp, err := pipeline.ReadCheckpoint(path)
+	if err != nil {
+		t.Fatalf("ReadCheckpoint: %v", err)
+	}
+	return cp
+}
+
+func TestCheckpointRecordsNextEdgeAndFingerprint(t *testing.T) {
+	t.Parallel()
+	cp := readCheckpoint(t, failAtB(t))
+	if cp.LastNodeID != "a" {
+		t.Errorf("LastNodeID = %q, want %q", cp.LastNodeID, "a")
+	}
+	if cp.Next == nil || cp.Next.From != "a" || cp.Next.To != "b" {
+		t.Errorf("Next = %+v, want a -> b", cp.Next)
+	}
+	if cp.Completed {
+		t.Error("Completed set for an unfinished run")
+	}
+	if cp.Fingerprint != pipeline.Fingerprint(resumeDOT) {
+		t.Errorf("Fingerprint = %q, want fingerprint of the source", cp.Fingerprint)
+	}
+}
+
+func TestResumeContinuesAfterLastNode(t *testing.T) {
+	t.Parallel()
+	cpPath := failAtB(t)
+	cp := readCheckpoint(t, cpPath)
+
+	work := &journalHandler{}
+	pctx := cp.PipelineContext()
+	eng := resumeEngine(t, resumeDOT, work, pctx, cpPath)
+	if err := eng.Resume(context.Background(), cp, pipeline.ResumeOptions{}); err != nil {
+		t.Fatalf("Resume: %v", err)
+	}
+	if !slices.Equal(work.calls, []string{"b"}) {
+		t.Errorf("calls = %v, want [b]; a must not run again", work.calls)
+	}
+	if pctx.GetString("a_done") != "yes" || pctx.GetString("b_done") != "yes" {
+		t.Error("resumed context lost checkpointed or new values")
+	}
+	if !readCheckpoint(t, cpPath).Completed {
+		t.Error("final checkpoint not marked completed")
+	}
+}
+
+func TestResumeRerunLast(t *testing.T) {
+	t.Parallel()
+	cpPath := failAtB(t)
+	cp := readCheckpoint(t, cpPath)
+
+	work := &journalHandler{}
+	eng := resumeEngine(t, resumeDOT, work, cp.PipelineContext(), cpPath)
+	if err := eng.Resume(context.Background(), cp, pipeline.ResumeOptions{RerunLast: true}); err != nil {
+		t.Fatalf("Resume: %v", err)
+	}
+	if !slices.Equal(work.calls, []string{"a", "b"}) {
+		t.Errorf("calls = %v, want [a b]", work.calls)
+	}
+}
+
+func TestResumeCompletedRun(t *testing.T) {
+	t.Parallel()
+	cpPath := filepath.Join(t.TempDir(), "cp.json")
+	eng := resumeEngine(t, resumeDOT, &journalHandler{}, pipeline.NewPipelineContext(), cpPath)
+	if err := eng.Execute(context.Background(), ""); err != nil {
+		t.Fatalf("Execute: %v", err)
+	}
+	cp := readCheckpoint(t, cpPath)
+
+	work := &journalHandler{}
+	eng = resumeEngine(t, resumeDOT, work, cp.PipelineContext(), cpPath)
+	err := eng.Resume(context.Background(), cp, pipeline.ResumeOptions{})
+	if !errors.Is(err, pipeline.ErrRunCompleted) {
+		t.Fatalf("expected ErrRunCompleted, got %v", err)
+	}
+	if len(work.calls) != 0 {
+		t.Errorf("calls = %v, want none", work.calls)
+	}
+}
+
+func TestResumeDetectsDrift(t *testing.T) {
+	t.Parallel()
+	cpPath := failAtB(t)
+	cp := readCheckpoint(t, cpPath)
+	changed := resumeDOT + "\n// edited\n"
+
+	work := &journalHandler{}
+	eng := resumeEngine(t, changed, work, cp.PipelineContext(), cpPath)
+	err := eng.Resume(context.Background(), cp, pipeline.ResumeOptions{})
+	if !errors.Is(err, pipeline.ErrPipelineDrift) {
+		t.Fatalf("expected ErrPipelineDrift, got %v", err)
+	}
+	if len(work.calls) != 0 {
+		t.Errorf("calls = %v, want none after refusing to resume", work.calls)
+	}
+
+	if err := eng.Resume(context.Background(), cp, pipeline.ResumeOptions{AllowDrift: true}); err != nil {
+		t.Fatalf("Resume with AllowDrift: %v", err)
+	}
+	if !slices.Equal(work.calls, []string{"b"}) {
+		t.Errorf("calls = %v, want [b]", work.calls)
+	}
+}
+
+func TestResumeLegacyCheckpointSelectsNextEdge(t *testing.T) {
+	t.Parallel()
+	// Checkpoints written by SaveCheckpoint carry no edge or fingerprint.
+	cpPath := filepath.Join(t.TempDir(), "cp.json")
+	if err := pipeline.NewPipelineContext().SaveCheckpoint(cpPath, "a"); err != nil {
+		t.Fatalf("SaveCheckpoint: %v", err)
+	}
+	cp := readCheckpoint(t, cpPath)
+
+	work := &journalHandler{}
+	eng := resumeEngine(t, resumeDOT, work, cp.PipelineContext(), cpPath)
+	if err := eng.Resume(context.Background(), cp, pipeline.ResumeOptions{}); err != nil {
+		t.Fatalf("Resume: %v", err)
+	}
+	if !slices.Equal(work.calls, []string{"b"}) {
+		t.Errorf("calls = %v, want [b]", work.calls)
+	}
+}
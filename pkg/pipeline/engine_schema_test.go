@@ -0,0 +1,209 @@
+package pipeline_test
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/ravi-parthasarathy/attractor/pkg/pipeline"
+)
+
+func nodeErrors(n *pipeline.Node) string {
+	var msgs []string
+	for _, e := range pipeline.ValidateNode(n) {
+		msgs = append(msgs, e.Error())
+	}
+	return strings.Join(msgs, "\n")
+}
+
+func TestValidateNodeAttrTypes(t *testing.T) {
+	got := nodeErrors(&pipeline.Node{ID: "n", Type: pipeline.NodeTypeExec, Attrs: map[string]string{
+		"cmd":           "make",
+		"timeout":       "5 min",
+		"fail_on_error": "yes",
+		"stdout_key":    "{{.out}}",
+		"retry_max":     "-1",
+		"shape":         "box",
+	}})
+	for _, want := range []string{
+		`node "n": timeout="5 min" must be a duration such as 30s or 5m`,
+		`node "n": fail_on_error="yes" must be true or false`,
+		`node "n": stdout_key="{{.out}}" is not a context key name`,
+		`node "n": retry_max="-1" must be a non-negative integer`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("ValidateNode missing %q:\n%s", want, got)
+		}
+	}
+	if strings.Contains(got, "shape") {
+		t.Errorf("ValidateNode rejected a display attribute:\n%s", got)
+	}
+
+	for _, tc := range []struct {
+		typ   pipeline.NodeType
+		attrs map[string]string
+		want  string
+	}{
+		{pipeline.NodeTypeMap, map[string]string{"items": "xs", "item_key": "x", "prompt": "p", "concurrency": "abc"},
+			`concurrency="abc" must be a non-negative integer`},
+		{pipeline.NodeTypeFanIn, map[string]string{"mode": "most"},
+			`mode="most" must be one of all, any, first_success, quorum`},
+		{pipeline.NodeTypeRegex, map[string]string{"source": "s", "key": "k", "pattern": "a("},
+			`pattern="a(" is not a valid regular expression`},
+		{pipeline.NodeTypeJSONPack, map[string]string{"keys": "a, b c", "output": "o"},
+			`keys="a, b c" contains "b c", which is not a context key name`},
+	} {
+		if got := nodeErrors(&pipeline.Node{ID: "n", Type: tc.typ, Attrs: tc.attrs}); !strings.Contains(got, tc.want) {
+			t.Errorf("%s: ValidateNode = %q, want %q", tc.typ, got, tc.want)
+		}
+	}
+}
+
+func TestValidateNodeUnknownAttrs(t *testing.T) {
+	got := nodeErrors(&pipeline.Node{ID: "n", Type: pipeline.NodeTypeHTTP, Attrs: map[string]string{
+		"url":      "https://example.com",
+		"methd":    "POST",
+		"retrymax": "2",
+		"colour":   "red",
+	}})
+	for _, want := range []string{
+		`unknown attribute "methd" for node type "http" (did you mean "method"?)`,
+		`unknown attribute "retrymax" for node type "http" (did you mean "retry_max"?)`,
+		`unknown attribute "colour" for node type "http"`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("ValidateNode missing %q:\n%s", want, got)
+		}
+	}
+
+	// A type with no schema has only its common attributes checked.
+	got = nodeErrors(&pipeline.Node{ID: "n", Type: "work", Attrs: map[string]string{"anything": "x", "max_visits": "many"}})
+	if got != `node "n": max_visits="many" must be a non-negative integer` {
+		t.Errorf("ValidateNode without a schema = %q", got)
+	}
+}
+
+func TestValidateBuiltinSchemas(t *testing.T) {
+	// The built-in schemas are checked without the handlers package.
+	p, err := pipeline.ParseDOT(`digraph builtin {
+		start [type=start]
+		note  [type=set value=x max_visits=many]
+		wait  [type=sleep duration=soon]
+		exit  [type=exit]
+		start -> note -> wait -> exit
+	}`)
+	if err != nil {
+		t.Fatalf("ParseDOT: %v", err)
+	}
+	err = pipeline.ValidateErr(p)
+	for _, want := range []string{
+		`node "note": missing required attribute "key" for node type "set"`,
+		`node "note": max_visits="many" must be a non-negative integer`,
+		`node "wait": duration="soon" must be a duration`,
+	} {
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("ValidateErr = %v, want %q", err, want)
+		}
+	}
+}
+
+func TestRegisterSchema(t *testing.T) {
+	pipeline.RegisterSchema(pipeline.NodeSchema{
+		Type: "schema_probe",
+		Attrs: []pipeline.AttrSchema{
+			{Name: "target", Type: pipeline.AttrString, Required: true},
+			{Name: "wait", Type: pipeline.AttrDuration},
+		},
+	})
+	got := nodeErrors(&pipeline.Node{ID: "p", Type: "schema_probe", Attrs: map[string]string{"wait": "soon", "targte": "x"}})
+	for _, want := range []string{
+		`missing required attribute "target" for node type "schema_probe"`,
+		`wait="soon" must be a duration`,
+		`unknown attribute "targte" for node type "schema_probe" (did you mean "target"?)`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("ValidateNode missing %q:\n%s", want, got)
+		}
+	}
+}
+
+func TestValidateHandlers(t *testing.T) {
+	p, err := pipeline.ParseDOT(`digraph types {
+		start [type=start]
+		fan   [type=fan_out]
+		a     [type=sleepp duration=1s]
+		b     [type=work]
+		join  [type=fan_in]
+		exit  [type=exit]
+		start -> fan
+		fan -> a -> join
+		fan -> b -> join
+		join -> exit
+	}`)
+	if err != nil {
+		t.Fatalf("ParseDOT: %v", err)
+	}
+	reg := &stubRegistry{handlers: map[pipeline.NodeType]pipeline.Handler{
+		"start":  &noopHandler{},
+		"sleep":  &noopHandler{},
+		"work":   &noopHandler{},
+		"fan_in": &noopHandler{},
+		"exit":   &noopHandler{},
+	}}
+	errs := pipeline.ValidateHandlers(p, reg)
+	want := `node "a": unknown node type "sleepp" (did you mean "sleep"?)`
+	if len(errs) != 1 || errs[0].Error() != want {
+		t.Errorf("ValidateHandlers = %v, want [%s]", errs, want)
+	}
+	if _, err := pipeline.NewEngine(p, reg, pipeline.NewPipelineContext(), ""); err == nil || !strings.Contains(err.Error(), want) {
+		t.Errorf("NewEngine = %v, want %q", err, want)
+	}
+}
+
+func TestLint(t *testing.T) {
+	p, err := pipeline.ParseDOT(`digraph lint {
+  start [type=start]
+  run   [type=exec cmd="make" timeout="5 min"]
+  exit  [type=exit]
+  start -> run
+  run -> exit [label="status =="]
+}`)
+	if err != nil {
+		t.Fatalf("ParseDOT: %v", err)
+	}
+	errs := pipeline.Lint(p, nil, nil)
+	type want struct {
+		rule string
+		line int
+		col  int
+	}
+	var got []want
+	for _, e := range errs {
+		if e.Level() != pipeline.SeverityError {
+			t.Errorf("%v: severity %q, want error", e, e.Level())
+		}
+		got = append(got, want{e.Rule, e.Span.Start.Line, e.Span.Start.Col})
+	}
+	wants := []want{{pipeline.RuleAttrValue, 3, 31}, {pipeline.RuleCondition, 6, 16}}
+	if !slices.Equal(got, wants) {
+		t.Errorf("Lint = %+v, want %+v", got, wants)
+	}
+
+	// Dataflow problems are warnings, reported once the pipeline is valid.
+	p, err = pipeline.ParseDOT(`digraph lint {
+  start [type=start]
+  note  [type=set key=unused value=x]
+  last  [type=set key=result value=done]
+  exit  [type=exit]
+  start -> note -> last -> exit
+}`)
+	if err != nil {
+		t.Fatalf("ParseDOT: %v", err)
+	}
+	errs = pipeline.Lint(p, nil, nil)
+	if len(errs) != 1 || errs[0].Level() != pipeline.SeverityWarning || errs[0].Rule != pipeline.RuleUnreadKey ||
+		errs[0].Span.Start != (pipeline.Pos{Line: 3, Col: 3}) {
+		// The result written just before the exit is not unread.
+		t.Errorf("Lint = %+v, want one unread-key warning at 3:3", errs)
+	}
+}
@@ -0,0 +1,96 @@
+package pipeline_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ravi-parthasarathy/attractor/pkg/pipeline"
+)
+
+func TestExecuteFailsWhileCheckpointLocked(t *testing.T) {
+	cpPath := filepath.Join(t.TempDir(), "cp.json")
+	held := pipeline.NewFileStore(cpPath)
+	if err := held.Lock(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	defer held.Close()
+
+	work := &journalHandler{}
+	eng := resumeEngine(t, resumeDOT, work, pipeline.NewPipelineContext(), cpPath)
+	err := eng.Execute(context.Background(), "")
+	if !errors.Is(err, pipeline.ErrCheckpointLocked) {
+		t.Fatalf("err = %v, want ErrCheckpointLocked", err)
+	}
+	if len(work.calls) != 0 {
+		t.Errorf("nodes ran while locked: %v", work.calls)
+	}
+
+	// Once the other run lets go, the store is usable again.
+	held.Close()
+	if err := eng.Execute(context.Background(), ""); err != nil {
+		t.Fatalf("Execute after unlock: %v", err)
+	}
+	if err := held.Lock(context.Background()); err != nil {
+		t.Errorf("lock not released after Execute: %v", err)
+	}
+}
+
+func TestCheckpointStoreOverride(t *testing.T) {
+	store := pipeline.NewFileStore(filepath.Join(t.TempDir(), "elsewhere.json"))
+	work := &journalHandler{}
+	eng := resumeEngine(t, resumeDOT, work, pipeline.NewPipelineContext(), "")
+	eng.SetCheckpointStore(store)
+	if err := eng.Execute(context.Background(), ""); err != nil {
+		t.Fatal(err)
+	}
+	cp, err := store.Load(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cp.Completed || cp.LastNodeID != "e" {
+		t.Errorf("checkpoint = %+v, want completed at e", cp)
+	}
+}
+
+func TestHistoryIgnoresTornFinalLine(t *testing.T) {
+	cpPath := completedRun(t)
+	before := readHistory(t, cpPath)
+
+	f, err := os.OpenFile(pipeline.HistoryPath(cpPath), os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(`{"last_node_id":"tor`)
+	f.Close()
+
+	after := readHistory(t, cpPath)
+	if strings.Join(historyNodes(after), ",") != strings.Join(historyNodes(before), ",") {
+		t.Errorf("history = %v, want %v", historyNodes(after), historyNodes(before))
+	}
+}
+
+// failingStore fails to save the checkpoint that completes the run.
+type failingStore struct {
+	pipeline.CheckpointStore
+}
+
+func (s failingStore) Save(ctx context.Context, cp *pipeline.Checkpoint) error {
+	if cp.Completed {
+		return errors.New("disk full")
+	}
+	return s.CheckpointStore.Save(ctx, cp)
+}
+
+func TestExecuteReportsFinalCheckpointError(t *testing.T) {
+	work := &journalHandler{}
+	eng := resumeEngine(t, resumeDOT, work, pipeline.NewPipelineContext(), "")
+	eng.SetCheckpointStore(failingStore{pipeline.NewFileStore(filepath.Join(t.TempDir(), "cp.json"))})
+	err := eng.Execute(context.Background(), "")
+	if err == nil || !strings.Contains(err.Error(), "disk full") {
+		t.Errorf("Execute = %v, want the checkpoint error", err)
+	}
+}
@@ -0,0 +1,185 @@
+package pipeline_test
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/ravi-parthasarathy/attractor/pkg/pipeline"
+)
+
+// hookHandler runs hook before handing the node to the wrapped handler.
+type hookHandler struct {
+	pipeline.Handler
+	hook func(ctx context.Context, node *pipeline.Node) error
+}
+
+func (h *hookHandler) Handle(ctx context.Context, node *pipeline.Node, pctx *pipeline.PipelineContext) error {
+	if err := h.hook(ctx, node); err != nil {
+		return err
+	}
+	return h.Handler.Handle(ctx, node, pctx)
+}
+
+func suspendEngine(t *testing.T, src string, work pipeline.Handler, pctx *pipeline.PipelineContext, cpPath string) *pipeline.Engine {
+	t.Helper()
+	p, err := pipeline.ParseDOT(src)
+	if err != nil {
+		t.Fatalf("ParseDOT: %v", err)
+	}
+	reg := &stubRegistry{handlers: map[pipeline.NodeType]pipeline.Handler{
+		pipeline.NodeTypeStart: &countingHandler{},
+		pipeline.NodeTypeFanIn: &noopHandler{},
+		"work":                 work,
+		pipeline.NodeTypeExit:  &exitHandler{},
+	}}
+	eng, err := pipeline.NewEngine(p, reg, pctx, cpPath)
+	if err != nil {
+		t.Fatalf("NewEngine: %v", err)
+	}
+	return eng
+}
+
+// resumeToEnd resumes the run checkpointed at cpPath with work and checks
+// that it completes.
+func resumeToEnd(t *testing.T, src string, work pipeline.Handler, cpPath string) {
+	t.Helper()
+	cp := readCheckpoint(t, cpPath)
+	eng := suspendEngine(t, src, work, cp.PipelineContext(), cpPath)
+	if err := eng.Resume(context.Background(), cp, pipeline.ResumeOptions{}); err != nil {
+		t.Fatalf("Resume: %v", err)
+	}
+	if done := readCheckpoint(t, cpPath); !done.Completed || done.Suspended {
+		t.Errorf("checkpoint after resume = %+v, want completed", done)
+	}
+}
+
+func TestSuspendFinishesRunningNode(t *testing.T) {
+	cpPath := filepath.Join(t.TempDir(), "cp.json")
+	work := &journalHandler{}
+	var eng *pipeline.Engine
+	eng = suspendEngine(t, resumeDOT, &hookHandler{Handler: work, hook: func(_ context.Context, node *pipeline.Node) error {
+		if node.ID == "a" {
+			eng.Suspend("stopped by test")
+		}
+		return nil
+	}}, pipeline.NewPipelineContext(), cpPath)
+
+	err := eng.Execute(context.Background(), "")
+	if !errors.Is(err, pipeline.ErrSuspended) {
+		t.Fatalf("Execute = %v, want ErrSuspended", err)
+	}
+	if got := strings.Join(work.calls, ","); got != "a" {
+		t.Errorf("ran %s, want only a", got)
+	}
+	cp := readCheckpoint(t, cpPath)
+	if !cp.Suspended || cp.SuspendReason != "stopped by test" {
+		t.Errorf("checkpoint suspended=%v reason=%q, want the suspension recorded", cp.Suspended, cp.SuspendReason)
+	}
+	if cp.LastNodeID != "a" || cp.Next == nil || cp.Next.To != "b" || cp.Data["a_done"] != "yes" {
+		t.Errorf("checkpoint = %s next=%+v %v, want a done and next b", cp.LastNodeID, cp.Next, cp.Data)
+	}
+	if got := strings.Join(historyNodes(readHistory(t, cpPath)), ","); got != "s,a,a" {
+		t.Errorf("history nodes = %s, want s,a,a", got)
+	}
+
+	resumed := &journalHandler{}
+	resumeToEnd(t, resumeDOT, resumed, cpPath)
+	if got := strings.Join(resumed.calls, ","); got != "b" {
+		t.Errorf("resume ran %s, want only b", got)
+	}
+}
+
+func TestSuspendGracePeriodExpired(t *testing.T) {
+	cpPath := filepath.Join(t.TempDir(), "cp.json")
+	ctx, cancel := context.WithCancelCause(context.Background())
+	defer cancel(nil)
+	var eng *pipeline.Engine
+	eng = suspendEngine(t, resumeDOT, &hookHandler{Handler: &journalHandler{}, hook: func(ctx context.Context, node *pipeline.Node) error {
+		if node.ID == "a" {
+			// The node outlives the grace period and is cancelled.
+			eng.Suspend("stopped by test")
+			cancel(errors.New("grace period expired"))
+			<-ctx.Done()
+			return ctx.Err()
+		}
+		return nil
+	}}, pipeline.NewPipelineContext(), cpPath)
+
+	if err := eng.Execute(ctx, ""); !errors.Is(err, pipeline.ErrSuspended) {
+		t.Fatalf("Execute = %v, want ErrSuspended", err)
+	}
+	cp := readCheckpoint(t, cpPath)
+	if !cp.Suspended || !strings.Contains(cp.SuspendReason, "grace period expired") {
+		t.Errorf("checkpoint suspended=%v reason=%q, want the cancellation cause", cp.Suspended, cp.SuspendReason)
+	}
+	if cp.LastNodeID != "s" || cp.Next == nil || cp.Next.To != "a" {
+		t.Errorf("checkpoint = %s next=%+v, want s with next a", cp.LastNodeID, cp.Next)
+	}
+
+	resumed := &journalHandler{}
+	resumeToEnd(t, resumeDOT, resumed, cpPath)
+	if got := strings.Join(resumed.calls, ","); got != "a,b" {
+		t.Errorf("resume ran %s, want a,b", got)
+	}
+}
+
+func TestCancelledRunMarkedSuspended(t *testing.T) {
+	cpPath := filepath.Join(t.TempDir(), "cp.json")
+	ctx, cancel := context.WithCancelCause(context.Background())
+	defer cancel(nil)
+	eng := suspendEngine(t, resumeDOT, &hookHandler{Handler: &journalHandler{}, hook: func(ctx context.Context, node *pipeline.Node) error {
+		if node.ID == "b" {
+			cancel(errors.New("aborted"))
+			return ctx.Err()
+		}
+		return nil
+	}}, pipeline.NewPipelineContext(), cpPath)
+
+	err := eng.Execute(ctx, "")
+	if err == nil || errors.Is(err, pipeline.ErrSuspended) {
+		t.Fatalf("Execute = %v, want a cancellation error", err)
+	}
+	if cp := readCheckpoint(t, cpPath); !cp.Suspended || cp.SuspendReason != "aborted" || cp.LastNodeID != "a" {
+		t.Errorf("checkpoint = %s suspended=%v reason=%q, want a marked suspended", cp.LastNodeID, cp.Suspended, cp.SuspendReason)
+	}
+}
+
+func TestSuspendDuringFanOut(t *testing.T) {
+	cpPath := filepath.Join(t.TempDir(), "cp.json")
+	work := newBranchHandler(false)
+	var eng *pipeline.Engine
+	eng = suspendEngine(t, branchResumeDOT, &hookHandler{Handler: work, hook: func(_ context.Context, node *pipeline.Node) error {
+		if node.ID == "a1" {
+			eng.Suspend("stopped by test")
+		}
+		return nil
+	}}, pipeline.NewPipelineContext(), cpPath)
+
+	if err := eng.Execute(context.Background(), ""); !errors.Is(err, pipeline.ErrSuspended) {
+		t.Fatalf("Execute = %v, want ErrSuspended", err)
+	}
+	if n := work.calls["a2"]; n != 0 {
+		t.Errorf("a2 ran %d times after the suspension, want 0", n)
+	}
+	cp := readCheckpoint(t, cpPath)
+	if !cp.Suspended || cp.FanOut == nil {
+		t.Fatalf("checkpoint = %s suspended=%v fan_out=%+v, want the branches' progress", cp.LastNodeID, cp.Suspended, cp.FanOut)
+	}
+	i := slices.IndexFunc(cp.FanOut.Branches, func(b *pipeline.BranchState) bool { return b.Start == "a1" })
+	if a := cp.FanOut.Branches[i]; a.LastNodeID != "a1" || a.Next == nil || a.Next.To != "a2" {
+		t.Errorf("branch a1 = %+v, want a1 completed and next a2", a)
+	}
+
+	// Between the two runs every node runs exactly once.
+	resumed := newBranchHandler(false)
+	resumeToEnd(t, branchResumeDOT, resumed, cpPath)
+	for _, id := range []string{"a1", "a2", "b1", "b2", "c1", "r"} {
+		if n := work.calls[id] + resumed.calls[id]; n != 1 {
+			t.Errorf("%s ran %d times, want 1", id, n)
+		}
+	}
+}
@@ -0,0 +1,200 @@
+package pipeline_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/ravi-parthasarathy/attractor/pkg/pipeline"
+	"github.com/ravi-parthasarathy/attractor/pkg/pipeline/handlers"
+)
+
+func TestTemplateFuncs(t *testing.T) {
+	t.Setenv("ATTRACTOR_TEST_ENV", "from-env")
+	data := map[string]any{
+		"name":  "ann",
+		"empty": "",
+		"items": []any{"a", "b", int64(3)},
+		"user":  map[string]any{"name": "Ann"},
+		"n":     int64(7),
+		"ratio": 0.5,
+		"count": "4",
+		"doc":   `{"id": 2, "tags": ["x"]}`,
+		"text":  "line one\nline two",
+		"quote": "it's",
+	}
+	for _, tc := range []struct{ tpl, want string }{
+		{`{{.missing | default "anon"}} {{.empty | default "none"}} {{.name | default "anon"}}`, "anon none ann"},
+		{`{{.items | toJson}} {{.name | toJson}} {{.user | toJson}}`, `["a","b",3] "ann" {"name":"Ann"}`},
+		{`{{(fromJson .doc).id}} {{index (fromJson .doc).tags 0}} {{fromJson .doc}}`, `2 x {"id":2,"tags":["x"]}`},
+		{`{{.items | join ", "}}`, "a, b, 3"},
+		{`{{range split "," "x,y"}}[{{.}}]{{end}} {{split "," "x,y" | join "+"}}`, "[x][y] x+y"},
+		{`{{trim "  hi  "}}|{{upper .name}}|{{lower "ABC"}}|{{replace "n" "N" .name}}`, "hi|ANN|abc|aNN"},
+		{`{{indent 2 .text}}`, "  line one\n  line two"},
+		{`{{quote .name}} {{shquote .quote}}`, `"ann" 'it'\''s'`},
+		{`{{b64enc .name}} {{b64dec "YW5u"}}`, "YW5u ann"},
+		{`{{sha256 "abc"}}`, "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad"},
+		{`{{env "ATTRACTOR_TEST_ENV"}}`, "from-env"},
+		{`{{add .n 1}} {{sub .n .count}} {{mul .n .ratio}} {{div .n 2}} {{mod .n 4}} {{div 1.0 4}}`, "8 3 3.5 3 3 0.25"},
+	} {
+		got, err := pipeline.RenderTemplate(context.Background(), tc.tpl, data)
+		if err != nil {
+			t.Errorf("%s: %v", tc.tpl, err)
+			continue
+		}
+		if got != tc.want {
+			t.Errorf("%s = %q, want %q", tc.tpl, got, tc.want)
+		}
+	}
+
+	if got, err := pipeline.RenderTemplate(context.Background(), `{{now "2006"}}`, nil); err != nil || len(got) != 4 {
+		t.Errorf(`now "2006" = %q, %v; want a year`, got, err)
+	}
+	for _, tpl := range []string{`{{div .n 0}}`, `{{add .name 1}}`, `{{fromJson .name}}`, `{{join "," .name}}`} {
+		if _, err := pipeline.RenderTemplate(context.Background(), tpl, data); err == nil {
+			t.Errorf("%s succeeded, want an error", tpl)
+		}
+	}
+}
+
+func TestStrictTemplates(t *testing.T) {
+	data := map[string]any{"name": "ann", "user": map[string]any{"name": "Ann"}}
+	ctx := pipeline.WithStrictTemplates(context.Background(), true)
+	for _, tpl := range []string{`{{.missing}}`, `{{.user.missing}}`} {
+		_, err := pipeline.RenderTemplate(ctx, tpl, data)
+		if err == nil || !strings.Contains(err.Error(), "missing") {
+			t.Errorf("%s in strict mode = %v, want a missing key error", tpl, err)
+		}
+	}
+	// index reads a key that may be missing.
+	got, err := pipeline.RenderTemplate(ctx, `{{index . "missing" | default "anon"}} {{.name}}`, data)
+	if err != nil || got != "anon ann" {
+		t.Errorf("strict index = %q, %v; want %q", got, err, "anon ann")
+	}
+	// default takes a missing key as nil, wherever the key is read.
+	for tpl, want := range map[string]string{
+		`{{default "anon" .missing}}`:                       "anon",
+		`{{.missing | default "anon"}}`:                     "anon",
+		`{{.user.missing | default "anon"}} {{.user.name}}`: "anon Ann",
+		`{{default "anon" .missing.deeper}}`:                "anon",
+		`{{default "anon" $.name}}`:                         "ann",
+		`{{with .user}}{{default "anon" .nick}}{{end}}`:     "anon",
+		`{{if eq (default "x" .missing) "x"}}yes{{end}}`:    "yes",
+		`{{default "anon" (.missing)}}`:                     "anon",
+		`{{default "anon" ((.user.missing))}}`:              "anon",
+		`{{(.missing) | default "anon"}}`:                   "anon",
+	} {
+		if got, err := pipeline.RenderTemplate(ctx, tpl, data); err != nil || got != want {
+			t.Errorf("strict %s = %q, %v; want %q", tpl, got, err, want)
+		}
+	}
+	// Only as an argument to default: any other use is still an error.
+	for _, tpl := range []string{`{{.missing | upper | default "anon"}}`, `{{default "anon" (.missing | upper)}}`} {
+		if _, err := pipeline.RenderTemplate(ctx, tpl, data); err == nil {
+			t.Errorf("strict %s succeeded, want an error", tpl)
+		}
+	}
+	if got, _ := pipeline.RenderTemplate(context.Background(), `{{.missing}}`, data); got != "<no value>" {
+		t.Errorf("non-strict missing key = %q, want <no value>", got)
+	}
+}
+
+func TestStrictTemplatesGraphAttr(t *testing.T) {
+	src := `digraph strictness {
+		strict_templates=true
+		start [type=start]
+		greet [type=set key=greeting value="hello {{.nmae}}"]
+		exit  [type=exit]
+		start -> greet -> exit
+	}`
+	p, err := pipeline.ParseDOT(src)
+	if err != nil {
+		t.Fatalf("ParseDOT: %v", err)
+	}
+	reg := handlers.NewRegistry()
+	reg.Register("start", &handlers.StartHandler{})
+	reg.Register("set", &handlers.SetHandler{})
+	reg.Register("exit", &handlers.ExitHandler{})
+	pctx := pipeline.NewPipelineContext()
+	pctx.Set("name", "ann")
+	eng, err := pipeline.NewEngine(p, reg, pctx, "")
+	if err != nil {
+		t.Fatalf("NewEngine: %v", err)
+	}
+	err = eng.Execute(context.Background(), "")
+	if err == nil || !strings.Contains(err.Error(), `"nmae"`) {
+		t.Errorf("Execute = %v, want an error naming the missing key", err)
+	}
+}
+
+func TestStrictTemplatesCondition(t *testing.T) {
+	data := map[string]any{"name": "ann"}
+	ctx := pipeline.WithStrictTemplates(context.Background(), true)
+	if _, err := pipeline.EvalConditionContext(ctx, `{{ .nmae }} == "ann"`, data); err == nil || !strings.Contains(err.Error(), `"nmae"`) {
+		t.Errorf("strict template condition = %v, want an error naming the missing key", err)
+	}
+	if ok, err := pipeline.EvalCondition(`{{ .nmae }} == "ann"`, data); err != nil || ok {
+		t.Errorf("non-strict template condition = %v, %v; want false", ok, err)
+	}
+
+	p, err := pipeline.ParseDOT(`digraph strictness {
+		strict_templates=true
+		start [type=start]
+		a     [type=set key=x value=1]
+		b     [type=set key=x value=2]
+		exit  [type=exit]
+		start -> a [label="{{ .nmae }} == 'ann'"]
+		start -> b
+		a -> exit
+		b -> exit
+	}`)
+	if err != nil {
+		t.Fatalf("ParseDOT: %v", err)
+	}
+	reg := handlers.NewRegistry()
+	reg.Register("start", &handlers.StartHandler{})
+	reg.Register("set", &handlers.SetHandler{})
+	reg.Register("exit", &handlers.ExitHandler{})
+	pctx := pipeline.NewPipelineContext()
+	pctx.Set("name", "ann")
+	eng, err := pipeline.NewEngine(p, reg, pctx, "")
+	if err != nil {
+		t.Fatalf("NewEngine: %v", err)
+	}
+	err = eng.Execute(context.Background(), "")
+	if err == nil || !strings.Contains(err.Error(), `"nmae"`) {
+		t.Errorf("Execute = %v, want an error naming the missing key", err)
+	}
+}
+
+func TestValidateTemplates(t *testing.T) {
+	p, err := pipeline.ParseDOT(`digraph bad {
+		strict_templates=sometimes
+		start [type=start]
+		a     [type=set key=x value="{{.x | nosuch}}"]
+		b     [type=exec cmd="echo {{.x"]
+		c     [type=set key=y value="{{.x | default \"\" | upper}}"]
+		exit  [type=exit]
+		start -> a -> b -> c -> exit
+	}`)
+	if err != nil {
+		t.Fatalf("ParseDOT: %v", err)
+	}
+	var msgs []string
+	for _, e := range pipeline.Validate(p) {
+		msgs = append(msgs, e.Error())
+	}
+	got := strings.Join(msgs, "\n")
+	for _, want := range []string{
+		`strict_templates="sometimes" must be true or false`,
+		`node "a": attribute "value": template: :1: function "nosuch" not defined`,
+		`node "b": attribute "cmd": template: :1: unclosed action`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("lint errors missing %q:\n%s", want, got)
+		}
+	}
+	if strings.Contains(got, `node "c"`) {
+		t.Errorf("lint rejected a valid template:\n%s", got)
+	}
+}
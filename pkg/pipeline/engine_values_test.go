@@ -0,0 +1,89 @@
+package pipeline_test
+
+import (
+	"context"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/ravi-parthasarathy/attractor/pkg/pipeline"
+)
+
+func TestFormatValue(t *testing.T) {
+	for _, tc := range []struct {
+		v    any
+		want string
+	}{
+		{"text", "text"},
+		{nil, ""},
+		{true, "true"},
+		{int64(42), "42"},
+		{0.5, "0.5"},
+		{[]any{"a", int64(1)}, `["a",1]`},
+		{map[string]any{"b": int64(2), "a": "x"}, `{"a":"x","b":2}`},
+	} {
+		if got := pipeline.FormatValue(tc.v); got != tc.want {
+			t.Errorf("FormatValue(%#v) = %q, want %q", tc.v, got, tc.want)
+		}
+	}
+}
+
+func TestDecodeValue(t *testing.T) {
+	got, err := pipeline.DecodeValue([]byte(`{"id":9007199254740993,"f":1.5,"e":1e3,"l":[true,null]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]any{"id": int64(9007199254740993), "f": 1.5, "e": 1000.0, "l": []any{true, nil}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("DecodeValue = %#v, want %#v", got, want)
+	}
+	if _, err := pipeline.DecodeValue([]byte(`{} {}`)); err == nil {
+		t.Error("expected an error for trailing data")
+	}
+}
+
+func TestTypedValuesSurviveResume(t *testing.T) {
+	cpPath := filepath.Join(t.TempDir(), "cp.json")
+	pctx := pipeline.NewPipelineContext()
+	typed := map[string]any{
+		"items": []any{"a", "b"},
+		"user":  map[string]any{"name": "Ann", "age": int64(30)},
+		"n":     int64(3),
+		"f":     2.0,
+		"ok":    false,
+	}
+	pctx.Merge(typed)
+	eng := resumeEngine(t, resumeDOT, &journalHandler{broken: true}, pctx, cpPath)
+	if err := eng.Execute(context.Background(), ""); err == nil {
+		t.Fatal("expected b to fail")
+	}
+
+	cp := readCheckpoint(t, cpPath)
+	for k, want := range typed {
+		if got := cp.Data[k]; !reflect.DeepEqual(got, want) {
+			t.Errorf("checkpoint %s = %#v, want %#v", k, got, want)
+		}
+	}
+	resumed := cp.PipelineContext()
+	if err := resumeEngine(t, resumeDOT, &journalHandler{}, resumed, cpPath).Resume(context.Background(), cp, pipeline.ResumeOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := resumed.Get("user"); !reflect.DeepEqual(got, typed["user"]) {
+		t.Errorf("user after resume = %#v", got)
+	}
+}
+
+func TestConditionOnTypedValues(t *testing.T) {
+	ctx := map[string]any{"n": int64(3), "ok": true, "tags": []any{"x"}}
+	for expr, want := range map[string]bool{
+		"n == 3":          true,
+		"ok == true":      true,
+		`tags == '["x"]'`: true,
+		"n != 3":          false,
+	} {
+		got, err := pipeline.EvalCondition(expr, ctx)
+		if err != nil || got != want {
+			t.Errorf("%s = %v, %v; want %v", expr, got, err, want)
+		}
+	}
+}
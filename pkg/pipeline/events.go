@@ -0,0 +1,163 @@
+package pipeline
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+)
+
+// EventType identifies the kind of engine event.
+type EventType string
+
+const (
+	EventRunStarted     EventType = "run_started"
+	EventRunFinished    EventType = "run_finished"
+	EventNodeStarted    EventType = "node_started"
+	EventNodeFinished   EventType = "node_finished"
+	EventNodeRetry      EventType = "node_retry"
+	EventEdgeSelected   EventType = "edge_selected"
+	EventContextChanged EventType = "context_changed"
+	EventBranchStarted  EventType = "branch_started"
+	EventBranchFinished EventType = "branch_finished"
+	// EventAgent carries an agent.Event forwarded by an LLM handler; the
+	// agent's own event type is in AgentEvent.
+	EventAgent EventType = "agent"
+)
+
+// Event is emitted by the engine (and by handlers via Emit) for observability.
+// Only the fields relevant to Type are populated.
+type Event struct {
+	Type     EventType `json:"type"`
+	Time     time.Time `json:"time"`
+	Pipeline string    `json:"pipeline,omitempty"`
+
+	NodeID   string        `json:"node,omitempty"`
+	NodeType NodeType      `json:"node_type,omitempty"`
+	Status   OutcomeStatus `json:"status,omitempty"`
+	Attempt  int           `json:"attempt,omitempty"`
+	Duration time.Duration `json:"duration_ns,omitempty"`
+	Error    string        `json:"error,omitempty"`
+
+	// Edge selection.
+	From      string `json:"from,omitempty"`
+	To        string `json:"to,omitempty"`
+	Condition string `json:"condition,omitempty"`
+	On        string `json:"on,omitempty"`
+
+	// Context keys added or modified by a node.
+	Keys []string `json:"keys,omitempty"`
+
+	// Fan-out branch, identified by its first node.
+	Branch string `json:"branch,omitempty"`
+
+	// Forwarded agent events.
+	AgentEvent string `json:"agent_event,omitempty"`
+	Tool       string `json:"tool,omitempty"`
+	Content    string `json:"content,omitempty"`
+}
+
+// Observer receives engine events.  Implementations must be safe for
+// concurrent use: fan-out branches emit from separate goroutines.
+type Observer interface {
+	OnEvent(ev Event)
+}
+
+// ObserverFunc adapts an ordinary function to the Observer interface.
+type ObserverFunc func(ev Event)
+
+// OnEvent calls f(ev).
+func (f ObserverFunc) OnEvent(ev Event) { f(ev) }
+
+type emitterKey struct{}
+
+// Emit publishes ev to the observers of the engine run that owns ctx.
+// Handlers use it to forward their own events, such as agent tool calls.
+// It is a no-op when ctx does not belong to an engine run with observers.
+func Emit(ctx context.Context, ev Event) {
+	fn, ok := ctx.Value(emitterKey{}).(func(Event))
+	if !ok {
+		return
+	}
+	if ev.Time.IsZero() {
+		ev.Time = time.Now()
+	}
+	fn(ev)
+}
+
+// observing reports whether events emitted on ctx reach any observer.  The
+// engine uses it to skip work, such as diffing the context, that only feeds
+// events.
+func observing(ctx context.Context) bool {
+	_, ok := ctx.Value(emitterKey{}).(func(Event))
+	return ok
+}
+
+// withObservers returns a context whose Emit delivers to e's observers and
+// then to any emitter already on ctx, so that events from an included
+// sub-pipeline reach the observers of the outer run.
+func (e *Engine) withObservers(ctx context.Context) context.Context {
+	parent, _ := ctx.Value(emitterKey{}).(func(Event))
+	if len(e.observers) == 0 && parent == nil {
+		return ctx
+	}
+	observers := e.observers
+	name := e.pipeline.Name
+	return context.WithValue(ctx, emitterKey{}, func(ev Event) {
+		if ev.Pipeline == "" {
+			ev.Pipeline = name
+		}
+		for _, o := range observers {
+			o.OnEvent(ev)
+		}
+		if parent != nil {
+			parent(ev)
+		}
+	})
+}
+
+// changedKeys returns, in sorted order, the keys of after that are absent
+// from before or hold a different value.
+func changedKeys(before, after map[string]any) []string {
+	var keys []string
+	for k, v := range after {
+		if old, ok := before[k]; !ok || !reflect.DeepEqual(old, v) {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// JSONLTracer is an Observer that writes each event as one JSON line.
+type JSONLTracer struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+	err error
+}
+
+// NewJSONLTracer creates a tracer writing to w.
+func NewJSONLTracer(w io.Writer) *JSONLTracer {
+	return &JSONLTracer{enc: json.NewEncoder(w)}
+}
+
+// OnEvent writes ev as a JSON line.  After the first write error, further
+// events are dropped; see Err.
+func (t *JSONLTracer) OnEvent(ev Event) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.err != nil {
+		return
+	}
+	t.err = t.enc.Encode(ev)
+}
+
+// Err returns the first error encountered while writing events.
+func (t *JSONLTracer) Err() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.err
+}
@@ -0,0 +1,730 @@
+package pipeline
+
+import (
+	"fmt"
+	"maps"
+	"regexp"
+	"slices"
+	"strings"
+	"unicode/utf8"
+)
+
+// ─── Formatting ───────────────────────────────────────────────────────────────
+
+// formatWidth is the line length past which FormatDOT puts each attribute
+// of a statement on its own line.
+const formatWidth = 100
+
+// FormatDOT rewrites a pipeline source in the canonical layout of attractor
+// fmt: statements indented by four spaces and grouped as graph attributes,
+// subgraphs, nodes and then edges, each group in source order; attributes
+// sorted by name with type first; IDs quoted only when DOT requires it;
+// and the IDs and attribute lists of adjacent nodes and edges aligned.
+// Comments stay with the statement or attribute they precede or follow on
+// the same line, and single blank lines between statements are kept.
+//
+// The result parses to the same pipeline as src.  Grouping can change a
+// pipeline in rare cases, such as a node [...] default placed after some
+// nodes; FormatDOT then keeps the statements in source order.
+func FormatDOT(src string) (string, error) {
+	p, err := ParseDOT(src)
+	if err != nil {
+		return "", err
+	}
+	g, err := parseLayout(src)
+	if err != nil {
+		return "", err
+	}
+	for _, group := range []bool{true, false} {
+		out := g.format(group)
+		if q, err := ParseDOT(out); err == nil && samePipeline(p, q) {
+			return out, nil
+		}
+	}
+	return "", fmt.Errorf("format: the formatted source would not describe the same pipeline")
+}
+
+// samePipeline reports whether a and b have the same name, graph
+// attributes, nodes, edges in the same order, and params.
+func samePipeline(a, b *Pipeline) bool {
+	if a.Name != b.Name || !maps.Equal(a.Attrs, b.Attrs) || len(a.Nodes) != len(b.Nodes) ||
+		len(a.Edges) != len(b.Edges) || len(a.Params) != len(b.Params) {
+		return false
+	}
+	for id, n := range a.Nodes {
+		m, ok := b.Nodes[id]
+		if !ok || n.Type != m.Type || !maps.Equal(n.Attrs, m.Attrs) {
+			return false
+		}
+	}
+	for i, e := range a.Edges {
+		f := b.Edges[i]
+		if e.From != f.From || e.To != f.To || e.Condition != f.Condition || e.On != f.On {
+			return false
+		}
+	}
+	for i, prm := range a.Params {
+		if prm.Name != b.Params[i].Name || !maps.Equal(prm.Attrs, b.Params[i].Attrs) {
+			return false
+		}
+	}
+	return true
+}
+
+// ─── Layout tree ──────────────────────────────────────────────────────────────
+
+// comment is a comment token with whether a blank line precedes it.
+type comment struct {
+	text  string
+	pos   Pos
+	blank bool
+}
+
+type stmtKind int
+
+const (
+	stmtAssign   stmtKind = iota // name=value
+	stmtDefault                  // graph, node or edge [...]
+	stmtSubgraph                 // subgraph name { ... }
+	stmtNode                     // id [...]
+	stmtEdge                     // a -> b [...]
+)
+
+// layoutAttr is one name=value of an attribute list.
+type layoutAttr struct {
+	name, value string // formatted; value is "" for a bare name
+	leading     []comment
+	trailing    string
+	after       []comment // between the attribute and the closing ]
+}
+
+// operand is a node ID or a subgraph in an edge statement.
+type operand struct {
+	id    string
+	block *layoutBlock
+	name  string // of the subgraph, with its keyword, or ""
+}
+
+type layoutStmt struct {
+	kind     stmtKind
+	blank    bool // a blank line precedes the statement or its comments
+	leading  []comment
+	trailing string
+	// head is the name of an assignment, the keyword of a default or the
+	// ID of a node statement.
+	head  string
+	value string // of an assignment
+	ops   []operand
+	edge  string // -> or --
+	block *layoutBlock
+	attrs []layoutAttr
+}
+
+type layoutBlock struct {
+	stmts []*layoutStmt
+	// end holds the comments after the last statement.
+	end []comment
+}
+
+type layoutGraph struct {
+	leading []comment
+	// blank is whether a blank line separates leading from the header.
+	blank    bool
+	header   string // such as digraph name
+	comment  string // on the line of the opening brace
+	body     *layoutBlock
+	trailing []comment
+}
+
+// ─── Layout parser ────────────────────────────────────────────────────────────
+
+// layoutParser reads the statements of a DOT source with the comments
+// around them.  ParseDOT has already checked the syntax; anything this
+// parser does not expect is an error rather than a silent loss of text.
+type layoutParser struct {
+	toks []Token
+	i    int
+	last Pos // end of the last token read, comments included
+	code Pos // end of the last token read that is not a comment
+	// pending are the comments peek has passed over.
+	pending []comment
+}
+
+func parseLayout(src string) (*layoutGraph, error) {
+	lp := &layoutParser{toks: ScanDOT(src), last: Pos{Line: 1, Col: 1}}
+	g := &layoutGraph{}
+	first := lp.peek()
+	g.leading = lp.comments()
+	g.blank = len(g.leading) > 0 && first.Span.Start.Line-lp.last.Line > 1
+	var header []string
+	for {
+		t := lp.next()
+		if t.Kind != TokenID {
+			return nil, lp.unexpected(t)
+		}
+		header = append(header, strings.ToLower(t.Text))
+		if kw := strings.ToLower(t.Text); kw == "graph" || kw == "digraph" {
+			break
+		}
+	}
+	if lp.peek().Kind == TokenID {
+		header = append(header, formatID(lp.next().Text))
+	}
+	g.header = strings.Join(header, " ")
+	if t := lp.next(); t.Text != "{" {
+		return nil, lp.unexpected(t)
+	}
+	g.comment = lp.trailing()
+	body, err := lp.block()
+	if err != nil {
+		return nil, err
+	}
+	g.body = body
+	if t := lp.next(); t.Kind != TokenEOF {
+		return nil, lp.unexpected(t)
+	}
+	g.trailing = lp.comments()
+	return g, nil
+}
+
+// peek returns the next token that is not a comment, queueing the comments
+// before it.
+func (lp *layoutParser) peek() Token {
+	for lp.toks[lp.i].Kind == TokenComment {
+		t := lp.toks[lp.i]
+		lp.pending = append(lp.pending, comment{
+			text:  strings.TrimRight(t.Text, " \t\r"),
+			pos:   t.Span.Start,
+			blank: t.Span.Start.Line-lp.last.Line > 1,
+		})
+		lp.last = t.Span.End
+		lp.i++
+	}
+	return lp.toks[lp.i]
+}
+
+func (lp *layoutParser) next() Token {
+	t := lp.peek()
+	if t.Kind != TokenEOF {
+		lp.i++
+		lp.last = t.Span.End
+		lp.code = t.Span.End
+	}
+	return t
+}
+
+func (lp *layoutParser) is(text string) bool {
+	t := lp.peek()
+	return t.Kind == TokenPunct && t.Text == text
+}
+
+// comments returns the queued comments.
+func (lp *layoutParser) comments() []comment {
+	c := lp.pending
+	lp.pending = nil
+	return c
+}
+
+// inside returns the queued comments that come before the last token
+// read, that is inside the construct just read.
+func (lp *layoutParser) inside() []comment {
+	n := 0
+	for n < len(lp.pending) && lp.pending[n].pos.Before(lp.code) {
+		n++
+	}
+	c := lp.pending[:n:n]
+	lp.pending = lp.pending[n:]
+	return c
+}
+
+// trailing returns the comment that follows on the line of the last token
+// read, if there is one.
+func (lp *layoutParser) trailing() string {
+	lp.peek()
+	if len(lp.pending) == 0 || lp.pending[0].pos.Line != lp.code.Line || lp.pending[0].pos.Before(lp.code) {
+		return ""
+	}
+	c := lp.pending[0]
+	lp.pending = lp.pending[1:]
+	return c.text
+}
+
+func (lp *layoutParser) unexpected(t Token) error {
+	if t.Kind == TokenEOF {
+		return fmt.Errorf("format: unexpected end of file")
+	}
+	return fmt.Errorf("format: unexpected %q at %s", t.Text, t.Span.Start)
+}
+
+// block reads statements up to and including the closing brace.
+func (lp *layoutParser) block() (*layoutBlock, error) {
+	b := &layoutBlock{}
+	for {
+		if lp.is(";") {
+			lp.next()
+			continue
+		}
+		if lp.is("}") {
+			b.end = lp.comments()
+			lp.next()
+			return b, nil
+		}
+		// A blank line before the statement or its first comment.
+		blank := lp.peekBlank()
+		s, err := lp.stmt()
+		if err != nil {
+			return nil, err
+		}
+		s.blank = blank
+		if lp.is(";") {
+			lp.next()
+		}
+		s.trailing = lp.trailing()
+		b.stmts = append(b.stmts, s)
+	}
+}
+
+// peekBlank reports whether a blank line separates the last token read from
+// the next one, comments included.
+func (lp *layoutParser) peekBlank() bool {
+	if len(lp.pending) > 0 {
+		return lp.pending[0].blank
+	}
+	return lp.toks[lp.i].Span.Start.Line-lp.last.Line > 1
+}
+
+func (lp *layoutParser) stmt() (*layoutStmt, error) {
+	first := lp.peek()
+	s := &layoutStmt{leading: lp.comments()}
+	if first.Kind == TokenID {
+		switch kw := strings.ToLower(first.Text); kw {
+		case "graph", "node", "edge":
+			lp.next()
+			s.kind, s.head = stmtDefault, kw
+			attrs, err := lp.attrLists()
+			s.attrs = attrs
+			return s, err
+		}
+		if lp.toks[lp.nextCode(lp.i+1)].Text == "=" {
+			lp.next()
+			lp.next()
+			v := lp.next()
+			if v.Kind != TokenID {
+				return nil, lp.unexpected(v)
+			}
+			s.kind, s.head, s.value = stmtAssign, formatID(first.Text), formatID(v.Text)
+			return s, nil
+		}
+	}
+
+	op, err := lp.operand()
+	if err != nil {
+		return nil, err
+	}
+	s.ops = []operand{op}
+	for lp.is("->") || lp.is("--") {
+		s.edge = lp.next().Text
+		op, err := lp.operand()
+		if err != nil {
+			return nil, err
+		}
+		s.ops = append(s.ops, op)
+	}
+	switch {
+	case len(s.ops) > 1:
+		s.kind = stmtEdge
+	case op.block != nil:
+		s.kind, s.head, s.block = stmtSubgraph, op.name, op.block
+	default:
+		s.kind, s.head = stmtNode, op.id
+	}
+	if s.kind == stmtSubgraph {
+		return s, nil
+	}
+	s.attrs, err = lp.attrLists()
+	// Comments inside the statement move before it.
+	s.leading = append(s.leading, lp.inside()...)
+	return s, err
+}
+
+// nextCode returns the index of the first token at or after i that is not
+// a comment.
+func (lp *layoutParser) nextCode(i int) int {
+	for lp.toks[i].Kind == TokenComment {
+		i++
+	}
+	return i
+}
+
+// operand reads a node ID with an optional port, or a subgraph.
+func (lp *layoutParser) operand() (operand, error) {
+	t := lp.peek()
+	if t.Kind == TokenID && strings.EqualFold(t.Text, "subgraph") || lp.is("{") {
+		var name []string
+		if t.Kind == TokenID {
+			lp.next()
+			name = append(name, "subgraph")
+			if lp.peek().Kind == TokenID {
+				name = append(name, formatID(lp.next().Text))
+			}
+		}
+		if t := lp.next(); t.Text != "{" {
+			return operand{}, lp.unexpected(t)
+		}
+		// Comments between the name and the brace stay before the body.
+		pending := lp.comments()
+		b, err := lp.block()
+		if err != nil {
+			return operand{}, err
+		}
+		if len(pending) > 0 && len(b.stmts) > 0 {
+			b.stmts[0].leading = append(pending, b.stmts[0].leading...)
+		} else {
+			b.end = append(pending, b.end...)
+		}
+		return operand{block: b, name: strings.Join(name, " ")}, nil
+	}
+	if t.Kind != TokenID {
+		return operand{}, lp.unexpected(lp.next())
+	}
+	id := formatID(lp.next().Text)
+	for lp.is(":") {
+		lp.next()
+		port := lp.next()
+		if port.Kind != TokenID {
+			return operand{}, lp.unexpected(port)
+		}
+		id += ":" + formatID(port.Text)
+	}
+	return operand{id: id}, nil
+}
+
+// attrLists reads any number of [...] lists into one.
+func (lp *layoutParser) attrLists() ([]layoutAttr, error) {
+	var (
+		attrs []layoutAttr
+		end   []comment
+	)
+	for lp.is("[") {
+		lp.next()
+		for {
+			if lp.is(",") || lp.is(";") {
+				lp.next()
+				continue
+			}
+			if lp.is("]") {
+				end = append(end, lp.comments()...)
+				lp.next()
+				break
+			}
+			a := layoutAttr{leading: lp.comments()}
+			name := lp.next()
+			if name.Kind != TokenID {
+				return nil, lp.unexpected(name)
+			}
+			a.name = formatID(name.Text)
+			if lp.is("=") {
+				lp.next()
+				v := lp.next()
+				if v.Kind != TokenID {
+					return nil, lp.unexpected(v)
+				}
+				a.value = formatID(v.Text)
+			}
+			if lp.is(",") || lp.is(";") {
+				lp.next()
+			}
+			a.trailing = lp.trailing()
+			attrs = append(attrs, a)
+		}
+	}
+	// Comments before a ] follow the last attribute, or the statement if
+	// there is none.
+	if len(attrs) > 0 {
+		attrs[len(attrs)-1].after = end
+	} else {
+		lp.pending = append(end, lp.pending...)
+	}
+	// type first, then by name; a repeated attribute keeps its order, so
+	// the last still wins.
+	slices.SortStableFunc(attrs, func(a, b layoutAttr) int {
+		switch {
+		case a.name == b.name:
+			return 0
+		case a.name == "type":
+			return -1
+		case b.name == "type":
+			return 1
+		}
+		return strings.Compare(a.name, b.name)
+	})
+	return attrs, nil
+}
+
+var (
+	plainID   = regexp.MustCompile(`^[A-Za-z_\x{80}-\x{10FFFF}][A-Za-z_0-9\x{80}-\x{10FFFF}]*$`)
+	numeralID = regexp.MustCompile(`^-?(\.[0-9]+|[0-9]+(\.[0-9]*)?)$`)
+)
+
+// formatID removes the quotes from a quoted ID that DOT reads the same
+// way without them.  Other IDs are kept as written.
+func formatID(text string) string {
+	if len(text) < 2 || text[0] != '"' {
+		return text
+	}
+	inner := text[1 : len(text)-1]
+	if numeralID.MatchString(inner) || plainID.MatchString(inner) && !isKeyword(inner) {
+		return inner
+	}
+	return text
+}
+
+func isKeyword(s string) bool {
+	switch strings.ToLower(s) {
+	case "strict", "graph", "digraph", "subgraph", "node", "edge":
+		return true
+	}
+	return false
+}
+
+// ─── Layout printer ───────────────────────────────────────────────────────────
+
+func (g *layoutGraph) format(group bool) string {
+	var sb strings.Builder
+	writeComments(&sb, "", g.leading, true)
+	if g.blank {
+		sb.WriteString("\n")
+	}
+	sb.WriteString(g.header + " {")
+	if g.comment != "" {
+		sb.WriteString(" " + g.comment)
+	}
+	sb.WriteString("\n")
+	writeBlock(&sb, "    ", g.body, group)
+	sb.WriteString("}\n")
+	writeComments(&sb, "", g.trailing, false)
+	return sb.String()
+}
+
+// writeComments writes each comment on its own line, keeping the blank
+// lines before them unless first.
+func writeComments(sb *strings.Builder, indent string, cs []comment, first bool) {
+	for i, c := range cs {
+		if c.blank && !(first && i == 0) {
+			sb.WriteString("\n")
+		}
+		sb.WriteString(indent + c.text + "\n")
+	}
+}
+
+// groupStmts orders statements as assignments and defaults, subgraphs,
+// nodes and edges, with a blank line between the groups.
+func groupStmts(stmts []*layoutStmt) []*layoutStmt {
+	rank := func(k stmtKind) int {
+		switch k {
+		case stmtAssign, stmtDefault:
+			return 0
+		case stmtSubgraph:
+			return 1
+		case stmtNode:
+			return 2
+		}
+		return 3
+	}
+	out := slices.Clone(stmts)
+	slices.SortStableFunc(out, func(a, b *layoutStmt) int { return rank(a.kind) - rank(b.kind) })
+	for i := range out {
+		s := *out[i]
+		s.blank = i > 0 && (s.blank || rank(s.kind) != rank(out[i-1].kind))
+		out[i] = &s
+	}
+	return out
+}
+
+func writeBlock(sb *strings.Builder, indent string, b *layoutBlock, group bool) {
+	stmts := b.stmts
+	if group {
+		stmts = groupStmts(stmts)
+	}
+	heads := make([]string, len(stmts))
+	for i, s := range stmts {
+		heads[i] = stmtHead(s, indent, group)
+	}
+	for i := 0; i < len(stmts); {
+		// A run of adjacent statements of one kind is aligned together.
+		j := i + 1
+		for j < len(stmts) && stmts[j].kind == stmts[i].kind && !stmts[j].blank {
+			j++
+		}
+		align := alignHeads(stmts[i:j], heads[i:j])
+		for k := i; k < j; k++ {
+			s := stmts[k]
+			if s.blank && k > 0 {
+				sb.WriteString("\n")
+			}
+			// s.blank stands for a blank line before the first comment.
+			writeComments(sb, indent, s.leading, true)
+			writeStmt(sb, indent, s, align[k-i], group)
+		}
+		i = j
+	}
+	if len(b.end) > 0 {
+		writeComments(sb, indent, b.end, len(stmts) == 0)
+	}
+}
+
+// stmtHead formats what comes before a statement's attribute list.
+func stmtHead(s *layoutStmt, indent string, group bool) string {
+	switch s.kind {
+	case stmtAssign:
+		return s.head + "=" + s.value
+	case stmtDefault, stmtNode:
+		return s.head
+	case stmtSubgraph:
+		return subgraphText(s.head, s.block, indent, group)
+	}
+	parts := make([]string, len(s.ops))
+	for i, op := range s.ops {
+		if op.block != nil {
+			parts[i] = subgraphText(op.name, op.block, indent, group)
+		} else {
+			parts[i] = op.id
+		}
+	}
+	return strings.Join(parts, " "+s.edge+" ")
+}
+
+// subgraphText formats a subgraph: on one line if it only lists node IDs,
+// such as {a b}, else as an indented block.
+func subgraphText(name string, b *layoutBlock, indent string, group bool) string {
+	prefix := ""
+	if name != "" {
+		prefix = name + " "
+	}
+	simple := len(b.end) == 0
+	var ids []string
+	for _, s := range b.stmts {
+		simple = simple && s.kind == stmtNode && len(s.attrs) == 0 && len(s.leading) == 0 && s.trailing == ""
+		ids = append(ids, s.head)
+	}
+	if simple && (name == "" || len(ids) == 0) {
+		return prefix + "{" + strings.Join(ids, " ") + "}"
+	}
+	var sb strings.Builder
+	sb.WriteString(prefix + "{\n")
+	writeBlock(&sb, indent+"    ", b, group)
+	sb.WriteString(indent + "}")
+	return sb.String()
+}
+
+// alignment is the padding of a statement in an aligned run: first is the
+// width of its first ID and head that of everything before its [.
+type alignment struct {
+	first, head int
+}
+
+func alignHeads(stmts []*layoutStmt, heads []string) []alignment {
+	aligned := func(i int) bool {
+		return !strings.Contains(heads[i], "\n") && (stmts[i].kind == stmtNode || stmts[i].kind == stmtEdge)
+	}
+	var first, head int
+	for i, s := range stmts {
+		if aligned(i) && s.kind == stmtEdge && s.ops[0].block == nil {
+			first = max(first, width(s.ops[0].id))
+		}
+	}
+	for i, s := range stmts {
+		if aligned(i) && len(s.attrs) > 0 {
+			head = max(head, width(alignedHead(s, heads[i], first)))
+		}
+	}
+	out := make([]alignment, len(stmts))
+	for i, s := range stmts {
+		if aligned(i) {
+			out[i] = alignment{head: head}
+			if s.kind == stmtEdge {
+				out[i].first = first
+			}
+		}
+	}
+	return out
+}
+
+// alignedHead pads the first ID of an edge statement's head to first.
+func alignedHead(s *layoutStmt, head string, first int) string {
+	if s.kind != stmtEdge || s.ops[0].block != nil {
+		return head
+	}
+	id := s.ops[0].id
+	return pad(id, first) + head[len(id):]
+}
+
+func width(s string) int { return utf8.RuneCountInString(s) }
+
+func pad(s string, w int) string {
+	if n := w - width(s); n > 0 {
+		return s + strings.Repeat(" ", n)
+	}
+	return s
+}
+
+func writeStmt(sb *strings.Builder, indent string, s *layoutStmt, al alignment, group bool) {
+	head := alignedHead(s, stmtHead(s, indent, group), al.first)
+	line := indent + head
+	if len(s.attrs) > 0 {
+		line = indent + pad(head, al.head) + " "
+		line += attrList(s.attrs, width(line[strings.LastIndex(line, "\n")+1:]))
+	} else {
+		line = strings.TrimRight(line, " ")
+	}
+	if s.trailing != "" {
+		line += " " + s.trailing
+	}
+	sb.WriteString(line + "\n")
+}
+
+// attrList formats an attribute list that starts at column col: on one
+// line if it fits and has no comments, else one attribute per line.
+func attrList(attrs []layoutAttr, col int) string {
+	parts := make([]string, len(attrs))
+	multi := false
+	for i, a := range attrs {
+		parts[i] = a.name
+		if a.value != "" {
+			parts[i] += "=" + a.value
+		}
+		multi = multi || len(a.leading) > 0 || len(a.after) > 0 ||
+			a.trailing != "" && i < len(attrs)-1 || strings.Contains(parts[i], "\n")
+	}
+	one := "[" + strings.Join(parts, " ") + "]"
+	if !multi && (col+width(one) <= formatWidth || len(attrs) == 1) {
+		if t := attrs[len(attrs)-1].trailing; t != "" {
+			one += " " + t
+		}
+		return one
+	}
+	indent := "\n" + strings.Repeat(" ", col+1)
+	var sb strings.Builder
+	sb.WriteString("[")
+	for i, a := range attrs {
+		if i > 0 || len(a.leading) > 0 {
+			sb.WriteString(indent)
+		}
+		for _, c := range a.leading {
+			sb.WriteString(c.text + indent)
+		}
+		sb.WriteString(parts[i])
+		if a.trailing != "" {
+			sb.WriteString(" " + a.trailing)
+		}
+		for _, c := range a.after {
+			sb.WriteString(indent + c.text)
+		}
+	}
+	// A comment would swallow the ], so it goes on a line of its own.
+	if last := attrs[len(attrs)-1]; last.trailing != "" || len(last.after) > 0 {
+		sb.WriteString("\n" + strings.Repeat(" ", col))
+	}
+	sb.WriteString("]")
+	return sb.String()
+}
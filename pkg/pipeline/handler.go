@@ -1,6 +1,9 @@
 package pipeline
 
-import "context"
+import (
+	"context"
+	"errors"
+)
 
 // Handler executes a pipeline node.
 // Implementations live in the handlers sub-package; this interface is defined
@@ -21,3 +24,38 @@ type HandlerRegistry interface {
 type ExitSignal struct{}
 
 func (ExitSignal) Error() string { return "pipeline exit" }
+
+// NodeError attaches a machine-readable kind to a handler error.  When a node
+// fails, the engine stores the kind in the context as last_error_kind so that
+// recovery branches can tell, for example, a non-zero exit from a timeout.
+type NodeError struct {
+	Kind string
+	Err  error
+}
+
+func (e *NodeError) Error() string { return e.Err.Error() }
+
+func (e *NodeError) Unwrap() error { return e.Err }
+
+// Error kinds reported in last_error_kind.
+const (
+	ErrorKindError     = "error"
+	ErrorKindTimeout   = "timeout"
+	ErrorKindExitCode  = "exit_code"
+	ErrorKindHTTP      = "http_status"
+	ErrorKindAssertion = "assertion"
+)
+
+// ErrorKind classifies err for failure routing.  A wrapped *NodeError wins;
+// otherwise deadline errors are reported as "timeout" and everything else as
+// "error".
+func ErrorKind(err error) string {
+	var ne *NodeError
+	if errors.As(err, &ne) && ne.Kind != "" {
+		return ne.Kind
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return ErrorKindTimeout
+	}
+	return ErrorKindError
+}
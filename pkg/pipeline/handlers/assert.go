@@ -11,13 +11,18 @@ import (
 // and returns an error if the condition is false.
 type AssertHandler struct{}
 
-func (h *AssertHandler) Handle(_ context.Context, node *pipeline.Node, pctx *pipeline.PipelineContext) error {
+// Schema describes the attributes of a NodeTypeAssert node.
+func (h *AssertHandler) Schema() pipeline.NodeSchema {
+	return pipeline.BuiltinSchema(pipeline.NodeTypeAssert)
+}
+
+func (h *AssertHandler) Handle(ctx context.Context, node *pipeline.Node, pctx *pipeline.PipelineContext) error {
 	expr := node.Attrs["expr"]
 	if expr == "" {
 		return fmt.Errorf("assert node %q: missing required 'expr' attribute", node.ID)
 	}
 
-	ok, err := pipeline.EvalCondition(expr, pctx.Snapshot())
+	ok, err := pipeline.EvalConditionContext(ctx, expr, pctx.Snapshot())
 	if err != nil {
 		return fmt.Errorf("assert node %q: eval condition: %w", node.ID, err)
 	}
@@ -26,7 +31,10 @@ func (h *AssertHandler) Handle(_ context.Context, node *pipeline.Node, pctx *pip
 		if msg == "" {
 			msg = "assertion failed"
 		}
-		return fmt.Errorf("assert node %q: %s: expr=%q", node.ID, msg, expr)
+		return &pipeline.NodeError{
+			Kind: pipeline.ErrorKindAssertion,
+			Err:  fmt.Errorf("assert node %q: %s: expr=%q", node.ID, msg, expr),
+		}
 	}
 	return nil
 }
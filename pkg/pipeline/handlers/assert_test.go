@@ -100,3 +100,27 @@ func TestAssertCompoundExpr(t *testing.T) {
 		t.Fatalf("expected nil, got: %v", err)
 	}
 }
+
+func TestAssertRichCondition(t *testing.T) {
+	t.Parallel()
+	pctx := pipeline.NewPipelineContext()
+	pctx.Set("exit_code", int64(0))
+	pctx.Set("report", `{"failed": 2, "suite": "unit"}`)
+
+	node := newAssertNode("chk", map[string]string{"expr": "exit_code == 0 && report.failed > 0"})
+	if err := (&handlers.AssertHandler{}).Handle(t.Context(), node, pctx); err != nil {
+		t.Fatalf("expected nil error, got: %v", err)
+	}
+
+	node.Attrs["expr"] = "report.suite in ['e2e', 'smoke']"
+	err := (&handlers.AssertHandler{}).Handle(t.Context(), node, pctx)
+	if pipeline.ErrorKind(err) != pipeline.ErrorKindAssertion {
+		t.Errorf("Handle = %v, want an assertion failure", err)
+	}
+
+	node.Attrs["expr"] = "report.failed >"
+	err = (&handlers.AssertHandler{}).Handle(t.Context(), node, pctx)
+	if err == nil || !strings.Contains(err.Error(), "at column 16") {
+		t.Errorf("Handle = %v, want a parse error with its position", err)
+	}
+}
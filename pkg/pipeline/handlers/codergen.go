@@ -18,6 +18,11 @@ type CodergenHandler struct {
 	Workdir      string
 }
 
+// Schema describes the attributes of a NodeTypeCodergen node.
+func (h *CodergenHandler) Schema() pipeline.NodeSchema {
+	return pipeline.BuiltinSchema(pipeline.NodeTypeCodergen)
+}
+
 func (h *CodergenHandler) Handle(ctx context.Context, node *pipeline.Node, pctx *pipeline.PipelineContext) error {
 	// Node attr overrides the default model
 	model := h.DefaultModel
@@ -33,7 +38,7 @@ func (h *CodergenHandler) Handle(ctx context.Context, node *pipeline.Node, pctx
 	if promptTpl == "" {
 		promptTpl = pctx.GetString("seed")
 	}
-	rendered, err := renderTemplate(promptTpl, pctx.Snapshot())
+	rendered, err := renderTemplate(ctx, promptTpl, pctx.Snapshot())
 	if err != nil {
 		return fmt.Errorf("codergen node %q: template error: %w", node.ID, err)
 	}
@@ -78,6 +83,7 @@ func (h *CodergenHandler) Handle(ctx context.Context, node *pipeline.Node, pctx
 	go func() {
 		defer close(done)
 		for e := range eventCh {
+			forwardAgentEvent(ctx, node, e)
 			switch e.Type {
 			case agent.EventTypeToolCall:
 				slog.Debug("tool call", "node", node.ID, "tool", e.ToolName, "input", e.Content)
@@ -12,6 +12,11 @@ import (
 // pipeline context.
 type EnvHandler struct{}
 
+// Schema describes the attributes of a NodeTypeEnv node.
+func (h *EnvHandler) Schema() pipeline.NodeSchema {
+	return pipeline.BuiltinSchema(pipeline.NodeTypeEnv)
+}
+
 func (h *EnvHandler) Handle(_ context.Context, node *pipeline.Node, pctx *pipeline.PipelineContext) error {
 	key := node.Attrs["key"]
 	if key == "" {
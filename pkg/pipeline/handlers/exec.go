@@ -3,6 +3,7 @@ package handlers
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"os/exec"
 	"strconv"
@@ -13,30 +14,45 @@ import (
 )
 
 // ExecHandler runs a shell command and stores its stdout, stderr, and exit
-// code in the pipeline context.
+// code in the pipeline context.  A non-zero exit suppressed with
+// fail_on_error=false is reported as a partial outcome.
 type ExecHandler struct {
 	Workdir string
 }
 
+// Schema describes the attributes of a NodeTypeExec node.
+func (h *ExecHandler) Schema() pipeline.NodeSchema {
+	return pipeline.BuiltinSchema(pipeline.NodeTypeExec)
+}
+
 func (h *ExecHandler) Handle(ctx context.Context, node *pipeline.Node, pctx *pipeline.PipelineContext) error {
+	_, err := h.Execute(ctx, node, pctx)
+	return err
+}
+
+func (h *ExecHandler) Execute(ctx context.Context, node *pipeline.Node, pctx *pipeline.PipelineContext) (pipeline.Outcome, error) {
+	fail := func(err error) (pipeline.Outcome, error) {
+		return pipeline.Outcome{Status: pipeline.OutcomeFail}, err
+	}
+
 	cmdTpl := node.Attrs["cmd"]
 	if cmdTpl == "" {
-		return fmt.Errorf("exec node %q: missing 'cmd' attribute", node.ID)
+		return fail(fmt.Errorf("exec node %q: missing 'cmd' attribute", node.ID))
 	}
 
 	// Render cmd template.
 	snapshot := pctx.Snapshot()
-	renderedCmd, err := renderTemplate(cmdTpl, snapshot)
+	renderedCmd, err := renderTemplate(ctx, cmdTpl, snapshot)
 	if err != nil {
-		return fmt.Errorf("exec node %q: cmd template error: %w", node.ID, err)
+		return fail(fmt.Errorf("exec node %q: cmd template error: %w", node.ID, err))
 	}
 
 	// Resolve working directory.
 	workdir := h.Workdir
 	if wdTpl := node.Attrs["workdir"]; wdTpl != "" {
-		wd, wdErr := renderTemplate(wdTpl, snapshot)
+		wd, wdErr := renderTemplate(ctx, wdTpl, snapshot)
 		if wdErr != nil {
-			return fmt.Errorf("exec node %q: workdir template error: %w", node.ID, wdErr)
+			return fail(fmt.Errorf("exec node %q: workdir template error: %w", node.ID, wdErr))
 		}
 		workdir = wd
 	}
@@ -46,7 +62,7 @@ func (h *ExecHandler) Handle(ctx context.Context, node *pipeline.Node, pctx *pip
 	if timeoutStr := node.Attrs["timeout"]; timeoutStr != "" {
 		d, parseErr := time.ParseDuration(timeoutStr)
 		if parseErr != nil {
-			return fmt.Errorf("exec node %q: invalid timeout %q: %w", node.ID, timeoutStr, parseErr)
+			return fail(fmt.Errorf("exec node %q: invalid timeout %q: %w", node.ID, timeoutStr, parseErr))
 		}
 		if d > 0 {
 			var cancel context.CancelFunc
@@ -97,14 +113,25 @@ func (h *ExecHandler) Handle(ctx context.Context, node *pipeline.Node, pctx *pip
 		pctx.Set(ek, strconv.Itoa(exitCode))
 	}
 
+	if exitCode == 0 {
+		return pipeline.Outcome{Status: pipeline.OutcomeSuccess}, nil
+	}
+
 	// Fail on non-zero exit unless suppressed.
-	if exitCode != 0 && node.Attrs["fail_on_error"] != "false" {
+	if node.Attrs["fail_on_error"] != "false" {
 		msg := fmt.Sprintf("exec node %q: command exited with code %d", node.ID, exitCode)
 		if firstLine := strings.SplitN(strings.TrimSpace(stderr), "\n", 2)[0]; firstLine != "" {
 			msg += ": " + firstLine
 		}
-		return fmt.Errorf("%s", msg)
+		kind := pipeline.ErrorKindExitCode
+		if errors.Is(runCtx.Err(), context.DeadlineExceeded) {
+			kind = pipeline.ErrorKindTimeout
+		}
+		return fail(&pipeline.NodeError{Kind: kind, Err: errors.New(msg)})
 	}
 
-	return nil
+	return pipeline.Outcome{
+		Status: pipeline.OutcomePartial,
+		Notes:  fmt.Sprintf("command exited with code %d (fail_on_error=false)", exitCode),
+	}, nil
 }
@@ -102,9 +102,13 @@ func TestExecFailOnError(t *testing.T) {
 		"cmd": "exit 1",
 	})
 	h := &handlers.ExecHandler{}
-	if err := h.Handle(t.Context(), node, pctx); err == nil {
+	err := h.Handle(t.Context(), node, pctx)
+	if err == nil {
 		t.Fatal("expected error for non-zero exit code")
 	}
+	if got := pipeline.ErrorKind(err); got != pipeline.ErrorKindExitCode {
+		t.Errorf("ErrorKind = %q, want %q", got, pipeline.ErrorKindExitCode)
+	}
 }
 
 func TestExecNoFailOnError(t *testing.T) {
@@ -115,9 +119,13 @@ func TestExecNoFailOnError(t *testing.T) {
 		"fail_on_error": "false",
 	})
 	h := &handlers.ExecHandler{}
-	if err := h.Handle(t.Context(), node, pctx); err != nil {
+	res, err := h.Execute(t.Context(), node, pctx)
+	if err != nil {
 		t.Fatalf("expected no error with fail_on_error=false, got: %v", err)
 	}
+	if res.Status != pipeline.OutcomePartial {
+		t.Errorf("Status = %q, want %q", res.Status, pipeline.OutcomePartial)
+	}
 }
 
 func TestExecTimeout(t *testing.T) {
@@ -128,9 +136,13 @@ func TestExecTimeout(t *testing.T) {
 		"timeout": "50ms",
 	})
 	h := &handlers.ExecHandler{}
-	if err := h.Handle(t.Context(), node, pctx); err == nil {
+	err := h.Handle(t.Context(), node, pctx)
+	if err == nil {
 		t.Fatal("expected timeout error")
 	}
+	if got := pipeline.ErrorKind(err); got != pipeline.ErrorKindTimeout {
+		t.Errorf("ErrorKind = %q, want %q", got, pipeline.ErrorKindTimeout)
+	}
 }
 
 func TestExecTemplateCmd(t *testing.T) {
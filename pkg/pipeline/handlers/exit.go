@@ -10,6 +10,11 @@ import (
 // ExitHandler marks the pipeline as complete by returning an ExitSignal.
 type ExitHandler struct{}
 
+// Schema describes the attributes of a NodeTypeExit node.
+func (h *ExitHandler) Schema() pipeline.NodeSchema {
+	return pipeline.BuiltinSchema(pipeline.NodeTypeExit)
+}
+
 func (h *ExitHandler) Handle(_ context.Context, _ *pipeline.Node, pctx *pipeline.PipelineContext) error {
 	pctx.Set("exit_time", time.Now().UTC().Format(time.RFC3339))
 	return pipeline.ExitSignal{}
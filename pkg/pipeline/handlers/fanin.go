@@ -10,6 +10,11 @@ import (
 // have converged. Actual waiting is handled by the engine.
 type FanInHandler struct{}
 
+// Schema describes the attributes of a NodeTypeFanIn node.
+func (h *FanInHandler) Schema() pipeline.NodeSchema {
+	return pipeline.BuiltinSchema(pipeline.NodeTypeFanIn)
+}
+
 func (h *FanInHandler) Handle(_ context.Context, node *pipeline.Node, pctx *pipeline.PipelineContext) error {
 	pctx.Set(node.ID+"_fanin", "complete")
 	return nil
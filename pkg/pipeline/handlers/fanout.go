@@ -12,6 +12,11 @@ import (
 // Actual parallel execution is coordinated by the engine.
 type FanOutHandler struct{}
 
+// Schema describes the attributes of a NodeTypeFanOut node.
+func (h *FanOutHandler) Schema() pipeline.NodeSchema {
+	return pipeline.BuiltinSchema(pipeline.NodeTypeFanOut)
+}
+
 func (h *FanOutHandler) Handle(_ context.Context, node *pipeline.Node, pctx *pipeline.PipelineContext) error {
 	pctx.Set(node.ID+"_fanout", "started")
 	return nil
@@ -19,6 +19,11 @@ type ForEachHandler struct {
 	Workdir string
 }
 
+// Schema describes the attributes of a NodeTypeForEach node.
+func (h *ForEachHandler) Schema() pipeline.NodeSchema {
+	return pipeline.BuiltinSchema(pipeline.NodeTypeForEach)
+}
+
 func (h *ForEachHandler) Handle(ctx context.Context, node *pipeline.Node, pctx *pipeline.PipelineContext) error {
 	itemsKey := node.Attrs["items"]
 	if itemsKey == "" {
@@ -39,14 +44,8 @@ func (h *ForEachHandler) Handle(ctx context.Context, node *pipeline.Node, pctx *
 	}
 
 	// Parse the items array.
-	raw := pctx.GetString(itemsKey)
-	if raw == "" {
-		pctx.Set(resultsKey, "[]")
-		pctx.Set("last_output", "[]")
-		return nil
-	}
-	var items []any
-	if err := json.Unmarshal([]byte(raw), &items); err != nil {
+	items, err := contextList(pctx, itemsKey)
+	if err != nil {
 		return fmt.Errorf("for_each node %q: invalid JSON in items key %q: %w", node.ID, itemsKey, err)
 	}
 	if len(items) == 0 {
@@ -58,7 +57,7 @@ func (h *ForEachHandler) Handle(ctx context.Context, node *pipeline.Node, pctx *
 	// Resolve working directory.
 	workdir := h.Workdir
 	if wdTpl := node.Attrs["workdir"]; wdTpl != "" {
-		wd, wdErr := renderTemplate(wdTpl, pctx.Snapshot())
+		wd, wdErr := renderTemplate(ctx, wdTpl, pctx.Snapshot())
 		if wdErr != nil {
 			return fmt.Errorf("for_each node %q: workdir template error: %w", node.ID, wdErr)
 		}
@@ -80,10 +79,10 @@ func (h *ForEachHandler) Handle(ctx context.Context, node *pipeline.Node, pctx *
 	for i, item := range items {
 		// Branch context: copy parent and set item_key.
 		branch := pctx.Copy()
-		branch.Set(itemKey, fmt.Sprintf("%v", item))
+		branch.Set(itemKey, item)
 
 		// Render command template.
-		renderedCmd, err := renderTemplate(cmdTpl, branch.Snapshot())
+		renderedCmd, err := renderTemplate(ctx, cmdTpl, branch.Snapshot())
 		if err != nil {
 			return fmt.Errorf("for_each node %q: item %d cmd template error: %w", node.ID, i, err)
 		}
@@ -185,3 +185,26 @@ func TestForEachValidatorCatchesMissingAttrs(t *testing.T) {
 		t.Fatalf("expected 3 validator errors, got %d: %v", len(errs), errs)
 	}
 }
+
+func TestForEachTypedItems(t *testing.T) {
+	t.Parallel()
+	pctx := pipeline.NewPipelineContext()
+	pctx.Set("users", []any{map[string]any{"name": "ann"}, map[string]any{"name": "bob"}})
+
+	node := forEachNode("fe", map[string]string{
+		"items":    "users",
+		"item_key": "u",
+		"cmd":      "echo {{.u.name}}",
+	})
+	h := &handlers.ForEachHandler{}
+	if err := h.Handle(t.Context(), node, pctx); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var got []string
+	if err := json.Unmarshal([]byte(pctx.GetString("fe_results")), &got); err != nil {
+		t.Fatalf("unmarshal results: %v", err)
+	}
+	if len(got) != 2 || strings.TrimSpace(got[0]) != "ann" || strings.TrimSpace(got[1]) != "bob" {
+		t.Errorf("results = %q, want ann and bob", got)
+	}
+}
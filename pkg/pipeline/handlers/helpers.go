@@ -1,19 +1,60 @@
 package handlers
 
 import (
-	"bytes"
-	"text/template"
+	"context"
+	"errors"
+
+	"github.com/ravi-parthasarathy/attractor/pkg/agent"
+	"github.com/ravi-parthasarathy/attractor/pkg/pipeline"
 )
 
-// renderTemplate executes a Go template string against a data map.
-func renderTemplate(tplStr string, data map[string]any) (string, error) {
-	tpl, err := template.New("").Parse(tplStr)
-	if err != nil {
-		return "", err
+// renderTemplate executes a Go template string against a data map with the
+// pipeline template functions; see pipeline.RenderTemplate.
+func renderTemplate(ctx context.Context, tplStr string, data map[string]any) (string, error) {
+	return pipeline.RenderTemplate(ctx, tplStr, data)
+}
+
+// contextList returns the list stored under key: a list value, or a string
+// holding a JSON array.  An unset or empty key is an empty list.
+func contextList(pctx *pipeline.PipelineContext, key string) ([]any, error) {
+	v, _ := pctx.Get(key)
+	if s, ok := v.(string); ok {
+		if s == "" {
+			return nil, nil
+		}
+		var err error
+		if v, err = pipeline.DecodeValue([]byte(s)); err != nil {
+			return nil, err
+		}
+	}
+	switch v := v.(type) {
+	case []any:
+		return v, nil
+	case nil:
+		return nil, nil
+	}
+	return nil, errors.New("not a list")
+}
+
+// forwardAgentEvent republishes an agent loop event on the engine's event bus.
+// LLM turn and completion events are omitted; the engine's node events
+// already cover them.
+func forwardAgentEvent(ctx context.Context, node *pipeline.Node, e agent.Event) {
+	switch e.Type {
+	case agent.EventTypeToolCall, agent.EventTypeToolResult, agent.EventTypeError, agent.EventTypeSteering:
+	default:
+		return
+	}
+	ev := pipeline.Event{
+		Type:       pipeline.EventAgent,
+		NodeID:     node.ID,
+		NodeType:   node.Type,
+		AgentEvent: string(e.Type),
+		Tool:       e.ToolName,
+		Content:    e.Content,
 	}
-	var buf bytes.Buffer
-	if err := tpl.Execute(&buf, data); err != nil {
-		return "", err
+	if e.IsError {
+		ev.Error = e.Content
 	}
-	return buf.String(), nil
+	pipeline.Emit(ctx, ev)
 }
@@ -4,6 +4,8 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"log/slog"
+	"mime"
 	"net/http"
 	"strings"
 	"time"
@@ -11,12 +13,18 @@ import (
 	"github.com/ravi-parthasarathy/attractor/pkg/pipeline"
 )
 
-const defaultHTTPTimeout = 30 * time.Second
-
 // HTTPHandler makes an HTTP request and stores the response body and status
-// code in the pipeline context.
+// code in the pipeline context, both as strings.  A JSON response
+// (Content-Type application/json or */*+json) is also stored decoded, under
+// json_key (default <id>_json), so later nodes can use its fields without
+// parsing it.
 type HTTPHandler struct{}
 
+// Schema describes the attributes of a NodeTypeHTTP node.
+func (h *HTTPHandler) Schema() pipeline.NodeSchema {
+	return pipeline.BuiltinSchema(pipeline.NodeTypeHTTP)
+}
+
 func (h *HTTPHandler) Handle(ctx context.Context, node *pipeline.Node, pctx *pipeline.PipelineContext) error {
 	snap := pctx.Snapshot()
 
@@ -25,7 +33,7 @@ func (h *HTTPHandler) Handle(ctx context.Context, node *pipeline.Node, pctx *pip
 	if urlTpl == "" {
 		return fmt.Errorf("http node %q: missing required 'url' attribute", node.ID)
 	}
-	urlStr, err := renderTemplate(urlTpl, snap)
+	urlStr, err := renderTemplate(ctx, urlTpl, snap)
 	if err != nil {
 		return fmt.Errorf("http node %q: url template: %w", node.ID, err)
 	}
@@ -39,7 +47,7 @@ func (h *HTTPHandler) Handle(ctx context.Context, node *pipeline.Node, pctx *pip
 	// Optional body (template-rendered)
 	var bodyReader io.Reader
 	if bodyTpl := node.Attrs["body"]; bodyTpl != "" {
-		bodyStr, err := renderTemplate(bodyTpl, snap)
+		bodyStr, err := renderTemplate(ctx, bodyTpl, snap)
 		if err != nil {
 			return fmt.Errorf("http node %q: body template: %w", node.ID, err)
 		}
@@ -47,7 +55,7 @@ func (h *HTTPHandler) Handle(ctx context.Context, node *pipeline.Node, pctx *pip
 	}
 
 	// Timeout
-	timeout := defaultHTTPTimeout
+	timeout := pipeline.DefaultHTTPTimeout
 	if ts := node.Attrs["timeout"]; ts != "" {
 		if d, err := time.ParseDuration(ts); err == nil {
 			timeout = d
@@ -65,7 +73,7 @@ func (h *HTTPHandler) Handle(ctx context.Context, node *pipeline.Node, pctx *pip
 
 	// Optional headers: semicolon-separated Key:Value pairs
 	if headersTpl := node.Attrs["headers"]; headersTpl != "" {
-		headersStr, err := renderTemplate(headersTpl, snap)
+		headersStr, err := renderTemplate(ctx, headersTpl, snap)
 		if err != nil {
 			return fmt.Errorf("http node %q: headers template: %w", node.ID, err)
 		}
@@ -106,11 +114,34 @@ func (h *HTTPHandler) Handle(ctx context.Context, node *pipeline.Node, pctx *pip
 
 	pctx.Set(responseKey, string(bodyBytes))
 	pctx.Set(statusKey, fmt.Sprintf("%d", resp.StatusCode))
+	if isJSONContent(resp.Header.Get("Content-Type")) {
+		jsonKey := node.Attrs["json_key"]
+		if jsonKey == "" {
+			jsonKey = node.ID + "_json"
+		}
+		if v, err := pipeline.DecodeValue(bodyBytes); err == nil {
+			pctx.Set(jsonKey, v)
+		} else {
+			slog.Warn("http node: response is not valid JSON", "node", node.ID, "error", err)
+		}
+	}
 
 	// Optionally fail on non-2xx
 	if node.Attrs["fail_non2xx"] == "true" && (resp.StatusCode < 200 || resp.StatusCode >= 300) {
-		return fmt.Errorf("http node %q: non-2xx status %d", node.ID, resp.StatusCode)
+		return &pipeline.NodeError{
+			Kind: pipeline.ErrorKindHTTP,
+			Err:  fmt.Errorf("http node %q: non-2xx status %d", node.ID, resp.StatusCode),
+		}
 	}
 
 	return nil
 }
+
+// isJSONContent reports whether a Content-Type header names JSON.
+func isJSONContent(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	return mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"reflect"
 	"testing"
 	"time"
 
@@ -180,3 +181,37 @@ func TestHTTPNodeMissingURL(t *testing.T) {
 		t.Fatal("expected error for missing url, got nil")
 	}
 }
+
+func TestHTTPNodeJSONResponse(t *testing.T) {
+	t.Parallel()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/text" {
+			_, _ = fmt.Fprint(w, `{"ok":true}`)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		_, _ = fmt.Fprint(w, `{"user":{"name":"Ann"},"ids":[1,2]}`)
+	}))
+	defer srv.Close()
+
+	pctx := pipeline.NewPipelineContext()
+	h := &handlers.HTTPHandler{}
+	if err := h.Handle(t.Context(), newHTTPNode("fetch", map[string]string{"url": srv.URL}), pctx); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got, _ := pctx.Get("fetch_status"); got != "200" {
+		t.Errorf("status = %#v, want \"200\" as a string", got)
+	}
+	want := map[string]any{"user": map[string]any{"name": "Ann"}, "ids": []any{int64(1), int64(2)}}
+	if got, _ := pctx.Get("fetch_json"); !reflect.DeepEqual(got, want) {
+		t.Errorf("fetch_json = %#v, want %#v", got, want)
+	}
+
+	node := newHTTPNode("plain", map[string]string{"url": srv.URL + "/text"})
+	if err := h.Handle(t.Context(), node, pctx); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, ok := pctx.Get("plain_json"); ok {
+		t.Error("plain_json set for a response that is not JSON")
+	}
+}
@@ -14,14 +14,26 @@ import (
 
 // HumanHandler pauses the pipeline and prompts the user for input via stdin.
 // Supports a "key" attr to control the context key and an "options" attr to
-// display a numbered menu and validate the response.
+// display a numbered menu and validate the response.  The chosen option is
+// also the outcome's preferred label, so an outgoing edge labelled with the
+// option text is followed.
 type HumanHandler struct {
 	// In and Out allow tests to inject alternate stdin/stdout.
 	In  io.Reader
 	Out io.Writer
 }
 
-func (h *HumanHandler) Handle(_ context.Context, node *pipeline.Node, pctx *pipeline.PipelineContext) error {
+// Schema describes the attributes of a NodeTypeHuman node.
+func (h *HumanHandler) Schema() pipeline.NodeSchema {
+	return pipeline.BuiltinSchema(pipeline.NodeTypeHuman)
+}
+
+func (h *HumanHandler) Handle(ctx context.Context, node *pipeline.Node, pctx *pipeline.PipelineContext) error {
+	_, err := h.Execute(ctx, node, pctx)
+	return err
+}
+
+func (h *HumanHandler) Execute(_ context.Context, node *pipeline.Node, pctx *pipeline.PipelineContext) (pipeline.Outcome, error) {
 	promptText := node.Attrs["prompt"]
 	if promptText == "" {
 		promptText = fmt.Sprintf("Node %q requires your input", node.ID)
@@ -67,21 +79,21 @@ func (h *HumanHandler) Handle(_ context.Context, node *pipeline.Node, pctx *pipe
 
 		line, err := reader.ReadString('\n')
 		if err != nil {
-			return fmt.Errorf("human node %q: read error: %w", node.ID, err)
+			return pipeline.Outcome{Status: pipeline.OutcomeFail}, fmt.Errorf("human node %q: read error: %w", node.ID, err)
 		}
 		response := strings.TrimSpace(line)
 
 		if len(options) == 0 {
 			// No validation — accept any input.
 			pctx.Set(key, response)
-			return nil
+			return pipeline.Outcome{Status: pipeline.OutcomeSuccess}, nil
 		}
 
 		// Try numeric selection first.
 		if n, parseErr := strconv.Atoi(response); parseErr == nil {
 			if n >= 1 && n <= len(options) {
 				pctx.Set(key, options[n-1])
-				return nil
+				return pipeline.Outcome{Status: pipeline.OutcomeSuccess, PreferredLabel: options[n-1]}, nil
 			}
 		}
 
@@ -90,7 +102,7 @@ func (h *HumanHandler) Handle(_ context.Context, node *pipeline.Node, pctx *pipe
 		for _, o := range options {
 			if strings.ToLower(o) == lower {
 				pctx.Set(key, o)
-				return nil
+				return pipeline.Outcome{Status: pipeline.OutcomeSuccess, PreferredLabel: o}, nil
 			}
 		}
 
@@ -129,3 +129,23 @@ func TestHumanOptionsMenuDisplayed(t *testing.T) {
 		t.Errorf("expected menu item '2) beta' in output: %s", display)
 	}
 }
+
+func TestHumanOptionsPreferredLabel(t *testing.T) {
+	t.Parallel()
+	pctx := pipeline.NewPipelineContext()
+	node := humanNode("review", map[string]string{
+		"prompt":  "Approve the plan?",
+		"options": "approve,revise",
+	})
+
+	var out bytes.Buffer
+	h := &handlers.HumanHandler{In: strings.NewReader("2\n"), Out: &out}
+	res, err := h.Execute(t.Context(), node, pctx)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// The chosen option selects the matching outgoing edge label.
+	if res.PreferredLabel != "revise" {
+		t.Errorf("PreferredLabel = %q, want %q", res.PreferredLabel, "revise")
+	}
+}
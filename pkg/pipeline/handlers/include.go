@@ -19,6 +19,11 @@ type IncludeHandler struct {
 	RegistryBuilder func(workdir, defaultModel string) pipeline.HandlerRegistry
 }
 
+// Schema describes the attributes of a NodeTypeInclude node.
+func (h *IncludeHandler) Schema() pipeline.NodeSchema {
+	return pipeline.BuiltinSchema(pipeline.NodeTypeInclude)
+}
+
 func (h *IncludeHandler) Handle(ctx context.Context, node *pipeline.Node, pctx *pipeline.PipelineContext) error {
 	pathTpl := node.Attrs["path"]
 	if pathTpl == "" {
@@ -26,7 +31,7 @@ func (h *IncludeHandler) Handle(ctx context.Context, node *pipeline.Node, pctx *
 	}
 
 	// Render path template.
-	rendered, err := renderTemplate(pathTpl, pctx.Snapshot())
+	rendered, err := renderTemplate(ctx, pathTpl, pctx.Snapshot())
 	if err != nil {
 		return fmt.Errorf("include node %q: path template error: %w", node.ID, err)
 	}
@@ -36,7 +41,7 @@ func (h *IncludeHandler) Handle(ctx context.Context, node *pipeline.Node, pctx *
 	if err != nil {
 		return fmt.Errorf("include node %q: read %q: %w", node.ID, rendered, err)
 	}
-	p, err := pipeline.ParseDOT(string(src))
+	p, err := pipeline.Parse(string(src), pipeline.SyntaxOf(rendered))
 	if err != nil {
 		return fmt.Errorf("include node %q: parse %q: %w", node.ID, rendered, err)
 	}
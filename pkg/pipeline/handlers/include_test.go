@@ -72,6 +72,33 @@ func TestIncludeContextShared(t *testing.T) {
 	}
 }
 
+func TestIncludeYAML(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	subPath := writeSubPipeline(t, dir, "sub.yaml", `nodes:
+  start: {type: start}
+  set_val: {type: set, key: sub_ran, value: "yes"}
+  done: {type: exit}
+edges:
+  - {from: start, to: set_val}
+  - {from: set_val, to: done}
+`)
+
+	pctx := pipeline.NewPipelineContext()
+	node := &pipeline.Node{
+		ID:    "inc",
+		Type:  pipeline.NodeTypeInclude,
+		Attrs: map[string]string{"path": subPath},
+	}
+	h := &handlers.IncludeHandler{RegistryBuilder: minimalRegistry}
+	if err := h.Handle(t.Context(), node, pctx); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := pctx.GetString("sub_ran"); got != "yes" {
+		t.Errorf("sub_ran = %q, want %q", got, "yes")
+	}
+}
+
 func TestIncludePathTemplate(t *testing.T) {
 	t.Parallel()
 	dir := t.TempDir()
@@ -2,16 +2,22 @@ package handlers
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
 
 	"github.com/ravi-parthasarathy/attractor/pkg/pipeline"
 )
 
 // JSONDecodeHandler unpacks a JSON object stored in a context key into
-// individual context keys, optionally prefixed.
+// individual context keys, optionally prefixed.  Values keep their JSON
+// types: numbers, booleans, lists and nested objects are stored as such, and
+// null as "".  The source may also hold an object value rather than JSON.
 type JSONDecodeHandler struct{}
 
+// Schema describes the attributes of a NodeTypeJSONDecode node.
+func (h *JSONDecodeHandler) Schema() pipeline.NodeSchema {
+	return pipeline.BuiltinSchema(pipeline.NodeTypeJSONDecode)
+}
+
 func (h *JSONDecodeHandler) Handle(_ context.Context, node *pipeline.Node, pctx *pipeline.PipelineContext) error {
 	source := node.Attrs["source"]
 	if source == "" {
@@ -19,40 +25,28 @@ func (h *JSONDecodeHandler) Handle(_ context.Context, node *pipeline.Node, pctx
 	}
 	prefix := node.Attrs["prefix"]
 
-	raw := pctx.GetString(source)
-	// Empty source is treated as an empty object — no keys to set.
-	if raw == "" {
+	// An unset or empty source is treated as an empty object — no keys to
+	// set.
+	top, _ := pctx.Get(source)
+	if top == nil || top == "" {
 		return nil
 	}
-
-	// Unmarshal into a generic map to detect non-objects before typed decode.
-	var top any
-	if err := json.Unmarshal([]byte(raw), &top); err != nil {
-		return fmt.Errorf("json_decode node %q: invalid JSON in %q: %w", node.ID, source, err)
+	if raw, ok := top.(string); ok {
+		var err error
+		if top, err = pipeline.DecodeValue([]byte(raw)); err != nil {
+			return fmt.Errorf("json_decode node %q: invalid JSON in %q: %w", node.ID, source, err)
+		}
 	}
-	if _, ok := top.(map[string]any); !ok {
+	fields, ok := top.(map[string]any)
+	if !ok {
 		return fmt.Errorf("json_decode node %q: value of %q must be a JSON object", node.ID, source)
 	}
 
-	fields := top.(map[string]any)
 	for k, v := range fields {
-		var strVal string
-		switch tv := v.(type) {
-		case string:
-			strVal = tv
-		case nil:
-			strVal = ""
-		case bool, float64:
-			strVal = fmt.Sprintf("%v", tv)
-		default:
-			// Nested object or array — re-marshal to compact JSON.
-			b, err := json.Marshal(tv)
-			if err != nil {
-				return fmt.Errorf("json_decode node %q: marshal field %q: %w", node.ID, k, err)
-			}
-			strVal = string(b)
+		if v == nil {
+			v = ""
 		}
-		pctx.Set(prefix+k, strVal)
+		pctx.Set(prefix+k, v)
 	}
 	return nil
 }
@@ -1,6 +1,7 @@
 package handlers_test
 
 import (
+	"reflect"
 	"testing"
 
 	"github.com/ravi-parthasarathy/attractor/pkg/pipeline"
@@ -74,7 +75,7 @@ func TestJSONDecodeNestedObject(t *testing.T) {
 	if err := h.Handle(t.Context(), node, pctx); err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
-	// Nested object should be re-marshalled to a JSON string.
+	// Nested object reads back as JSON.
 	meta := pctx.GetString("meta")
 	if meta == "" {
 		t.Error("expected 'meta' key to be set")
@@ -135,7 +136,6 @@ func TestJSONDecodeValidatorCatchesMissingSource(t *testing.T) {
 func TestJSONDecodeNumericValues(t *testing.T) {
 	t.Parallel()
 	pctx := pipeline.NewPipelineContext()
-	// JSON numbers are float64 after json.Unmarshal into any.
 	pctx.Set("data", `{"count":42,"ratio":0.5,"active":true}`)
 
 	node := jsonDecodeNode("d", map[string]string{"source": "data"})
@@ -143,7 +143,7 @@ func TestJSONDecodeNumericValues(t *testing.T) {
 	if err := h.Handle(t.Context(), node, pctx); err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
-	// count stored as "42" (float64 → string).
+	// count reads back as "42".
 	if got := pctx.GetString("count"); got == "" {
 		t.Error("expected 'count' key to be set")
 	}
@@ -151,3 +151,44 @@ func TestJSONDecodeNumericValues(t *testing.T) {
 		t.Errorf("active = %q, want %q", got, "true")
 	}
 }
+
+func TestJSONDecodeKeepsTypes(t *testing.T) {
+	t.Parallel()
+	pctx := pipeline.NewPipelineContext()
+	pctx.Set("data", `{"count":42,"ratio":0.5,"active":true,"tags":["x","y"],"user":{"name":"Ann"},"none":null,"id":9007199254740993}`)
+
+	node := jsonDecodeNode("d", map[string]string{"source": "data"})
+	h := &handlers.JSONDecodeHandler{}
+	if err := h.Handle(t.Context(), node, pctx); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := map[string]any{
+		"count":  int64(42),
+		"ratio":  0.5,
+		"active": true,
+		"tags":   []any{"x", "y"},
+		"user":   map[string]any{"name": "Ann"},
+		"none":   "",
+		"id":     int64(9007199254740993),
+	}
+	for k, w := range want {
+		if got, _ := pctx.Get(k); !reflect.DeepEqual(got, w) {
+			t.Errorf("%s = %#v, want %#v", k, got, w)
+		}
+	}
+}
+
+func TestJSONDecodeObjectValue(t *testing.T) {
+	t.Parallel()
+	pctx := pipeline.NewPipelineContext()
+	pctx.Set("data", map[string]any{"name": "Ann"})
+
+	node := jsonDecodeNode("d", map[string]string{"source": "data", "prefix": "u_"})
+	h := &handlers.JSONDecodeHandler{}
+	if err := h.Handle(t.Context(), node, pctx); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := pctx.GetString("u_name"); got != "Ann" {
+		t.Errorf("u_name = %q, want Ann", got)
+	}
+}
@@ -15,6 +15,11 @@ import (
 // a new context key.
 type JSONExtractHandler struct{}
 
+// Schema describes the attributes of a NodeTypeJSONExtract node.
+func (h *JSONExtractHandler) Schema() pipeline.NodeSchema {
+	return pipeline.BuiltinSchema(pipeline.NodeTypeJSONExtract)
+}
+
 func (h *JSONExtractHandler) Handle(_ context.Context, node *pipeline.Node, pctx *pipeline.PipelineContext) error {
 	sourceKey := node.Attrs["source"]
 	if sourceKey == "" {
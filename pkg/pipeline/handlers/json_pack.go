@@ -11,8 +11,14 @@ import (
 
 // JSONPackHandler packs a set of pipeline context keys into a single JSON
 // object string and stores it under the key named by the "output" attribute.
+// Typed values keep their JSON types; unset keys pack as "".
 type JSONPackHandler struct{}
 
+// Schema describes the attributes of a NodeTypeJSONPack node.
+func (h *JSONPackHandler) Schema() pipeline.NodeSchema {
+	return pipeline.BuiltinSchema(pipeline.NodeTypeJSONPack)
+}
+
 func (h *JSONPackHandler) Handle(_ context.Context, node *pipeline.Node, pctx *pipeline.PipelineContext) error {
 	keysAttr := node.Attrs["keys"]
 	if keysAttr == "" {
@@ -25,13 +31,17 @@ func (h *JSONPackHandler) Handle(_ context.Context, node *pipeline.Node, pctx *p
 
 	// Split and trim the key names.
 	names := strings.Split(keysAttr, ",")
-	obj := make(map[string]string, len(names))
+	obj := make(map[string]any, len(names))
 	for _, name := range names {
 		name = strings.TrimSpace(name)
 		if name == "" {
 			continue
 		}
-		obj[name] = pctx.GetString(name)
+		v, ok := pctx.Get(name)
+		if !ok || v == nil {
+			v = ""
+		}
+		obj[name] = v
 	}
 
 	data, err := json.Marshal(obj)
@@ -22,6 +22,11 @@ type MapHandler struct {
 	Workdir      string
 }
 
+// Schema describes the attributes of a NodeTypeMap node.
+func (h *MapHandler) Schema() pipeline.NodeSchema {
+	return pipeline.BuiltinSchema(pipeline.NodeTypeMap)
+}
+
 func (h *MapHandler) Handle(ctx context.Context, node *pipeline.Node, pctx *pipeline.PipelineContext) error {
 	itemsKey := node.Attrs["items"]
 	if itemsKey == "" {
@@ -42,14 +47,8 @@ func (h *MapHandler) Handle(ctx context.Context, node *pipeline.Node, pctx *pipe
 	}
 
 	// Parse items JSON array.
-	itemsJSON := pctx.GetString(itemsKey)
-	if itemsJSON == "" {
-		pctx.Set(resultsKey, "[]")
-		pctx.Set("last_output", "[]")
-		return nil
-	}
-	var items []any
-	if err := json.Unmarshal([]byte(itemsJSON), &items); err != nil {
+	items, err := contextList(pctx, itemsKey)
+	if err != nil {
 		return fmt.Errorf("map node %q: context key %q is not a valid JSON array: %w", node.ID, itemsKey, err)
 	}
 	if len(items) == 0 {
@@ -119,9 +118,9 @@ func (h *MapHandler) runItem(
 ) (string, error) {
 	// Each item gets an independent copy of the context.
 	branchCtx := pctx.Copy()
-	branchCtx.Set(itemKey, fmt.Sprintf("%v", item))
+	branchCtx.Set(itemKey, item)
 
-	rendered, err := renderTemplate(promptTpl, branchCtx.Snapshot())
+	rendered, err := renderTemplate(ctx, promptTpl, branchCtx.Snapshot())
 	if err != nil {
 		return "", fmt.Errorf("item %d: prompt template: %w", idx, err)
 	}
@@ -157,6 +156,7 @@ func (h *MapHandler) runItem(
 	go func() {
 		defer close(done)
 		for e := range eventCh {
+			forwardAgentEvent(ctx, node, e)
 			switch e.Type {
 			case agent.EventTypeToolCall:
 				slog.Debug("map tool call", "node", node.ID, "item", idx, "tool", e.ToolName)
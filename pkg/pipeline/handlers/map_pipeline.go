@@ -0,0 +1,209 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/ravi-parthasarathy/attractor/pkg/pipeline"
+)
+
+// MapPipelineHandler runs an included DOT pipeline once for every element of
+// a JSON array stored in the pipeline context.  Runs proceed in parallel,
+// bounded by the concurrency attribute, and each gets its own copy of the
+// context with the element stored under item_key.  The keys each run writes
+// (or the subset named by outputs) are collected into a JSON array of
+// objects, one per element, in input order.
+//
+// RegistryBuilder constructs the handler registry for each run; it is
+// injected at registration time to avoid import cycles, as for
+// IncludeHandler.
+type MapPipelineHandler struct {
+	Workdir         string
+	DefaultModel    string
+	RegistryBuilder func(workdir, defaultModel string) pipeline.HandlerRegistry
+}
+
+// Schema describes the attributes of a NodeTypeMapPipeline node.
+func (h *MapPipelineHandler) Schema() pipeline.NodeSchema {
+	return pipeline.BuiltinSchema(pipeline.NodeTypeMapPipeline)
+}
+
+func (h *MapPipelineHandler) Handle(ctx context.Context, node *pipeline.Node, pctx *pipeline.PipelineContext) error {
+	itemsKey := node.Attrs["items"]
+	if itemsKey == "" {
+		return fmt.Errorf("map_pipeline node %q: missing required 'items' attribute", node.ID)
+	}
+	itemKey := node.Attrs["item_key"]
+	if itemKey == "" {
+		return fmt.Errorf("map_pipeline node %q: missing required 'item_key' attribute", node.ID)
+	}
+	pathTpl := node.Attrs["path"]
+	if pathTpl == "" {
+		return fmt.Errorf("map_pipeline node %q: missing required 'path' attribute", node.ID)
+	}
+	if h.RegistryBuilder == nil {
+		return fmt.Errorf("map_pipeline node %q: RegistryBuilder not configured", node.ID)
+	}
+
+	resultsKey := node.Attrs["results_key"]
+	if resultsKey == "" {
+		resultsKey = node.ID + "_results"
+	}
+	var outputs []string
+	for _, k := range strings.Split(node.Attrs["outputs"], ",") {
+		if k = strings.TrimSpace(k); k != "" {
+			outputs = append(outputs, k)
+		}
+	}
+
+	// Parse items JSON array.
+	items, err := contextList(pctx, itemsKey)
+	if err != nil {
+		return fmt.Errorf("map_pipeline node %q: context key %q is not a valid JSON array: %w", node.ID, itemsKey, err)
+	}
+	if len(items) == 0 {
+		pctx.Set(resultsKey, "[]")
+		pctx.Set("last_output", "[]")
+		return nil
+	}
+
+	// Read and parse the per-item pipeline once; every run shares it.
+	path, err := renderTemplate(ctx, pathTpl, pctx.Snapshot())
+	if err != nil {
+		return fmt.Errorf("map_pipeline node %q: path template error: %w", node.ID, err)
+	}
+	src, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("map_pipeline node %q: read %q: %w", node.ID, path, err)
+	}
+	p, err := pipeline.Parse(string(src), pipeline.SyntaxOf(path))
+	if err != nil {
+		return fmt.Errorf("map_pipeline node %q: parse %q: %w", node.ID, path, err)
+	}
+	if lintErr := pipeline.ValidateErr(p); lintErr != nil {
+		return fmt.Errorf("map_pipeline node %q: invalid pipeline %q: %w", node.ID, path, lintErr)
+	}
+	pipeline.ApplyStylesheet(p)
+
+	// Concurrency limit: 0 means "run all in parallel".
+	concurrency := len(items)
+	if cs := node.Attrs["concurrency"]; cs != "" {
+		if n, err := strconv.Atoi(cs); err == nil && n > 0 && n < concurrency {
+			concurrency = n
+		}
+	}
+
+	// The first failure cancels the runs still in progress.
+	runCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	results := make([]map[string]any, len(items))
+
+	// Keep the first failure; later ones are usually the cancellation it
+	// caused.
+	var (
+		mu       sync.Mutex
+		firstErr error
+	)
+
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for i, item := range items {
+		sem <- struct{}{}
+		if runCtx.Err() != nil {
+			<-sem
+			break
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			res, err := h.runItem(runCtx, p, pctx, itemKey, item, i, outputs)
+			if err != nil {
+				mu.Lock()
+				if firstErr == nil {
+					firstErr = err
+				}
+				mu.Unlock()
+				cancel()
+				return
+			}
+			results[i] = res
+		}()
+	}
+	wg.Wait()
+
+	if firstErr != nil {
+		return fmt.Errorf("map_pipeline node %q: %w", node.ID, firstErr)
+	}
+	if ctx.Err() != nil {
+		return fmt.Errorf("map_pipeline node %q: %w", node.ID, ctx.Err())
+	}
+
+	b, err := json.Marshal(results)
+	if err != nil {
+		return fmt.Errorf("map_pipeline node %q: marshal results: %w", node.ID, err)
+	}
+	pctx.Set(resultsKey, string(b))
+	pctx.Set("last_output", string(b))
+	pctx.Set(node.ID+"_count", strconv.Itoa(len(results)))
+	return nil
+}
+
+// runItem executes p for one element on a copy of pctx and returns the
+// element's outputs: the named output keys, or else every key the run added
+// or changed.
+func (h *MapPipelineHandler) runItem(
+	ctx context.Context,
+	p *pipeline.Pipeline,
+	pctx *pipeline.PipelineContext,
+	itemKey string,
+	item any,
+	idx int,
+	outputs []string,
+) (map[string]any, error) {
+	itemCtx := pctx.Copy()
+	before := itemCtx.Snapshot()
+	itemCtx.Set(itemKey, item)
+	itemCtx.Set(itemKey+"_index", strconv.Itoa(idx))
+
+	eng, err := pipeline.NewEngine(p, h.RegistryBuilder(h.Workdir, h.DefaultModel), itemCtx, "")
+	if err != nil {
+		return nil, fmt.Errorf("item %d: build engine: %w", idx, err)
+	}
+	if err := eng.Execute(ctx, ""); err != nil {
+		return nil, fmt.Errorf("item %d: %w", idx, err)
+	}
+
+	after := itemCtx.Snapshot()
+	out := make(map[string]any)
+	if len(outputs) > 0 {
+		for _, k := range outputs {
+			if v, ok := after[k]; ok {
+				out[k] = v
+			}
+		}
+		return out, nil
+	}
+	keys := make([]string, 0, len(after))
+	for k := range after {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if k == itemKey || k == itemKey+"_index" {
+			continue
+		}
+		if old, ok := before[k]; !ok || !reflect.DeepEqual(old, after[k]) {
+			out[k] = after[k]
+		}
+	}
+	return out, nil
+}
@@ -0,0 +1,231 @@
+package handlers_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ravi-parthasarathy/attractor/pkg/pipeline"
+	"github.com/ravi-parthasarathy/attractor/pkg/pipeline/handlers"
+)
+
+const perItemDOT = `digraph per_item {
+    start  [type=start]
+    greet  [type=set key="greeting" value="hello {{.name}}"]
+    pos    [type=set key="position" value="{{.name_index}}"]
+    done   [type=exit]
+    start -> greet -> pos -> done
+}`
+
+func mapPipelineNode(attrs map[string]string) *pipeline.Node {
+	return &pipeline.Node{ID: "mp", Type: pipeline.NodeTypeMapPipeline, Attrs: attrs}
+}
+
+func TestMapPipelineCollectsOutputs(t *testing.T) {
+	t.Parallel()
+	path := writeSubPipeline(t, t.TempDir(), "item.dot", perItemDOT)
+
+	pctx := pipeline.NewPipelineContext()
+	pctx.Set("names", `["ann","bob","cy"]`)
+	node := mapPipelineNode(map[string]string{"items": "names", "item_key": "name", "path": path})
+	h := &handlers.MapPipelineHandler{RegistryBuilder: minimalRegistry}
+	if err := h.Handle(t.Context(), node, pctx); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var got []map[string]string
+	if err := json.Unmarshal([]byte(pctx.GetString("mp_results")), &got); err != nil {
+		t.Fatalf("mp_results is not a JSON array of objects: %v", err)
+	}
+	if len(got) != 3 {
+		t.Fatalf("got %d results, want 3", len(got))
+	}
+	for i, name := range []string{"ann", "bob", "cy"} {
+		if got[i]["greeting"] != "hello "+name {
+			t.Errorf("result %d greeting = %q, want %q", i, got[i]["greeting"], "hello "+name)
+		}
+		if _, ok := got[i]["name"]; ok {
+			t.Errorf("result %d includes the item key", i)
+		}
+	}
+	if got[2]["position"] != "2" {
+		t.Errorf("result 2 position = %q, want %q", got[2]["position"], "2")
+	}
+	if pctx.GetString("mp_count") != "3" {
+		t.Errorf("mp_count = %q, want %q", pctx.GetString("mp_count"), "3")
+	}
+	if pctx.GetString("last_output") != pctx.GetString("mp_results") {
+		t.Error("last_output does not match mp_results")
+	}
+	// Per-item writes stay in the per-item copies.
+	if _, ok := pctx.Get("greeting"); ok {
+		t.Error("per-item write leaked into the parent context")
+	}
+}
+
+func TestMapPipelineOutputsAndResultsKey(t *testing.T) {
+	t.Parallel()
+	path := writeSubPipeline(t, t.TempDir(), "item.dot", perItemDOT)
+
+	pctx := pipeline.NewPipelineContext()
+	pctx.Set("names", `["ann"]`)
+	node := mapPipelineNode(map[string]string{
+		"items":       "names",
+		"item_key":    "name",
+		"path":        path,
+		"outputs":     "greeting, missing",
+		"results_key": "greetings",
+	})
+	h := &handlers.MapPipelineHandler{RegistryBuilder: minimalRegistry}
+	if err := h.Handle(t.Context(), node, pctx); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got, want := pctx.GetString("greetings"), `[{"greeting":"hello ann"}]`; got != want {
+		t.Errorf("greetings = %s, want %s", got, want)
+	}
+}
+
+func TestMapPipelineObjectItems(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	path := writeSubPipeline(t, dir, "item.dot", `digraph per_item {
+    start [type=start]
+    copy  [type=set key="raw" value="{{.file}}"]
+    done  [type=exit]
+    start -> copy -> done
+}`)
+
+	pctx := pipeline.NewPipelineContext()
+	pctx.Set("files", `[{"path":"a.go"}]`)
+	node := mapPipelineNode(map[string]string{"items": "files", "item_key": "file", "path": path})
+	h := &handlers.MapPipelineHandler{RegistryBuilder: minimalRegistry}
+	if err := h.Handle(t.Context(), node, pctx); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var got []map[string]string
+	if err := json.Unmarshal([]byte(pctx.GetString("mp_results")), &got); err != nil {
+		t.Fatalf("unmarshal results: %v", err)
+	}
+	if got[0]["raw"] != `{"path":"a.go"}` {
+		t.Errorf("raw = %q, want the item as JSON", got[0]["raw"])
+	}
+}
+
+func TestMapPipelineEmptyArray(t *testing.T) {
+	t.Parallel()
+	pctx := pipeline.NewPipelineContext()
+	pctx.Set("names", "[]")
+	node := mapPipelineNode(map[string]string{"items": "names", "item_key": "name", "path": "unused.dot"})
+	h := &handlers.MapPipelineHandler{RegistryBuilder: minimalRegistry}
+	if err := h.Handle(t.Context(), node, pctx); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := pctx.GetString("mp_results"); got != "[]" {
+		t.Errorf("got %q, want %q", got, "[]")
+	}
+}
+
+func TestMapPipelineInvalidJSON(t *testing.T) {
+	t.Parallel()
+	pctx := pipeline.NewPipelineContext()
+	pctx.Set("names", `{"not":"array"}`)
+	node := mapPipelineNode(map[string]string{"items": "names", "item_key": "name", "path": "unused.dot"})
+	h := &handlers.MapPipelineHandler{RegistryBuilder: minimalRegistry}
+	if err := h.Handle(t.Context(), node, pctx); err == nil {
+		t.Fatal("expected error for non-array items")
+	}
+}
+
+func TestMapPipelineMissingFile(t *testing.T) {
+	t.Parallel()
+	pctx := pipeline.NewPipelineContext()
+	pctx.Set("names", `["ann"]`)
+	node := mapPipelineNode(map[string]string{"items": "names", "item_key": "name", "path": "/nonexistent/item.dot"})
+	h := &handlers.MapPipelineHandler{RegistryBuilder: minimalRegistry}
+	if err := h.Handle(t.Context(), node, pctx); err == nil {
+		t.Fatal("expected error for missing pipeline file")
+	}
+}
+
+// probeHandler records how many runs are inside it at once, and fails for
+// the item "bad".
+type probeHandler struct {
+	mu      sync.Mutex
+	active  int
+	maxSeen int
+}
+
+func (h *probeHandler) Handle(ctx context.Context, _ *pipeline.Node, pctx *pipeline.PipelineContext) error {
+	h.mu.Lock()
+	h.active++
+	h.maxSeen = max(h.maxSeen, h.active)
+	h.mu.Unlock()
+	defer func() {
+		h.mu.Lock()
+		h.active--
+		h.mu.Unlock()
+	}()
+
+	if pctx.GetString("name") == "bad" {
+		return errors.New("bad item")
+	}
+	select {
+	case <-time.After(20 * time.Millisecond):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+const probeDOT = `digraph probe {
+    start [type=start]
+    work  [type=probe]
+    done  [type=exit]
+    start -> work -> done
+}`
+
+func probeRegistry(probe *probeHandler) func(_, _ string) pipeline.HandlerRegistry {
+	return func(w, m string) pipeline.HandlerRegistry {
+		reg := minimalRegistry(w, m).(*handlers.Registry)
+		reg.Register("probe", probe)
+		return reg
+	}
+}
+
+func TestMapPipelineConcurrencyLimit(t *testing.T) {
+	t.Parallel()
+	path := writeSubPipeline(t, t.TempDir(), "probe.dot", probeDOT)
+
+	pctx := pipeline.NewPipelineContext()
+	pctx.Set("names", `["a","b","c","d","e","f"]`)
+	node := mapPipelineNode(map[string]string{"items": "names", "item_key": "name", "path": path, "concurrency": "2"})
+	probe := &probeHandler{}
+	h := &handlers.MapPipelineHandler{RegistryBuilder: probeRegistry(probe)}
+	if err := h.Handle(t.Context(), node, pctx); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if probe.maxSeen > 2 {
+		t.Errorf("saw %d concurrent runs, want at most 2", probe.maxSeen)
+	}
+}
+
+func TestMapPipelineItemFailure(t *testing.T) {
+	t.Parallel()
+	path := writeSubPipeline(t, t.TempDir(), "probe.dot", probeDOT)
+
+	pctx := pipeline.NewPipelineContext()
+	pctx.Set("names", `["a","bad","c"]`)
+	node := mapPipelineNode(map[string]string{"items": "names", "item_key": "name", "path": path})
+	h := &handlers.MapPipelineHandler{RegistryBuilder: probeRegistry(&probeHandler{})}
+	err := h.Handle(t.Context(), node, pctx)
+	if err == nil || !strings.Contains(err.Error(), "bad item") {
+		t.Fatalf("expected the failing item's error, got %v", err)
+	}
+	if _, ok := pctx.Get("mp_results"); ok {
+		t.Error("mp_results set despite a failed item")
+	}
+}
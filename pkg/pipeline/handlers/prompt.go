@@ -17,6 +17,11 @@ type PromptHandler struct {
 	DefaultModel string
 }
 
+// Schema describes the attributes of a NodeTypePrompt node.
+func (h *PromptHandler) Schema() pipeline.NodeSchema {
+	return pipeline.BuiltinSchema(pipeline.NodeTypePrompt)
+}
+
 func (h *PromptHandler) Handle(ctx context.Context, node *pipeline.Node, pctx *pipeline.PipelineContext) error {
 	// Resolve required attributes.
 	promptTpl := node.Attrs["prompt"]
@@ -29,7 +34,7 @@ func (h *PromptHandler) Handle(ctx context.Context, node *pipeline.Node, pctx *p
 	}
 
 	// Render prompt template.
-	rendered, err := renderTemplate(promptTpl, pctx.Snapshot())
+	rendered, err := renderTemplate(ctx, promptTpl, pctx.Snapshot())
 	if err != nil {
 		return fmt.Errorf("prompt node %q: template error: %w", node.ID, err)
 	}
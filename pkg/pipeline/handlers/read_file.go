@@ -13,7 +13,12 @@ import (
 // pipeline context under the configured key.
 type ReadFileHandler struct{}
 
-func (h *ReadFileHandler) Handle(_ context.Context, node *pipeline.Node, pctx *pipeline.PipelineContext) error {
+// Schema describes the attributes of a NodeTypeReadFile node.
+func (h *ReadFileHandler) Schema() pipeline.NodeSchema {
+	return pipeline.BuiltinSchema(pipeline.NodeTypeReadFile)
+}
+
+func (h *ReadFileHandler) Handle(ctx context.Context, node *pipeline.Node, pctx *pipeline.PipelineContext) error {
 	key := node.Attrs["key"]
 	if key == "" {
 		return fmt.Errorf("read_file node %q: missing required 'key' attribute", node.ID)
@@ -23,7 +28,7 @@ func (h *ReadFileHandler) Handle(_ context.Context, node *pipeline.Node, pctx *p
 		return fmt.Errorf("read_file node %q: missing required 'path' attribute", node.ID)
 	}
 
-	path, err := renderTemplate(pathTpl, pctx.Snapshot())
+	path, err := renderTemplate(ctx, pathTpl, pctx.Snapshot())
 	if err != nil {
 		return fmt.Errorf("read_file node %q: path template: %w", node.ID, err)
 	}
@@ -13,6 +13,11 @@ import (
 // capture group (or the whole match) in the output key.
 type RegexHandler struct{}
 
+// Schema describes the attributes of a NodeTypeRegex node.
+func (h *RegexHandler) Schema() pipeline.NodeSchema {
+	return pipeline.BuiltinSchema(pipeline.NodeTypeRegex)
+}
+
 func (h *RegexHandler) Handle(_ context.Context, node *pipeline.Node, pctx *pipeline.PipelineContext) error {
 	source := node.Attrs["source"]
 	if source == "" {
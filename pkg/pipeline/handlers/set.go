@@ -11,13 +11,18 @@ import (
 // the result under the node's "key" attribute in the context.
 type SetHandler struct{}
 
-func (h *SetHandler) Handle(_ context.Context, node *pipeline.Node, pctx *pipeline.PipelineContext) error {
+// Schema describes the attributes of a NodeTypeSet node.
+func (h *SetHandler) Schema() pipeline.NodeSchema {
+	return pipeline.BuiltinSchema(pipeline.NodeTypeSet)
+}
+
+func (h *SetHandler) Handle(ctx context.Context, node *pipeline.Node, pctx *pipeline.PipelineContext) error {
 	key := node.Attrs["key"]
 	valueTpl := node.Attrs["value"]
 	if key == "" {
 		return fmt.Errorf("set node %q: missing 'key' attribute", node.ID)
 	}
-	val, err := renderTemplate(valueTpl, pctx.Snapshot())
+	val, err := renderTemplate(ctx, valueTpl, pctx.Snapshot())
 	if err != nil {
 		return fmt.Errorf("set node %q: template error: %w", node.ID, err)
 	}
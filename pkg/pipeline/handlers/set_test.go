@@ -0,0 +1,50 @@
+package handlers_test
+
+import (
+	"testing"
+
+	"github.com/ravi-parthasarathy/attractor/pkg/pipeline"
+	"github.com/ravi-parthasarathy/attractor/pkg/pipeline/handlers"
+)
+
+func TestSetTemplateTypedValues(t *testing.T) {
+	t.Parallel()
+	pctx := pipeline.NewPipelineContext()
+	pctx.Set("items", []any{"a", "b"})
+	pctx.Set("user", map[string]any{"name": "Ann", "roles": []any{"admin"}})
+	pctx.Set("count", int64(2))
+
+	for _, tc := range []struct{ tpl, want string }{
+		{`{{range .items}}[{{.}}]{{end}}`, "[a][b]"},
+		{`{{.user.name}} {{index .user.roles 0}}`, "Ann admin"},
+		{`{{.items}} {{.user}}`, `["a","b"] {"name":"Ann","roles":["admin"]}`},
+		{`{{if eq .count 2}}two{{end}} {{len .items}}`, "two 2"},
+	} {
+		node := &pipeline.Node{ID: "s", Type: pipeline.NodeTypeSet, Attrs: map[string]string{"key": "out", "value": tc.tpl}}
+		if err := (&handlers.SetHandler{}).Handle(t.Context(), node, pctx); err != nil {
+			t.Fatalf("%s: %v", tc.tpl, err)
+		}
+		if got := pctx.GetString("out"); got != tc.want {
+			t.Errorf("%s = %q, want %q", tc.tpl, got, tc.want)
+		}
+	}
+}
+
+func TestSetTemplateFuncsAndStrict(t *testing.T) {
+	t.Parallel()
+	pctx := pipeline.NewPipelineContext()
+	pctx.Set("items", []any{"a", "b"})
+	node := &pipeline.Node{ID: "s", Type: pipeline.NodeTypeSet, Attrs: map[string]string{"key": "out", "value": `{{.items | join "+"}} {{len .items | add 1}}`}}
+	if err := (&handlers.SetHandler{}).Handle(t.Context(), node, pctx); err != nil {
+		t.Fatalf("Handle: %v", err)
+	}
+	if got := pctx.GetString("out"); got != "a+b 3" {
+		t.Errorf("out = %q, want %q", got, "a+b 3")
+	}
+
+	node.Attrs["value"] = "{{.itmes}}"
+	ctx := pipeline.WithStrictTemplates(t.Context(), true)
+	if err := (&handlers.SetHandler{}).Handle(ctx, node, pctx); err == nil {
+		t.Error("Handle with a missing key in strict mode succeeded, want an error")
+	}
+}
@@ -12,6 +12,11 @@ import (
 // The sleep is cancellable via the context.
 type SleepHandler struct{}
 
+// Schema describes the attributes of a NodeTypeSleep node.
+func (h *SleepHandler) Schema() pipeline.NodeSchema {
+	return pipeline.BuiltinSchema(pipeline.NodeTypeSleep)
+}
+
 func (h *SleepHandler) Handle(ctx context.Context, node *pipeline.Node, _ *pipeline.PipelineContext) error {
 	durStr := node.Attrs["duration"]
 	if durStr == "" {
@@ -2,7 +2,6 @@ package handlers
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
 	"strings"
 
@@ -10,9 +9,14 @@ import (
 )
 
 // SplitHandler splits a string stored in the pipeline context by a separator
-// and stores the resulting elements as a JSON array under a new context key.
+// and stores the resulting elements as a list under a new context key.
 type SplitHandler struct{}
 
+// Schema describes the attributes of a NodeTypeSplit node.
+func (h *SplitHandler) Schema() pipeline.NodeSchema {
+	return pipeline.BuiltinSchema(pipeline.NodeTypeSplit)
+}
+
 func (h *SplitHandler) Handle(_ context.Context, node *pipeline.Node, pctx *pipeline.PipelineContext) error {
 	source := node.Attrs["source"]
 	if source == "" {
@@ -41,10 +45,10 @@ func (h *SplitHandler) Handle(_ context.Context, node *pipeline.Node, pctx *pipe
 		parts = filtered
 	}
 
-	b, err := json.Marshal(parts)
-	if err != nil {
-		return fmt.Errorf("split node %q: marshal result: %w", node.ID, err)
+	items := make([]any, len(parts))
+	for i, p := range parts {
+		items[i] = p
 	}
-	pctx.Set(key, string(b))
+	pctx.Set(key, items)
 	return nil
 }
@@ -128,3 +128,19 @@ func TestSplitMissingKeyAttr(t *testing.T) {
 		t.Fatal("expected error for missing key attr")
 	}
 }
+
+func TestSplitStoresList(t *testing.T) {
+	t.Parallel()
+	pctx := pipeline.NewPipelineContext()
+	pctx.Set("raw", "a,b")
+
+	h := &handlers.SplitHandler{}
+	node := splitNode("s", map[string]string{"source": "raw", "key": "parts", "sep": ","})
+	if err := h.Handle(t.Context(), node, pctx); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	v, _ := pctx.Get("parts")
+	if list, ok := v.([]any); !ok || len(list) != 2 || list[0] != "a" || list[1] != "b" {
+		t.Errorf("parts = %#v, want a list of a and b", v)
+	}
+}
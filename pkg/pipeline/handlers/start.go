@@ -14,6 +14,11 @@ type StartHandler struct {
 	Seed string
 }
 
+// Schema describes the attributes of a NodeTypeStart node.
+func (h *StartHandler) Schema() pipeline.NodeSchema {
+	return pipeline.BuiltinSchema(pipeline.NodeTypeStart)
+}
+
 func (h *StartHandler) Handle(_ context.Context, node *pipeline.Node, pctx *pipeline.PipelineContext) error {
 	seed := h.Seed
 	if seed == "" {
@@ -12,7 +12,12 @@ import (
 // value and stores the result in the output key.
 type StringTransformHandler struct{}
 
-func (h *StringTransformHandler) Handle(_ context.Context, node *pipeline.Node, pctx *pipeline.PipelineContext) error {
+// Schema describes the attributes of a NodeTypeStringTransform node.
+func (h *StringTransformHandler) Schema() pipeline.NodeSchema {
+	return pipeline.BuiltinSchema(pipeline.NodeTypeStringTransform)
+}
+
+func (h *StringTransformHandler) Handle(ctx context.Context, node *pipeline.Node, pctx *pipeline.PipelineContext) error {
 	source := node.Attrs["source"]
 	if source == "" {
 		return fmt.Errorf("string_transform node %q: missing 'source' attribute", node.ID)
@@ -41,11 +46,11 @@ func (h *StringTransformHandler) Handle(_ context.Context, node *pipeline.Node,
 		case "replace":
 			oldTpl := node.Attrs["old"]
 			newTpl := node.Attrs["new"]
-			oldStr, err := renderTemplate(oldTpl, snapshot)
+			oldStr, err := renderTemplate(ctx, oldTpl, snapshot)
 			if err != nil {
 				return fmt.Errorf("string_transform node %q: 'old' template error: %w", node.ID, err)
 			}
-			newStr, err := renderTemplate(newTpl, snapshot)
+			newStr, err := renderTemplate(ctx, newTpl, snapshot)
 			if err != nil {
 				return fmt.Errorf("string_transform node %q: 'new' template error: %w", node.ID, err)
 			}
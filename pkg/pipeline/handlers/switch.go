@@ -14,6 +14,11 @@ import (
 // and logs the routing key and its current value.
 type SwitchHandler struct{}
 
+// Schema describes the attributes of a NodeTypeSwitch node.
+func (h *SwitchHandler) Schema() pipeline.NodeSchema {
+	return pipeline.BuiltinSchema(pipeline.NodeTypeSwitch)
+}
+
 func (h *SwitchHandler) Handle(_ context.Context, node *pipeline.Node, pctx *pipeline.PipelineContext) error {
 	key := node.Attrs["key"]
 	if key == "" {
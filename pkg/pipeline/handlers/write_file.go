@@ -15,7 +15,12 @@ import (
 // result to disk, optionally in append mode.
 type WriteFileHandler struct{}
 
-func (h *WriteFileHandler) Handle(_ context.Context, node *pipeline.Node, pctx *pipeline.PipelineContext) error {
+// Schema describes the attributes of a NodeTypeWriteFile node.
+func (h *WriteFileHandler) Schema() pipeline.NodeSchema {
+	return pipeline.BuiltinSchema(pipeline.NodeTypeWriteFile)
+}
+
+func (h *WriteFileHandler) Handle(ctx context.Context, node *pipeline.Node, pctx *pipeline.PipelineContext) error {
 	snap := pctx.Snapshot()
 
 	pathTpl := node.Attrs["path"]
@@ -27,11 +32,11 @@ func (h *WriteFileHandler) Handle(_ context.Context, node *pipeline.Node, pctx *
 		return fmt.Errorf("write_file node %q: missing required 'content' attribute", node.ID)
 	}
 
-	path, err := renderTemplate(pathTpl, snap)
+	path, err := renderTemplate(ctx, pathTpl, snap)
 	if err != nil {
 		return fmt.Errorf("write_file node %q: path template: %w", node.ID, err)
 	}
-	content, err := renderTemplate(contentTpl, snap)
+	content, err := renderTemplate(ctx, contentTpl, snap)
 	if err != nil {
 		return fmt.Errorf("write_file node %q: content template: %w", node.ID, err)
 	}
@@ -0,0 +1,53 @@
+package pipeline
+
+import (
+	"fmt"
+	"os"
+)
+
+// HistoryPath returns the path of the checkpoint journal kept next to the
+// checkpoint file at checkpointPath.  The journal holds one JSON-encoded
+// JournalEntry per line, one for every step of the run, oldest first.
+// Unlike the checkpoint file, which is rewritten every so often with the
+// full context, it is never rewritten: resuming appends to it and only a
+// fresh run starts it over.
+func HistoryPath(checkpointPath string) string {
+	return checkpointPath + ".history"
+}
+
+// ReadHistory returns every step recorded in the journal of the checkpoint
+// at checkpointPath, oldest first, each with the full context after it.  A
+// final line without a newline is the remains of an interrupted append and
+// is ignored.
+func ReadHistory(checkpointPath string) ([]*Checkpoint, error) {
+	data, err := os.ReadFile(HistoryPath(checkpointPath))
+	if err != nil {
+		return nil, fmt.Errorf("history read: %w", err)
+	}
+	entries, _, err := decodeJournal(data)
+	if err != nil {
+		return nil, err
+	}
+	return ReplayJournal(nil, entries), nil
+}
+
+// HistoryStep returns the journal entry for step n.
+func HistoryStep(steps []*Checkpoint, n int) (*Checkpoint, error) {
+	for _, cp := range steps {
+		if cp.Step == n {
+			return cp, nil
+		}
+	}
+	return nil, fmt.Errorf("history has no step %d", n)
+}
+
+// HistoryNode returns the latest journal entry recorded after nodeID
+// completed.
+func HistoryNode(steps []*Checkpoint, nodeID string) (*Checkpoint, error) {
+	for i := len(steps) - 1; i >= 0; i-- {
+		if steps[i].LastNodeID == nodeID {
+			return steps[i], nil
+		}
+	}
+	return nil, fmt.Errorf("history has no step for node %q", nodeID)
+}
@@ -0,0 +1,245 @@
+package pipeline
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"maps"
+	"os"
+	"reflect"
+	"sort"
+)
+
+// DefaultCompactEvery is how many journal entries a checkpoint store writes
+// between full snapshots of the context.  Loading a checkpoint replays at
+// most this many entries on top of the latest snapshot.
+const DefaultCompactEvery = 50
+
+// JournalEntry is one step of a checkpoint journal.  Instead of the whole
+// context, Data holds only the keys the step added or changed and Deleted
+// the keys it removed, so saving a step costs in proportion to what the step
+// did rather than to the size of the context.
+//
+// A Base entry holds the whole context in Data.  Stores start every journal
+// with one, and write one whenever they do not know the state the previous
+// entry left behind.
+type JournalEntry struct {
+	Checkpoint
+	Base    bool     `json:"base,omitempty"`
+	Deleted []string `json:"deleted,omitempty"`
+}
+
+// NewJournalEntry returns the entry that takes the context from prev to
+// cp.Data.  A nil prev makes a Base entry.
+func NewJournalEntry(prev map[string]any, cp *Checkpoint) JournalEntry {
+	e := JournalEntry{Checkpoint: *cp}
+	if prev == nil {
+		e.Base = true
+		return e
+	}
+	e.Data = make(map[string]any)
+	for k, v := range cp.Data {
+		if old, ok := prev[k]; !ok || !reflect.DeepEqual(old, v) {
+			e.Data[k] = v
+		}
+	}
+	for k := range prev {
+		if _, ok := cp.Data[k]; !ok {
+			e.Deleted = append(e.Deleted, k)
+		}
+	}
+	sort.Strings(e.Deleted)
+	return e
+}
+
+// Apply updates data, the context before the entry's step, to the context
+// after it.  data is modified in place; a Base entry, or a nil data, starts
+// from a new map.
+func (e *JournalEntry) Apply(data map[string]any) map[string]any {
+	if e.Base || data == nil {
+		data = make(map[string]any, len(e.Data))
+	}
+	maps.Copy(data, e.Data)
+	for _, k := range e.Deleted {
+		delete(data, k)
+	}
+	return data
+}
+
+// ReplayJournal applies entries in order to base, the context before the
+// first of them, and returns the full checkpoint after each one.  base is
+// not modified.
+func ReplayJournal(base map[string]any, entries []JournalEntry) []*Checkpoint {
+	data := maps.Clone(base)
+	steps := make([]*Checkpoint, len(entries))
+	for i := range entries {
+		data = entries[i].Apply(data)
+		cp := entries[i].Checkpoint
+		cp.Data = maps.Clone(data)
+		steps[i] = &cp
+	}
+	return steps
+}
+
+// decodeJournal decodes newline-terminated JSON journal entries.  It also
+// returns the length of the complete lines; anything after them is the
+// remains of an interrupted append.
+func decodeJournal(data []byte) ([]JournalEntry, int, error) {
+	var entries []JournalEntry
+	n := 0
+	for line := 1; ; line++ {
+		i := bytes.IndexByte(data[n:], '\n')
+		if i < 0 {
+			return entries, n, nil
+		}
+		raw := data[n : n+i]
+		n += i + 1
+		if len(bytes.TrimSpace(raw)) == 0 {
+			continue
+		}
+		var e JournalEntry
+		if err := UnmarshalCheckpoint(raw, &e); err != nil {
+			return nil, 0, fmt.Errorf("history line %d: %w", line, err)
+		}
+		entries = append(entries, e)
+	}
+}
+
+// journalTail describes the part of a journal file read by readJournal.
+type journalTail struct {
+	entries int   // complete entries read
+	end     int64 // offset just past the last complete entry
+	size    int64 // file size; larger than end after a torn append
+}
+
+// readJournal decodes the journal at path from offset on.
+func readJournal(path string, offset int64) ([]JournalEntry, journalTail, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, journalTail{}, err
+	}
+	defer f.Close()
+	size, err := f.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, journalTail{}, err
+	}
+	if offset > size {
+		// The journal was replaced behind the snapshot's back; all that is
+		// left is the snapshot itself.
+		return nil, journalTail{end: size, size: size}, nil
+	}
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		return nil, journalTail{}, err
+	}
+	data, err := io.ReadAll(f)
+	if err != nil {
+		return nil, journalTail{}, err
+	}
+	entries, n, err := decodeJournal(data)
+	if err != nil {
+		return nil, journalTail{}, err
+	}
+	return entries, journalTail{entries: len(entries), end: offset + int64(n), size: size}, nil
+}
+
+// appendJournal adds e as one line to the journal at path, syncs it to disk
+// and returns the journal's new length.
+func appendJournal(path string, e JournalEntry) (int64, error) {
+	data, err := MarshalCheckpoint(e)
+	if err != nil {
+		return 0, fmt.Errorf("history marshal: %w", err)
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return 0, fmt.Errorf("history write: %w", err)
+	}
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		f.Close()
+		return 0, fmt.Errorf("history write: %w", err)
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return 0, fmt.Errorf("history write: %w", err)
+	}
+	end, err := f.Seek(0, io.SeekEnd)
+	if err != nil {
+		f.Close()
+		return 0, fmt.Errorf("history write: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return 0, fmt.Errorf("history write: %w", err)
+	}
+	return end, nil
+}
+
+// fileSnapshot is the form of the checkpoint file kept by FileStore: the
+// full checkpoint as of the entry of the journal that ends at JournalOffset.
+// Entries after that offset are replayed on top of it when it is read.
+type fileSnapshot struct {
+	Checkpoint
+	JournalOffset int64 `json:"journal_offset,omitempty"`
+}
+
+// readFileCheckpoint reads the checkpoint file at path and replays the
+// journal entries written after it.
+func readFileCheckpoint(path string) (*Checkpoint, journalTail, error) {
+	var snap fileSnapshot
+	data, readErr := os.ReadFile(path)
+	switch {
+	case readErr == nil:
+		if err := UnmarshalCheckpoint(data, &snap); err != nil {
+			return nil, journalTail{}, fmt.Errorf("checkpoint unmarshal: %w", err)
+		}
+		if snap.Step == 0 {
+			// Written by SaveCheckpoint; it has no journal.
+			return finishCheckpoint(&snap.Checkpoint), journalTail{}, nil
+		}
+	case errors.Is(readErr, fs.ErrNotExist):
+		// A store that stopped before writing its first snapshot may still
+		// have journalled the step.
+	default:
+		return nil, journalTail{}, fmt.Errorf("checkpoint read: %w", readErr)
+	}
+
+	entries, tail, err := readJournal(HistoryPath(path), snap.JournalOffset)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+	case err != nil:
+		return nil, journalTail{}, fmt.Errorf("history read: %w", err)
+	}
+	if readErr != nil && len(entries) == 0 {
+		return nil, journalTail{}, fmt.Errorf("checkpoint read: %w", readErr)
+	}
+	if len(entries) == 0 {
+		return finishCheckpoint(&snap.Checkpoint), tail, nil
+	}
+	state := snap.Data
+	for i := range entries {
+		state = entries[i].Apply(state)
+	}
+	cp := entries[len(entries)-1].Checkpoint
+	cp.Data = state
+	return finishCheckpoint(&cp), tail, nil
+}
+
+// writeSnapshot atomically replaces the checkpoint file at path with cp,
+// recording that it is current up to journalOffset.
+func writeSnapshot(path string, cp *Checkpoint, journalOffset int64) error {
+	data, err := MarshalCheckpoint(fileSnapshot{Checkpoint: *cp, JournalOffset: journalOffset})
+	if err != nil {
+		return fmt.Errorf("checkpoint marshal: %w", err)
+	}
+	if err := writeFileAtomic(path, data, 0o600); err != nil {
+		return fmt.Errorf("checkpoint write: %w", err)
+	}
+	return nil
+}
+
+func finishCheckpoint(cp *Checkpoint) *Checkpoint {
+	if cp.Data == nil {
+		cp.Data = make(map[string]any)
+	}
+	return cp
+}
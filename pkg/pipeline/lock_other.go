@@ -0,0 +1,31 @@
+//go:build !unix
+
+package pipeline
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+)
+
+// fileLock is a lock file created exclusively.  Unlike flock it outlives a
+// crashed process; remove the file by hand in that case.
+type fileLock struct {
+	path string
+}
+
+func lockFile(path string) (*fileLock, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+	if errors.Is(err, fs.ErrExist) {
+		return nil, ErrCheckpointLocked
+	}
+	if err != nil {
+		return nil, err
+	}
+	f.Close()
+	return &fileLock{path: path}, nil
+}
+
+func (l *fileLock) release() error {
+	return os.Remove(l.path)
+}
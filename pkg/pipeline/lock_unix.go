@@ -0,0 +1,35 @@
+//go:build unix
+
+package pipeline
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+// fileLock is an advisory flock(2) lock, released by the kernel if the
+// process dies.
+type fileLock struct {
+	f *os.File
+}
+
+func lockFile(path string) (*fileLock, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+		f.Close()
+		if errors.Is(err, syscall.EWOULDBLOCK) {
+			return nil, ErrCheckpointLocked
+		}
+		return nil, err
+	}
+	return &fileLock{f: f}, nil
+}
+
+func (l *fileLock) release() error {
+	_ = syscall.Flock(int(l.f.Fd()), syscall.LOCK_UN)
+	return l.f.Close()
+}
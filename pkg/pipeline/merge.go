@@ -0,0 +1,269 @@
+package pipeline
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Merge policies for the fan_in "merge" attribute.  They decide how the
+// context writes of parallel branches are combined when the branches join.
+const (
+	// MergeLast applies each branch's writes in branch (edge definition)
+	// order, so the last branch to write a key wins.  Conflicting writes are
+	// recorded in <fan_in>_conflicts.
+	MergeLast = "last"
+	// MergeNamespace stores each written key as "<branch>.<key>", where
+	// branch is the ID of the branch's first node.
+	MergeNamespace = "namespace"
+	// MergeCollect stores each written key as a JSON array of the values
+	// written by the branches, in branch order.
+	MergeCollect = "collect"
+	// MergeError fails the fan_in when two branches write different values
+	// to the same key.
+	MergeError = "error"
+)
+
+// Reducers for the fan_in "reduce" attribute, which combines the values that
+// branches wrote to one key: reduce="summary:concat,tokens:sum".
+const (
+	ReduceConcat  = "concat"  // join string values with newlines
+	ReduceSum     = "sum"     // add numeric values
+	ReduceCollect = "collect" // JSON array of values
+	ReduceFirst   = "first"   // value of the first branch that wrote the key
+	ReduceLast    = "last"    // value of the last branch that wrote the key
+)
+
+// Join modes for the fan_in "mode" attribute.  They decide how many branches
+// must succeed before the run continues past the fan_in.  Once the outcome is
+// settled either way, branches that are still running are cancelled.
+const (
+	// JoinAll requires every branch to succeed; the first failure cancels
+	// the rest (fail fast).
+	JoinAll = "all"
+	// JoinAny waits for every branch and requires at least one to succeed.
+	JoinAny = "any"
+	// JoinFirstSuccess keeps the first branch to succeed and cancels the
+	// rest (a race).
+	JoinFirstSuccess = "first_success"
+	// JoinQuorum keeps the first "quorum" branches to succeed and cancels
+	// the rest.
+	JoinQuorum = "quorum"
+)
+
+// JoinModes and MergePolicies list the values of the fan_in mode and merge
+// attributes.
+var (
+	JoinModes     = []string{JoinAll, JoinAny, JoinFirstSuccess, JoinQuorum}
+	MergePolicies = []string{MergeLast, MergeNamespace, MergeCollect, MergeError}
+)
+
+var reducers = []string{ReduceConcat, ReduceSum, ReduceCollect, ReduceFirst, ReduceLast}
+
+// branchWrites is the set of context keys one fan-out branch added or
+// changed, relative to the context at the fan_out.
+type branchWrites struct {
+	branch string
+	data   map[string]any
+}
+
+// parseReduce parses a fan_in "reduce" attribute of the form
+// "key:reducer,key:reducer".
+func parseReduce(s string) (map[string]string, error) {
+	out := map[string]string{}
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		key, op, ok := strings.Cut(part, ":")
+		key, op = strings.TrimSpace(key), strings.TrimSpace(op)
+		if !ok || key == "" || op == "" {
+			return nil, fmt.Errorf("reduce entry %q: expected key:reducer", part)
+		}
+		if !slices.Contains(reducers, op) {
+			return nil, fmt.Errorf("reduce entry %q: unknown reducer %q (want one of %s)", part, op, strings.Join(reducers, ", "))
+		}
+		out[key] = op
+	}
+	return out, nil
+}
+
+// parseJoinMode returns a fan_in node's join mode and, for JoinQuorum, the
+// number of branches that must succeed.
+func parseJoinMode(n *Node) (string, int, error) {
+	mode := n.Attrs["mode"]
+	if mode == "" {
+		mode = JoinAll
+	}
+	if !slices.Contains(JoinModes, mode) {
+		return "", 0, fmt.Errorf("unknown mode=%q (want one of %s)", mode, strings.Join(JoinModes, ", "))
+	}
+	s, ok := n.Attrs["quorum"]
+	if mode != JoinQuorum {
+		if ok {
+			return "", 0, fmt.Errorf("quorum is only valid with mode=%s", JoinQuorum)
+		}
+		return mode, 0, nil
+	}
+	q, err := strconv.Atoi(s)
+	if err != nil || q < 1 {
+		return "", 0, fmt.Errorf("mode=%s needs quorum set to a positive integer, got %q", JoinQuorum, s)
+	}
+	return mode, q, nil
+}
+
+// requiredSuccesses returns how many of total branches must succeed.
+func requiredSuccesses(mode string, quorum, total int) int {
+	switch mode {
+	case JoinAny, JoinFirstSuccess:
+		return 1
+	case JoinQuorum:
+		return quorum
+	default:
+		return total
+	}
+}
+
+// stopsEarly reports whether the join cancels the remaining branches as soon
+// as enough have succeeded.  JoinAny instead keeps every branch's result.
+func stopsEarly(mode string) bool {
+	return mode != JoinAny
+}
+
+// validateMergeAttrs checks the quorum and reduce attributes of a fan_in
+// node.  The values of mode and merge are checked against the fan_in
+// schema.
+func validateMergeAttrs(n *Node) []string {
+	var msgs []string
+	if mode := n.Attrs["mode"]; mode == "" || slices.Contains(JoinModes, mode) {
+		if _, _, err := parseJoinMode(n); err != nil {
+			msgs = append(msgs, err.Error())
+		}
+	}
+	if _, err := parseReduce(n.Attrs["reduce"]); err != nil {
+		msgs = append(msgs, err.Error())
+	}
+	return msgs
+}
+
+// mergeBranches combines the writes of the branches joined at the fan_in node
+// join according to its merge and reduce attributes.  It returns the values
+// to store in the context and the keys that two or more branches wrote with
+// different values (ignoring keys that have a reducer).  Under MergeError a
+// non-empty conflict list is an error.
+func mergeBranches(join *Node, branches []branchWrites) (map[string]any, []string, error) {
+	policy := join.Attrs["merge"]
+	if policy == "" {
+		policy = MergeLast
+	}
+	reduce, err := parseReduce(join.Attrs["reduce"])
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Values written to each key, in branch order.
+	written := map[string][]branchValue{}
+	for _, b := range branches {
+		for k, v := range b.data {
+			written[k] = append(written[k], branchValue{b.branch, v})
+		}
+	}
+
+	keys := make([]string, 0, len(written))
+	for k := range written {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	out := map[string]any{}
+	var conflicts []string
+	for _, k := range keys {
+		vals := written[k]
+		if op, ok := reduce[k]; ok {
+			v, err := applyReducer(op, vals)
+			if err != nil {
+				return nil, nil, fmt.Errorf("reduce %s:%s: %w", k, op, err)
+			}
+			out[k] = v
+			continue
+		}
+		if conflicting(vals) {
+			conflicts = append(conflicts, k)
+		}
+		switch policy {
+		case MergeNamespace:
+			for _, bv := range vals {
+				out[bv.branch+"."+k] = bv.value
+			}
+		case MergeCollect:
+			v, err := applyReducer(ReduceCollect, vals)
+			if err != nil {
+				return nil, nil, fmt.Errorf("collect %s: %w", k, err)
+			}
+			out[k] = v
+		default:
+			out[k] = vals[len(vals)-1].value
+		}
+	}
+
+	if policy == MergeError && len(conflicts) > 0 {
+		return nil, conflicts, fmt.Errorf("branches wrote conflicting values for %s", strings.Join(conflicts, ", "))
+	}
+	return out, conflicts, nil
+}
+
+type branchValue struct {
+	branch string
+	value  any
+}
+
+// conflicting reports whether the branches wrote more than one distinct value.
+func conflicting(vals []branchValue) bool {
+	for _, bv := range vals[1:] {
+		if !reflect.DeepEqual(bv.value, vals[0].value) {
+			return true
+		}
+	}
+	return false
+}
+
+func applyReducer(op string, vals []branchValue) (any, error) {
+	switch op {
+	case ReduceFirst:
+		return vals[0].value, nil
+	case ReduceLast:
+		return vals[len(vals)-1].value, nil
+	case ReduceConcat:
+		parts := make([]string, len(vals))
+		for i, bv := range vals {
+			parts[i] = FormatValue(bv.value)
+		}
+		return strings.Join(parts, "\n"), nil
+	case ReduceSum:
+		var sum float64
+		for _, bv := range vals {
+			f, err := strconv.ParseFloat(strings.TrimSpace(FormatValue(bv.value)), 64)
+			if err != nil {
+				return nil, fmt.Errorf("branch %q: value %q is not a number", bv.branch, FormatValue(bv.value))
+			}
+			sum += f
+		}
+		return strconv.FormatFloat(sum, 'f', -1, 64), nil
+	case ReduceCollect:
+		items := make([]any, len(vals))
+		for i, bv := range vals {
+			items[i] = bv.value
+		}
+		data, err := json.Marshal(items)
+		if err != nil {
+			return nil, err
+		}
+		return string(data), nil
+	}
+	return nil, fmt.Errorf("unknown reducer %q", op)
+}
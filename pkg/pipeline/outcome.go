@@ -0,0 +1,88 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"strings"
+)
+
+// OutcomeStatus summarises how a node finished.  The engine stores it in the
+// "outcome" context key after every node, so edge conditions such as
+// outcome == 'partial' can route on it.
+type OutcomeStatus string
+
+const (
+	OutcomeSuccess OutcomeStatus = "success"
+	OutcomePartial OutcomeStatus = "partial"
+	OutcomeFail    OutcomeStatus = "fail"
+	OutcomeSkipped OutcomeStatus = "skipped"
+)
+
+// Outcome is the structured result of executing a node.
+type Outcome struct {
+	Status OutcomeStatus `json:"status"`
+	// PreferredLabel, if set, selects the outgoing edge whose label matches
+	// it (case-insensitively) ahead of normal condition evaluation.
+	PreferredLabel string `json:"preferred_label,omitempty"`
+	// Outputs are declared results; the engine stores each one in the
+	// context under its key.
+	Outputs map[string]any `json:"outputs,omitempty"`
+	// Notes is a free-form, human-readable explanation of the status.
+	Notes string `json:"notes,omitempty"`
+}
+
+// OutcomeHandler is an optional extension of Handler for handlers that report
+// a structured Outcome instead of a bare error.  When a registered Handler
+// also implements OutcomeHandler, the engine calls Execute rather than Handle.
+//
+// A non-nil error, or a nil error with Status == OutcomeFail, is treated as a
+// node failure: it is retried and routed exactly like a Handle error.
+type OutcomeHandler interface {
+	Execute(ctx context.Context, node *Node, pctx *PipelineContext) (Outcome, error)
+}
+
+// runHandler invokes h and returns its outcome.  Plain handlers are adapted:
+// a nil error becomes a success outcome and an error becomes a fail outcome.
+func runHandler(ctx context.Context, h Handler, node *Node, pctx *PipelineContext) (Outcome, error) {
+	oh, ok := h.(OutcomeHandler)
+	if !ok {
+		if err := h.Handle(ctx, node, pctx); err != nil {
+			return Outcome{Status: OutcomeFail, Notes: err.Error()}, err
+		}
+		return Outcome{Status: OutcomeSuccess}, nil
+	}
+
+	out, err := oh.Execute(ctx, node, pctx)
+	if err == nil && out.Status == OutcomeFail {
+		msg := out.Notes
+		if msg == "" {
+			msg = "node reported failure"
+		}
+		err = errors.New(msg)
+	}
+	if err != nil {
+		out.Status = OutcomeFail
+		if out.Notes == "" {
+			out.Notes = err.Error()
+		}
+		return out, err
+	}
+	if out.Status == "" {
+		out.Status = OutcomeSuccess
+	}
+	return out, nil
+}
+
+// applyOutcome writes a successful outcome's declared outputs and status into
+// the context.
+func applyOutcome(pctx *PipelineContext, out Outcome) {
+	for k, v := range out.Outputs {
+		pctx.Set(k, v)
+	}
+	pctx.Set("outcome", string(out.Status))
+}
+
+// labelMatches reports whether an edge label selects the preferred label.
+func labelMatches(label, preferred string) bool {
+	return strings.EqualFold(strings.TrimSpace(label), strings.TrimSpace(preferred))
+}
@@ -0,0 +1,269 @@
+package pipeline
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ParamsSubgraph is the name of the DOT subgraph that declares a pipeline's
+// parameters: each node in it is a Param rather than a pipeline node.
+//
+//	subgraph params {
+//	    repo  [type=string required=true description="Repository to build"]
+//	    depth [type=int default=1]
+//	    mode  [enum="fast,full" default=fast]
+//	}
+const ParamsSubgraph = "params"
+
+// ParamType is the type of value a Param accepts.
+type ParamType string
+
+const (
+	ParamString ParamType = "string"
+	ParamInt    ParamType = "int"
+	ParamNumber ParamType = "number"
+	ParamBool   ParamType = "bool"
+	ParamList   ParamType = "list"
+	ParamObject ParamType = "object"
+)
+
+var paramTypes = []ParamType{ParamString, ParamInt, ParamNumber, ParamBool, ParamList, ParamObject}
+
+// Param is a variable a pipeline declares that it expects to be given with
+// --var or --var-file.
+type Param struct {
+	Name string
+	// Type defaults to ParamString.
+	Type     ParamType
+	Required bool
+	// Default is the DOT text of the default value, used when HasDefault
+	// is set and the variable is not given; see Param.Parse.
+	Default     string
+	HasDefault  bool
+	Description string
+	// Enum lists the allowed values, in DOT text, when it is not empty.
+	Enum  []string
+	Attrs map[string]string // all DOT attributes
+	// Span is where the param is declared; zero if unknown.
+	Span Span
+}
+
+// newParam builds a Param from the attributes of its declaration.  Values
+// that do not parse are left for validateParams to report.
+func newParam(name string, attrs map[string]string) *Param {
+	p := &Param{
+		Name:        name,
+		Type:        ParamType(attrs["type"]),
+		Description: attrs["description"],
+		Attrs:       attrs,
+	}
+	if p.Type == "" {
+		p.Type = ParamString
+	}
+	p.Required, _ = strconv.ParseBool(attrs["required"])
+	p.Default, p.HasDefault = attrs["default"]
+	for _, v := range strings.Split(attrs["enum"], ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			p.Enum = append(p.Enum, v)
+		}
+	}
+	return p
+}
+
+// Param returns the declared parameter called name, or nil.
+func (p *Pipeline) Param(name string) *Param {
+	for _, prm := range p.Params {
+		if prm.Name == name {
+			return prm
+		}
+	}
+	return nil
+}
+
+// Parse converts the text of a value, as given with --var, to the param's
+// type: int64 for int, float64 for number, bool for bool, and JSON for list
+// and object.
+func (prm *Param) Parse(s string) (any, error) {
+	var v any
+	var err error
+	switch prm.Type {
+	case ParamString:
+		return s, nil
+	case ParamInt:
+		v, err = strconv.ParseInt(strings.TrimSpace(s), 10, 64)
+	case ParamNumber:
+		v, err = strconv.ParseFloat(strings.TrimSpace(s), 64)
+	case ParamBool:
+		v, err = strconv.ParseBool(strings.TrimSpace(s))
+	case ParamList, ParamObject:
+		v, err = DecodeValue([]byte(s))
+		if err == nil && valueType(v) != prm.Type {
+			err = fmt.Errorf("got %s", valueType(v))
+		}
+	default:
+		return nil, fmt.Errorf("unknown type %q", prm.Type)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%q is not a valid %s", s, prm.Type)
+	}
+	return v, nil
+}
+
+// check returns v as a value of the param's type: strings are parsed with
+// Parse, and anything else must already have the type.  The result must
+// be one of the param's Enum values, if it has any.
+func (prm *Param) check(v any) (any, error) {
+	if s, ok := v.(string); ok {
+		var err error
+		if v, err = prm.Parse(s); err != nil {
+			return nil, err
+		}
+	} else if t := valueType(v); t != prm.Type && (prm.Type != ParamNumber || t != ParamInt) {
+		return nil, fmt.Errorf("want %s, got %s %s", prm.Type, t, FormatValue(v))
+	}
+	if len(prm.Enum) > 0 && !slices.ContainsFunc(prm.Enum, func(e string) bool {
+		ev, err := prm.Parse(e)
+		return err == nil && FormatValue(ev) == FormatValue(v)
+	}) {
+		got := FormatValue(v)
+		if _, ok := v.(string); ok {
+			got = strconv.Quote(got)
+		}
+		return nil, fmt.Errorf("%s is not one of %s", got, strings.Join(prm.Enum, ", "))
+	}
+	return v, nil
+}
+
+// valueType returns the ParamType of a context value, or "null" for nil.
+func valueType(v any) ParamType {
+	switch v.(type) {
+	case string:
+		return ParamString
+	case int64, int:
+		return ParamInt
+	case float64:
+		return ParamNumber
+	case bool:
+		return ParamBool
+	case []any:
+		return ParamList
+	case map[string]any:
+		return ParamObject
+	case nil:
+		return "null"
+	}
+	return ParamType(fmt.Sprintf("%T", v))
+}
+
+// BindParams checks vars, the variables given to a new run, against the
+// pipeline's declared params.  It returns the values to start the run with:
+// vars converted to their params' types (see Param.Parse), plus the
+// defaults of params that were not given.  A variable with no declared
+// param, a missing required param or a value of the wrong type is an error,
+// and all of them are reported together.  A pipeline that declares no
+// params accepts any vars as they are.
+func (p *Pipeline) BindParams(vars map[string]any) (map[string]any, error) {
+	return p.bindParams(vars, true)
+}
+
+// BindParamOverrides is BindParams for the variables set when resuming a
+// run.  The checkpoint already holds the others, so missing params are not
+// an error and defaults are not applied.
+func (p *Pipeline) BindParamOverrides(vars map[string]any) (map[string]any, error) {
+	return p.bindParams(vars, false)
+}
+
+func (p *Pipeline) bindParams(vars map[string]any, fill bool) (map[string]any, error) {
+	if len(p.Params) == 0 {
+		return vars, nil
+	}
+	out := make(map[string]any, len(p.Params))
+	var msgs []string
+
+	var unknown []string
+	for k := range vars {
+		if p.Param(k) == nil {
+			unknown = append(unknown, k)
+		}
+	}
+	sort.Strings(unknown)
+	for _, k := range unknown {
+		msgs = append(msgs, fmt.Sprintf("unknown variable %q (the pipeline declares %s)", k, strings.Join(p.paramNames(), ", ")))
+	}
+
+	for _, prm := range p.Params {
+		v, ok := vars[prm.Name]
+		switch {
+		case ok:
+			cv, err := prm.check(v)
+			if err != nil {
+				msgs = append(msgs, fmt.Sprintf("param %q: %v", prm.Name, err))
+				continue
+			}
+			out[prm.Name] = cv
+		case !fill:
+		case prm.Required:
+			msgs = append(msgs, fmt.Sprintf("missing required param %q", prm.Name))
+		case prm.HasDefault:
+			dv, err := prm.Parse(prm.Default)
+			if err != nil {
+				msgs = append(msgs, fmt.Sprintf("param %q: default: %v", prm.Name, err))
+				continue
+			}
+			out[prm.Name] = dv
+		}
+	}
+
+	if len(msgs) > 0 {
+		return nil, fmt.Errorf("invalid variables:\n  %s", strings.Join(msgs, "\n  "))
+	}
+	return out, nil
+}
+
+func (p *Pipeline) paramNames() []string {
+	names := make([]string, len(p.Params))
+	for i, prm := range p.Params {
+		names[i] = prm.Name
+	}
+	return names
+}
+
+// validateParams checks the pipeline's param declarations.
+func validateParams(p *Pipeline) []LintError {
+	var errs []LintError
+	add := func(prm *Param, format string, args ...any) {
+		errs = append(errs, LintError{Rule: RuleParam, Span: prm.Span, Message: fmt.Sprintf("param %q: ", prm.Name) + fmt.Sprintf(format, args...)})
+	}
+	for _, prm := range p.Params {
+		if !slices.Contains(paramTypes, prm.Type) {
+			names := make([]string, len(paramTypes))
+			for i, t := range paramTypes {
+				names[i] = string(t)
+			}
+			add(prm, "unknown type %q (want one of %s)", prm.Type, strings.Join(names, ", "))
+			continue
+		}
+		if s, ok := prm.Attrs["required"]; ok {
+			if _, err := strconv.ParseBool(s); err != nil {
+				add(prm, "required=%q must be true or false", s)
+			}
+		}
+		if prm.Required && prm.HasDefault {
+			add(prm, "a required param cannot have a default")
+		}
+		for _, e := range prm.Enum {
+			if _, err := prm.Parse(e); err != nil {
+				add(prm, "enum value: %v", err)
+			}
+		}
+		if prm.HasDefault {
+			if _, err := prm.check(prm.Default); err != nil {
+				add(prm, "default: %v", err)
+			}
+		}
+	}
+	return errs
+}
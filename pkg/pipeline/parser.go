@@ -1,17 +1,21 @@
 package pipeline
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"strings"
 
 	gographviz "github.com/awalterschulze/gographviz"
 )
 
-// ParseDOT parses a Graphviz DOT string into a Pipeline.
+// ParseDOT parses a Graphviz DOT string into a Pipeline, recording where
+// each node, edge and attribute is defined.  A syntax error is a
+// *ParseError.
 func ParseDOT(src string) (*Pipeline, error) {
 	graphAst, err := gographviz.ParseString(src)
 	if err != nil {
-		return nil, fmt.Errorf("dot parse error: %w", err)
+		return nil, newParseError(err)
 	}
 
 	// Use a custom permissive graph collector that accepts any attribute name
@@ -22,8 +26,9 @@ func ParseDOT(src string) (*Pipeline, error) {
 	}
 
 	p := &Pipeline{
-		Name:  collector.name,
-		Nodes: make(map[string]*Node),
+		Name:        collector.name,
+		Nodes:       make(map[string]*Node),
+		Fingerprint: Fingerprint(src),
 	}
 
 	// Build nodes
@@ -50,22 +55,37 @@ func ParseDOT(src string) (*Pipeline, error) {
 			From:      e.from,
 			To:        e.to,
 			Condition: e.condition,
+			On:        e.on,
 		})
 	}
 
+	for _, name := range collector.params {
+		p.Params = append(p.Params, newParam(name, collector.paramAttrs[name]))
+	}
+
+	p.Attrs = collector.graphAttrs
+
 	// Extract graph-level stylesheet
 	if raw, ok := collector.graphAttrs["model_stylesheet"]; ok {
 		p.Stylesheet = parseStylesheet(raw)
 	}
 
+	locate(p, src)
 	return p, nil
 }
 
+// Fingerprint returns the hex SHA-256 of a pipeline source.
+func Fingerprint(src string) string {
+	sum := sha256.Sum256([]byte(src))
+	return hex.EncodeToString(sum[:])
+}
+
 // ─── permissive DOT collector ─────────────────────────────────────────────────
 
 type rawEdge struct {
 	from, to  string
 	condition string
+	on        string
 }
 
 // dotCollector implements gographviz.Interface without attribute validation.
@@ -76,6 +96,9 @@ type dotCollector struct {
 	graphAttrs map[string]string
 	// defaultNodeAttrs holds attrs set at the graph level (node [...]).
 	defaultNodeAttrs map[string]string
+	// params lists the nodes of the params subgraph in declaration order.
+	params     []string
+	paramAttrs map[string]map[string]string
 }
 
 func newDOTCollector() *dotCollector {
@@ -83,6 +106,7 @@ func newDOTCollector() *dotCollector {
 		nodes:            make(map[string]map[string]string),
 		graphAttrs:       make(map[string]string),
 		defaultNodeAttrs: make(map[string]string),
+		paramAttrs:       make(map[string]map[string]string),
 	}
 }
 
@@ -91,8 +115,18 @@ func (c *dotCollector) SetDir(_ bool) error     { return nil }
 func (c *dotCollector) SetName(n string) error  { c.name = unquote(n); return nil }
 func (c *dotCollector) String() string          { return c.name }
 
-func (c *dotCollector) AddNode(_ string, name string, attrs map[string]string) error {
+func (c *dotCollector) AddNode(parent string, name string, attrs map[string]string) error {
 	id := unquote(name)
+	if unquote(parent) == ParamsSubgraph {
+		if _, ok := c.paramAttrs[id]; !ok {
+			c.params = append(c.params, id)
+			c.paramAttrs[id] = make(map[string]string)
+		}
+		for k, v := range attrs {
+			c.paramAttrs[id][k] = unquote(v)
+		}
+		return nil
+	}
 	if _, ok := c.nodes[id]; !ok {
 		// Copy default attrs first
 		c.nodes[id] = make(map[string]string, len(c.defaultNodeAttrs))
@@ -111,7 +145,12 @@ func (c *dotCollector) AddEdge(src, dst string, _ bool, attrs map[string]string)
 	if lbl, ok := attrs["label"]; ok {
 		cond = unquote(lbl)
 	}
-	c.edges = append(c.edges, rawEdge{from: unquote(src), to: unquote(dst), condition: cond})
+	c.edges = append(c.edges, rawEdge{
+		from:      unquote(src),
+		to:        unquote(dst),
+		condition: cond,
+		on:        unquote(attrs["on"]),
+	})
 	return nil
 }
 
@@ -128,13 +167,27 @@ func (c *dotCollector) AddSubGraph(_, _ string, _ map[string]string) error { ret
 
 // ─── helpers ─────────────────────────────────────────────────────────────────
 
-// unquote strips surrounding double-quotes from a DOT attribute value.
+// unquote strips surrounding double-quotes from a DOT attribute value and
+// decodes its escapes: \" is a quote and \\ a backslash, so that
+// default="[\"a\"]" reads as ["a"] and path="C:\\" as C:\.  A backslash
+// before any other character is kept, so \n in a prompt stays \n.
 func unquote(s string) string {
 	s = strings.TrimSpace(s)
-	if len(s) >= 2 && s[0] == '"' && s[len(s)-1] == '"' {
-		return s[1 : len(s)-1]
+	if len(s) < 2 || s[0] != '"' || s[len(s)-1] != '"' {
+		return s
+	}
+	s = s[1 : len(s)-1]
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) && (s[i+1] == '"' || s[i+1] == '\\') {
+			i++
+		}
+		sb.WriteByte(s[i])
 	}
-	return s
+	return sb.String()
 }
 
 // parseStylesheet parses a simple CSS-like model stylesheet.
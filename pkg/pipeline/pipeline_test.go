@@ -2,8 +2,10 @@ package pipeline_test
 
 import (
 	"context"
+	"errors"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/ravi-parthasarathy/attractor/pkg/pipeline"
@@ -54,6 +56,38 @@ func TestParseDOT_NodeAttrs(t *testing.T) {
 	}
 }
 
+func TestParseDOT_Escapes(t *testing.T) {
+	src := `digraph test {
+		goal="say \"hi\""
+		subgraph params {
+			flags [type=list default="[\"-v\"]"]
+		}
+		start  [type=start]
+		s      [type=set key=k value="a \\\"quoted\\\" \\ b" dir="C:\\" prompt="one\ntwo" re="v(\\d+)"]
+		finish [type=exit]
+		start -> s
+		s -> finish [label="k == \"x\\\\y\""]
+	}`
+	p, err := pipeline.ParseDOT(src)
+	if err != nil {
+		t.Fatalf("ParseDOT: %v", err)
+	}
+	for _, tc := range []struct{ name, got, want string }{
+		{"goal", p.Attrs["goal"], `say "hi"`},
+		{"default", p.Params[0].Attrs["default"], `["-v"]`},
+		// \\ is a backslash and \" a quote; any other escape is kept.
+		{"value", p.Nodes["s"].Attrs["value"], `a \"quoted\" \ b`},
+		{"dir", p.Nodes["s"].Attrs["dir"], `C:\`},
+		{"prompt", p.Nodes["s"].Attrs["prompt"], `one\ntwo`},
+		{"re", p.Nodes["s"].Attrs["re"], `v(\d+)`},
+		{"label", p.OutgoingEdges("s")[0].Condition, `k == "x\\y"`},
+	} {
+		if tc.got != tc.want {
+			t.Errorf("%s = %q, want %q", tc.name, tc.got, tc.want)
+		}
+	}
+}
+
 func TestParseDOT_EdgeCondition(t *testing.T) {
 	src := `digraph test {
 		start  [type=start]
@@ -73,6 +107,163 @@ func TestParseDOT_EdgeCondition(t *testing.T) {
 	}
 }
 
+func TestParseDOT_Positions(t *testing.T) {
+	src := `digraph pos {
+  // comment with a -> b [x=1]
+  node [shape=box]
+  subgraph params { depth [type=int default=1] }
+  start [type=start]
+  greet [type=set key=greeting
+         value="multi
+line"]
+  start -> greet -> exit [label="x == 1"]
+  exit [type=exit]
+  rankdir=LR
+}`
+	p, err := pipeline.ParseDOT(src)
+	if err != nil {
+		t.Fatalf("ParseDOT: %v", err)
+	}
+	span := func(l1, c1, l2, c2 int) pipeline.Span {
+		return pipeline.Span{Start: pipeline.Pos{Line: l1, Col: c1}, End: pipeline.Pos{Line: l2, Col: c2}}
+	}
+	for _, tc := range []struct {
+		what      string
+		got, want pipeline.Span
+	}{
+		{"graph", p.Span, span(1, 1, 1, 12)},
+		{"rankdir", p.AttrSpans["rankdir"], span(11, 3, 11, 13)},
+		{"param depth", p.Params[0].Span, span(4, 21, 4, 26)},
+		{"node greet", p.Nodes["greet"].Span, span(6, 3, 6, 8)},
+		{"greet key", p.Nodes["greet"].AttrSpans["key"], span(6, 19, 6, 31)},
+		{"greet value", p.Nodes["greet"].AttrSpans["value"], span(7, 10, 8, 6)},
+		{"greet shape", p.Nodes["greet"].AttrSpans["shape"], span(3, 9, 3, 18)},
+		{"node exit", p.Nodes["exit"].Span, span(10, 3, 10, 7)},
+		{"edge start -> greet", p.Edges[0].Span, span(9, 3, 9, 17)},
+		{"edge greet -> exit", p.Edges[1].Span, span(9, 12, 9, 25)},
+		{"edge label", p.Edges[1].AttrSpans["label"], span(9, 27, 9, 41)},
+	} {
+		if tc.got != tc.want {
+			t.Errorf("%s: span = %v, want %v", tc.what, tc.got, tc.want)
+		}
+	}
+}
+
+func TestParseDOT_ErrorPosition(t *testing.T) {
+	_, err := pipeline.ParseDOT("digraph x {\n  a [type=set\n  b -> c\n}")
+	var pe *pipeline.ParseError
+	if !errors.As(err, &pe) {
+		t.Fatalf("ParseDOT = %v, want a *ParseError", err)
+	}
+	if pe.Pos != (pipeline.Pos{Line: 3, Col: 5}) {
+		t.Errorf("Pos = %v, want 3:5", pe.Pos)
+	}
+	if want := `dot parse error at 3:5: unexpected "->"`; !strings.HasPrefix(err.Error(), want) {
+		t.Errorf("error = %q, want prefix %q", err, want)
+	}
+}
+
+func TestParseYAML(t *testing.T) {
+	src := `name: demo
+attrs:
+  goal: Greet {{.name}}
+stylesheet: |
+  type[codergen] { model: "m1" }
+params:
+  names: {type: list, default: [a, b]}
+  depth:
+nodes:
+  start: {type: start}
+  greet:
+    prompt: |
+      Say "hello" to {{.name}}.
+      Use {braces} freely.
+    retry_max: 2
+  exit: {type: exit}
+edges:
+  - {from: start, to: greet}
+  - {from: greet, to: exit, condition: outcome == 'success'}
+  - {from: greet, to: exit, on: failure}
+`
+	p, err := pipeline.ParseYAML(src)
+	if err != nil {
+		t.Fatalf("ParseYAML: %v", err)
+	}
+	if p.Name != "demo" || p.Attrs["goal"] != "Greet {{.name}}" {
+		t.Errorf("name = %q, attrs = %v", p.Name, p.Attrs)
+	}
+	if p.Stylesheet == nil || len(p.Stylesheet.Rules) != 1 || p.Stylesheet.Rules[0].Model != "m1" {
+		t.Errorf("stylesheet = %+v", p.Stylesheet)
+	}
+	if len(p.Params) != 2 || p.Params[0].Type != pipeline.ParamList || p.Params[0].Default != `["a","b"]` ||
+		p.Params[1].Name != "depth" || len(p.Params[1].Attrs) != 0 {
+		t.Errorf("params = %+v", p.Params)
+	}
+	greet := p.Nodes["greet"]
+	if greet.Type != pipeline.NodeTypeCodergen || greet.Attrs["prompt"] != "Say \"hello\" to {{.name}}.\nUse {braces} freely.\n" ||
+		greet.Attrs["retry_max"] != "2" {
+		t.Errorf("greet = %+v", greet)
+	}
+	if len(p.Edges) != 3 || p.Edges[1].Condition != "outcome == 'success'" || p.Edges[2].On != pipeline.EdgeOnFailure {
+		t.Errorf("edges = %+v", p.Edges)
+	}
+	if errs := pipeline.Validate(p); len(errs) != 0 {
+		t.Errorf("Validate = %v", errs)
+	}
+
+	span := func(l1, c1, l2, c2 int) pipeline.Span {
+		return pipeline.Span{Start: pipeline.Pos{Line: l1, Col: c1}, End: pipeline.Pos{Line: l2, Col: c2}}
+	}
+	for _, tc := range []struct {
+		what      string
+		got, want pipeline.Span
+	}{
+		{"graph", p.Span, span(1, 1, 1, 11)},
+		{"goal", p.AttrSpans["goal"], span(3, 3, 3, 24)},
+		{"param names", p.Params[0].Span, span(7, 3, 7, 8)},
+		{"node greet", p.Nodes["greet"].Span, span(11, 3, 11, 8)},
+		{"greet retry_max", p.Nodes["greet"].AttrSpans["retry_max"], span(15, 5, 15, 17)},
+		{"edge greet -> exit", p.Edges[1].Span, span(19, 12, 19, 27)},
+		{"edge condition", p.Edges[1].AttrSpans["label"], span(19, 29, 19, 60)},
+	} {
+		if tc.got != tc.want {
+			t.Errorf("%s: span = %v, want %v", tc.what, tc.got, tc.want)
+		}
+	}
+
+	// JSON is read as YAML.
+	j, err := pipeline.Parse(`{"nodes": {"start": {"type": "start"}, "exit": {"type": "exit"}},
+  "edges": [{"from": "start", "to": "exit", "condition": "x == 1"}]}`, pipeline.SyntaxJSON)
+	if err != nil {
+		t.Fatalf("Parse json: %v", err)
+	}
+	if len(j.Nodes) != 2 || j.Edges[0].Condition != "x == 1" {
+		t.Errorf("json pipeline = %+v", j)
+	}
+}
+
+func TestParseYAML_Errors(t *testing.T) {
+	for _, tc := range []struct {
+		src  string
+		want string
+	}{
+		{"nodes: {a: {}}\nedges: [{from: a, to: b}]\n", `yaml parse error at 2:23: edge endpoint "b" is not a node`},
+		{"nodes: {a: {}}\nedges: [{from: a}]\n", "yaml parse error at 2:9: an edge needs from and to"},
+		{"nodes: {a: {}}\nedges: [{from: a, to: a, label: x}]\n", `yaml parse error at 2:26: unknown edge key "label"`},
+		{"graph: x\n", `yaml parse error at 1:1: unknown key "graph"`},
+		{"nodes:\n  a: {}\n  a: {}\n", `yaml parse error at 3:3: node "a" is declared twice`},
+		{"nodes: [a, b]\n", "yaml parse error at 1:8: expected a mapping"},
+		{"nodes:\n  a: b: c\n", "yaml parse error at 2:1: mapping values are not allowed in this context"},
+		{"", "yaml parse error: empty pipeline"},
+	} {
+		_, err := pipeline.ParseYAML(tc.src)
+		var pe *pipeline.ParseError
+		if !errors.As(err, &pe) || !strings.HasPrefix(err.Error(), tc.want) {
+			t.Errorf("ParseYAML(%q) = %v, want %s", tc.src, err, tc.want)
+		}
+	}
+}
+
 // ─── Validator tests ──────────────────────────────────────────────────────────
 
 func TestValidate_Valid(t *testing.T) {
@@ -216,6 +407,184 @@ func TestEvalCondition_ParseError(t *testing.T) {
 	}
 }
 
+func TestEvalConditionOperators(t *testing.T) {
+	snap := map[string]any{
+		"exit_code": "2",
+		"score":     0.85,
+		"count":     int64(3),
+		"output":    "tests: PASS\nlint: ok",
+		"lang":      "go",
+		"langs":     []any{"go", "rust"},
+		"result":    `{"status": "ok", "items": [{"id": 7}]}`,
+		"user":      map[string]any{"name": "Ann", "admin": false},
+		"a.b":       "dotted",
+		"done":      true,
+		"empty":     "",
+		"zero":      int64(0),
+		"none":      []any{},
+		"version":   "v1.2.3",
+	}
+	tests := []struct {
+		cond string
+		want bool
+	}{
+		{"exit_code > 0", true},
+		{"exit_code >= 3", false},
+		{"score >= 0.8 && score < 0.9", true},
+		{"count == 3", true},
+		{"count == '3'", true},
+		{"count != 3.0", false},
+		{"version < 'v2'", true},
+		{"output =~ /PASS/", true},
+		{"output =~ /pass/i", true},
+		{"output !~ /FAIL/", true},
+		{"output =~ 'lint: (ok|warn)'", true},
+		{"lang in ['go', 'rust']", true},
+		{"lang in [python, java]", false},
+		{"lang not in [python]", true},
+		{"'rust' in langs", true},
+		{"contains(output, 'FAIL')", false},
+		{"contains(langs, 'rust') && contains(user, 'name')", true},
+		{"startsWith(version, 'v1.') && endsWith(version, '.3')", true},
+		{"len(langs) == 2 && len(lang) > 1", true},
+		{"lower(user.name) == 'ann'", true},
+		{"result.status == 'ok'", true},
+		{"result.items.0.id == 7", true},
+		{"result.missing == ''", true},
+		{"user.admin", false},
+		{"user.admin == false", true},
+		{"a.b == dotted", true},
+		{"done && !empty && !zero && !none", true},
+		{"exists(empty) && !exists(missing)", true},
+		{"!(count > 2 || missing)", false},
+		{"exists(missing) && missing >= 0.8", false},
+		{"!exists(missing) || missing.x < 1", true},
+		{"missing > 1 || missing <= 1", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.cond, func(t *testing.T) {
+			got, err := pipeline.EvalCondition(tt.cond, snap)
+			if err != nil {
+				t.Fatalf("EvalCondition(%q): %v", tt.cond, err)
+			}
+			if got != tt.want {
+				t.Errorf("EvalCondition(%q) = %v, want %v", tt.cond, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEvalConditionErrors(t *testing.T) {
+	for _, tc := range []struct{ cond, want string }{
+		{"status ==", "expected a value, found end of expression at column 10"},
+		{"(a && b", "expected ')' to close '(' at column 1, found end of expression at column 8"},
+		{"a == 'x", "unterminated string at column 6"},
+		{"a =~ /[/", "invalid regular expression"},
+		{"a == b c", `unexpected "c" at column 8`},
+		{"nosuch(a)", `unknown function "nosuch" at column 1`},
+		{"len(a, b)", "len takes 1 argument(s), got 2 at column 1"},
+		{"a # b", `unexpected character '#' at column 3`},
+	} {
+		_, err := pipeline.ParseCondition(tc.cond)
+		var cerr *pipeline.ConditionError
+		if !errors.As(err, &cerr) || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("ParseCondition(%q) = %v, want a ConditionError with %q", tc.cond, err, tc.want)
+		}
+	}
+
+	// Comparing values that are not both numbers fails when evaluated.
+	_, err := pipeline.EvalCondition("exit_code > 0", map[string]any{"exit_code": "n/a"})
+	if err == nil || !strings.Contains(err.Error(), `cannot compare "n/a" with int 0`) {
+		t.Errorf("EvalCondition = %v, want a comparison error", err)
+	}
+}
+
+func TestEvalConditionTemplate(t *testing.T) {
+	snap := map[string]any{
+		"status": "done",
+		"lang":   "go",
+		"files":  []any{"a.go", "b.go"},
+		"count":  int64(3),
+		"flag":   "false",
+	}
+	for _, tc := range []struct {
+		cond string
+		want bool
+	}{
+		{`{{ .status }} == "done"`, true},
+		{`{{ .status }} == "pending"`, false},
+		{`{{ .status | upper }} == DONE && count > 2`, true},
+		{`{{ and (eq .lang "go") (gt (len .files) 1) }}`, true},
+		{`{{ eq .lang "rust" }}`, false},
+		{`{{ len .files }} >= 2`, true},
+		{`{{ .flag }}`, false},
+		{`{{ .missing }}`, false},
+		{`{{ .missing | default "x" }}`, true},
+		{`{{ if .files }}yes{{ end }}`, true},
+		{`{{ .lang }}-{{ .status }} == 'go-done'`, true},
+		{`  {{ sub .count 3 }}`, false},
+	} {
+		got, err := pipeline.EvalCondition(tc.cond, snap)
+		if err != nil {
+			t.Errorf("EvalCondition(%q): %v", tc.cond, err)
+			continue
+		}
+		if got != tc.want {
+			t.Errorf("EvalCondition(%q) = %v, want %v", tc.cond, got, tc.want)
+		}
+	}
+
+	c, err := pipeline.ParseCondition(`{{ if eq .outcome "fail" }}{{ range .items }}{{ .id }}{{ end }}{{ $.user.name }}{{ index . "a-b" }}{{ end }} && ok`)
+	if err != nil {
+		t.Fatalf("ParseCondition: %v", err)
+	}
+	if got := strings.Join(c.Keys(), ","); got != "outcome,items,user.name,a-b,ok" {
+		t.Errorf("Keys = %s", got)
+	}
+	if _, err := pipeline.ParseCondition(`{{ .x | nosuch }} == 1`); err == nil || !strings.Contains(err.Error(), `invalid template: template: :1: function "nosuch" not defined at column 1`) {
+		t.Errorf("ParseCondition = %v, want a template error", err)
+	}
+}
+
+func TestValidateConditions(t *testing.T) {
+	p, err := pipeline.ParseDOT(`digraph conds {
+		start [type=start]
+		check [type=assert expr="score >= "]
+		route [type=switch key=mode]
+		a     [type=set key=x value=1]
+		exit  [type=exit]
+		start -> check
+		check -> route [label="score > 0.5 &&"]
+		check -> a     [label="{{ .score }"]
+		check -> exit  [label="{{ .score }} >= 0.5"]
+		route -> a     [label="not a condition!"]
+		a -> exit
+	}`)
+	if err != nil {
+		t.Fatalf("ParseDOT: %v", err)
+	}
+	var msgs []string
+	for _, e := range pipeline.Validate(p) {
+		msgs = append(msgs, e.Error())
+	}
+	got := strings.Join(msgs, "\n")
+	for _, want := range []string{
+		`node "check": attribute "expr": condition "score >= ": expected a value, found end of expression at column 10`,
+		`node "check": edge to "route": condition "score > 0.5 &&": expected a value`,
+		`node "check": edge to "a": condition "{{ .score }": invalid template: template: :1: unexpected "}" in operand at column 1`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("lint errors missing %q:\n%s", want, got)
+		}
+	}
+	if strings.Contains(got, `"route"`) && strings.Contains(got, "not a condition") {
+		t.Errorf("switch labels were parsed as conditions:\n%s", got)
+	}
+	if strings.Contains(got, `edge to "exit"`) {
+		t.Errorf("lint rejected a valid template condition:\n%s", got)
+	}
+}
+
 // ─── PipelineContext / checkpoint tests ───────────────────────────────────────
 
 func TestPipelineContext_SetGet(t *testing.T) {
@@ -363,6 +732,41 @@ func TestEngine_ConditionalEdge(t *testing.T) {
 	}
 }
 
+func TestEngine_GuardedMissingKey(t *testing.T) {
+	// score is never set: the guarded edge is not taken and the run goes
+	// on along the next one instead of failing.
+	src := `digraph guard {
+		s    [type=start]
+		ship [type=set, key="result", value="ship"]
+		redo [type=set, key="result", value="redo"]
+		done [type=exit]
+		s    -> ship [label="exists(score) && score >= 0.8"]
+		s    -> redo
+		ship -> done
+		redo -> done
+	}`
+	p, err := pipeline.ParseDOT(src)
+	if err != nil {
+		t.Fatalf("ParseDOT: %v", err)
+	}
+	rec := &recordHandler{}
+	reg := handlers.NewRegistry()
+	reg.Register("start", rec)
+	reg.Register("set", rec)
+	reg.Register("exit", &handlers.ExitHandler{})
+
+	eng, err := pipeline.NewEngine(p, reg, pipeline.NewPipelineContext(), "")
+	if err != nil {
+		t.Fatalf("NewEngine: %v", err)
+	}
+	if err := eng.Execute(context.Background(), ""); err != nil {
+		t.Fatalf("Execute: %v", err)
+	}
+	if got := strings.Join(rec.visited, " "); got != "s redo" {
+		t.Errorf("visited %q, want the unguarded edge to redo", got)
+	}
+}
+
 func TestEngine_InvalidPipeline(t *testing.T) {
 	// No start node.
 	src := `digraph bad {
@@ -0,0 +1,108 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+)
+
+// ErrPipelineDrift is returned by Resume when the checkpoint was written by a
+// different version of the pipeline source and AllowDrift is not set.
+var ErrPipelineDrift = errors.New("pipeline changed since the checkpoint was written")
+
+// ErrRunCompleted is returned by Resume when the checkpointed run has already
+// finished and RerunLast is not set.
+var ErrRunCompleted = errors.New("checkpointed run already completed")
+
+// ResumeOptions controls how Resume picks up a checkpointed run.
+type ResumeOptions struct {
+	// RerunLast runs the checkpoint's last completed node again instead of
+	// continuing after it.
+	RerunLast bool
+	// AllowDrift resumes even when the pipeline's fingerprint differs from
+	// the checkpoint's, logging a warning instead of failing.
+	AllowDrift bool
+}
+
+// Resume continues a run from cp.  The engine's context should hold the
+// checkpoint's data (see Checkpoint.PipelineContext).
+//
+// By default the run continues at the target of the edge recorded in the
+// checkpoint, so the last completed node is not executed a second time.
+// Checkpoints without a recorded edge select it again from the saved
+// context.  A checkpoint written during a fan_out resumes its branches; see
+// FanOutState.
+func (e *Engine) Resume(ctx context.Context, cp *Checkpoint, opts ResumeOptions) error {
+	startID, err := e.resumeNode(e.withTemplateOptions(ctx), cp, opts)
+	if err != nil {
+		return err
+	}
+	if cp.FanOut != nil && !opts.RerunLast {
+		e.resumeFanOut = cp.FanOut
+	}
+	e.resumeFrom = cp
+	if cp.Suspended {
+		slog.Info("resuming suspended run", "reason", cp.SuspendReason)
+	}
+	slog.Info("resuming from checkpoint", "last", cp.LastNodeID, "next", startID)
+	return e.Execute(ctx, startID)
+}
+
+// resumeNode returns the node a resumed run starts at.
+func (e *Engine) resumeNode(ctx context.Context, cp *Checkpoint, opts ResumeOptions) (string, error) {
+	if cp.Fingerprint != "" && e.pipeline.Fingerprint != "" && cp.Fingerprint != e.pipeline.Fingerprint {
+		if !opts.AllowDrift {
+			return "", fmt.Errorf("%w (checkpoint %.12s, pipeline %.12s)",
+				ErrPipelineDrift, cp.Fingerprint, e.pipeline.Fingerprint)
+		}
+		slog.Warn("resuming a checkpoint written by a different pipeline version",
+			"checkpoint", cp.Fingerprint, "pipeline", e.pipeline.Fingerprint)
+	}
+
+	if cp.LastNodeID == "" {
+		return "", fmt.Errorf("checkpoint records no completed node")
+	}
+	if _, ok := e.pipeline.Nodes[cp.LastNodeID]; !ok {
+		return "", fmt.Errorf("checkpoint node %q not found in pipeline", cp.LastNodeID)
+	}
+	if opts.RerunLast {
+		return cp.LastNodeID, nil
+	}
+	if cp.Completed {
+		return "", fmt.Errorf("%w at node %q", ErrRunCompleted, cp.LastNodeID)
+	}
+	if cp.FanOut != nil {
+		// Interrupted while its branches ran; LastNodeID is the fan_out.
+		return cp.LastNodeID, nil
+	}
+
+	if cp.Next != nil {
+		if _, ok := e.pipeline.Nodes[cp.Next.To]; !ok {
+			return "", fmt.Errorf("checkpoint next node %q not found in pipeline", cp.Next.To)
+		}
+		return cp.Next.To, nil
+	}
+
+	// No recorded edge: select it the way the run would have.
+	var (
+		next *Edge
+		err  error
+	)
+	if cp.Outcome != nil && cp.Outcome.Status == OutcomeFail {
+		next, err = e.selectFailure(ctx, cp.LastNodeID, e.pctx)
+	} else {
+		preferred := ""
+		if cp.Outcome != nil {
+			preferred = cp.Outcome.PreferredLabel
+		}
+		next, err = e.selectNext(ctx, cp.LastNodeID, e.pctx, preferred)
+	}
+	if err != nil {
+		return "", fmt.Errorf("node %q: select next: %w", cp.LastNodeID, err)
+	}
+	if next == nil {
+		return "", fmt.Errorf("%w at node %q", ErrRunCompleted, cp.LastNodeID)
+	}
+	return next.To, nil
+}
@@ -0,0 +1,287 @@
+package pipeline
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// AttrType is the kind of value a node attribute takes.
+type AttrType string
+
+const (
+	AttrString    AttrType = "string"
+	AttrTemplate  AttrType = "template"  // Go template rendered against the context
+	AttrCondition AttrType = "condition" // condition expression; see EvalCondition
+	AttrKey       AttrType = "key"       // name of a context key
+	AttrKeys      AttrType = "keys"      // comma-separated context key names
+	AttrInt       AttrType = "int"       // non-negative integer
+	AttrBool      AttrType = "bool"
+	AttrDuration  AttrType = "duration" // Go duration such as 30s or 5m
+	AttrEnum      AttrType = "enum"     // one of Enum
+	AttrRegex     AttrType = "regex"    // regular expression
+)
+
+// AttrSchema describes one attribute of a node type.
+type AttrSchema struct {
+	Name        string
+	Type        AttrType
+	Required    bool
+	Default     string // as documentation; handlers apply their own defaults
+	Enum        []string
+	Description string
+}
+
+// NodeSchema describes a node type and the attributes its handler reads.
+type NodeSchema struct {
+	Type        NodeType
+	Description string
+	Attrs       []AttrSchema
+}
+
+// Attr returns the schema of the attribute name, or nil.
+func (s NodeSchema) Attr(name string) *AttrSchema {
+	for i := range s.Attrs {
+		if s.Attrs[i].Name == name {
+			return &s.Attrs[i]
+		}
+	}
+	return nil
+}
+
+// SchemaHandler is an optional extension of Handler for handlers that
+// describe their attributes.  The built-in handlers all implement it,
+// returning their BuiltinSchema.
+type SchemaHandler interface {
+	Schema() NodeSchema
+}
+
+var (
+	schemasMu sync.RWMutex
+	schemas   = func() map[NodeType]NodeSchema {
+		m := make(map[NodeType]NodeSchema, len(builtinSchemas))
+		for _, s := range builtinSchemas {
+			m[s.Type] = s
+		}
+		return m
+	}()
+)
+
+// BuiltinSchema returns the schema of the built-in node type t, whatever
+// RegisterSchema has since registered for it.  It returns a schema with
+// only Type set if t is not built in.
+func BuiltinSchema(t NodeType) NodeSchema {
+	for _, s := range builtinSchemas {
+		if s.Type == t {
+			return s
+		}
+	}
+	return NodeSchema{Type: t}
+}
+
+// RegisterSchema makes s the schema Validate checks nodes of type s.Type
+// against, replacing any schema registered before, the built-in ones
+// included.  Nodes of a type with no schema have their attributes left
+// unchecked.
+func RegisterSchema(s NodeSchema) {
+	schemasMu.Lock()
+	defer schemasMu.Unlock()
+	schemas[s.Type] = s
+}
+
+// LookupSchema returns the schema registered for t.
+func LookupSchema(t NodeType) (NodeSchema, bool) {
+	schemasMu.RLock()
+	defer schemasMu.RUnlock()
+	s, ok := schemas[t]
+	return s, ok
+}
+
+// Schemas returns every registered schema, sorted by node type.
+func Schemas() []NodeSchema {
+	schemasMu.RLock()
+	defer schemasMu.RUnlock()
+	out := make([]NodeSchema, 0, len(schemas))
+	for _, s := range schemas {
+		out = append(out, s)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Type < out[j].Type })
+	return out
+}
+
+// CommonAttrs are the attributes every node accepts, whatever its type.
+var CommonAttrs = []AttrSchema{
+	{Name: "type", Type: AttrString, Default: string(NodeTypeCodergen), Description: "Node type, selecting the handler"},
+	{Name: "label", Type: AttrString, Description: "Display label"},
+	{Name: "retry_max", Type: AttrInt, Default: "0", Description: "Retries after a failure"},
+	{Name: "retry_delay", Type: AttrDuration, Default: "0s", Description: "Wait between retries"},
+	{Name: "max_visits", Type: AttrInt, Default: strconv.Itoa(DefaultMaxVisits), Description: "Times the node may run in one execution; 0 is unlimited"},
+	{Name: "model", Type: AttrString, Description: "LLM model (provider:model-id); model_stylesheet may set it on any node"},
+}
+
+// displayAttrs are Graphviz attributes that only affect rendering.  They
+// are accepted on every node and not listed in schemas.
+var displayAttrs = []string{
+	"shape", "style", "color", "fillcolor", "fontcolor", "fontname", "fontsize",
+	"tooltip", "xlabel", "width", "height", "penwidth", "peripheries", "comment", "class", "group",
+}
+
+// attrsOfType returns the names of the attributes of node type t that have
+// type at.
+func attrsOfType(t NodeType, at AttrType) []string {
+	s, _ := LookupSchema(t)
+	var names []string
+	for _, a := range s.Attrs {
+		if a.Type == at {
+			names = append(names, a.Name)
+		}
+	}
+	return names
+}
+
+// ValidateNode checks a node's attributes against the schema registered
+// for its type: required attributes are present, values have the declared
+// type, and there are no unknown attributes.  A node of a type with no
+// schema has only its CommonAttrs checked.  Templates and conditions are
+// parsed by Validate.
+func ValidateNode(n *Node) []LintError {
+	s, hasSchema := LookupSchema(n.Type)
+	var errs []LintError
+	report := func(rule, attr, format string, args ...any) {
+		errs = append(errs, LintError{NodeID: n.ID, Rule: rule, Attr: attr, Message: fmt.Sprintf(format, args...)})
+	}
+	for _, a := range s.Attrs {
+		if a.Required && n.Attrs[a.Name] == "" {
+			report(RuleRequiredAttr, a.Name, "missing required attribute %q for node type %q", a.Name, n.Type)
+		}
+	}
+	names := make([]string, 0, len(n.Attrs))
+	for name := range n.Attrs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		a := s.Attr(name)
+		if a == nil {
+			a = commonAttr(name)
+		}
+		switch {
+		case a != nil:
+			if msg := a.check(n.Attrs[name]); msg != "" {
+				report(RuleAttrValue, name, "%s=%q %s", name, n.Attrs[name], msg)
+			}
+		case slices.Contains(displayAttrs, name) || !hasSchema:
+		default:
+			msg := fmt.Sprintf("unknown attribute %q for node type %q", name, n.Type)
+			if guess := closestAttr(name, s); guess != "" {
+				msg += fmt.Sprintf(" (did you mean %q?)", guess)
+			}
+			report(RuleUnknownAttr, name, "%s", msg)
+		}
+	}
+	return errs
+}
+
+func commonAttr(name string) *AttrSchema {
+	for i := range CommonAttrs {
+		if CommonAttrs[i].Name == name {
+			return &CommonAttrs[i]
+		}
+	}
+	return nil
+}
+
+// check returns why v is not a valid value for a, or "".  Empty values are
+// treated as unset.
+func (a *AttrSchema) check(v string) string {
+	if v == "" {
+		return ""
+	}
+	switch a.Type {
+	case AttrInt:
+		if n, err := strconv.Atoi(v); err != nil || n < 0 {
+			return "must be a non-negative integer"
+		}
+	case AttrBool:
+		if v != "true" && v != "false" {
+			return "must be true or false"
+		}
+	case AttrDuration:
+		if _, err := time.ParseDuration(v); err != nil {
+			return "must be a duration such as 30s or 5m"
+		}
+	case AttrEnum:
+		if !slices.Contains(a.Enum, v) {
+			return "must be one of " + strings.Join(a.Enum, ", ")
+		}
+	case AttrRegex:
+		if _, err := regexp.Compile(v); err != nil {
+			return fmt.Sprintf("is not a valid regular expression: %v", err)
+		}
+	case AttrKey:
+		if !validKey(v) {
+			return "is not a context key name"
+		}
+	case AttrKeys:
+		for _, k := range strings.Split(v, ",") {
+			if k = strings.TrimSpace(k); k != "" && !validKey(k) {
+				return fmt.Sprintf("contains %q, which is not a context key name", k)
+			}
+		}
+	}
+	return ""
+}
+
+// validKey reports whether s can name a context key in an attribute: a
+// template or a name with spaces is a mistake there.
+func validKey(s string) bool {
+	return !strings.Contains(s, "{{") && !strings.ContainsAny(s, " \t\n")
+}
+
+// closestAttr returns the attribute of s or CommonAttrs most like name, or
+// "" if none is close.
+func closestAttr(name string, s NodeSchema) string {
+	known := keySet{}
+	for _, a := range append(slices.Clone(s.Attrs), CommonAttrs...) {
+		known[a.Name] = true
+	}
+	return closestKey(name, known)
+}
+
+// ValidateHandlers checks that reg has a handler for the type of every node
+// in p.  fan_out nodes are run by the engine and need none.
+func ValidateHandlers(p *Pipeline, reg HandlerRegistry) []LintError {
+	has := func(t NodeType) bool {
+		_, err := reg.Get(t)
+		return t == NodeTypeFanOut || err == nil
+	}
+	var errs []LintError
+	ids := make([]string, 0, len(p.Nodes))
+	for id := range p.Nodes {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		t := p.Nodes[id].Type
+		if has(t) {
+			continue
+		}
+		msg := fmt.Sprintf("unknown node type %q", t)
+		known := keySet{}
+		for _, s := range Schemas() {
+			if has(s.Type) {
+				known[string(s.Type)] = true
+			}
+		}
+		if guess := closestKey(string(t), known); guess != "" {
+			msg += fmt.Sprintf(" (did you mean %q?)", guess)
+		}
+		errs = append(errs, LintError{NodeID: id, Rule: RuleUnknownType, Attr: "type", Message: msg})
+	}
+	return locateErrors(p, errs)
+}
@@ -0,0 +1,563 @@
+package pipeline
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Pos is a position in a pipeline source.  Line and Col are 1-based; Col
+// counts Unicode code points.  The zero Pos is unknown.
+type Pos struct {
+	Line, Col int
+}
+
+// IsValid reports whether p is a known position.
+func (p Pos) IsValid() bool { return p.Line > 0 }
+
+func (p Pos) String() string { return fmt.Sprintf("%d:%d", p.Line, p.Col) }
+
+// Before reports whether p comes before q.
+func (p Pos) Before(q Pos) bool {
+	return p.Line < q.Line || p.Line == q.Line && p.Col < q.Col
+}
+
+// Span is the range of a source from Start up to, not including, End.
+type Span struct {
+	Start, End Pos
+}
+
+// IsValid reports whether s is a known range.
+func (s Span) IsValid() bool { return s.Start.IsValid() }
+
+// Contains reports whether pos is within s.
+func (s Span) Contains(pos Pos) bool {
+	return s.IsValid() && !pos.Before(s.Start) && pos.Before(s.End)
+}
+
+// ParseError is a syntax error in a pipeline source.
+type ParseError struct {
+	Syntax Syntax // "" for DOT
+	Pos    Pos    // zero if the parser did not report one
+	Msg    string // such as unexpected "->", expected one of: = ] , id
+	Err    error  // the error of the DOT or YAML parser, if any
+}
+
+func (e *ParseError) Error() string {
+	syn := e.Syntax
+	if syn == "" {
+		syn = SyntaxDOT
+	}
+	if e.Pos.IsValid() {
+		return fmt.Sprintf("%s parse error at %s: %s", syn, e.Pos, e.Msg)
+	}
+	return fmt.Sprintf("%s parse error: %s", syn, e.Msg)
+}
+
+func (e *ParseError) Unwrap() error { return e.Err }
+
+// gographviz reports positions only in the text of its errors, which read
+// like: Error in S71: ->(16,->), Pos(offset=28, line=3, column=4),
+// expected one of: = ] , id
+var parseErrorText = regexp.MustCompile(`(?s)^Error in S\d+: (.*?)\(\d+,(.*)\), Pos\(offset=\d+, line=(\d+), column=(\d+)\),? ?(.*)$`)
+
+func newParseError(err error) *ParseError {
+	pe := &ParseError{Msg: err.Error(), Err: err}
+	m := parseErrorText.FindStringSubmatch(strings.TrimSpace(err.Error()))
+	if m == nil {
+		return pe
+	}
+	pe.Pos.Line, _ = strconv.Atoi(m[3])
+	pe.Pos.Col, _ = strconv.Atoi(m[4])
+	lit, _, _ := strings.Cut(m[2], "\n")
+	switch {
+	case m[1] == "$":
+		pe.Msg = "unexpected end of file"
+	case m[1] == "INVALID" && strings.HasPrefix(lit, `"`):
+		pe.Msg = "unterminated string"
+	case m[1] == "INVALID":
+		pe.Msg = fmt.Sprintf("invalid token %s", lit)
+	default:
+		pe.Msg = fmt.Sprintf("unexpected %q", lit)
+	}
+	if expected := strings.Fields(m[5]); len(expected) > 0 {
+		for i, tok := range expected {
+			if tok == "$" {
+				expected[i] = "end of file"
+			}
+		}
+		pe.Msg += ", " + strings.Join(expected, " ")
+	}
+	return pe
+}
+
+// ─── DOT scanner ──────────────────────────────────────────────────────────────
+
+// TokenKind classifies a Token.
+type TokenKind int
+
+const (
+	TokenEOF     TokenKind = iota
+	TokenID                // identifier, numeral, quoted or HTML string
+	TokenPunct             // { } [ ] ; , = : -> --
+	TokenComment           // // … , /* … */ or a # line
+)
+
+// Token is a lexical token of a DOT source.
+type Token struct {
+	Kind TokenKind
+	Text string // as written, quotes included
+	Span Span
+	// newline is true when a line break separates the token from the one
+	// before it.
+	newline bool
+}
+
+// ScanDOT splits src into tokens, comments included, ending with a
+// TokenEOF.  It does not check the syntax: characters it does not
+// recognise become TokenPunct tokens.
+func ScanDOT(src string) []Token {
+	var (
+		toks    []Token
+		pos     = Pos{Line: 1, Col: 1}
+		i       int
+		newline bool
+	)
+	advance := func(n int) {
+		for _, r := range src[i : i+n] {
+			if r == '\n' {
+				pos.Line++
+				pos.Col = 1
+			} else {
+				pos.Col++
+			}
+		}
+		i += n
+	}
+	emit := func(kind TokenKind, n int) {
+		start := pos
+		text := src[i : i+n]
+		advance(n)
+		toks = append(toks, Token{Kind: kind, Text: text, Span: Span{start, pos}, newline: newline})
+		newline = false
+	}
+	for i < len(src) {
+		c := src[i]
+		rest := src[i:]
+		switch {
+		case c == '\n':
+			newline = true
+			advance(1)
+		case c == ' ' || c == '\t' || c == '\r':
+			advance(1)
+		case strings.HasPrefix(rest, "//") || c == '#' && (pos.Col == 1 || newline || len(toks) == 0):
+			n := strings.IndexByte(rest, '\n')
+			if n < 0 {
+				n = len(rest)
+			}
+			emit(TokenComment, len(strings.TrimRight(rest[:n], "\r")))
+		case strings.HasPrefix(rest, "/*"):
+			n := strings.Index(rest[2:], "*/")
+			if n < 0 {
+				n = len(rest)
+			} else {
+				n += 4
+			}
+			emit(TokenComment, n)
+		case c == '"':
+			n := 1
+			for n < len(rest) && rest[n] != '"' {
+				if rest[n] == '\\' && n+1 < len(rest) {
+					n++
+				}
+				n++
+			}
+			emit(TokenID, min(n+1, len(rest)))
+		case c == '<':
+			depth, n := 0, 0
+			for n < len(rest) {
+				if rest[n] == '<' {
+					depth++
+				} else if rest[n] == '>' {
+					depth--
+				}
+				n++
+				if depth == 0 {
+					break
+				}
+			}
+			emit(TokenID, n)
+		case strings.HasPrefix(rest, "->") || strings.HasPrefix(rest, "--"):
+			emit(TokenPunct, 2)
+		case c == '-' || c == '.' || isDigit(c):
+			n, digits := 0, 0
+			if c == '-' {
+				n++
+			}
+			for ; n < len(rest) && (rest[n] == '.' || isDigit(rest[n])); n++ {
+				if isDigit(rest[n]) {
+					digits++
+				}
+			}
+			if digits == 0 {
+				emit(TokenPunct, 1)
+			} else {
+				emit(TokenID, n)
+			}
+		case isIDRune(rune(c)):
+			n := 0
+			for n < len(rest) {
+				r, size := utf8.DecodeRuneInString(rest[n:])
+				if !isIDRune(r) && !(r < utf8.RuneSelf && isDigit(byte(r))) {
+					break
+				}
+				n += size
+			}
+			emit(TokenID, n)
+		default:
+			_, size := utf8.DecodeRuneInString(rest)
+			emit(TokenPunct, size)
+		}
+	}
+	toks = append(toks, Token{Kind: TokenEOF, Span: Span{pos, pos}, newline: newline})
+	return toks
+}
+
+func isDigit(c byte) bool { return c >= '0' && c <= '9' }
+
+func isIDRune(r rune) bool {
+	return r == '_' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= utf8.RuneSelf
+}
+
+// ─── locating nodes, edges and attributes ─────────────────────────────────────
+
+// locate records in p where its nodes, edges, params and attributes are
+// defined in src, the source p was parsed from.  src has already been
+// parsed, so the walk assumes it is well-formed and stops at the first
+// surprise, leaving later spans unknown.
+func locate(p *Pipeline, src string) {
+	l := &locator{
+		p:       p,
+		defined: map[string]bool{},
+		seen:    map[[2]string]int{},
+		edges:   map[[2]string][]*Edge{},
+	}
+	for _, t := range ScanDOT(src) {
+		if t.Kind != TokenComment {
+			l.toks = append(l.toks, t)
+		}
+	}
+	for _, e := range p.Edges {
+		k := [2]string{e.From, e.To}
+		l.edges[k] = append(l.edges[k], e)
+	}
+	l.graph()
+}
+
+type locator struct {
+	p       *Pipeline
+	toks    []Token
+	i       int
+	defined map[string]bool       // nodes with a node statement so far
+	seen    map[[2]string]int     // edges located so far, by endpoints
+	edges   map[[2]string][]*Edge // p.Edges by endpoints, in order
+}
+
+// scope holds the node and edge attribute defaults of a graph or subgraph.
+type scope struct {
+	name      string
+	nodeAttrs map[string]Span
+	edgeAttrs map[string]Span
+}
+
+type attrSpan struct {
+	name string
+	span Span
+}
+
+func (l *locator) peek() Token { return l.toks[l.i] }
+
+func (l *locator) next() Token {
+	t := l.toks[l.i]
+	if t.Kind != TokenEOF {
+		l.i++
+	}
+	return t
+}
+
+func (l *locator) is(text string) bool {
+	t := l.peek()
+	return t.Kind == TokenPunct && t.Text == text
+}
+
+func (l *locator) keyword(word string) bool {
+	t := l.peek()
+	return t.Kind == TokenID && strings.EqualFold(t.Text, word)
+}
+
+func (l *locator) graph() {
+	start := l.peek().Span.Start
+	if l.keyword("strict") {
+		l.next()
+	}
+	if !l.keyword("graph") && !l.keyword("digraph") {
+		return
+	}
+	end := l.next().Span.End
+	if l.peek().Kind == TokenID {
+		end = l.next().Span.End
+	}
+	l.p.Span = Span{start, end}
+	if !l.is("{") {
+		return
+	}
+	l.next()
+	l.stmts(&scope{nodeAttrs: map[string]Span{}, edgeAttrs: map[string]Span{}})
+}
+
+// stmts walks statements up to the closing brace of sc and returns the IDs
+// of the nodes they mention.
+func (l *locator) stmts(sc *scope) []Token {
+	var ids []Token
+	for {
+		t := l.peek()
+		switch {
+		case t.Kind == TokenEOF:
+			return ids
+		case l.is("}"):
+			l.next()
+			return ids
+		case l.is(";"):
+			l.next()
+		case l.keyword("graph") || l.keyword("node") || l.keyword("edge"):
+			kw := strings.ToLower(l.next().Text)
+			for _, a := range l.attrLists() {
+				switch kw {
+				case "graph":
+					setSpan(&l.p.AttrSpans, a.name, a.span)
+				case "node":
+					sc.nodeAttrs[a.name] = a.span
+				case "edge":
+					sc.edgeAttrs[a.name] = a.span
+				}
+			}
+		case t.Kind == TokenID && l.toks[l.i+1].Kind == TokenPunct && l.toks[l.i+1].Text == "=":
+			a, ok := l.attr()
+			if !ok {
+				return ids
+			}
+			setSpan(&l.p.AttrSpans, a.name, a.span)
+		case t.Kind == TokenID || l.is("{"):
+			subgraph := l.keyword("subgraph") || l.is("{")
+			operand, ok := l.operand(sc)
+			if !ok {
+				return ids
+			}
+			ids = append(ids, operand...)
+			if l.is("->") || l.is("--") {
+				ids = append(ids, l.edgeStmt(sc, operand)...)
+			} else if !subgraph {
+				l.nodeStmt(sc, operand[0], l.attrLists())
+			}
+		default:
+			return ids
+		}
+	}
+}
+
+// operand reads a node ID, with any port, or a subgraph, and returns the
+// IDs of the nodes it names.
+func (l *locator) operand(sc *scope) ([]Token, bool) {
+	if l.keyword("subgraph") || l.is("{") {
+		name := ""
+		if l.keyword("subgraph") {
+			l.next()
+			if l.peek().Kind == TokenID {
+				name = unquote(l.next().Text)
+			}
+		}
+		if !l.is("{") {
+			return nil, false
+		}
+		l.next()
+		inner := &scope{name: name, nodeAttrs: copySpans(sc.nodeAttrs), edgeAttrs: copySpans(sc.edgeAttrs)}
+		return l.stmts(inner), true
+	}
+	id := l.next()
+	if sc.name != ParamsSubgraph {
+		l.mention(sc, id)
+	}
+	for l.is(":") {
+		l.next()
+		if l.peek().Kind != TokenID {
+			return nil, false
+		}
+		id.Span.End = l.next().Span.End
+	}
+	return []Token{id}, true
+}
+
+// mention records a place node id appears, and takes the first as the
+// node's Span until a node statement defines it.
+func (l *locator) mention(sc *scope, id Token) {
+	n, ok := l.p.Nodes[unquote(id.Text)]
+	if !ok {
+		return
+	}
+	n.Refs = append(n.Refs, id.Span)
+	if n.Span.IsValid() {
+		return
+	}
+	n.Span = id.Span
+	for name, span := range sc.nodeAttrs {
+		setSpan(&n.AttrSpans, name, span)
+	}
+}
+
+func (l *locator) nodeStmt(sc *scope, id Token, attrs []attrSpan) {
+	name := unquote(id.Text)
+	if sc.name == ParamsSubgraph {
+		for _, prm := range l.p.Params {
+			if prm.Name == name && !prm.Span.IsValid() {
+				prm.Span = id.Span
+			}
+		}
+		return
+	}
+	n, ok := l.p.Nodes[name]
+	if !ok {
+		return
+	}
+	// The first node statement is the node's definition, even if an edge
+	// mentioned it before.
+	if !l.defined[name] {
+		l.defined[name] = true
+		n.Span = id.Span
+	}
+	for _, a := range attrs {
+		setSpan(&n.AttrSpans, a.name, a.span)
+	}
+}
+
+func (l *locator) edgeStmt(sc *scope, first []Token) []Token {
+	var ids []Token
+	operands := [][]Token{first}
+	for l.is("->") || l.is("--") {
+		l.next()
+		operand, ok := l.operand(sc)
+		if !ok {
+			return ids
+		}
+		ids = append(ids, operand...)
+		operands = append(operands, operand)
+	}
+	attrs := l.attrLists()
+	for i := 1; i < len(operands); i++ {
+		for _, from := range operands[i-1] {
+			for _, to := range operands[i] {
+				k := [2]string{unquote(from.Text), unquote(to.Text)}
+				n := l.seen[k]
+				l.seen[k]++
+				if n >= len(l.edges[k]) {
+					continue
+				}
+				e := l.edges[k][n]
+				e.Span = Span{from.Span.Start, to.Span.End}
+				for name, span := range sc.edgeAttrs {
+					setSpan(&e.AttrSpans, name, span)
+				}
+				for _, a := range attrs {
+					setSpan(&e.AttrSpans, a.name, a.span)
+				}
+			}
+		}
+	}
+	return ids
+}
+
+// attrLists reads any number of [ … ] attribute lists.
+func (l *locator) attrLists() []attrSpan {
+	var attrs []attrSpan
+	for l.is("[") {
+		l.next()
+		for !l.is("]") {
+			if l.is(",") || l.is(";") {
+				l.next()
+				continue
+			}
+			a, ok := l.attr()
+			if !ok {
+				return attrs
+			}
+			attrs = append(attrs, a)
+		}
+		l.next()
+	}
+	return attrs
+}
+
+// attr reads name=value, or a bare name, which DOT reads as name=true.
+func (l *locator) attr() (attrSpan, bool) {
+	name := l.next()
+	if name.Kind != TokenID {
+		return attrSpan{}, false
+	}
+	a := attrSpan{name: unquote(name.Text), span: name.Span}
+	if l.is("=") {
+		l.next()
+		value := l.next()
+		if value.Kind != TokenID {
+			return attrSpan{}, false
+		}
+		a.span.End = value.Span.End
+	}
+	return a, true
+}
+
+func setSpan(m *map[string]Span, name string, span Span) {
+	if *m == nil {
+		*m = map[string]Span{}
+	}
+	(*m)[name] = span
+}
+
+func copySpans(m map[string]Span) map[string]Span {
+	out := make(map[string]Span, len(m))
+	for k, v := range m {
+		out[k] = v
+	}
+	return out
+}
+
+// locateErrors sets the Span of each of errs that has none from the spans
+// recorded in p: that of the attribute at fault if it is known, else that
+// of the edge, the node or the graph header.
+func locateErrors(p *Pipeline, errs []LintError) []LintError {
+	for i := range errs {
+		e := &errs[i]
+		if e.Span.IsValid() {
+			continue
+		}
+		switch {
+		case e.Edge != nil:
+			e.Span = spanOf(e.Edge.AttrSpans, e.Attr, e.Edge.Span)
+		case e.NodeID != "":
+			if n, ok := p.Nodes[e.NodeID]; ok {
+				e.Span = spanOf(n.AttrSpans, e.Attr, n.Span)
+			}
+		default:
+			e.Span = spanOf(p.AttrSpans, e.Attr, p.Span)
+		}
+	}
+	return errs
+}
+
+// spanOf returns the span of attribute attr in spans, or def.
+func spanOf(spans map[string]Span, attr string, def Span) Span {
+	if s, ok := spans[attr]; ok && attr != "" {
+		return s
+	}
+	return def
+}
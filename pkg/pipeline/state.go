@@ -1,13 +1,19 @@
 package pipeline
 
 import (
-	"encoding/json"
 	"fmt"
-	"os"
 	"sync"
+	"time"
 )
 
 // PipelineContext is a thread-safe key-value store for pipeline state.
+//
+// Handlers store strings by default, but a value may be anything JSON can
+// represent: string, bool, int64 (whole numbers), float64, nil, []any and
+// map[string]any.  Such typed values come from --var-file, json_decode,
+// split and http, and templates use them directly ({{range .items}},
+// {{.user.name}}).  Values are shared between copies of a context, so
+// handlers replace them rather than modify them in place.
 type PipelineContext struct {
 	mu   sync.RWMutex
 	data map[string]any
@@ -33,14 +39,11 @@ func (c *PipelineContext) Get(key string) (any, bool) {
 	return v, ok
 }
 
-// GetString retrieves a string value, returning "" if not found or not a string.
+// GetString retrieves a value as a string, returning "" if not found.
+// Values that are not strings are formatted with FormatValue.
 func (c *PipelineContext) GetString(key string) string {
-	v, ok := c.Get(key)
-	if !ok {
-		return ""
-	}
-	s, _ := v.(string)
-	return s
+	v, _ := c.Get(key)
+	return FormatValue(v)
 }
 
 // Snapshot returns a shallow copy of all key-value pairs.
@@ -64,49 +67,92 @@ func (c *PipelineContext) Merge(src map[string]any) {
 }
 
 // Copy returns a new PipelineContext initialised from a snapshot of this one.
-// The copy is completely independent — mutations to either context do not
-// affect the other.
+// The copy is independent — setting a key in either context does not affect
+// the other — but the values themselves are shared.
 func (c *PipelineContext) Copy() *PipelineContext {
 	return &PipelineContext{data: c.Snapshot()}
 }
 
-// checkpoint is the JSON-serialisable form of a saved checkpoint.
-type checkpoint struct {
-	LastNodeID string         `json:"last_node_id"`
-	Data       map[string]any `json:"data"`
+// Checkpoint is the JSON-serialisable form of a saved checkpoint.
+type Checkpoint struct {
+	LastNodeID string   `json:"last_node_id"`
+	Outcome    *Outcome `json:"outcome,omitempty"`
+	// Next is the edge the engine chose after LastNodeID completed; resuming
+	// continues at its target so that LastNodeID does not run twice.  It is
+	// nil when the run ended at LastNodeID (see Completed) or for checkpoints
+	// written before edges were recorded.
+	Next *CheckpointEdge `json:"next,omitempty"`
+	// Completed is set once the run has reached an exit node or a node with
+	// no outgoing edge.
+	Completed bool `json:"completed,omitempty"`
+	// FanOut is set on checkpoints written while the branches of a fan_out
+	// were running; LastNodeID is then the fan_out node.
+	FanOut *FanOutState `json:"fan_out,omitempty"`
+	// Suspended marks the checkpoint written when a run was interrupted
+	// (see Engine.Suspend), with the reason.  It repeats the checkpoint
+	// before it, so resuming continues from the same place.
+	Suspended     bool   `json:"suspended,omitempty"`
+	SuspendReason string `json:"suspend_reason,omitempty"`
+	// Fingerprint identifies the pipeline source the checkpoint was written
+	// by; see Pipeline.Fingerprint.
+	Fingerprint string `json:"fingerprint,omitempty"`
+	// Step numbers the checkpoints of a run from 1; see HistoryPath.
+	Step int            `json:"step,omitempty"`
+	Time time.Time      `json:"time,omitzero"`
+	Data map[string]any `json:"data"`
+}
+
+// CheckpointEdge is the JSON form of an Edge recorded in a checkpoint.
+type CheckpointEdge struct {
+	From      string `json:"from"`
+	To        string `json:"to"`
+	Condition string `json:"condition,omitempty"`
+	On        string `json:"on,omitempty"`
+}
+
+func checkpointEdge(e *Edge) *CheckpointEdge {
+	if e == nil {
+		return nil
+	}
+	return &CheckpointEdge{From: e.From, To: e.To, Condition: e.Condition, On: e.On}
+}
+
+// PipelineContext returns a context holding the checkpoint's data.
+func (cp *Checkpoint) PipelineContext() *PipelineContext {
+	return &PipelineContext{data: cp.Data}
 }
 
 // SaveCheckpoint persists the context + last completed node ID to a JSON file.
 func (c *PipelineContext) SaveCheckpoint(path, lastNodeID string) error {
-	c.mu.RLock()
-	snap := make(map[string]any, len(c.data))
-	for k, v := range c.data {
-		snap[k] = v
-	}
-	c.mu.RUnlock()
+	return writeCheckpoint(path, Checkpoint{LastNodeID: lastNodeID, Data: c.Snapshot()})
+}
 
-	cp := checkpoint{LastNodeID: lastNodeID, Data: snap}
-	data, err := json.MarshalIndent(cp, "", "  ")
+// writeCheckpoint atomically replaces path with cp as indented JSON.
+func writeCheckpoint(path string, cp Checkpoint) error {
+	data, err := MarshalCheckpoint(fileSnapshot{Checkpoint: cp})
 	if err != nil {
 		return fmt.Errorf("checkpoint marshal: %w", err)
 	}
-	if err := os.WriteFile(path, data, 0o600); err != nil {
+	if err := writeFileAtomic(path, data, 0o600); err != nil {
 		return fmt.Errorf("checkpoint write: %w", err)
 	}
 	return nil
 }
 
+// ReadCheckpoint reads a checkpoint file without converting it to a context.
+// Steps journalled since the file was last written (see FileStore) are
+// replayed on top of it.
+func ReadCheckpoint(path string) (*Checkpoint, error) {
+	cp, _, err := readFileCheckpoint(path)
+	return cp, err
+}
+
 // LoadCheckpoint restores a context from a JSON checkpoint file.
 // Returns the context and the last completed node ID.
 func LoadCheckpoint(path string) (*PipelineContext, string, error) {
-	data, err := os.ReadFile(path)
+	cp, err := ReadCheckpoint(path)
 	if err != nil {
-		return nil, "", fmt.Errorf("checkpoint read: %w", err)
-	}
-	var cp checkpoint
-	if err := json.Unmarshal(data, &cp); err != nil {
-		return nil, "", fmt.Errorf("checkpoint unmarshal: %w", err)
+		return nil, "", err
 	}
-	ctx := &PipelineContext{data: cp.Data}
-	return ctx, cp.LastNodeID, nil
+	return cp.PipelineContext(), cp.LastNodeID, nil
 }
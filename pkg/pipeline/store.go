@@ -0,0 +1,198 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+)
+
+// ErrNoCheckpoint is returned by CheckpointStore.Load when nothing has been
+// saved yet.
+var ErrNoCheckpoint = errors.New("no checkpoint saved")
+
+// ErrCheckpointLocked is returned by CheckpointStore.Lock while another run
+// holds the store.
+var ErrCheckpointLocked = errors.New("checkpoint is locked by another run")
+
+// CheckpointStore persists the checkpoints of a run: the latest one, which
+// resume starts from, and the history of every step (see HistoryPath).
+// The engine locks the store for the duration of Execute so that two runs
+// pointed at the same store fail instead of overwriting each other.
+type CheckpointStore interface {
+	// Lock claims the store for one run.  It fails with ErrCheckpointLocked
+	// while another run holds it.
+	Lock(ctx context.Context) error
+	// Unlock releases the claim taken by Lock.
+	Unlock(ctx context.Context) error
+	// Save records cp as the latest checkpoint and appends it to the
+	// history.  A crash during Save leaves the previous checkpoint intact.
+	Save(ctx context.Context, cp *Checkpoint) error
+	// Load returns the latest checkpoint, or ErrNoCheckpoint.
+	Load(ctx context.Context) (*Checkpoint, error)
+	// History returns every saved step, oldest first.
+	History(ctx context.Context) ([]*Checkpoint, error)
+	// Reset discards the latest checkpoint and the history, for a fresh run.
+	Reset(ctx context.Context) error
+	// Close releases any resources held by the store.
+	Close() error
+}
+
+// FileStore is a CheckpointStore backed by a checkpoint file, its journal
+// next to it (see HistoryPath), and an advisory lock file "<path>.lock".
+//
+// Each Save appends only the context keys that changed to the journal (see
+// JournalEntry).  Every DefaultCompactEvery steps, and when the run
+// completes, the full context is written to the checkpoint file, which
+// records how much of the journal it covers; reading the checkpoint replays
+// the rest.  The checkpoint file is replaced by atomic rename, so readers
+// never see a partial write.
+type FileStore struct {
+	path         string
+	lock         *fileLock
+	compactEvery int
+
+	data    map[string]any // context after the last journal entry; nil if unknown
+	pending int            // journal entries since the checkpoint file was written
+	end     int64          // journal length after the last complete entry; -1 if unknown
+	trunc   int64          // length to cut the journal back to before appending; -1 for none
+}
+
+// NewFileStore returns a store that keeps its checkpoint at path.
+func NewFileStore(path string) *FileStore {
+	return &FileStore{path: path, compactEvery: DefaultCompactEvery, end: -1, trunc: -1}
+}
+
+// Path returns the checkpoint file path.
+func (s *FileStore) Path() string { return s.path }
+
+// SetCompactEvery sets how many steps are journalled between rewrites of
+// the checkpoint file; 1 rewrites it on every step.  n <= 0 restores
+// DefaultCompactEvery.
+func (s *FileStore) SetCompactEvery(n int) {
+	if n <= 0 {
+		n = DefaultCompactEvery
+	}
+	s.compactEvery = n
+}
+
+func (s *FileStore) Lock(_ context.Context) error {
+	if s.lock != nil {
+		return nil
+	}
+	l, err := lockFile(s.path + ".lock")
+	if err != nil {
+		return fmt.Errorf("checkpoint %s: %w", s.path, err)
+	}
+	s.lock = l
+	return nil
+}
+
+func (s *FileStore) Unlock(_ context.Context) error {
+	if s.lock == nil {
+		return nil
+	}
+	err := s.lock.release()
+	s.lock = nil
+	return err
+}
+
+func (s *FileStore) Save(_ context.Context, cp *Checkpoint) error {
+	journal := HistoryPath(s.path)
+	if s.trunc >= 0 {
+		// Drop what an interrupted append left behind, so the next entry
+		// starts on a line of its own.
+		if err := os.Truncate(journal, s.trunc); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("history write: %w", err)
+		}
+		s.trunc = -1
+	}
+
+	// The journal is authoritative, so it is written first; the checkpoint
+	// file only saves replaying it from the start.
+	entry := NewJournalEntry(s.data, cp)
+	end, err := appendJournal(journal, entry)
+	if err != nil {
+		s.data, s.trunc = nil, s.end
+		return err
+	}
+	s.data = maps.Clone(cp.Data)
+	s.end = end
+	s.pending++
+	if entry.Base || cp.Completed || s.pending >= s.compactEvery {
+		if err := writeSnapshot(s.path, cp, end); err != nil {
+			return err
+		}
+		s.pending = 0
+	}
+	return nil
+}
+
+func (s *FileStore) Load(_ context.Context) (*Checkpoint, error) {
+	cp, tail, err := readFileCheckpoint(s.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrNoCheckpoint
+	}
+	if err != nil {
+		return nil, err
+	}
+	s.data = maps.Clone(cp.Data)
+	s.pending = tail.entries
+	s.end = tail.end
+	if tail.size > tail.end {
+		s.trunc = tail.end
+	}
+	return cp, nil
+}
+
+func (s *FileStore) History(_ context.Context) ([]*Checkpoint, error) {
+	return ReadHistory(s.path)
+}
+
+func (s *FileStore) Reset(_ context.Context) error {
+	for _, p := range []string{s.path, HistoryPath(s.path)} {
+		if err := os.Remove(p); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("checkpoint reset: %w", err)
+		}
+	}
+	s.data, s.pending, s.end, s.trunc = nil, 0, 0, -1
+	return nil
+}
+
+func (s *FileStore) Close() error {
+	return s.Unlock(context.Background())
+}
+
+// writeFileAtomic writes data to a temporary file in path's directory and
+// renames it over path.
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	dir, base := filepath.Split(path)
+	if dir == "" {
+		dir = "."
+	}
+	f, err := os.CreateTemp(dir, "."+base+".tmp*")
+	if err != nil {
+		return err
+	}
+	tmp := f.Name()
+	defer os.Remove(tmp) // no-op once renamed
+
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp, perm); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,81 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+)
+
+// ErrSuspended is returned by Execute and Resume when the run stopped because
+// Suspend was called.
+var ErrSuspended = errors.New("run suspended")
+
+// suspension is a request to stop a run between nodes, shared by an engine
+// and the engines running its fan_out branches.
+type suspension struct {
+	once   sync.Once
+	on     atomic.Bool
+	reason string // written before on is set
+}
+
+func (s *suspension) request(reason string) {
+	s.once.Do(func() {
+		s.reason = reason
+		s.on.Store(true)
+	})
+}
+
+// requested returns the reason given to the first request, if any.
+func (s *suspension) requested() (string, bool) {
+	if !s.on.Load() {
+		return "", false
+	}
+	return s.reason, true
+}
+
+// Suspend asks the engine to stop the run before starting another node.
+// Nodes already running, including those of fan_out branches, are left to
+// finish; the caller decides how long to wait before cancelling Execute's
+// context.  The run then ends with an error wrapping ErrSuspended, and its
+// last checkpoint is recorded again marked Suspended with reason.  Only the
+// first call has any effect, and the engine runs no further nodes after it.
+// Suspend may be called from any goroutine.
+func (e *Engine) Suspend(reason string) {
+	e.suspend.request(reason)
+}
+
+// suspended is given the error a run ended with.  When the run was suspended
+// or cancelled, it records the last checkpoint again marked Suspended, so the
+// checkpoint shows that the run was interrupted and why, and it wraps err in
+// ErrSuspended for a suspension.  Other errors are returned unchanged.
+func (e *Engine) suspended(ctx context.Context, err error) error {
+	reason, ok := e.suspend.requested()
+	switch {
+	case ok && ctx.Err() != nil:
+		reason += "; " + context.Cause(ctx).Error()
+	case ok:
+	case ctx.Err() != nil:
+		reason = context.Cause(ctx).Error()
+	default:
+		return err
+	}
+	if ok && !errors.Is(err, ErrSuspended) {
+		err = fmt.Errorf("%w: %w", ErrSuspended, err)
+	}
+	if e.store == nil || e.last == nil {
+		return err
+	}
+
+	// The last checkpoint already points at the node to resume at; a node
+	// cut short by cancellation runs again.
+	cp := *e.last
+	cp.Suspended, cp.SuspendReason = true, reason
+	if cpErr := e.saveCheckpoint(ctx, &PipelineContext{data: cp.Data}, cp); cpErr != nil {
+		return errors.Join(err, fmt.Errorf("save suspended checkpoint: %w", cpErr))
+	}
+	slog.Info("run suspended", "reason", reason, "step", e.step)
+	return err
+}
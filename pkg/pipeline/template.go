@@ -0,0 +1,546 @@
+package pipeline
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"text/template/parse"
+	"time"
+)
+
+// templateFuncs are the functions available to every templated attribute,
+// in addition to text/template's built-ins.  Functions that take a string
+// accept any context value and format it with FormatValue.
+var templateFuncs = template.FuncMap{
+	// Values
+	"default":  tplDefault,
+	"toJson":   tplToJSON,
+	"fromJson": tplFromJSON,
+	"env":      os.Getenv,
+	"now":      tplNow,
+
+	// Strings
+	"join":    tplJoin,
+	"split":   tplSplit,
+	"trim":    func(s any) string { return strings.TrimSpace(FormatValue(s)) },
+	"upper":   func(s any) string { return strings.ToUpper(FormatValue(s)) },
+	"lower":   func(s any) string { return strings.ToLower(FormatValue(s)) },
+	"replace": func(old, repl string, s any) string { return strings.ReplaceAll(FormatValue(s), old, repl) },
+	"indent":  tplIndent,
+	"quote":   func(s any) string { return strconv.Quote(FormatValue(s)) },
+	"shquote": func(s any) string { return "'" + strings.ReplaceAll(FormatValue(s), "'", `'\''`) + "'" },
+	"b64enc":  func(s any) string { return base64.StdEncoding.EncodeToString([]byte(FormatValue(s))) },
+	"b64dec":  tplB64Dec,
+	"sha256":  tplSHA256,
+
+	// Arithmetic
+	"add": func(a, b any) (any, error) { return arith("add", a, b) },
+	"sub": func(a, b any) (any, error) { return arith("sub", a, b) },
+	"mul": func(a, b any) (any, error) { return arith("mul", a, b) },
+	"div": func(a, b any) (any, error) { return arith("div", a, b) },
+	"mod": func(a, b any) (any, error) { return arith("mod", a, b) },
+}
+
+// ParseTemplate parses an attribute template with the template functions.
+// The linter uses it to report template errors before a run.
+func ParseTemplate(tpl string) (*template.Template, error) {
+	return template.New("").Funcs(templateFuncs).Parse(tpl)
+}
+
+type strictTemplatesKey struct{}
+
+// WithStrictTemplates returns a context under which RenderTemplate treats a
+// reference to a missing context key as an error instead of printing
+// "<no value>".  The engine sets it from the strict_templates graph
+// attribute.
+func WithStrictTemplates(ctx context.Context, strict bool) context.Context {
+	return context.WithValue(ctx, strictTemplatesKey{}, strict)
+}
+
+// RenderTemplate executes tpl against the context values in data.  List and
+// object values print as JSON; templates can still range over them and
+// reach into them ({{.user.name}}, {{index .items 0}}).
+//
+// In strict mode a key read only to be handed to default, as in
+// {{.name | default "anon"}} or {{default "anon" .user.name}}, may still be
+// missing: default receives nil for it.
+func RenderTemplate(ctx context.Context, tpl string, data map[string]any) (string, error) {
+	var t *template.Template
+	var err error
+	if strict, _ := ctx.Value(strictTemplatesKey{}).(bool); strict {
+		t, err = template.New("").Funcs(templateFuncs).Funcs(strictFuncs).Parse(tpl)
+		if err != nil {
+			return "", err
+		}
+		t.Option("missingkey=error")
+		optionalDefaults(t)
+	} else if t, err = ParseTemplate(tpl); err != nil {
+		return "", err
+	}
+	values := make(map[string]any, len(data))
+	for k, v := range data {
+		values[k] = templateValue(v)
+	}
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, values); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// validateTemplates parses every attribute whose schema type is template
+// and checks the strict_templates graph attribute.
+func validateTemplates(p *Pipeline) []LintError {
+	var errs []LintError
+	if s, ok := p.Attrs["strict_templates"]; ok {
+		if _, err := strconv.ParseBool(s); err != nil {
+			errs = append(errs, LintError{Rule: RuleAttrValue, Attr: "strict_templates", Message: fmt.Sprintf("graph attribute strict_templates=%q must be true or false", s)})
+		}
+	}
+	ids := make([]string, 0, len(p.Nodes))
+	for id := range p.Nodes {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		n := p.Nodes[id]
+		for _, attr := range attrsOfType(n.Type, AttrTemplate) {
+			if _, err := ParseTemplate(n.Attrs[attr]); err != nil {
+				errs = append(errs, LintError{NodeID: id, Rule: RuleTemplate, Attr: attr, Message: fmt.Sprintf("attribute %q: %v", attr, err)})
+			}
+		}
+	}
+	return errs
+}
+
+// templateKeys returns the context paths a template reads, in the order
+// they appear: fields of dot outside range and with blocks ({{.user.name}}
+// reads "user.name"), fields of $ anywhere, and keys read with
+// {{index . "key"}}.
+func templateKeys(t *template.Template) []string {
+	var keys []string
+	var walk func(n parse.Node, root bool)
+	walk = func(n parse.Node, root bool) {
+		switch n := n.(type) {
+		case *parse.ListNode:
+			if n == nil {
+				return
+			}
+			for _, c := range n.Nodes {
+				walk(c, root)
+			}
+		case *parse.ActionNode:
+			walk(n.Pipe, root)
+		case *parse.IfNode:
+			walk(n.Pipe, root)
+			walk(n.List, root)
+			walk(n.ElseList, root)
+		case *parse.RangeNode:
+			// Dot is the element inside the body.
+			walk(n.Pipe, root)
+			walk(n.List, false)
+			walk(n.ElseList, root)
+		case *parse.WithNode:
+			walk(n.Pipe, root)
+			walk(n.List, false)
+			walk(n.ElseList, root)
+		case *parse.PipeNode:
+			if n == nil {
+				return
+			}
+			for _, c := range n.Cmds {
+				walk(c, root)
+			}
+		case *parse.CommandNode:
+			if len(n.Args) == 3 {
+				id, isIdent := n.Args[0].(*parse.IdentifierNode)
+				_, isDot := n.Args[1].(*parse.DotNode)
+				key, isString := n.Args[2].(*parse.StringNode)
+				if isIdent && id.Ident == "index" && isDot && isString && root {
+					keys = append(keys, key.Text)
+				}
+			}
+			for _, a := range n.Args {
+				walk(a, root)
+			}
+		case *parse.ChainNode:
+			walk(n.Node, root)
+		case *parse.FieldNode:
+			if root {
+				keys = append(keys, strings.Join(n.Ident, "."))
+			}
+		case *parse.VariableNode:
+			if len(n.Ident) > 1 && n.Ident[0] == "$" {
+				keys = append(keys, strings.Join(n.Ident[1:], "."))
+			}
+		}
+	}
+	if t.Tree != nil {
+		walk(t.Tree.Root, true)
+	}
+	return keys
+}
+
+// strictFuncs are added to templateFuncs in strict mode, for the calls
+// optionalDefaults writes.
+var strictFuncs = template.FuncMap{"_optional": tplOptional}
+
+// optionalDefaults rewrites the arguments of every call to default, and a
+// lone field piped into one, so that they read their key with _optional and
+// a missing key reaches default as nil instead of failing under
+// missingkey=error: .user.name becomes (_optional . "user" "name") and
+// $x.name becomes (_optional $x "name").
+func optionalDefaults(t *template.Template) {
+	var walk func(n parse.Node)
+	walk = func(n parse.Node) {
+		switch n := n.(type) {
+		case *parse.ListNode:
+			if n == nil {
+				return
+			}
+			for _, c := range n.Nodes {
+				walk(c)
+			}
+		case *parse.ActionNode:
+			walk(n.Pipe)
+		case *parse.IfNode:
+			walk(n.Pipe)
+			walk(n.List)
+			walk(n.ElseList)
+		case *parse.RangeNode:
+			walk(n.Pipe)
+			walk(n.List)
+			walk(n.ElseList)
+		case *parse.WithNode:
+			walk(n.Pipe)
+			walk(n.List)
+			walk(n.ElseList)
+		case *parse.TemplateNode:
+			walk(n.Pipe)
+		case *parse.PipeNode:
+			if n == nil {
+				return
+			}
+			for i, c := range n.Cmds {
+				if id, ok := c.Args[0].(*parse.IdentifierNode); ok && id.Ident == "default" {
+					for j := 1; j < len(c.Args); j++ {
+						c.Args[j] = optionalArg(c.Args[j])
+					}
+					if i > 0 && len(n.Cmds[i-1].Args) == 1 {
+						n.Cmds[i-1].Args[0] = optionalArg(n.Cmds[i-1].Args[0])
+					}
+				}
+				walk(c)
+			}
+		case *parse.CommandNode:
+			for _, a := range n.Args {
+				walk(a)
+			}
+		case *parse.ChainNode:
+			walk(n.Node)
+		}
+	}
+	if t.Tree != nil {
+		walk(t.Tree.Root)
+	}
+}
+
+// optionalArg returns the _optional call that reads the field n, or n
+// itself when it is not a field.  A field in parentheses, as in
+// (.user.name), is rewritten inside them.
+func optionalArg(n parse.Node) parse.Node {
+	var from parse.Node
+	var keys []string
+	switch a := n.(type) {
+	case *parse.PipeNode:
+		if len(a.Decl) == 0 && len(a.Cmds) == 1 && len(a.Cmds[0].Args) == 1 {
+			a.Cmds[0].Args[0] = optionalArg(a.Cmds[0].Args[0])
+		}
+		return n
+	case *parse.FieldNode:
+		from, keys = &parse.DotNode{NodeType: parse.NodeDot, Pos: a.Pos}, a.Ident
+	case *parse.VariableNode:
+		if len(a.Ident) < 2 {
+			return n
+		}
+		from = &parse.VariableNode{NodeType: parse.NodeVariable, Pos: a.Pos, Ident: a.Ident[:1]}
+		keys = a.Ident[1:]
+	default:
+		return n
+	}
+	args := []parse.Node{parse.NewIdentifier("_optional").SetPos(n.Position()), from}
+	for _, k := range keys {
+		args = append(args, &parse.StringNode{NodeType: parse.NodeString, Pos: n.Position(), Quoted: strconv.Quote(k), Text: k})
+	}
+	cmd := &parse.CommandNode{NodeType: parse.NodeCommand, Pos: n.Position(), Args: args}
+	return &parse.PipeNode{NodeType: parse.NodePipe, Pos: n.Position(), Cmds: []*parse.CommandNode{cmd}}
+}
+
+// tplOptional follows keys from v through objects, giving nil as soon as
+// one is missing or v is not an object.
+func tplOptional(v any, keys ...string) any {
+	for _, k := range keys {
+		switch m := v.(type) {
+		case map[string]any:
+			v = m[k]
+		case jsonObject:
+			v = m[k]
+		default:
+			return nil
+		}
+	}
+	return v
+}
+
+// withTemplateOptions applies the pipeline's strict_templates attribute to
+// ctx.  A pipeline that does not set it inherits the setting of the run
+// that included it.
+func (e *Engine) withTemplateOptions(ctx context.Context) context.Context {
+	if strict, err := strconv.ParseBool(e.pipeline.Attrs["strict_templates"]); err == nil {
+		return WithStrictTemplates(ctx, strict)
+	}
+	return ctx
+}
+
+// jsonObject and jsonList are the forms objects and lists take in template
+// data, so that printing one gives its JSON.
+type (
+	jsonObject map[string]any
+	jsonList   []any
+)
+
+func (m jsonObject) String() string { return FormatValue(map[string]any(m)) }
+func (l jsonList) String() string   { return FormatValue([]any(l)) }
+
+func templateValue(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		m := make(jsonObject, len(v))
+		for k, e := range v {
+			m[k] = templateValue(e)
+		}
+		return m
+	case []any:
+		l := make(jsonList, len(v))
+		for i, e := range v {
+			l[i] = templateValue(e)
+		}
+		return l
+	}
+	return v
+}
+
+// plainValue undoes templateValue.
+func plainValue(v any) any {
+	switch v := v.(type) {
+	case jsonObject:
+		m := make(map[string]any, len(v))
+		for k, e := range v {
+			m[k] = plainValue(e)
+		}
+		return m
+	case jsonList:
+		l := make([]any, len(v))
+		for i, e := range v {
+			l[i] = plainValue(e)
+		}
+		return l
+	}
+	return v
+}
+
+// ─── template functions ──────────────────────────────────────────────────────
+
+// tplDefault returns v, or def if v is missing, "" or an empty list or
+// object: {{.name | default "anonymous"}}.
+func tplDefault(def, v any) any {
+	switch x := v.(type) {
+	case nil:
+		return def
+	case string:
+		if x == "" {
+			return def
+		}
+	case jsonList:
+		if len(x) == 0 {
+			return def
+		}
+	case jsonObject:
+		if len(x) == 0 {
+			return def
+		}
+	}
+	return v
+}
+
+func tplToJSON(v any) (string, error) {
+	b, err := json.Marshal(plainValue(v))
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+func tplFromJSON(s any) (any, error) {
+	v, err := DecodeValue([]byte(FormatValue(s)))
+	if err != nil {
+		return nil, fmt.Errorf("fromJson: %w", err)
+	}
+	return templateValue(v), nil
+}
+
+// tplNow returns the current UTC time in RFC 3339 form, or formatted with
+// the Go time layout given: {{now "2006-01-02"}}.
+func tplNow(layout ...string) (string, error) {
+	switch len(layout) {
+	case 0:
+		return time.Now().UTC().Format(time.RFC3339), nil
+	case 1:
+		return time.Now().UTC().Format(layout[0]), nil
+	}
+	return "", errors.New("now: takes at most one layout")
+}
+
+// tplJoin joins the elements of a list: {{.items | join ", "}}.
+func tplJoin(sep string, list any) (string, error) {
+	var elems []string
+	switch l := list.(type) {
+	case jsonList:
+		for _, e := range l {
+			elems = append(elems, FormatValue(e))
+		}
+	case []string:
+		elems = l
+	case nil:
+	default:
+		return "", fmt.Errorf("join: %s is not a list", valueType(plainValue(list)))
+	}
+	return strings.Join(elems, sep), nil
+}
+
+// tplSplit splits a string into a list: {{range split "," .csv}}.
+func tplSplit(sep string, s any) jsonList {
+	parts := strings.Split(FormatValue(s), sep)
+	out := make(jsonList, len(parts))
+	for i, p := range parts {
+		out[i] = p
+	}
+	return out
+}
+
+// tplIndent prefixes every line of s with n spaces.
+func tplIndent(n int, s any) string {
+	pad := strings.Repeat(" ", n)
+	lines := strings.Split(FormatValue(s), "\n")
+	for i, line := range lines {
+		if line != "" {
+			lines[i] = pad + line
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+func tplB64Dec(s any) (string, error) {
+	b, err := base64.StdEncoding.DecodeString(FormatValue(s))
+	if err != nil {
+		return "", fmt.Errorf("b64dec: %w", err)
+	}
+	return string(b), nil
+}
+
+func tplSHA256(s any) string {
+	sum := sha256.Sum256([]byte(FormatValue(s)))
+	return hex.EncodeToString(sum[:])
+}
+
+// arith applies a binary arithmetic operation.  Operands are numbers or
+// strings holding numbers; the result is an int64 when both are whole
+// numbers and a float64 otherwise.
+func arith(op string, a, b any) (any, error) {
+	x, err := toNumber(a)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	y, err := toNumber(b)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	xi, xInt := x.(int64)
+	yi, yInt := y.(int64)
+	if xInt && yInt {
+		switch op {
+		case "add":
+			return xi + yi, nil
+		case "sub":
+			return xi - yi, nil
+		case "mul":
+			return xi * yi, nil
+		case "div", "mod":
+			if yi == 0 {
+				return nil, fmt.Errorf("%s: division by zero", op)
+			}
+			if op == "div" {
+				return xi / yi, nil
+			}
+			return xi % yi, nil
+		}
+	}
+	xf, yf := toFloat(x), toFloat(y)
+	switch op {
+	case "add":
+		return xf + yf, nil
+	case "sub":
+		return xf - yf, nil
+	case "mul":
+		return xf * yf, nil
+	case "div":
+		if yf == 0 {
+			return nil, fmt.Errorf("%s: division by zero", op)
+		}
+		return xf / yf, nil
+	case "mod":
+		if yf == 0 {
+			return nil, fmt.Errorf("%s: division by zero", op)
+		}
+		return math.Mod(xf, yf), nil
+	}
+	return nil, fmt.Errorf("unknown operation %q", op)
+}
+
+// toNumber returns v as an int64 or float64.
+func toNumber(v any) (any, error) {
+	switch n := v.(type) {
+	case int64, float64:
+		return n, nil
+	case int:
+		return int64(n), nil
+	case string:
+		s := strings.TrimSpace(n)
+		if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+			return i, nil
+		}
+		if f, err := strconv.ParseFloat(s, 64); err == nil {
+			return f, nil
+		}
+		return nil, fmt.Errorf("%q is not a number", n)
+	}
+	return nil, fmt.Errorf("%s is not a number", valueType(plainValue(v)))
+}
+
+func toFloat(n any) float64 {
+	if i, ok := n.(int64); ok {
+		return float64(i)
+	}
+	return n.(float64)
+}
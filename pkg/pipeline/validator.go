@@ -2,13 +2,63 @@ package pipeline
 
 import (
 	"fmt"
+	"sort"
 	"strings"
 )
 
-// LintError describes a structural problem in a pipeline.
+// LintError describes a problem in a pipeline.
 type LintError struct {
 	NodeID  string
 	Message string
+	// Rule names the check that found the problem; see the Rule constants.
+	Rule string
+	// Severity is SeverityError when empty.
+	Severity Severity
+	// Edge is the edge the problem is on, if any.  Attr is the attribute
+	// it is in, if any: of Edge, of NodeID, or else of the graph.
+	Edge *Edge
+	Attr string
+	// Span is where the problem is in the source; zero if unknown.
+	Span Span
+}
+
+// Severity is how serious a LintError is.
+type Severity string
+
+const (
+	SeverityError   Severity = "error"
+	SeverityWarning Severity = "warning"
+)
+
+// Rules reported by Validate, ValidateHandlers and CheckDataflow.
+const (
+	RuleParse         = "parse"
+	RuleStartNode     = "start-node"
+	RuleExitNode      = "exit-node"
+	RuleUnknownNode   = "unknown-node"
+	RuleEdgeTrigger   = "edge-trigger"
+	RuleCycle         = "cycle"
+	RuleUnreachable   = "unreachable"
+	RuleFanOut        = "fan-out"
+	RuleFanIn         = "fan-in"
+	RuleParam         = "param"
+	RuleCondition     = "condition"
+	RuleTemplate      = "template"
+	RuleRequiredAttr  = "required-attr"
+	RuleAttrValue     = "attr-value"
+	RuleUnknownAttr   = "unknown-attr"
+	RuleUnknownType   = "unknown-type"
+	RuleUndefinedKey  = "undefined-key"
+	RuleUnreadKey     = "unread-key"
+	RuleUndeclaredVar = "undeclared-var"
+)
+
+// Level returns e.Severity, or SeverityError if it is empty.
+func (e LintError) Level() Severity {
+	if e.Severity == "" {
+		return SeverityError
+	}
+	return e.Severity
 }
 
 func (e LintError) Error() string {
@@ -18,31 +68,6 @@ func (e LintError) Error() string {
 	return e.Message
 }
 
-// nodeRequiredAttrs maps each node type to the list of attribute names that
-// must be present (non-empty) in the DOT file.  The linter reports all
-// missing attributes across all nodes before aborting.
-var nodeRequiredAttrs = map[NodeType][]string{
-	NodeTypeSet:         {"key"},
-	NodeTypeHTTP:        {"url"},
-	NodeTypeAssert:      {"expr"},
-	NodeTypeSleep:       {"duration"},
-	NodeTypeSwitch:      {"key"},
-	NodeTypeEnv:         {"key", "from"},
-	NodeTypeReadFile:    {"key", "path"},
-	NodeTypeWriteFile:   {"path", "content"},
-	NodeTypeJSONExtract: {"source", "path", "key"},
-	NodeTypeSplit:       {"source", "key"},
-	NodeTypeMap:         {"items", "item_key", "prompt"},
-	NodeTypePrompt:      {"prompt", "key"},
-	NodeTypeJSONDecode:  {"source"},
-	NodeTypeExec:            {"cmd"},
-	NodeTypeJSONPack:        {"keys", "output"},
-	NodeTypeRegex:           {"source", "pattern", "key"},
-	NodeTypeStringTransform: {"source", "ops", "key"},
-	NodeTypeForEach:         {"items", "item_key", "cmd"},
-	NodeTypeInclude:         {"path"},
-}
-
 // Validate checks a pipeline for structural correctness.
 // Returns all discovered errors (not just the first).
 func Validate(p *Pipeline) []LintError {
@@ -57,11 +82,11 @@ func Validate(p *Pipeline) []LintError {
 	}
 	switch len(startNodes) {
 	case 0:
-		errs = append(errs, LintError{Message: "pipeline must have exactly one start node"})
+		errs = append(errs, LintError{Rule: RuleStartNode, Message: "pipeline must have exactly one start node"})
 	case 1:
 		// good
 	default:
-		errs = append(errs, LintError{Message: fmt.Sprintf("pipeline has %d start nodes; exactly one required", len(startNodes))})
+		errs = append(errs, LintError{Rule: RuleStartNode, Message: fmt.Sprintf("pipeline has %d start nodes; exactly one required", len(startNodes))})
 	}
 
 	// Exactly one exit node
@@ -73,21 +98,56 @@ func Validate(p *Pipeline) []LintError {
 	}
 	switch len(exitNodes) {
 	case 0:
-		errs = append(errs, LintError{Message: "pipeline must have exactly one exit node"})
+		errs = append(errs, LintError{Rule: RuleExitNode, Message: "pipeline must have exactly one exit node"})
 	case 1:
 		// good
 	default:
-		errs = append(errs, LintError{Message: fmt.Sprintf("pipeline has %d exit nodes; exactly one required", len(exitNodes))})
+		errs = append(errs, LintError{Rule: RuleExitNode, Message: fmt.Sprintf("pipeline has %d exit nodes; exactly one required", len(exitNodes))})
 	}
 
 	// All edge endpoints must reference existing nodes
 	for _, e := range p.Edges {
 		if _, ok := p.Nodes[e.From]; !ok {
-			errs = append(errs, LintError{Message: fmt.Sprintf("edge references unknown source node %q", e.From)})
+			errs = append(errs, LintError{Rule: RuleUnknownNode, Edge: e, Message: fmt.Sprintf("edge references unknown source node %q", e.From)})
 		}
 		if _, ok := p.Nodes[e.To]; !ok {
-			errs = append(errs, LintError{Message: fmt.Sprintf("edge references unknown target node %q", e.To)})
+			errs = append(errs, LintError{Rule: RuleUnknownNode, Edge: e, Message: fmt.Sprintf("edge references unknown target node %q", e.To)})
+		}
+	}
+
+	// Edge triggers must be one of the recognised values.
+	for _, e := range p.Edges {
+		if e.On != "" && e.On != EdgeOnFailure && e.On != EdgeOnExhausted {
+			errs = append(errs, LintError{
+				NodeID:  e.From,
+				Rule:    RuleEdgeTrigger,
+				Edge:    e,
+				Attr:    "on",
+				Message: fmt.Sprintf("edge to %q has unknown on=%q (want %q or %q)", e.To, e.On, EdgeOnFailure, EdgeOnExhausted),
+			})
+		}
+	}
+
+	// max_visits must be a non-negative integer; on nodes it is checked
+	// with the other attributes.
+	if s, ok := p.Attrs["max_visits"]; ok {
+		if _, valid := parseMaxVisits(s); !valid {
+			errs = append(errs, LintError{Rule: RuleAttrValue, Attr: "max_visits", Message: fmt.Sprintf("graph attribute max_visits=%q must be a non-negative integer", s)})
+		}
+	}
+
+	// A cycle is intentional when at least one edge (conditional, on=failure
+	// or on=exhausted) leads out of it.  A cycle with no way out can only end
+	// by aborting at max_visits.
+	for _, scc := range stronglyConnected(p) {
+		if !isCycle(p, scc) || hasExit(p, scc) {
+			continue
 		}
+		errs = append(errs, LintError{
+			NodeID:  scc[0],
+			Rule:    RuleCycle,
+			Message: fmt.Sprintf("cycle through %s has no edge leading out of it", strings.Join(scc, ", ")),
+		})
 	}
 
 	// All non-start nodes must be reachable from start
@@ -98,44 +158,83 @@ func Validate(p *Pipeline) []LintError {
 				continue
 			}
 			if !reachable[id] {
-				errs = append(errs, LintError{NodeID: id, Message: "node is not reachable from start"})
+				errs = append(errs, LintError{NodeID: id, Rule: RuleUnreachable, Message: "node is not reachable from start"})
 			}
 		}
 	}
 
-	// Every fan_out node must have a reachable fan_in node downstream.
+	// Every fan_out node must have a matching fan_in node downstream.
 	for id, n := range p.Nodes {
 		if n.Type != NodeTypeFanOut {
 			continue
 		}
-		if !hasFanInReachable(p, id) {
-			errs = append(errs, LintError{NodeID: id, Message: "fan_out node has no reachable fan_in node"})
+		if _, err := matchFanIn(p, id); err != nil {
+			errs = append(errs, LintError{NodeID: id, Rule: RuleFanOut, Message: err.Error()})
 		}
 	}
 
-	// Required attribute checks for known node types.
+	// fan_in join modes, merge policies and reducers must be recognised.
 	for id, n := range p.Nodes {
-		required, ok := nodeRequiredAttrs[n.Type]
-		if !ok {
+		if n.Type != NodeTypeFanIn {
 			continue
 		}
-		for _, attr := range required {
-			if n.Attrs[attr] == "" {
-				errs = append(errs, LintError{
-					NodeID:  id,
-					Message: fmt.Sprintf("missing required attribute %q for node type %q", attr, n.Type),
-				})
-			}
+		for _, msg := range validateMergeAttrs(n) {
+			errs = append(errs, LintError{NodeID: id, Rule: RuleFanIn, Message: msg})
 		}
 	}
 
-	return errs
+	// Declared params must have a known type and valid defaults.
+	errs = append(errs, validateParams(p)...)
+
+	// Conditions on edges and assert nodes must parse.
+	errs = append(errs, validateConditions(p)...)
+
+	// Templated attributes must parse.
+	errs = append(errs, validateTemplates(p)...)
+
+	// Node attributes must match the schema of their type.
+	ids := make([]string, 0, len(p.Nodes))
+	for id := range p.Nodes {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		errs = append(errs, ValidateNode(p.Nodes[id])...)
+	}
+
+	return locateErrors(p, errs)
 }
 
-// hasFanInReachable returns true if a fan_in node is reachable from startID via BFS.
-func hasFanInReachable(p *Pipeline, startID string) bool {
+// matchFanIn returns the fan_in node that joins the branches of the fan_out
+// node fanOutID.  An explicit join attribute names it directly.  Otherwise
+// the branches are searched breadth-first for fan_in nodes, skipping over
+// each nested fan_out section (from the nested fan_out to its own fan_in);
+// exactly one fan_in must be found.
+func matchFanIn(p *Pipeline, fanOutID string) (string, error) {
+	return matchFanInFrom(p, fanOutID, map[string]bool{})
+}
+
+func matchFanInFrom(p *Pipeline, fanOutID string, resolving map[string]bool) (string, error) {
+	if id := p.Nodes[fanOutID].Attrs["join"]; id != "" {
+		n, ok := p.Nodes[id]
+		if !ok {
+			return "", fmt.Errorf("join=%q references unknown node", id)
+		}
+		if n.Type != NodeTypeFanIn {
+			return "", fmt.Errorf("join=%q is not a fan_in node (type %q)", id, n.Type)
+		}
+		return id, nil
+	}
+
+	resolving[fanOutID] = true
+	defer delete(resolving, fanOutID)
+
+	var found []string
 	visited := map[string]bool{}
-	queue := []string{startID}
+	var queue []string
+	for _, e := range p.OutgoingEdges(fanOutID) {
+		queue = append(queue, e.To)
+	}
 	for len(queue) > 0 {
 		id := queue[0]
 		queue = queue[1:]
@@ -143,41 +242,81 @@ func hasFanInReachable(p *Pipeline, startID string) bool {
 			continue
 		}
 		visited[id] = true
-		for _, e := range p.OutgoingEdges(id) {
-			if n, ok := p.Nodes[e.To]; ok && n.Type == NodeTypeFanIn {
-				return true
+		n, ok := p.Nodes[id]
+		if !ok {
+			continue
+		}
+		switch n.Type {
+		case NodeTypeFanIn:
+			found = append(found, id)
+			continue
+		case NodeTypeFanOut:
+			if resolving[id] {
+				continue
 			}
-			if !visited[e.To] {
-				queue = append(queue, e.To)
+			inner, err := matchFanInFrom(p, id, resolving)
+			if err != nil {
+				return "", fmt.Errorf("nested fan_out %q: %w", id, err)
 			}
+			visited[inner] = true
+			id = inner
+		}
+		for _, e := range p.OutgoingEdges(id) {
+			queue = append(queue, e.To)
 		}
 	}
-	return false
-}
 
-// ValidateNode checks a single node's required attributes and returns any
-// lint errors.  This is a convenience helper used in tests and by Validate.
-func ValidateNode(n *Node) []LintError {
-	var errs []LintError
-	required, ok := nodeRequiredAttrs[n.Type]
-	if !ok {
-		return nil
+	switch len(found) {
+	case 0:
+		return "", fmt.Errorf("fan_out node has no reachable fan_in node")
+	case 1:
+		return found[0], nil
+	default:
+		return "", fmt.Errorf("branches reach several fan_in nodes (%s); set join to choose one", strings.Join(found, ", "))
 	}
-	for _, attr := range required {
-		if n.Attrs[attr] == "" {
-			errs = append(errs, LintError{
-				NodeID:  n.ID,
-				Message: fmt.Sprintf("missing required attribute %q for node type %q", attr, n.Type),
-			})
+}
+
+// matchFanIns returns the matching fan_in of every fan_out node in p that
+// has one; see matchFanIn.
+func matchFanIns(p *Pipeline) map[string]string {
+	out := map[string]string{}
+	for id, n := range p.Nodes {
+		if n.Type != NodeTypeFanOut {
+			continue
+		}
+		if join, err := matchFanIn(p, id); err == nil {
+			out[id] = join
 		}
 	}
+	return out
+}
+
+// Lint runs every check on p: Validate, ValidateHandlers against reg unless
+// it is nil and, if those find no errors, CheckDataflow with vars.  The
+// result is sorted by position in the source.
+func Lint(p *Pipeline, reg HandlerRegistry, vars map[string]any) []LintError {
+	errs := Validate(p)
+	if reg != nil {
+		errs = append(errs, ValidateHandlers(p, reg)...)
+	}
+	if len(errs) == 0 {
+		errs = CheckDataflow(p, vars)
+	}
+	sort.SliceStable(errs, func(i, j int) bool {
+		a, b := errs[i].Span.Start, errs[j].Span.Start
+		return a.Before(b)
+	})
 	return errs
 }
 
 // ValidateErr calls Validate and returns nil if there are no errors, or a
 // combined error message listing all lint errors.
 func ValidateErr(p *Pipeline) error {
-	errs := Validate(p)
+	return lintErr(Validate(p))
+}
+
+// lintErr folds errs into one error, or returns nil if errs is empty.
+func lintErr(errs []LintError) error {
 	if len(errs) == 0 {
 		return nil
 	}
@@ -188,6 +327,111 @@ func ValidateErr(p *Pipeline) error {
 	return fmt.Errorf("pipeline validation failed:\n  %s", strings.Join(msgs, "\n  "))
 }
 
+// stronglyConnected returns the strongly connected components of p, each
+// sorted by node ID, using Tarjan's algorithm.  Components are returned in
+// a deterministic order.
+func stronglyConnected(p *Pipeline) [][]string {
+	ids := make([]string, 0, len(p.Nodes))
+	for id := range p.Nodes {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	var (
+		index   = map[string]int{}
+		lowlink = map[string]int{}
+		onStack = map[string]bool{}
+		stack   []string
+		comps   [][]string
+		next    int
+	)
+	var visit func(id string)
+	visit = func(id string) {
+		index[id] = next
+		lowlink[id] = next
+		next++
+		stack = append(stack, id)
+		onStack[id] = true
+		for _, e := range p.OutgoingEdges(id) {
+			if _, ok := p.Nodes[e.To]; !ok {
+				continue
+			}
+			if _, seen := index[e.To]; !seen {
+				visit(e.To)
+				lowlink[id] = min(lowlink[id], lowlink[e.To])
+			} else if onStack[e.To] {
+				lowlink[id] = min(lowlink[id], index[e.To])
+			}
+		}
+		if lowlink[id] != index[id] {
+			return
+		}
+		var comp []string
+		for {
+			top := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			onStack[top] = false
+			comp = append(comp, top)
+			if top == id {
+				break
+			}
+		}
+		sort.Strings(comp)
+		comps = append(comps, comp)
+	}
+	for _, id := range ids {
+		if _, seen := index[id]; !seen {
+			visit(id)
+		}
+	}
+	sort.Slice(comps, func(i, j int) bool { return comps[i][0] < comps[j][0] })
+	return comps
+}
+
+// isCycle reports whether the strongly connected component scc contains a
+// cycle: more than one node, or a single node with an edge to itself.
+func isCycle(p *Pipeline, scc []string) bool {
+	if len(scc) > 1 {
+		return true
+	}
+	for _, e := range p.OutgoingEdges(scc[0]) {
+		if e.To == scc[0] {
+			return true
+		}
+	}
+	return false
+}
+
+// hasExit reports whether any edge leaves the component scc.
+func hasExit(p *Pipeline, scc []string) bool {
+	in := make(map[string]bool, len(scc))
+	for _, id := range scc {
+		in[id] = true
+	}
+	for _, id := range scc {
+		for _, e := range p.OutgoingEdges(id) {
+			if !in[e.To] {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// cyclicNodes returns the set of nodes that lie on at least one cycle and
+// can therefore run more than once.
+func cyclicNodes(p *Pipeline) map[string]bool {
+	out := map[string]bool{}
+	for _, scc := range stronglyConnected(p) {
+		if isCycle(p, scc) {
+			for _, id := range scc {
+				out[id] = true
+			}
+		}
+	}
+	return out
+}
+
 // reachableFrom returns the set of node IDs reachable from start via directed edges.
 func reachableFrom(p *Pipeline, start string) map[string]bool {
 	visited := map[string]bool{}
@@ -0,0 +1,213 @@
+package pipeline
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// FormatValue returns the string form of a context value: strings as they
+// are, nil as "", and anything else as compact JSON, so a list reads back as
+// the JSON array it came from.
+func FormatValue(v any) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case nil:
+		return ""
+	case fmt.Stringer:
+		return v.String()
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(b)
+}
+
+// DecodeValue parses JSON text into a context value.  Whole numbers become
+// int64 and other numbers float64, so integers beyond 2^53 keep every digit.
+func DecodeValue(data []byte) (any, error) {
+	var v any
+	if err := decodeJSON(data, &v); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// MarshalCheckpoint encodes a Checkpoint or JournalEntry (or a pointer to
+// one) as JSON for UnmarshalCheckpoint to decode.  Floats with no fractional
+// part are written as 2.0 rather than 2, so they are not read back as
+// integers.
+func MarshalCheckpoint(v any) ([]byte, error) {
+	switch c := v.(type) {
+	case *Checkpoint:
+		return MarshalCheckpoint(*c)
+	case *JournalEntry:
+		return MarshalCheckpoint(*c)
+	case Checkpoint:
+		keepFloats(&c)
+		return json.Marshal(c)
+	case JournalEntry:
+		keepFloats(&c.Checkpoint)
+		return json.Marshal(c)
+	case fileSnapshot:
+		keepFloats(&c.Checkpoint)
+		return json.MarshalIndent(c, "", "  ")
+	}
+	return nil, fmt.Errorf("cannot marshal %T as a checkpoint", v)
+}
+
+// UnmarshalCheckpoint decodes a JSON-encoded Checkpoint or JournalEntry into
+// v, restoring the types of the context values the way DecodeValue does.
+// Checkpoint stores use it so that a resumed run sees the values it saved.
+func UnmarshalCheckpoint(data []byte, v any) error {
+	var cp *Checkpoint
+	switch v := v.(type) {
+	case *Checkpoint:
+		cp = v
+	case *JournalEntry:
+		cp = &v.Checkpoint
+	case *fileSnapshot:
+		cp = &v.Checkpoint
+	default:
+		return fmt.Errorf("cannot unmarshal a checkpoint into %T", v)
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(v); err != nil {
+		return err
+	}
+	restoreMap(cp.Data)
+	if cp.Outcome != nil {
+		restoreMap(cp.Outcome.Outputs)
+	}
+	if cp.FanOut != nil {
+		for _, b := range cp.FanOut.Branches {
+			restoreMap(b.Data)
+		}
+	}
+	return nil
+}
+
+// decodeJSON unmarshals the single JSON value in data into v, which holds
+// any; see DecodeValue.
+func decodeJSON(data []byte, v *any) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(v); err != nil {
+		return err
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return fmt.Errorf("invalid character after top-level value")
+	}
+	*v = restoreValue(*v)
+	return nil
+}
+
+// restoreValue replaces the json.Numbers in v, decoded with UseNumber, by
+// int64 or float64.
+func restoreValue(v any) any {
+	switch v := v.(type) {
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i
+		}
+		if f, err := v.Float64(); err == nil {
+			return f
+		}
+		return v.String()
+	case map[string]any:
+		restoreMap(v)
+	case []any:
+		for i := range v {
+			v[i] = restoreValue(v[i])
+		}
+	}
+	return v
+}
+
+func restoreMap(m map[string]any) {
+	for k, v := range m {
+		m[k] = restoreValue(v)
+	}
+}
+
+// keepFloats replaces the maps of context values in cp, a copy owned by the
+// caller, with ones that encode whole-number floats as floats.  Maps with
+// none are left as they are.
+func keepFloats(cp *Checkpoint) {
+	if m := floatMap(cp.Data); m != nil {
+		cp.Data = m
+	}
+	if cp.Outcome != nil {
+		if m := floatMap(cp.Outcome.Outputs); m != nil {
+			out := *cp.Outcome
+			out.Outputs = m
+			cp.Outcome = &out
+		}
+	}
+	if cp.FanOut != nil {
+		fo := *cp.FanOut
+		fo.Branches = slices.Clone(fo.Branches)
+		for i, b := range fo.Branches {
+			if m := floatMap(b.Data); m != nil {
+				bs := *b
+				bs.Data = m
+				fo.Branches[i] = &bs
+			}
+		}
+		cp.FanOut = &fo
+	}
+}
+
+// floatValue returns v with its whole-number floats replaced by
+// json.Numbers that keep a decimal point, copying only what changes, and
+// whether anything did.
+func floatValue(v any) (any, bool) {
+	switch v := v.(type) {
+	case float64:
+		if v == math.Trunc(v) && !math.IsInf(v, 0) {
+			s := strconv.FormatFloat(v, 'g', -1, 64)
+			if !strings.ContainsAny(s, ".e") {
+				s += ".0"
+			}
+			return json.Number(s), true
+		}
+	case map[string]any:
+		out := floatMap(v)
+		return out, out != nil
+	case []any:
+		var out []any
+		for i, e := range v {
+			if f, changed := floatValue(e); changed {
+				if out == nil {
+					out = slices.Clone(v)
+				}
+				out[i] = f
+			}
+		}
+		return out, out != nil
+	}
+	return v, false
+}
+
+// floatMap is floatValue for a map; it returns nil if nothing changed.
+func floatMap(m map[string]any) map[string]any {
+	var out map[string]any
+	for k, v := range m {
+		if f, changed := floatValue(v); changed {
+			if out == nil {
+				out = maps.Clone(m)
+			}
+			out[k] = f
+		}
+	}
+	return out
+}
@@ -0,0 +1,487 @@
+package pipeline
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ─── YAML and JSON ────────────────────────────────────────────────────────────
+
+// ParseYAML parses a pipeline written in YAML into the Pipeline that
+// ParseDOT builds from the same pipeline written in DOT:
+//
+//	name: demo
+//	attrs:                  # graph attributes
+//	  goal: Greet someone
+//	stylesheet: |           # the model_stylesheet graph attribute
+//	  type[codergen] { model: "anthropic:claude-sonnet-4-5" }
+//	params:                 # the params subgraph, in order
+//	  name: {default: world}
+//	nodes:                  # node ID → attributes
+//	  start: {type: start}
+//	  greet:
+//	    prompt: |
+//	      Say "hello" to {{.name}}.
+//	  exit: {type: exit}
+//	edges:                  # in order
+//	  - {from: start, to: greet}
+//	  - {from: greet, to: exit, condition: outcome == 'success'}
+//	  - {from: greet, to: exit, on: failure}
+//
+// An attribute value is the text of its scalar, as in DOT, so 3 and "3"
+// are both the string 3; a list or mapping value is read as its JSON text,
+// as for a list default.  Every edge endpoint must be a node.  JSON
+// is read as YAML, so ParseYAML also parses the same pipeline written in
+// JSON.  A syntax error is a *ParseError.
+func ParseYAML(src string) (*Pipeline, error) {
+	return parseYAML(src, SyntaxYAML)
+}
+
+// yamlKeys are the keys of a pipeline mapping, in the order they are read
+// and written.
+var yamlKeys = []string{"name", "attrs", "stylesheet", "params", "nodes", "edges"}
+
+type yamlParser struct {
+	syn Syntax
+	p   *Pipeline
+}
+
+func parseYAML(src string, syn Syntax) (*Pipeline, error) {
+	y := &yamlParser{syn: syn, p: &Pipeline{
+		Nodes:       make(map[string]*Node),
+		Attrs:       make(map[string]string),
+		Fingerprint: Fingerprint(src),
+	}}
+	var doc yaml.Node
+	if err := yaml.Unmarshal([]byte(src), &doc); err != nil {
+		return nil, y.syntaxError(err)
+	}
+	if len(doc.Content) == 0 {
+		return nil, &ParseError{Syntax: syn, Msg: "empty pipeline"}
+	}
+	root := resolve(doc.Content[0])
+	if root.Kind != yaml.MappingNode {
+		return nil, y.errorf(root, "a pipeline is a mapping of %s", strings.Join(yamlKeys, ", "))
+	}
+	y.p.Span = Span{Start: yamlPos(root), End: yamlPos(root)}
+
+	sections := map[string][2]*yaml.Node{}
+	err := y.mapping(root, func(key, val *yaml.Node) error {
+		if !slices.Contains(yamlKeys, key.Value) {
+			return y.errorf(key, "unknown key %q, expected one of %s", key.Value, strings.Join(yamlKeys, ", "))
+		}
+		sections[key.Value] = [2]*yaml.Node{key, val}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range yamlKeys {
+		s, ok := sections[name]
+		if !ok {
+			continue
+		}
+		if err := y.section(name, s[0], s[1]); err != nil {
+			return nil, err
+		}
+	}
+	if raw, ok := y.p.Attrs["model_stylesheet"]; ok {
+		y.p.Stylesheet = parseStylesheet(raw)
+	}
+	for _, n := range y.p.Nodes {
+		sort.Slice(n.Refs, func(i, j int) bool { return n.Refs[i].Start.Before(n.Refs[j].Start) })
+	}
+	return y.p, nil
+}
+
+func (y *yamlParser) section(name string, key, val *yaml.Node) error {
+	p := y.p
+	switch name {
+	case "name":
+		if val.Kind != yaml.ScalarNode {
+			return y.errorf(val, "name must be a string")
+		}
+		p.Name = val.Value
+		p.Span = yamlSpan(key, val)
+
+	case "attrs":
+		attrs, spans, err := y.attrs(val)
+		if err != nil {
+			return err
+		}
+		p.Attrs, p.AttrSpans = attrs, spans
+
+	case "stylesheet":
+		if val.Kind != yaml.ScalarNode {
+			return y.errorf(val, "stylesheet must be a string")
+		}
+		if _, ok := p.Attrs["model_stylesheet"]; ok {
+			return y.errorf(key, "the stylesheet is also set by attrs.model_stylesheet")
+		}
+		p.Attrs["model_stylesheet"] = val.Value
+		setSpan(&p.AttrSpans, "model_stylesheet", yamlSpan(key, val))
+
+	case "params":
+		return y.mapping(val, func(k, v *yaml.Node) error {
+			attrs, _, err := y.attrs(v)
+			if err != nil {
+				return err
+			}
+			if p.Param(k.Value) != nil {
+				return y.errorf(k, "param %q is declared twice", k.Value)
+			}
+			prm := newParam(k.Value, attrs)
+			prm.Span = yamlSpan(k, nil)
+			p.Params = append(p.Params, prm)
+			return nil
+		})
+
+	case "nodes":
+		return y.mapping(val, func(k, v *yaml.Node) error {
+			attrs, spans, err := y.attrs(v)
+			if err != nil {
+				return err
+			}
+			if _, ok := p.Nodes[k.Value]; ok {
+				return y.errorf(k, "node %q is declared twice", k.Value)
+			}
+			n := &Node{ID: k.Value, Type: NodeType(attrs["type"]), Attrs: attrs, Span: yamlSpan(k, nil), AttrSpans: spans}
+			if n.Type == "" {
+				n.Type = NodeTypeCodergen // default for untyped nodes
+			}
+			n.Refs = append(n.Refs, n.Span)
+			p.Nodes[n.ID] = n
+			return nil
+		})
+
+	case "edges":
+		if val.Kind != yaml.SequenceNode {
+			return y.errorf(val, "edges must be a list")
+		}
+		for _, item := range val.Content {
+			e, err := y.edge(resolve(item))
+			if err != nil {
+				return err
+			}
+			p.Edges = append(p.Edges, e)
+		}
+	}
+	return nil
+}
+
+func (y *yamlParser) edge(item *yaml.Node) (*Edge, error) {
+	e := &Edge{}
+	var from, to *yaml.Node
+	err := y.mapping(item, func(k, v *yaml.Node) error {
+		if v.Kind != yaml.ScalarNode {
+			return y.errorf(v, "edge %s must be a string", k.Value)
+		}
+		switch k.Value {
+		case "from":
+			from, e.From = v, v.Value
+		case "to":
+			to, e.To = v, v.Value
+		case "condition":
+			// DOT writes the condition as the label attribute.
+			e.Condition = v.Value
+			setSpan(&e.AttrSpans, "label", yamlSpan(k, v))
+		case "on":
+			e.On = v.Value
+			setSpan(&e.AttrSpans, "on", yamlSpan(k, v))
+		default:
+			return y.errorf(k, "unknown edge key %q, expected from, to, condition or on", k.Value)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if from == nil || to == nil {
+		return nil, y.errorf(item, "an edge needs from and to")
+	}
+	for _, end := range []*yaml.Node{from, to} {
+		n, ok := y.p.Nodes[end.Value]
+		if !ok {
+			return nil, y.errorf(end, "edge endpoint %q is not a node", end.Value)
+		}
+		n.Refs = append(n.Refs, yamlSpan(end, nil))
+	}
+	e.Span = Span{Start: yamlPos(from), End: scalarEnd(to)}
+	return e, nil
+}
+
+// attrs reads a mapping of attributes, which may be empty or null.
+func (y *yamlParser) attrs(n *yaml.Node) (map[string]string, map[string]Span, error) {
+	attrs := map[string]string{}
+	spans := map[string]Span{}
+	if n.Kind == yaml.ScalarNode && n.Tag == "!!null" {
+		return attrs, spans, nil
+	}
+	err := y.mapping(n, func(k, v *yaml.Node) error {
+		if _, ok := attrs[k.Value]; ok {
+			return y.errorf(k, "attribute %q is set twice", k.Value)
+		}
+		value, err := y.value(v)
+		if err != nil {
+			return err
+		}
+		attrs[k.Value] = value
+		spans[k.Value] = yamlSpan(k, v)
+		return nil
+	})
+	return attrs, spans, err
+}
+
+// value returns the text of an attribute value: a scalar as written, and a
+// list or mapping as JSON.
+func (y *yamlParser) value(n *yaml.Node) (string, error) {
+	if n.Kind == yaml.ScalarNode {
+		return n.Value, nil
+	}
+	var v any
+	if err := n.Decode(&v); err != nil {
+		return "", y.errorf(n, "%v", err)
+	}
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return "", y.errorf(n, "value cannot be written as JSON: %v", err)
+	}
+	return strings.TrimSuffix(buf.String(), "\n"), nil
+}
+
+// mapping calls f with each key and value of a mapping, in order.
+func (y *yamlParser) mapping(n *yaml.Node, f func(key, val *yaml.Node) error) error {
+	if n.Kind != yaml.MappingNode {
+		return y.errorf(n, "expected a mapping")
+	}
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		key, val := resolve(n.Content[i]), resolve(n.Content[i+1])
+		if key.Kind != yaml.ScalarNode {
+			return y.errorf(key, "keys must be strings")
+		}
+		if err := f(key, val); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (y *yamlParser) errorf(n *yaml.Node, format string, args ...any) *ParseError {
+	return &ParseError{Syntax: y.syn, Pos: yamlPos(n), Msg: fmt.Sprintf(format, args...)}
+}
+
+// yaml.v3 reports positions only in the text of its errors, which read like:
+// yaml: line 3: mapping values are not allowed in this context
+var yamlErrorText = regexp.MustCompile(`^yaml: line (\d+): (.*)$`)
+
+func (y *yamlParser) syntaxError(err error) *ParseError {
+	pe := &ParseError{Syntax: y.syn, Msg: strings.TrimPrefix(err.Error(), "yaml: "), Err: err}
+	if m := yamlErrorText.FindStringSubmatch(err.Error()); m != nil {
+		pe.Pos.Line, _ = strconv.Atoi(m[1])
+		pe.Pos.Col = 1
+		pe.Msg = m[2]
+	}
+	return pe
+}
+
+// resolve follows an alias to the node it names.
+func resolve(n *yaml.Node) *yaml.Node {
+	for n.Kind == yaml.AliasNode && n.Alias != nil {
+		n = n.Alias
+	}
+	return n
+}
+
+func yamlPos(n *yaml.Node) Pos { return Pos{Line: n.Line, Col: n.Column} }
+
+// scalarEnd returns where the text of a scalar on one line ends.  Escapes in
+// a quoted scalar make it the end of a shorter text.
+func scalarEnd(n *yaml.Node) Pos {
+	end := Pos{Line: n.Line, Col: n.Column + utf8.RuneCountInString(n.Value)}
+	if n.Style&(yaml.DoubleQuotedStyle|yaml.SingleQuotedStyle) != 0 {
+		end.Col += 2
+	}
+	return end
+}
+
+// yamlSpan runs from key to the end of val when val is a scalar on the
+// same line, and covers just key otherwise.
+func yamlSpan(key, val *yaml.Node) Span {
+	span := Span{Start: yamlPos(key), End: scalarEnd(key)}
+	if val != nil && val.Kind == yaml.ScalarNode && val.Line == key.Line &&
+		val.Style&(yaml.LiteralStyle|yaml.FoldedStyle) == 0 && !strings.Contains(val.Value, "\n") {
+		span.End = scalarEnd(val)
+	}
+	return span
+}
+
+// ─── Writing YAML and JSON ────────────────────────────────────────────────────
+
+// yamlTree builds the document ParseYAML reads p from.  Attribute lists
+// and edges that fit on a line are flow mappings, and values that span
+// lines are literal blocks.
+func yamlTree(p *Pipeline) *yaml.Node {
+	root := &yaml.Node{Kind: yaml.MappingNode}
+	add := func(m *yaml.Node, key string, val *yaml.Node) {
+		m.Content = append(m.Content, yamlScalar(key), val)
+	}
+	attrs := func(attrs map[string]string, skip string) *yaml.Node {
+		m := &yaml.Node{Kind: yaml.MappingNode}
+		for _, name := range attrOrder(attrs) {
+			if name != skip {
+				add(m, name, yamlScalar(attrs[name]))
+			}
+		}
+		if len(m.Content) == 0 {
+			m.Style = yaml.FlowStyle
+		}
+		return m
+	}
+
+	if p.Name != "" {
+		add(root, "name", yamlScalar(p.Name))
+	}
+	if graph := attrs(p.Attrs, "model_stylesheet"); len(graph.Content) > 0 {
+		add(root, "attrs", graph)
+	}
+	if ss, ok := p.Attrs["model_stylesheet"]; ok {
+		add(root, "stylesheet", yamlScalar(ss))
+	}
+	if len(p.Params) > 0 {
+		params := &yaml.Node{Kind: yaml.MappingNode}
+		for _, prm := range p.Params {
+			add(params, prm.Name, flowIfShort(attrs(prm.Attrs, "")))
+		}
+		add(root, "params", params)
+	}
+	if len(p.Nodes) > 0 {
+		nodes := &yaml.Node{Kind: yaml.MappingNode}
+		for _, id := range nodeOrder(p) {
+			add(nodes, id, flowIfShort(attrs(p.Nodes[id].Attrs, "")))
+		}
+		add(root, "nodes", nodes)
+	}
+	if len(p.Edges) > 0 {
+		edges := &yaml.Node{Kind: yaml.SequenceNode}
+		for _, e := range p.Edges {
+			m := &yaml.Node{Kind: yaml.MappingNode}
+			add(m, "from", yamlScalar(e.From))
+			add(m, "to", yamlScalar(e.To))
+			if e.Condition != "" {
+				add(m, "condition", yamlScalar(e.Condition))
+			}
+			if e.On != "" {
+				add(m, "on", yamlScalar(e.On))
+			}
+			edges.Content = append(edges.Content, flowIfShort(m))
+		}
+		add(root, "edges", edges)
+	}
+	return root
+}
+
+// yamlFlowWidth is the longest flow mapping yamlTree writes on one line.
+const yamlFlowWidth = 80
+
+// flowIfShort makes m a flow mapping if its entries fit on one line.
+func flowIfShort(m *yaml.Node) *yaml.Node {
+	width := 2
+	for _, n := range m.Content {
+		if n.Style == yaml.LiteralStyle {
+			return m
+		}
+		width += utf8.RuneCountInString(n.Value) + 2
+	}
+	if width <= yamlFlowWidth {
+		m.Style = yaml.FlowStyle
+	}
+	return m
+}
+
+func yamlScalar(s string) *yaml.Node {
+	n := &yaml.Node{Kind: yaml.ScalarNode, Value: s}
+	if strings.Contains(s, "\n") {
+		n.Style = yaml.LiteralStyle
+	}
+	return n
+}
+
+func encodeYAML(p *Pipeline) (string, error) {
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(yamlTree(p)); err != nil {
+		return "", fmt.Errorf("encode yaml: %w", err)
+	}
+	if err := enc.Close(); err != nil {
+		return "", fmt.Errorf("encode yaml: %w", err)
+	}
+	return buf.String(), nil
+}
+
+// encodeJSON writes the document of yamlTree as JSON, every value a
+// string, with flow mappings on one line.
+func encodeJSON(p *Pipeline) (string, error) {
+	var sb strings.Builder
+	if err := writeJSON(&sb, yamlTree(p), ""); err != nil {
+		return "", fmt.Errorf("encode json: %w", err)
+	}
+	sb.WriteString("\n")
+	return sb.String(), nil
+}
+
+func writeJSON(sb *strings.Builder, n *yaml.Node, indent string) error {
+	if n.Kind == yaml.ScalarNode {
+		var buf bytes.Buffer
+		enc := json.NewEncoder(&buf)
+		enc.SetEscapeHTML(false)
+		if err := enc.Encode(n.Value); err != nil {
+			return err
+		}
+		sb.WriteString(strings.TrimSuffix(buf.String(), "\n"))
+		return nil
+	}
+	open, close, step := "[", "]", 1
+	if n.Kind == yaml.MappingNode {
+		open, close, step = "{", "}", 2
+	}
+	sb.WriteString(open)
+	if len(n.Content) == 0 {
+		sb.WriteString(close)
+		return nil
+	}
+	inner, sep, end := indent+"  ", ",\n", "\n"+indent
+	if n.Style == yaml.FlowStyle {
+		inner, sep, end = "", ", ", ""
+	} else {
+		sb.WriteString("\n")
+	}
+	for i := 0; i < len(n.Content); i += step {
+		if i > 0 {
+			sb.WriteString(sep)
+		}
+		sb.WriteString(inner)
+		if step == 2 {
+			if err := writeJSON(sb, n.Content[i], inner); err != nil {
+				return err
+			}
+			sb.WriteString(": ")
+		}
+		if err := writeJSON(sb, n.Content[i+step-1], inner); err != nil {
+			return err
+		}
+	}
+	sb.WriteString(end + close)
+	return nil
+}